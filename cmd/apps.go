@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewAppsCmd creates a new apps command for Nix Foundry.
+func NewAppsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apps",
+		Short: "Manage GUI application symlinks",
+		Long:  `Commands for managing the /Applications symlinks created for Nix GUI applications.`,
+	}
+
+	cmd.AddCommand(newAppsGCCmd())
+
+	return cmd
+}
+
+/*
+newAppsGCCmd creates the command that removes orphaned /Applications symlinks.
+*/
+func newAppsGCCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "gc",
+		Short: "Remove orphaned application symlinks",
+		Long: `Remove orphaned application symlinks.
+This command scans /Applications for symlinks into the Nix store whose target no
+longer exists or is no longer provided by an installed package, and removes them.
+Symlinks that do not point into the Nix store are left untouched.`,
+		RunE: runAppsGC,
+	}
+}
+
+func runAppsGC(_ *cobra.Command, _ []string) error {
+	configSvc := config.GetConfigService()
+
+	removed, err := configSvc.CleanOrphanedAppSymlinks()
+	for _, name := range removed {
+		fmt.Printf("🗑️  Removed symlink for %s\n", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clean application symlinks: %w", err)
+	}
+
+	if len(removed) == 0 {
+		fmt.Println("No orphaned application symlinks found")
+	} else {
+		fmt.Printf("✨ Removed %d orphaned application symlink(s)\n", len(removed))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(NewAppsCmd())
+}
@@ -21,7 +21,12 @@ func init() {
 		config.InitCmd,
 		config.ListCmd,
 		config.ShowCmd,
+		config.GetCmd,
 		config.SetCmd,
 		config.ResetCmd,
+		config.ExportCmd,
+		config.ImportCmd,
+		config.ValidateCmd,
+		config.NewScriptCmd(),
 	)
 }
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	forceImport    bool
+	exportFormat   string
+	importFormat   string
+	importDotfiles string
+	importYes      bool
+
+	// dotfileAnswers reads the answers to confirmDotfile; it is shared so that
+	// buffered input is not lost between prompts.
+	dotfileAnswers = bufio.NewReader(os.Stdin)
+)
+
+/*
+ExportCmd represents the export command for packaging the user and team
+configurations into a portable bundle.
+*/
+var ExportCmd = &cobra.Command{
+	Use:   "export <path>",
+	Short: "Export configurations to a bundle",
+	Long: `Export configurations to a bundle.
+This command packages your user configuration and all team configurations into a
+single tar.gz file that can be imported on another machine.
+
+With bundle.includeDotfiles set in the user configuration, the shell
+configuration file and the files listed in bundle.dotfiles are included as well.
+
+When the path ends in .yaml, .yml, .json or .toml, or --format is given, only the
+user configuration is exported, as a single file in that format.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+/*
+ImportCmd represents the import command for restoring configurations from a
+bundle created by the export command.
+*/
+var ImportCmd = &cobra.Command{
+	Use:   "import <path>",
+	Short: "Import configurations from a bundle",
+	Long: `Import configurations from a bundle.
+This command restores the configurations in a bundle created by 'config export'.
+Bundles whose files do not match the checksums recorded at export are rejected.
+Home directory paths are rewritten for this machine. An existing user
+configuration is only overwritten when --force is given.
+
+Dotfiles in the bundle are restored with --dotfiles=merge, which only updates
+the nix-foundry managed block of files that already exist, or
+--dotfiles=overwrite, which replaces them. Each change is shown as a diff and
+confirmed unless --yes is given. Replaced files are backed up to
+<file>.nix-foundry.bak.
+
+A single configuration file in YAML, JSON or TOML, detected by its extension or
+given with --format, is validated and saved as YAML in the location for its type.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+/*
+singleFileFormat returns the format to use for a single configuration file at
+path. ok is false when path should be treated as a bundle, i.e. when no format
+was given and the extension is not a known configuration format.
+*/
+func singleFileFormat(path, formatFlag string) (format schema.Format, ok bool, err error) {
+	if formatFlag != "" {
+		format, err = schema.ParseFormat(formatFlag)
+		return format, err == nil, err
+	}
+	if format, pathErr := schema.FormatFromPath(path); pathErr == nil {
+		return format, true, nil
+	}
+	return "", false, nil
+}
+
+func runExport(_ *cobra.Command, args []string) error {
+	configSvc := config.GetConfigService()
+
+	format, single, formatErr := singleFileFormat(args[0], exportFormat)
+	if formatErr != nil {
+		return formatErr
+	}
+
+	if single {
+		if err := configSvc.ExportConfig(args[0], format); err != nil {
+			return fmt.Errorf("failed to export configuration: %w", err)
+		}
+	} else if err := configSvc.ExportBundle(args[0]); err != nil {
+		return fmt.Errorf("failed to export configuration: %w", err)
+	}
+
+	fmt.Printf("✨ Configuration exported to %s\n", args[0])
+	return nil
+}
+
+func runImport(_ *cobra.Command, args []string) error {
+	configSvc := config.GetConfigService()
+
+	format, single, formatErr := singleFileFormat(args[0], importFormat)
+	if formatErr != nil {
+		return formatErr
+	}
+
+	if single {
+		if err := configSvc.ImportConfig(args[0], format, forceImport); err != nil {
+			return fmt.Errorf("failed to import configuration: %w", err)
+		}
+	} else {
+		mode, modeErr := config.ParseDotfileMode(importDotfiles)
+		if modeErr != nil {
+			return modeErr
+		}
+		opts := config.BundleImportOptions{Force: forceImport, Dotfiles: mode}
+		if !importYes {
+			if mode != config.DotfilesSkip && !platform.IsInteractive() {
+				return fmt.Errorf("restoring dotfiles asks before writing each one, which needs an interactive terminal; pass --yes to restore them without asking")
+			}
+			opts.ConfirmDotfile = confirmDotfile
+		}
+		if err := configSvc.ImportBundleWithOptions(args[0], opts); err != nil {
+			return fmt.Errorf("failed to import configuration: %w", err)
+		}
+	}
+
+	fmt.Println("✨ Configuration imported successfully!")
+	fmt.Println("Run 'nix-foundry config apply' to apply it.")
+	return nil
+}
+
+/*
+confirmDotfile shows the changes restoring a dotfile would make and asks the
+user to confirm. Anything but an explicit yes, including end of input, declines.
+*/
+func confirmDotfile(change config.DotfileChange) bool {
+	if change.Exists {
+		fmt.Printf("\n📄 %s:\n", change.Path)
+	} else {
+		fmt.Printf("\n📄 %s (new file):\n", change.Path)
+	}
+	for _, line := range change.Diff() {
+		fmt.Printf("  %s\n", line)
+	}
+
+	fmt.Printf("\nWrite %s? [y/N]: ", change.Path)
+	answer, _ := dotfileAnswers.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func init() {
+	ImportCmd.Flags().BoolVarP(&forceImport, "force", "f", false, "Overwrite an existing configuration")
+	ImportCmd.Flags().StringVar(&importDotfiles, "dotfiles", string(config.DotfilesSkip), "Restore dotfiles from a bundle: skip, overwrite or merge")
+	ImportCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Restore dotfiles without confirmation")
+	ImportCmd.Flags().StringVar(&importFormat, "format", "", "Import a single config file in this format (yaml, json or toml)")
+	ExportCmd.Flags().StringVar(&exportFormat, "format", "", "Export the user config as a single file in this format (yaml, json or toml)")
+}
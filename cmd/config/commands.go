@@ -7,9 +7,14 @@ configuration details. The package supports different configuration types
 package config
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/output"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 	"github.com/spf13/cobra"
 	"golang.org/x/text/cases"
@@ -17,10 +22,18 @@ import (
 )
 
 var (
-	configType   string
-	configName   string
-	showType     string
-	forceScripts bool
+	configType    string
+	configName    string
+	showType      string
+	forceScripts  bool
+	checkPackages bool
+	applyDiff     bool
+	allowSystem   bool
+	allowScripts  bool
+	assumeYes     bool
+	assumeNo      bool
+	applyProfile  string
+	updateLock    bool
 )
 
 /*
@@ -33,7 +46,16 @@ var ApplyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply the current configuration",
 	Long: `Apply the current configuration.
-This command will load and apply the active configuration, including any inherited configurations.`,
+This command will load and apply the active configuration, including any inherited configurations.
+Use --diff to preview the package, shell, and script changes without applying them.
+Use --profile to apply a profile from the configuration on top of the base packages;
+later applies keep using it until another profile is selected, or --profile ""
+selects none.
+Packages are installed from the nixpkgs revision recorded in nix-foundry.lock,
+which is written on the first apply. Use --update-lock to move to the current
+nixpkgs revision and see which package versions changed.
+Scripts are listed and confirmed before they run. Without a terminal, as in CI,
+pass --yes to run them or --no to skip them.`,
 	RunE: runApply,
 }
 
@@ -123,27 +145,173 @@ It retrieves and applies the active configuration, which includes:
 1. Shell environment configuration
 2. Package installation
 3. Script execution (with change detection unless forced)
+Scripts only run after confirmation unless --yes is given.
 Returns an error if any part of the application process fails.
 */
-func runApply(_ *cobra.Command, _ []string) error {
+func runApply(cmd *cobra.Command, _ []string) error {
 	configSvc := config.GetConfigService()
 
-	if err := configSvc.ApplyConfigWithOptions(forceScripts); err != nil {
+	opts := config.ApplyOptions{
+		ForceScripts:        forceScripts,
+		AllowScripts:        allowScripts,
+		AllowSystemPackages: allowSystem,
+		SelectProfile:       cmd.Flags().Changed("profile"),
+		Profile:             applyProfile,
+		UpdateLock:          updateLock,
+	}
+	if assumeYes && assumeNo {
+		return fmt.Errorf("--yes and --no cannot be used together")
+	}
+	switch {
+	case assumeNo:
+		opts.ConfirmScripts = func([]schema.Script) bool { return false }
+	case !assumeYes:
+		opts.ConfirmScripts = confirmScripts
+	}
+
+	if checkPackages {
+		activeConfig, configErr := configSvc.ConfigForApply(opts)
+		if configErr != nil {
+			return fmt.Errorf("failed to get active config: %w", configErr)
+		}
+		if reportErr := reportPackageChecks(configSvc.CheckPackages(activeConfig, false), false); reportErr != nil {
+			return fmt.Errorf("package check failed: %w", reportErr)
+		}
+	}
+
+	if applyDiff {
+		plan, planErr := configSvc.PlanApplyWithOptions(opts)
+		if planErr != nil {
+			return fmt.Errorf("failed to plan configuration: %w", planErr)
+		}
+		printApplyPlan(plan)
+		return nil
+	}
+
+	if !assumeYes && !assumeNo && !platform.IsInteractive() {
+		if confirmErr := requireScriptAnswer(configSvc, opts); confirmErr != nil {
+			return confirmErr
+		}
+	}
+
+	if err := configSvc.ApplyConfigWithOptions(opts); err != nil {
 		return fmt.Errorf("failed to apply configuration: %w", err)
 	}
 
 	fmt.Println("✨ Configuration applied successfully!")
+	if profile := configSvc.ActiveProfile(); profile != "" {
+		fmt.Printf("Active profile: %s\n", profile)
+	}
 	return nil
 }
 
+/*
+confirmScripts lists the scripts about to run with their commands and asks the
+user to confirm. Anything but an explicit yes, including end of input, declines.
+*/
+func confirmScripts(scripts []schema.Script) bool {
+	fmt.Println("📜 The following scripts will run:")
+	for _, script := range scripts {
+		fmt.Printf("\n  %s (from %s config):\n", script.Name, scriptScope(script))
+		for _, line := range strings.Split(strings.TrimRight(string(script.Commands), "\n"), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+
+	fmt.Print("\nRun these scripts? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+/*
+requireScriptAnswer returns an error naming --yes and --no when applying would
+ask to confirm scripts and nobody can answer, so that apply fails before
+changing anything instead of waiting for an answer.
+*/
+func requireScriptAnswer(configSvc *config.Service, opts config.ApplyOptions) error {
+	activeConfig, configErr := configSvc.ConfigForApply(opts)
+	if configErr != nil {
+		return fmt.Errorf("failed to get active config: %w", configErr)
+	}
+	plans, planErr := configSvc.PlanScripts(activeConfig, opts.ForceScripts, opts.AllowScripts)
+	if planErr != nil {
+		return fmt.Errorf("failed to plan scripts: %w", planErr)
+	}
+
+	pending := 0
+	for _, plan := range plans {
+		if plan.Run {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d script(s) need confirmation to run, which needs an interactive terminal; pass --yes to run them or --no to skip them", pending)
+	}
+	return nil
+}
+
+/*
+scriptScope returns the type of config a script comes from.
+*/
+func scriptScope(script schema.Script) schema.ConfigType {
+	if script.Scope == "" {
+		return schema.UserConfig
+	}
+	return script.Scope
+}
+
+/*
+printApplyPlan prints the changes an apply would make, grouped by packages,
+shell configuration, and scripts.
+*/
+func printApplyPlan(plan *config.ApplyPlan) {
+	fmt.Println("📦 Packages:")
+	if len(plan.ToInstall) == 0 && len(plan.ToRemove) == 0 {
+		fmt.Println("  No package changes needed")
+	}
+	for _, pkg := range plan.ToInstall {
+		fmt.Printf("  + %s\n", pkg)
+	}
+	for _, pkg := range plan.ToRemove {
+		fmt.Printf("  - %s\n", pkg)
+	}
+	for _, conflict := range plan.Conflicts {
+		fmt.Printf("  ⚠️  Conflict: %s\n", conflict)
+	}
+
+	if plan.ShellFile != "" {
+		fmt.Println("🐚 Shell:")
+		if plan.ShellChanged {
+			fmt.Printf("  ~ %s will be updated\n", plan.ShellFile)
+		} else {
+			fmt.Printf("  %s is up to date\n", plan.ShellFile)
+		}
+	}
+
+	if len(plan.Scripts) > 0 {
+		fmt.Println("📜 Scripts:")
+		for _, script := range plan.Scripts {
+			if script.Run {
+				fmt.Printf("  ▶️  %s\n", script.Script.Name)
+			} else {
+				fmt.Printf("  ⏭️  %s (skipped: %s)\n", script.Script.Name, script.Reason)
+			}
+		}
+	}
+
+	fmt.Println("\nNo changes were made. Run 'nix-foundry config apply' to apply them.")
+}
+
 /*
 runList displays all available configurations in the system.
 It shows each configuration's:
 - Name and type
 - Inheritance relationships (if any)
+With --output json or yaml, the configurations are written in full instead.
 Returns an error if the configuration listing process fails.
 */
-func runList(_ *cobra.Command, _ []string) error {
+func runList(cmd *cobra.Command, _ []string) error {
 	configSvc := config.GetConfigService()
 
 	configs, err := configSvc.ListConfigs()
@@ -151,6 +319,10 @@ func runList(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to list configurations: %w", err)
 	}
 
+	if format := output.FromCommand(cmd); format != output.Table {
+		return output.Write(os.Stdout, format, configs)
+	}
+
 	if len(configs) == 0 {
 		fmt.Println("No configurations found")
 		return nil
@@ -181,7 +353,7 @@ func runShow(_ *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to get active config: %w", err)
 		}
 
-		return showConfig(config)
+		return showConfig(config, configSvc.ActiveProfile())
 	}
 
 	name := args[0]
@@ -190,7 +362,7 @@ func runShow(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get config: %w", err)
 	}
 
-	return showConfig(config)
+	return showConfig(config, "")
 }
 
 /*
@@ -215,9 +387,10 @@ It shows:
 2. Settings (shell, logging, updates)
 3. Nix configuration (package manager, packages)
 4. Scripts (if any)
+5. Profiles (if any), marking activeProfile
 Returns an error if the display process fails.
 */
-func showConfig(config *schema.Config) error {
+func showConfig(config *schema.Config, activeProfile string) error {
 	fmt.Printf("Configuration: %s (%s)\n", config.Metadata.Name, config.Type)
 	if config.Base != "" {
 		fmt.Printf("Base: %s\n", config.Base)
@@ -256,6 +429,17 @@ func showConfig(config *schema.Config) error {
 		}
 	}
 
+	if len(config.Profiles) > 0 {
+		fmt.Println("\nProfiles:")
+		for _, name := range config.ProfileNames() {
+			marker := ""
+			if name == activeProfile {
+				marker = " (active)"
+			}
+			fmt.Printf("  • %s%s: %s\n", name, marker, strings.Join(config.Profiles[name].Packages, ", "))
+		}
+	}
+
 	return nil
 }
 
@@ -264,7 +448,7 @@ init initializes the configuration commands by setting up flags and options.
 It configures:
 - Init command flags for type and name
 - Show command flags for type specification
-- Apply command flags for force-scripts option
+- Apply command flags for force-scripts and check-packages options
 This function is automatically called during package initialization.
 */
 func init() {
@@ -272,4 +456,13 @@ func init() {
 	InitCmd.Flags().StringVarP(&configName, "name", "n", "", "Configuration name (required for team and project configs)")
 	ShowCmd.Flags().StringVarP(&showType, "type", "t", "", "Configuration type (user|team|project)")
 	ApplyCmd.Flags().BoolVar(&forceScripts, "force-scripts", false, "Force all scripts to run regardless of changes")
+	ApplyCmd.Flags().BoolVar(&checkPackages, "check-packages", false, "Check that all packages exist in nixpkgs before applying")
+	ApplyCmd.Flags().BoolVar(&applyDiff, "diff", false, "Show the changes apply would make without applying them")
+	ApplyCmd.Flags().BoolVar(&applyDiff, "dry-run", false, "Alias for --diff")
+	ApplyCmd.Flags().BoolVar(&allowSystem, "allow-system-packages", false, "Install missing system packages (runs apt, dnf, or flatpak with sudo)")
+	ApplyCmd.Flags().BoolVar(&allowScripts, "allow-scripts", false, "Run scripts from team and project configs")
+	ApplyCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Run scripts without asking for confirmation")
+	ApplyCmd.Flags().BoolVar(&assumeNo, "no", false, "Skip scripts that would ask for confirmation")
+	ApplyCmd.Flags().StringVar(&applyProfile, "profile", "", "Apply this profile and keep using it on later applies (\"\" for none)")
+	ApplyCmd.Flags().BoolVar(&updateLock, "update-lock", false, "Resolve nixpkgs to its current revision and update the lock file")
 }
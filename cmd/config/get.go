@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+GetCmd prints a single value of the active configuration, addressed by the dotted
+path of its YAML keys.
+*/
+var GetCmd = &cobra.Command{
+	Use:   "get <path>",
+	Short: "Print a configuration value",
+	Long: `Print a configuration value.
+The value is looked up in the active configuration by the dotted path of its keys,
+for example:
+
+  nix-foundry config get settings.shell
+  nix-foundry config get nix.packages.core
+  nix-foundry config get env.EDITOR`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		value, getErr := config.GetConfigService().GetValue(args[0])
+		if getErr != nil {
+			return getErr
+		}
+		return printValue(value)
+	},
+}
+
+/*
+printValue prints scalars as they are and lists and sections as YAML.
+*/
+func printValue(value interface{}) error {
+	if _, isDuration := value.(time.Duration); isDuration {
+		fmt.Println(value)
+		return nil
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		content, marshalErr := yaml.Marshal(value)
+		if marshalErr != nil {
+			return fmt.Errorf("failed to format value: %w", marshalErr)
+		}
+		fmt.Print(string(content))
+	default:
+		fmt.Println(value)
+	}
+	return nil
+}
@@ -4,11 +4,13 @@ package config
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/output"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/script"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -23,8 +25,9 @@ var (
 // NewScriptCmd creates a new script command.
 func NewScriptCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "script",
-		Short: "Manage shell scripts in the configuration",
+		Use:     "script",
+		Aliases: []string{"scripts"},
+		Short:   "Manage shell scripts in the configuration",
 		Long: `Manage shell scripts in the configuration.
 This command provides subcommands for managing shell scripts.`,
 	}
@@ -63,8 +66,9 @@ func newScriptListCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
 		Short: "List scripts",
-		Long:  `List all scripts in the configuration.`,
-		RunE:  runScriptList,
+		Long: `List all scripts in the active configuration in the order they run, and
+whether each one runs on this machine on the next apply.`,
+		RunE: runScriptList,
 	}
 }
 
@@ -160,7 +164,7 @@ func runScriptSet(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to marshal config: %w", encodeErr)
 	}
 
-	if writeErr := os.WriteFile(configPath, []byte(buf.String()), 0644); writeErr != nil {
+	if writeErr := filesystem.NewOSFileSystem().AtomicWriteFile(configPath, []byte(buf.String()), 0644); writeErr != nil {
 		return fmt.Errorf("failed to write config: %w", writeErr)
 	}
 
@@ -168,33 +172,38 @@ func runScriptSet(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
-func runScriptList(_ *cobra.Command, _ []string) error {
-	configPath, err := schema.GetConfigPath()
+func runScriptList(cmd *cobra.Command, _ []string) error {
+	configSvc := config.GetConfigService()
+
+	activeConfig, err := configSvc.GetActiveConfig()
 	if err != nil {
-		return fmt.Errorf("failed to get config path: %w", err)
+		return fmt.Errorf("failed to get active config: %w", err)
 	}
 
-	content, err := os.ReadFile(configPath)
+	plans, err := configSvc.PlanScripts(activeConfig, false, false)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return fmt.Errorf("invalid scripts: %w", err)
 	}
 
-	var config schema.Config
-	if unmarshalErr := yaml.Unmarshal(content, &config); unmarshalErr != nil {
-		return fmt.Errorf("failed to parse config file: %w", unmarshalErr)
+	if format := output.FromCommand(cmd); format != output.Table {
+		return output.Write(os.Stdout, format, plans)
 	}
 
-	if len(config.Nix.Scripts) == 0 {
+	if len(plans) == 0 {
 		fmt.Println("No scripts found")
 		return nil
 	}
 
-	fmt.Println("Available scripts:")
-	for _, script := range config.Nix.Scripts {
-		if script.Description != "" {
-			fmt.Printf("  %s - %s\n", script.Name, script.Description)
+	fmt.Println("Scripts, in the order they run on the next apply:")
+	for _, plan := range plans {
+		line := plan.Script.Name
+		if plan.Script.Description != "" {
+			line += " - " + plan.Script.Description
+		}
+		if plan.Run {
+			fmt.Printf("  ▶️  %s\n", line)
 		} else {
-			fmt.Printf("  %s\n", script.Name)
+			fmt.Printf("  ⏭️  %s (skipped: %s)\n", line, plan.Reason)
 		}
 	}
 
@@ -219,34 +228,9 @@ func runScriptRun(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse config file: %w", unmarshalErr)
 	}
 
-	var script *schema.Script
-	for _, s := range config.Nix.Scripts {
-		if s.Name == scriptName {
-			script = &s
-			break
-		}
-	}
-
-	if script == nil {
-		return fmt.Errorf("script '%s' not found", scriptName)
-	}
-
-	tmpDir, err := os.MkdirTemp("", "nix-foundry-script-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer func() { _ = os.RemoveAll(tmpDir) }()
-
-	scriptPath := filepath.Join(tmpDir, "script.sh")
-	if writeErr := os.WriteFile(scriptPath, []byte(script.Commands), 0755); writeErr != nil {
-		return fmt.Errorf("failed to write script file: %w", writeErr)
-	}
-
-	execCmd := exec.Command(config.Settings.Shell, scriptPath)
-	execCmd.Stdout = os.Stdout
-	execCmd.Stderr = os.Stderr
-	if runErr := execCmd.Run(); runErr != nil {
-		return fmt.Errorf("failed to run script: %w", runErr)
+	manager := script.NewManager(filesystem.NewOSFileSystem())
+	if runErr := manager.RunScript(scriptName, &config); runErr != nil {
+		return runErr
 	}
 
 	return nil
@@ -0,0 +1,35 @@
+package set
+
+import (
+	"fmt"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+/*
+pinCmd pins a package to a specific flake reference in the user configuration.
+*/
+var pinCmd = &cobra.Command{
+	Use:   "pin <name> <flake-ref>",
+	Short: "Pin a package to a flake reference",
+	Long: `Pin a package to a flake reference.
+The package will be installed from the given flake reference instead of the
+default nixpkgs, for example:
+
+  nix-foundry config set package pin ripgrep github:NixOS/nixpkgs/4a8b7c1d`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := config.GetConfigService().PinPackage(args[0], args[1]); err != nil {
+			return fmt.Errorf("failed to pin package: %w", err)
+		}
+
+		fmt.Printf("✨ Pinned %s to %s\n", args[0], args[1])
+		fmt.Println("Run 'nix-foundry config apply' to install it from the pinned source")
+		return nil
+	},
+}
+
+func init() {
+	packageCmd.AddCommand(pinCmd)
+}
@@ -1,13 +1,64 @@
 package set
 
 import (
+	"fmt"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
 	"github.com/spf13/cobra"
 )
 
+var (
+	appendValue bool
+	removeValue bool
+)
+
 // Cmd represents the set command
 var Cmd = &cobra.Command{
-	Use:   "set",
+	Use:   "set <path> <value>",
 	Short: "Set configuration values",
 	Long: `Set configuration values.
-This command provides subcommands for setting various configuration values.`,
+This command sets a value in the user configuration, addressed by the dotted path
+of its keys. Lists are given as comma-separated values, or changed one item at a
+time with --append and --remove, for example:
+
+  nix-foundry config set settings.shell zsh
+  nix-foundry config set settings.commandTimeout 30m
+  nix-foundry config set nix.packages.core --append nodejs
+  nix-foundry config set env.EDITOR nvim
+
+The change is only saved if the resulting configuration is valid. The subcommands
+below manage packages and scripts.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSet,
+}
+
+func runSet(_ *cobra.Command, args []string) error {
+	if appendValue && removeValue {
+		return fmt.Errorf("--append and --remove cannot be used together")
+	}
+
+	path, value := args[0], args[1]
+	configSvc := config.GetConfigService()
+
+	var setErr error
+	switch {
+	case appendValue:
+		setErr = configSvc.AppendValue(path, value)
+	case removeValue:
+		setErr = configSvc.RemoveValue(path, value)
+	default:
+		setErr = configSvc.SetValue(path, value)
+	}
+	if setErr != nil {
+		return fmt.Errorf("failed to set %s: %w", path, setErr)
+	}
+
+	fmt.Printf("✨ Updated %s\n", path)
+	fmt.Println("Run 'nix-foundry config apply' to apply it.")
+	return nil
+}
+
+func init() {
+	Cmd.Flags().BoolVar(&appendValue, "append", false, "Add the value to the list at the path")
+	Cmd.Flags().BoolVar(&removeValue, "remove", false, "Remove the value from the list at the path")
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+var offlineValidate bool
+
+/*
+ValidateCmd represents the validate command for checking the active configuration
+without applying it. Besides the schema checks, every configured package is looked
+up in nixpkgs so that typos surface before apply.
+*/
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the current configuration",
+	Long: `Validate the current configuration.
+This command checks the active configuration against the schema and verifies that
+every core and optional package exists in nixpkgs. Unknown packages are reported
+with suggestions, and a warning is shown when the packages have drifted from the
+lock file. Use --offline to skip the nixpkgs lookup.`,
+	RunE: runValidate,
+}
+
+func runValidate(cmd *cobra.Command, _ []string) error {
+	configSvc := config.GetConfigService()
+
+	activeConfig, configErr := configSvc.GetActiveConfig()
+	if configErr != nil {
+		return fmt.Errorf("failed to get active config: %w", configErr)
+	}
+
+	if validateErr := schema.ValidateConfig(activeConfig); validateErr != nil {
+		return fmt.Errorf("invalid configuration: %w", validateErr)
+	}
+
+	drift, driftErr := configSvc.CheckLockDrift(activeConfig)
+	if driftErr != nil {
+		fmt.Printf("⚠️  %v\n", driftErr)
+	}
+	if len(drift.Unlocked) > 0 {
+		fmt.Printf("⚠️  Not in the lock file yet: %s\n", strings.Join(drift.Unlocked, ", "))
+	}
+	if len(drift.Stale) > 0 {
+		fmt.Printf("⚠️  In the lock file but no longer configured: %s\n", strings.Join(drift.Stale, ", "))
+	}
+	if !drift.IsEmpty() {
+		fmt.Println("   Run 'nix-foundry config apply' to update the lock file")
+	}
+
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	if reportErr := reportPackageChecks(configSvc.CheckPackages(activeConfig, offlineValidate), verbose); reportErr != nil {
+		return reportErr
+	}
+
+	fmt.Println("✨ Configuration is valid")
+	return nil
+}
+
+/*
+reportPackageChecks prints the outcome of a package availability check and returns
+an error if any package is missing from nixpkgs. Packages that could not be
+verified only produce a note, listed individually in verbose mode.
+*/
+func reportPackageChecks(checks []packages.PackageCheck, verbose bool) error {
+	var notFound []packages.PackageCheck
+	var unverified []packages.PackageCheck
+	for _, check := range checks {
+		switch check.Status {
+		case packages.PackageNotFound:
+			notFound = append(notFound, check)
+		case packages.PackageUnverified:
+			unverified = append(unverified, check)
+		}
+	}
+
+	if verbose {
+		for _, check := range checks {
+			switch check.Status {
+			case packages.PackageFound:
+				fmt.Printf("  ✓ %s\n", check.Name)
+			case packages.PackageNotFound:
+				fmt.Printf("  ✗ %s: not found in nixpkgs\n", check.Name)
+			case packages.PackageUnverified:
+				fmt.Printf("  ? %s: couldn't verify (%s)\n", check.Name, check.Reason)
+			}
+		}
+	}
+
+	if len(unverified) > 0 && !verbose {
+		fmt.Printf("Note: %d package(s) could not be verified (%s)\n", len(unverified), unverified[0].Reason)
+	}
+
+	if len(notFound) == 0 {
+		return nil
+	}
+
+	for _, check := range notFound {
+		fmt.Printf("❌ Package '%s' was not found in nixpkgs", check.Name)
+		if len(check.Suggestions) > 0 {
+			fmt.Printf("; did you mean %s?", strings.Join(check.Suggestions, ", "))
+		}
+		fmt.Println()
+	}
+
+	return fmt.Errorf("%d unknown package(s) in configuration", len(notFound))
+}
+
+func init() {
+	ValidateCmd.Flags().BoolVar(&offlineValidate, "offline", false, "Skip checking packages against nixpkgs")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/doctor"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of your Nix Foundry setup",
+	Long: `Check the health of your Nix Foundry setup.
+This command checks that Nix is supported on this platform and installed, that
+the active configuration is valid, and that ~/.local/bin is on PATH, then prints
+a report with hints for anything that failed. It exits with an error if a
+critical check fails.`,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(_ *cobra.Command, _ []string) error {
+	homeDir, homeErr := platform.GetHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+
+	env := doctor.Environment{
+		PlatformSupported: platform.CheckNixSupported,
+		Nix:               nix.NewInstaller(filesystem.NewOSFileSystem()),
+		ActiveConfig:      config.GetConfigService().GetActiveConfig,
+		HomeDir:           homeDir,
+		Path:              os.Getenv("PATH"),
+	}
+	return doctor.Report(os.Stdout, doctor.Run(doctor.Checks(env)))
+}
@@ -8,25 +8,66 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
 	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
 	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/retry"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
 	"github.com/shawnkhoffman/nix-foundry/pkg/tui"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
 var (
-	multiUser bool
+	multiUser       bool
+	scriptChecksum  string
+	scriptURL       string
+	verifyScriptGPG bool
+	offlineInstall  bool
+	localScriptPath string
+	noChannels      bool
+	useCurl         bool
+	forceInstall    bool
+	unattended      bool
+	assumeYes       bool
+	installConfig   string
+	installShellArg string
+	installManager  string
+	installPackages []string
+	noDetect        bool
+	maxAttempts     int
 )
 
+/*
+InstallPlan describes what runInstall sets up. It is produced either by the
+interactive installer or, in unattended mode, from a config file and flags, so
+both paths share the rest of the installation.
+*/
+type InstallPlan struct {
+	Manager   string
+	Shell     string
+	Packages  []string
+	MultiUser bool
+	Confirmed bool
+
+	// Config is the user configuration written when WriteConfig is set.
+	Config *schema.Config
+	// WriteConfig is false when the plan was read from the user configuration itself.
+	WriteConfig bool
+	// Interactive is false when prompts must be skipped or answered from the plan.
+	Interactive bool
+	// DeferredPackages is true when the user chose to pick some packages later.
+	DeferredPackages bool
+}
+
 var installCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install Nix package manager",
@@ -38,15 +79,267 @@ This command will install Nix in either single-user or multi-user mode.`,
 func init() {
 	rootCmd.AddCommand(installCmd)
 	installCmd.Flags().BoolVar(&multiUser, "multi-user", false, "Install in multi-user mode (requires sudo)")
+	installCmd.Flags().StringVar(&scriptChecksum, "checksum", "", "Expected SHA-256 checksum of the Nix install script")
+	installCmd.Flags().StringVar(&scriptURL, "script-url", nix.DefaultInstallScriptURL, "URL of the Nix install script")
+	installCmd.Flags().BoolVar(&verifyScriptGPG, "verify-gpg", false, "Verify the Nix install script signature with gpg")
+	installCmd.Flags().BoolVar(&offlineInstall, "offline", false, "Never download the Nix install script; requires --script or "+nix.InstallScriptEnv)
+	installCmd.Flags().StringVar(&localScriptPath, "script", "", "Path to a pre-downloaded Nix install script or release tarball (defaults to $"+nix.InstallScriptEnv+")")
+	installCmd.Flags().BoolVar(&noChannels, "no-channels", false, "Skip adding and updating the nixpkgs channel")
+	installCmd.Flags().BoolVar(&forceInstall, "force", false, "Proceed even if Nix was installed by another tool (Determinate Systems, nix-darwin, NixOS)")
+	installCmd.Flags().BoolVar(&useCurl, "curl", false, "Download the install script with curl (e.g. when proxies are only configured for curl)")
+	installCmd.Flags().IntVar(&maxAttempts, "max-attempts", retry.DefaultMaxAttempts, "Attempts for network operations such as downloading the install script and waiting for the Nix daemon")
+	installCmd.Flags().BoolVar(&unattended, "unattended", false, "Install without the interactive installer, using a config file and flags")
+	installCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Accept the installation plan without confirmation (required with --unattended)")
+	installCmd.Flags().StringVar(&installConfig, "config", "", "Config file to read the shell, manager and packages from (defaults to the user config)")
+	installCmd.Flags().StringVar(&installShellArg, "shell", "", "Shell to configure: "+strings.Join(platform.SupportedShells, ", ")+" (used with --unattended)")
+	installCmd.Flags().StringVar(&installManager, "manager", "", "Package manager to configure (used with --unattended)")
+	installCmd.Flags().StringSliceVar(&installPackages, "packages", nil, "Packages to add to the configuration (used with --unattended)")
+	installCmd.Flags().BoolVar(&noDetect, "no-detect", false, "Start the installer from defaults instead of the detected shell, editor and installed packages")
+}
+
+/*
+interactiveInstallPlan runs the installation TUI and converts its result into an
+InstallPlan. When a user configuration already exists, the wizard starts from it
+and only the shell, the manager and the packages the wizard offers are changed in
+it; otherwise it starts from the detected environment unless --no-detect is given.
+*/
+func interactiveInstallPlan(caps *platform.Capabilities) (*InstallPlan, error) {
+	existing := existingUserConfig()
+	var selections tui.Selections
+	var tuiErr error
+	if existing == nil && !noDetect {
+		selections, tuiErr = tui.RunInstallTUIFromDetected(tui.DetectEnvironment(cmdexec.WithOutput(cmdexec.NewOSRunner(), io.Discard)))
+	} else {
+		selections, tuiErr = tui.RunInstallTUIFromConfig(existing)
+	}
+	if tuiErr != nil {
+		return nil, tuiErr
+	}
+
+	shell := selections.Shell
+	if shell == "custom" {
+		// The user will set up their shell themselves; configure the one they use
+		// now, or the platform default when that one is not supported.
+		shell = getCurrentShell()
+		if platform.ValidateShell(shell) != nil {
+			shell = filepath.Base(platform.GetDefaultShell())
+		}
+	}
+
+	planConfig := existing
+	if planConfig == nil {
+		planConfig = schema.NewDefaultConfig()
+	}
+	planConfig.Type = schema.UserConfig
+	planConfig.Settings.Shell = shell
+	planConfig.Nix.Manager = selections.Manager
+	applyPackageSelections(planConfig, selections.Packages(), selections.Unselected())
+	packages := planConfig.Nix.Packages.AllPackages()
+
+	return &InstallPlan{
+		Manager:          selections.Manager,
+		Shell:            shell,
+		Packages:         packages,
+		MultiUser:        determineMultiUserMode(caps, packages, multiUser || planConfig.Nix.MultiUser),
+		Confirmed:        selections.Confirmed,
+		Config:           planConfig,
+		WriteConfig:      true,
+		Interactive:      true,
+		DeferredPackages: selections.Deferred(),
+	}, nil
+}
+
+/*
+applyPackageSelections updates the packages of cfg with the choices made in the
+wizard. Packages it offered that were left unselected are removed from the core
+and optional packages, and selected packages that are not configured yet are
+added as optional packages. Packages the wizard did not offer are kept.
+*/
+func applyPackageSelections(cfg *schema.Config, selected, unselected []string) {
+	removed := make(map[string]bool, len(unselected))
+	for _, pkg := range unselected {
+		removed[pkg] = true
+	}
+
+	configured := make(map[string]bool)
+	keep := func(pkgs []string) []string {
+		var kept []string
+		for _, pkg := range pkgs {
+			name, _, _ := strings.Cut(pkg, "@")
+			if removed[name] {
+				continue
+			}
+			configured[name] = true
+			kept = append(kept, pkg)
+		}
+		return kept
+	}
+	cfg.Nix.Packages.Core = keep(cfg.Nix.Packages.Core)
+	cfg.Nix.Packages.Optional = keep(cfg.Nix.Packages.Optional)
+
+	for _, pkg := range selected {
+		name, _, _ := strings.Cut(pkg, "@")
+		if !configured[name] {
+			configured[name] = true
+			cfg.Nix.Packages.Optional = append(cfg.Nix.Packages.Optional, pkg)
+		}
+	}
+}
+
+/*
+mergePackages returns the packages of base followed by those of extra that are
+not already in base.
+*/
+func mergePackages(base, extra []string) []string {
+	merged := append([]string{}, base...)
+	seen := make(map[string]bool, len(base))
+	for _, pkg := range base {
+		seen[pkg] = true
+	}
+	for _, pkg := range extra {
+		if !seen[pkg] {
+			merged = append(merged, pkg)
+			seen[pkg] = true
+		}
+	}
+	return merged
+}
+
+/*
+existingUserConfig returns the current user configuration, or nil if there is
+none or it cannot be read.
+*/
+func existingUserConfig() *schema.Config {
+	userConfig, configErr := config.GetConfigService().GetConfig(schema.UserConfig, "")
+	if configErr != nil {
+		return nil
+	}
+	return userConfig
+}
+
+/*
+unattendedInstallPlan builds an InstallPlan without prompting. Settings are read
+from the file given with --config, or from the existing user configuration, and
+can be overridden with flags. The configuration read is kept as a whole and
+written as the user configuration, with only the overridden settings changed.
+The plan is only confirmed when --yes is given.
+*/
+func unattendedInstallPlan(caps *platform.Capabilities) (*InstallPlan, error) {
+	plan := &InstallPlan{
+		Manager:     "nix-env",
+		Shell:       getCurrentShell(),
+		Config:      schema.NewDefaultConfig(),
+		WriteConfig: true,
+		Confirmed:   assumeYes,
+	}
+
+	userConfigPath, pathErr := schema.GetConfigPath()
+	if pathErr != nil {
+		return nil, fmt.Errorf("failed to get config path: %w", pathErr)
+	}
+
+	sourcePath := installConfig
+	if sourcePath == "" {
+		if _, statErr := os.Stat(userConfigPath); statErr == nil {
+			sourcePath = userConfigPath
+		}
+	}
+
+	if sourcePath != "" {
+		// The user configuration is migrated in place; a --config file is only
+		// migrated in memory and written to the user configuration below.
+		configSvc := config.GetConfigService()
+		var sourceConfig *schema.Config
+		var loadErr error
+		absSource, absErr := filepath.Abs(sourcePath)
+		if absErr == nil && absSource == userConfigPath {
+			sourceConfig, loadErr = configSvc.GetConfig(schema.UserConfig, "")
+			plan.WriteConfig = false
+		} else {
+			sourceConfig, loadErr = configSvc.LoadConfigFile(sourcePath)
+		}
+		if loadErr != nil {
+			return nil, fmt.Errorf("failed to load config file: %w", loadErr)
+		}
+
+		if sourceConfig.Settings.Shell != "" {
+			plan.Shell = sourceConfig.Settings.Shell
+		}
+		if sourceConfig.Nix.Manager != "" {
+			plan.Manager = sourceConfig.Nix.Manager
+		}
+		plan.Config = sourceConfig
+		fmt.Printf("Using configuration from %s\n", sourcePath)
+	}
+
+	if installShellArg != "" {
+		plan.Shell = installShellArg
+		plan.WriteConfig = true
+	}
+	if installManager != "" {
+		plan.Manager = installManager
+		plan.WriteConfig = true
+	}
+	if len(installPackages) > 0 {
+		plan.Config.Nix.Packages.Optional = mergePackages(plan.Config.Nix.Packages.Optional, installPackages)
+		plan.WriteConfig = true
+	}
+
+	if plan.Shell == "" || plan.Shell == "." {
+		plan.Shell = filepath.Base(platform.GetDefaultShell())
+		logging.Warn("no shell configured, using the default", "shell", plan.Shell)
+	}
+	if shellErr := platform.ValidateShell(plan.Shell); shellErr != nil {
+		return nil, shellErr
+	}
+	if plan.Manager != "nix-env" && plan.Manager != "nix-profile" {
+		return nil, fmt.Errorf("unsupported package manager %q (expected nix-env or nix-profile)", plan.Manager)
+	}
+
+	plan.Config.Type = schema.UserConfig
+	plan.Config.Settings.Shell = plan.Shell
+	plan.Config.Nix.Manager = plan.Manager
+	plan.Packages = plan.Config.Nix.Packages.AllPackages()
+	plan.MultiUser = determineMultiUserMode(caps, plan.Packages, multiUser || plan.Config.Nix.MultiUser)
+
+	return plan, nil
+}
+
+/*
+printInstallPlan summarizes an InstallPlan before it is carried out.
+*/
+func printInstallPlan(plan *InstallPlan) {
+	fmt.Println("Installation plan:")
+	fmt.Printf("  • Mode:     %s\n", map[bool]string{true: "multi-user", false: "single-user"}[plan.MultiUser])
+	fmt.Printf("  • Shell:    %s\n", plan.Shell)
+	fmt.Printf("  • Manager:  %s\n", plan.Manager)
+	if len(plan.Packages) > 0 {
+		fmt.Printf("  • Packages: %s\n", strings.Join(plan.Packages, ", "))
+	}
+}
+
+/*
+renderDownloadProgress renders download progress on a single terminal line.
+*/
+func renderDownloadProgress(downloaded, total int64) {
+	if total <= 0 {
+		fmt.Printf("\r  %.1f MB", float64(downloaded)/(1<<20))
+		return
+	}
+
+	fmt.Printf("\r  %3d%% (%.1f / %.1f MB)", downloaded*100/total, float64(downloaded)/(1<<20), float64(total)/(1<<20))
+	if downloaded >= total {
+		fmt.Println()
+	}
 }
 
 /*
 getCurrentShell retrieves the current user's shell from the SHELL environment
-variable and returns just the base name of the shell (e.g., "bash", "zsh").
+variable and returns its name (e.g., "bash", "zsh", "nushell").
 */
 func getCurrentShell() string {
 	shell := os.Getenv("SHELL")
-	return filepath.Base(shell)
+	return platform.ShellName(filepath.Base(shell))
 }
 
 /*
@@ -56,8 +349,10 @@ the current shell. It also configures the system to use the new shell by:
 2. Adding the shell to /etc/shells if possible
 3. Attempting to change the user's default shell
 If any step fails, appropriate warnings are displayed but the process continues.
+When interactive is false, steps that may prompt for a password are skipped with
+a warning explaining how to finish them manually.
 */
-func installShell(shell string) error {
+func installShell(caps *platform.Capabilities, shell string, interactive bool) error {
 	currentShell := getCurrentShell()
 	if shell == currentShell {
 		return nil
@@ -68,20 +363,27 @@ func installShell(shell string) error {
 	nixEnvCmd := fmt.Sprintf(". %s && NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 /nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
 		"/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh",
 		shell)
-	execCmd := exec.Command("bash", "-c", nixEnvCmd)
-	if output, err := execCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to install %s: %s: %w", shell, output, err)
+	runner := cmdexec.NewOSRunner()
+	if err := cmdexec.WithOutput(runner, io.Discard).Run("bash", "-c", nixEnvCmd); err != nil {
+		return fmt.Errorf("failed to install %s: %w", shell, err)
 	}
 
-	shellPath := filepath.Join("/nix/var/nix/profiles/default/bin", shell)
+	shellPath := filepath.Join("/nix/var/nix/profiles/default/bin", platform.ShellExecutable(shell))
+
+	sudoArgs := []string{"sh", "-c", fmt.Sprintf("command -v %s >> /etc/shells 2>/dev/null || true", shellPath)}
+	if !interactive {
+		sudoArgs = append([]string{"-n"}, sudoArgs...)
+	}
+	_ = cmdexec.WithOutput(runner, io.Discard).Run("sudo", sudoArgs...)
 
-	execCmd = exec.Command("sudo", "sh", "-c", fmt.Sprintf("command -v %s >> /etc/shells 2>/dev/null || true", shellPath))
-	_ = execCmd.Run()
+	if !interactive {
+		logging.Warn("skipping default shell change in unattended mode", "command", "chsh -s "+shellPath)
+		return nil
+	}
 
-	if _, err := exec.LookPath("chsh"); err == nil {
-		execCmd = exec.Command("chsh", "-s", shellPath)
-		if err := execCmd.Run(); err != nil {
-			fmt.Printf("Warning: Failed to change shell to %s: %v\nYou may need to change your shell manually.\n", shell, err)
+	if caps.Chsh {
+		if err := runner.Run("chsh", "-s", shellPath); err != nil {
+			logging.Warn("failed to change shell; you may need to change it manually", "shell", shell, "error", err)
 		} else {
 			fmt.Printf("Successfully changed shell to %s. Please log out and back in for changes to take effect.\n", shell)
 		}
@@ -93,11 +395,20 @@ func installShell(shell string) error {
 
 /*
 determineMultiUserMode determines if multi-user mode is required based on:
-1. Platform requirements (e.g., macOS always needs multi-user mode)
-2. Selected packages that require multi-user mode (e.g., docker)
+1. Platform requirements (e.g., macOS always needs multi-user mode, WSL uses single-user mode)
+2. An explicit --multi-user request
+3. Selected packages that require multi-user mode (e.g., docker)
 */
-func determineMultiUserMode(packages []string) bool {
-	if platform.GetNixSystem() == "aarch64-darwin" || platform.GetNixSystem() == "x86_64-darwin" {
+func determineMultiUserMode(caps *platform.Capabilities, packages []string, requested bool) bool {
+	if !caps.MultiUser {
+		return false
+	}
+
+	if requested {
+		return true
+	}
+
+	if caps.RequiresMultiUser {
 		return true
 	}
 
@@ -111,22 +422,17 @@ func determineMultiUserMode(packages []string) bool {
 }
 
 /*
-createInitialConfig creates and saves the initial configuration with the provided settings.
+saveUserConfig saves userConfig as the user configuration, owned by the real
+user when running under sudo.
 */
-func createInitialConfig(manager, shell string, packages []string) error {
-	config := schema.NewDefaultConfig()
-	config.Settings.Shell = shell
-	config.Nix.Manager = manager
-	config.Nix.Packages.Optional = packages
-
+func saveUserConfig(userConfig *schema.Config) error {
 	configPath, pathErr := schema.GetConfigPath()
 	if pathErr != nil {
 		return fmt.Errorf("failed to get config path: %w", pathErr)
 	}
 
-	configDir := filepath.Dir(configPath)
-	if mkdirErr := os.MkdirAll(configDir, 0755); mkdirErr != nil {
-		return fmt.Errorf("failed to create config directory: %w", mkdirErr)
+	if saveErr := config.GetConfigService().SaveConfig(userConfig); saveErr != nil {
+		return saveErr
 	}
 
 	uid, gid, err := platform.GetRealUser()
@@ -134,19 +440,10 @@ func createInitialConfig(manager, shell string, packages []string) error {
 		return fmt.Errorf("failed to get real user: %w", err)
 	}
 
-	if chownErr := os.Chown(configDir, uid, gid); chownErr != nil {
+	if chownErr := os.Chown(filepath.Dir(configPath), uid, gid); chownErr != nil {
 		return fmt.Errorf("failed to set config directory ownership: %w", chownErr)
 	}
 
-	content, marshalErr := yaml.Marshal(config)
-	if marshalErr != nil {
-		return fmt.Errorf("failed to marshal config: %w", marshalErr)
-	}
-
-	if writeErr := os.WriteFile(configPath, content, 0644); writeErr != nil {
-		return fmt.Errorf("failed to write config: %w", writeErr)
-	}
-
 	if chownErr := os.Chown(configPath, uid, gid); chownErr != nil {
 		return fmt.Errorf("failed to set config file ownership: %w", chownErr)
 	}
@@ -154,39 +451,6 @@ func createInitialConfig(manager, shell string, packages []string) error {
 	return nil
 }
 
-/*
-initializeNixChannels initializes the Nix channels and waits for the daemon to be ready.
-*/
-func initializeNixChannels() error {
-	fmt.Println("Initializing Nix channels...")
-	cmd := exec.Command("bash", "-c", ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && nix-channel --add https://nixos.org/channels/nixpkgs-unstable && nix-channel --update")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Warning: Failed to initialize Nix channels: %v\n", err)
-	}
-
-	fmt.Println("Waiting for Nix daemon to be ready...")
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		if i > 0 {
-			fmt.Printf("Retrying in 2 seconds (attempt %d/%d)...\n", i+1, maxRetries)
-			time.Sleep(2 * time.Second)
-		}
-
-		checkCmd := exec.Command("bash", "-c", "/nix/var/nix/profiles/default/bin/nix-env --version")
-		if checkErr := checkCmd.Run(); checkErr == nil {
-			return nil
-		}
-
-		if i == maxRetries-1 {
-			return fmt.Errorf("nix daemon not ready after %d attempts", maxRetries)
-		}
-	}
-
-	return nil
-}
-
 /*
 configureNixSettings creates and configures Nix settings for the current user.
 */
@@ -227,7 +491,7 @@ func configureNixSettings(uid, gid int) error {
 /*
 runInstall handles the main installation process for Nix Foundry. It:
 1. Verifies proper permissions for multi-user installation
-2. Runs the installation TUI to gather user preferences
+2. Builds an InstallPlan from the installation TUI, or from a config file and flags with --unattended
 3. Determines if multi-user mode is required based on platform and package selection
 4. Creates and saves initial configuration
 5. Installs Nix package manager
@@ -237,23 +501,55 @@ runInstall handles the main installation process for Nix Foundry. It:
 Returns an error if any critical step fails.
 */
 func runInstall(_ *cobra.Command, _ []string) error {
+	if supportErr := platform.CheckNixSupported(); supportErr != nil {
+		return supportErr
+	}
+
+	caps, capsErr := platform.DetectCapabilities()
+	if capsErr != nil {
+		return fmt.Errorf("failed to detect platform capabilities: %w", capsErr)
+	}
+
 	if multiUser && os.Geteuid() != 0 {
 		return fmt.Errorf("multi-user installation requires root privileges. Please run with sudo")
 	}
 
-	manager, shell, packages, confirmed, initErr := tui.RunInstallTUI()
-	if initErr != nil {
-		return initErr
+	if localScriptPath == "" {
+		localScriptPath = os.Getenv(nix.InstallScriptEnv)
+	}
+	if offlineInstall && localScriptPath == "" {
+		return fmt.Errorf("--offline requires --script <path> or %s pointing at a pre-downloaded install script or tarball", nix.InstallScriptEnv)
+	}
+
+	var plan *InstallPlan
+	var planErr error
+	if unattended {
+		plan, planErr = unattendedInstallPlan(caps)
+	} else {
+		plan, planErr = interactiveInstallPlan(caps)
+	}
+	if planErr != nil {
+		return planErr
+	}
+
+	if unattended {
+		printInstallPlan(plan)
+		if !plan.Confirmed {
+			return fmt.Errorf("unattended installation requires --yes to accept the installation plan")
+		}
 	}
 
-	if !confirmed {
+	if !plan.Confirmed {
 		return fmt.Errorf("installation cancelled")
 	}
 
-	multiUser = determineMultiUserMode(packages)
+	multiUser = plan.MultiUser
+	if caps.WSL {
+		fmt.Println("Note: Detected WSL; installing Nix as on Linux in single-user mode")
+	}
 	if multiUser && os.Geteuid() != 0 {
 		var reason string
-		if platform.GetNixSystem() == "aarch64-darwin" || platform.GetNixSystem() == "x86_64-darwin" {
+		if caps.RequiresMultiUser {
 			reason = "macOS requires multi-user mode"
 		} else {
 			reason = "selected packages (docker) require multi-user mode"
@@ -261,12 +557,21 @@ func runInstall(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("multi-user installation is required (%s). Please run with sudo", reason)
 	}
 
-	if configErr := createInitialConfig(manager, shell, packages); configErr != nil {
-		return configErr
-	}
-
 	fs := filesystem.NewOSFileSystem()
 	installer := nix.NewInstaller(fs)
+	installer.SetVerification(nix.ScriptVerification{
+		ScriptURL: scriptURL,
+		SHA256:    scriptChecksum,
+		VerifyGPG: verifyScriptGPG,
+	})
+	installer.SetNonInteractive(!plan.Interactive)
+	installer.SetMaxAttempts(maxAttempts)
+
+	if plan.WriteConfig {
+		if configErr := saveUserConfig(plan.Config); configErr != nil {
+			return configErr
+		}
+	}
 
 	if installer.IsInstalled() {
 		currentMultiUser, modeErr := installer.IsMultiUser()
@@ -284,27 +589,44 @@ func runInstall(_ *cobra.Command, _ []string) error {
 		return nil
 	}
 
-	if installErr := installer.Install(multiUser); installErr != nil {
+	installErr := installer.Install(multiUser, nix.InstallOptions{
+		ScriptPath:   localScriptPath,
+		SkipDownload: offlineInstall,
+		UseCurl:      useCurl,
+		Progress:     renderDownloadProgress,
+		Force:        forceInstall,
+	})
+	if installErr != nil {
 		return fmt.Errorf("installation failed: %w", installErr)
 	}
 
-	if shellErr := installShell(shell); shellErr != nil {
-		fmt.Printf("Warning: Failed to install shell: %v\n", shellErr)
+	if shellErr := installShell(caps, plan.Shell, plan.Interactive); shellErr != nil {
+		logging.Warn("failed to install shell", "error", shellErr)
 	}
 
-	if pathErr := addToPath(shell); pathErr != nil {
-		fmt.Printf("Warning: Failed to add nix-foundry to PATH: %v\n", pathErr)
+	shellEnv := plan.Config.Env
+	if activeConfig, activeErr := config.GetConfigService().GetActiveConfig(); activeErr == nil {
+		shellEnv = activeConfig.Env
+	}
+	if pathErr := addToPath(plan.Shell, shellEnv); pathErr != nil {
+		logging.Warn("failed to add nix-foundry to PATH", "error", pathErr)
 	}
 
 	fmt.Printf("✨ Nix installed successfully in %s mode\n",
 		map[bool]string{true: "multi-user", false: "single-user"}[multiUser])
 
 	if copyErr := copyBinaryToLocalBin(); copyErr != nil {
-		fmt.Printf("Warning: Failed to copy nix-foundry to PATH: %v\n", copyErr)
+		logging.Warn("failed to copy nix-foundry to PATH", "error", copyErr)
+	}
+
+	if daemonErr := installer.WaitForDaemon(); daemonErr != nil {
+		return daemonErr
 	}
 
-	if channelErr := initializeNixChannels(); channelErr != nil {
-		return channelErr
+	if noChannels {
+		fmt.Println("Skipping Nix channel initialization (--no-channels)")
+	} else {
+		installer.InitializeChannels()
 	}
 
 	uid, gid, err := platform.GetRealUser()
@@ -321,7 +643,7 @@ func runInstall(_ *cobra.Command, _ []string) error {
 	fmt.Println(strings.Repeat("=", 60))
 	fmt.Println()
 	
-	if platform.GetNixSystem() == "aarch64-darwin" || platform.GetNixSystem() == "x86_64-darwin" {
+	if caps.OS == platform.MacOS {
 		fmt.Println("⚠️  IMPORTANT FOR macOS USERS:")
 		fmt.Println("To install GUI applications, you need to:")
 		fmt.Println("1. Open System Preferences → Privacy & Security → Full Disk Access")
@@ -335,7 +657,15 @@ func runInstall(_ *cobra.Command, _ []string) error {
 	
 	fmt.Println("Next steps:")
 	fmt.Println("1. Close and reopen your terminal (or run: source ~/.zshrc)")
-	fmt.Println("2. Install your selected packages by running:")
+	if plan.DeferredPackages {
+		fmt.Println("2. Add the packages you chose to pick yourself under nix.packages in:")
+		if configPath, pathErr := schema.GetConfigPath(); pathErr == nil {
+			fmt.Printf("   %s\n", configPath)
+		}
+		fmt.Println("3. Install your packages by running:")
+	} else {
+		fmt.Println("2. Install your selected packages by running:")
+	}
 	fmt.Println("   nix-foundry config apply")
 	fmt.Println()
 	fmt.Println("Note: Package installation runs in user context to avoid permission issues.")
@@ -376,7 +706,7 @@ func copyBinaryToLocalBin() error {
 		uid, gid, userErr := platform.GetRealUser()
 		if userErr == nil {
 			if chownErr := os.Chown(localBinDir, uid, gid); chownErr != nil {
-				fmt.Printf("Warning: Failed to set local bin directory ownership: %v\n", chownErr)
+				logging.Warn("failed to set local bin directory ownership", "error", chownErr)
 			}
 		}
 	}
@@ -394,7 +724,7 @@ func copyBinaryToLocalBin() error {
 		uid, gid, userErr := platform.GetRealUser()
 		if userErr == nil {
 			if chownErr := os.Chown(destPath, uid, gid); chownErr != nil {
-				fmt.Printf("Warning: Failed to set binary ownership: %v\n", chownErr)
+				logging.Warn("failed to set binary ownership", "error", chownErr)
 			}
 		}
 	}
@@ -425,9 +755,12 @@ func copyFile(src, dst string) error {
 
 /*
 addToPath adds nix-foundry to the user's PATH by modifying their shell configuration file.
+The content is kept inside the nix-foundry managed block so it can be updated in place
+and removed cleanly on uninstall. The block also exports env, as `config apply` writes
+it, so installing does not drop the exports of an existing configuration.
 */
-func addToPath(shell string) error {
-	rcFile, err := platform.GetShellConfigFile(shell)
+func addToPath(userShell string, env map[string]string) error {
+	rcFile, err := platform.GetShellConfigFile(userShell)
 	if err != nil {
 		return fmt.Errorf("failed to get shell config file: %w", err)
 	}
@@ -441,75 +774,35 @@ func addToPath(shell string) error {
 		rcFile = strings.Replace(rcFile, currentHome, realHomeDir, 1)
 	}
 
-	if shell == "fish" {
+	if _, statErr := os.Stat(filepath.Dir(rcFile)); os.IsNotExist(statErr) {
 		if mkdirErr := os.MkdirAll(filepath.Dir(rcFile), 0775); mkdirErr != nil {
-			return fmt.Errorf("failed to create fish config directory: %w", mkdirErr)
+			return fmt.Errorf("failed to create %s config directory: %w", userShell, mkdirErr)
 		}
 
 		if platform.IsRunningAsSudo() {
 			uid, gid, userErr := platform.GetRealUser()
 			if userErr == nil {
 				if chownErr := os.Chown(filepath.Dir(rcFile), uid, gid); chownErr != nil {
-					fmt.Printf("Warning: Failed to set fish config directory ownership: %v\n", chownErr)
+					logging.Warn("failed to set shell config directory ownership", "error", chownErr)
 				}
 			}
 		}
 	}
 
-	var content string
-	switch shell {
-	case "fish":
-		content = `
-if test -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
-    source '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
-else if test -e "$HOME/.nix-profile/etc/profile.d/nix.fish"
-    source "$HOME/.nix-profile/etc/profile.d/nix.fish"
-end
-
-if not contains $HOME/.local/bin $PATH
-    set -x PATH $PATH $HOME/.local/bin
-end
-`
-	case "zsh":
-		content = `
-if [ -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh' ]; then
-    . '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh'
-elif [ -e "$HOME/.nix-profile/etc/profile.d/nix.sh" ]; then
-    . "$HOME/.nix-profile/etc/profile.d/nix.sh"
-fi
-
-if [[ ":$PATH:" != *":$HOME/.local/bin:"* ]]; then
-    export PATH="$PATH:$HOME/.local/bin"
-fi
-`
-	default:
-		content = `
-if [ -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh' ]; then
-    . '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh'
-elif [ -e "$HOME/.nix-profile/etc/profile.d/nix.sh" ]; then
-    . "$HOME/.nix-profile/etc/profile.d/nix.sh"
-fi
-
-if [[ ":$PATH:" != *":$HOME/.local/bin:"* ]]; then
-    export PATH="$PATH:$HOME/.local/bin"
-fi
-`
-	}
-
-	existingContent, readErr := os.ReadFile(rcFile)
-	if readErr == nil && len(existingContent) > 0 {
-		if strings.Contains(string(existingContent), "nix-daemon") {
-			return nil
-		}
+	var existingContent []byte
+	if content, readErr := os.ReadFile(rcFile); readErr == nil {
+		existingContent = content
+	} else if !os.IsNotExist(readErr) {
+		return fmt.Errorf("failed to read rc file: %w", readErr)
 	}
 
-	f, openErr := os.OpenFile(rcFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
-	if openErr != nil {
-		return fmt.Errorf("failed to open rc file: %w", openErr)
+	block := shell.ManagedBlockWithEnv(userShell, env)
+	newContent := shell.UpsertManagedBlock(string(existingContent), block)
+	if newContent == string(existingContent) {
+		return nil
 	}
-	defer func() { _ = f.Close() }()
 
-	if _, writeErr := f.WriteString(content); writeErr != nil {
+	if writeErr := os.WriteFile(rcFile, []byte(newContent), 0664); writeErr != nil {
 		return fmt.Errorf("failed to update rc file: %w", writeErr)
 	}
 
@@ -517,7 +810,7 @@ fi
 		uid, gid, userErr := platform.GetRealUser()
 		if userErr == nil {
 			if chownErr := os.Chown(rcFile, uid, gid); chownErr != nil {
-				fmt.Printf("Warning: Failed to set rc file ownership: %v\n", chownErr)
+				logging.Warn("failed to set rc file ownership", "error", chownErr)
 			}
 		}
 	}
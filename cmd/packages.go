@@ -0,0 +1,246 @@
+// Package cmd provides the command-line interface for Nix Foundry.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/output"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/spf13/cobra"
+)
+
+var packagesCmd = &cobra.Command{
+	Use:   "packages",
+	Short: "Discover Nix packages",
+	Long: `Discover Nix packages.
+This command provides subcommands for finding packages to add to your configuration.`,
+}
+
+var packagesSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search nixpkgs for packages",
+	Long: `Search nixpkgs for packages.
+Results show the attribute name to use in your configuration, its version, and a description.
+Results are cached for a short time to avoid re-evaluating nixpkgs on every search.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runPackagesSearch,
+}
+
+var packagesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the packages of the active configuration",
+	Long: `List the packages of the active configuration.
+Each package is shown with where it comes from: the core or optional packages,
+or an enabled package group. With --groups, every package group is shown with
+its packages and whether it is enabled, either by its default or by your override.`,
+	Args: cobra.NoArgs,
+	RunE: runPackagesList,
+}
+
+var packagesGroupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Enable or disable package groups",
+	Long: `Enable or disable package groups.
+Package groups are named sets of packages defined under nix.packages.groups in
+user, team, or project configurations. Your choice is saved in the user
+configuration and overrides the group's default.`,
+}
+
+var packagesGroupEnableCmd = &cobra.Command{
+	Use:   "enable <name>",
+	Short: "Install the packages of a group",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return setPackageGroup(args[0], true)
+	},
+}
+
+var packagesGroupDisableCmd = &cobra.Command{
+	Use:   "disable <name>",
+	Short: "Stop installing the packages of a group",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return setPackageGroup(args[0], false)
+	},
+}
+
+var packagesAddGroupCmd = &cobra.Command{
+	Use:   "add-group <name>",
+	Short: "Add the packages of a preset group to your configuration",
+	Long: `Add the packages of a preset group to your configuration.
+Preset groups are bundled sets of packages for common use cases, such as web or
+devops. Their packages are added to the core packages of your user configuration,
+skipping any you already have. Run 'nix-foundry packages list-groups' to see them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPackagesAddGroup,
+}
+
+var packagesListGroupsCmd = &cobra.Command{
+	Use:   "list-groups",
+	Short: "List the preset package groups",
+	Long: `List the preset package groups.
+Each preset is shown with a description and its packages. Add one to your
+configuration with 'nix-foundry packages add-group <name>'.`,
+	Args: cobra.NoArgs,
+	RunE: runPackagesListGroups,
+}
+
+func init() {
+	rootCmd.AddCommand(packagesCmd)
+	packagesCmd.AddCommand(packagesSearchCmd)
+	packagesCmd.AddCommand(packagesListCmd)
+	packagesCmd.AddCommand(packagesGroupCmd)
+	packagesCmd.AddCommand(packagesAddGroupCmd)
+	packagesCmd.AddCommand(packagesListGroupsCmd)
+	packagesGroupCmd.AddCommand(packagesGroupEnableCmd)
+	packagesGroupCmd.AddCommand(packagesGroupDisableCmd)
+
+	packagesListCmd.Flags().Bool("groups", false, "Show package groups and whether they are enabled")
+}
+
+func runPackagesSearch(cmd *cobra.Command, args []string) error {
+	manager := packages.NewManager(filesystem.NewOSFileSystem())
+
+	results, err := manager.Search(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	if format := output.FromCommand(cmd); format != output.Table {
+		return output.Write(os.Stdout, format, results)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No packages found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tDESCRIPTION")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Name, result.Version, result.Description)
+	}
+	return w.Flush()
+}
+
+/*
+listedPackage is a package of the active configuration and where it comes from.
+*/
+type listedPackage struct {
+	Name   string `yaml:"name" json:"name"`
+	Source string `yaml:"source" json:"source"`
+}
+
+func runPackagesList(cmd *cobra.Command, _ []string) error {
+	activeConfig, err := config.GetConfigService().GetActiveConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get active config: %w", err)
+	}
+	pkgs := activeConfig.Nix.Packages
+	format := output.FromCommand(cmd)
+
+	if showGroups, _ := cmd.Flags().GetBool("groups"); showGroups {
+		statuses := pkgs.GroupStatuses()
+		if format != output.Table {
+			return output.Write(os.Stdout, format, statuses)
+		}
+		if len(statuses) == 0 {
+			fmt.Println("No package groups configured")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tENABLED\tREASON\tPACKAGES")
+		for _, status := range statuses {
+			enabled := "no"
+			if status.Enabled {
+				enabled = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status.Name, enabled, status.Reason, strings.Join(status.Packages, ", "))
+		}
+		return w.Flush()
+	}
+
+	var listed []listedPackage
+	for _, pkg := range pkgs.Core {
+		listed = append(listed, listedPackage{Name: pkg, Source: "core"})
+	}
+	for _, pkg := range pkgs.Optional {
+		listed = append(listed, listedPackage{Name: pkg, Source: "optional"})
+	}
+	for _, status := range pkgs.GroupStatuses() {
+		if !status.Enabled {
+			continue
+		}
+		for _, pkg := range status.Packages {
+			listed = append(listed, listedPackage{Name: pkg, Source: "group " + status.Name})
+		}
+	}
+
+	if format != output.Table {
+		return output.Write(os.Stdout, format, listed)
+	}
+	if len(listed) == 0 {
+		fmt.Println("No packages configured")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE")
+	for _, pkg := range listed {
+		fmt.Fprintf(w, "%s\t%s\n", pkg.Name, pkg.Source)
+	}
+	return w.Flush()
+}
+
+func setPackageGroup(name string, enabled bool) error {
+	if err := config.GetConfigService().SetPackageGroup(name, enabled); err != nil {
+		return fmt.Errorf("failed to update package group: %w", err)
+	}
+
+	if enabled {
+		fmt.Printf("✨ Enabled package group %s\n", name)
+	} else {
+		fmt.Printf("✨ Disabled package group %s\n", name)
+	}
+	fmt.Println("Run 'nix-foundry config apply' to update your packages")
+	return nil
+}
+
+func runPackagesAddGroup(_ *cobra.Command, args []string) error {
+	added, err := config.GetConfigService().AddPackagePreset(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to add package group: %w", err)
+	}
+
+	if len(added) == 0 {
+		fmt.Printf("The packages of %s are already in your configuration\n", args[0])
+		return nil
+	}
+	fmt.Printf("✨ Added %s from %s\n", strings.Join(added, ", "), args[0])
+	fmt.Println("Run 'nix-foundry config apply' to install them")
+	return nil
+}
+
+func runPackagesListGroups(cmd *cobra.Command, _ []string) error {
+	presets, err := packages.Presets()
+	if err != nil {
+		return err
+	}
+
+	if format := output.FromCommand(cmd); format != output.Table {
+		return output.Write(os.Stdout, format, presets)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tDESCRIPTION\tPACKAGES")
+	for _, preset := range presets {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", preset.Name, preset.Description, strings.Join(preset.Packages, ", "))
+	}
+	return w.Flush()
+}
@@ -1,6 +1,14 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/project"
 	"github.com/spf13/cobra"
 )
 
@@ -12,5 +20,153 @@ func NewProjectCmd() *cobra.Command {
 		Long:  `Commands for managing Nix projects.`,
 	}
 
+	cmd.AddCommand(newProjectShellCmd())
+	cmd.AddCommand(newProjectLockCmd())
+	cmd.AddCommand(newProjectInfoCmd())
+
 	return cmd
 }
+
+/*
+newProjectShellCmd creates the command that generates the project shell flake and
+.envrc from the project configuration.
+*/
+func newProjectShellCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Generate the project shell and direnv integration",
+		Long: `Generate the project shell and direnv integration.
+This command generates a flake in .nix-foundry/shell from .nix-foundry/config.yaml
+and points .envrc at it so direnv activates the environment when you enter the
+project. The flake is only regenerated when the project configuration changes.
+A flake that was edited by hand is not overwritten unless --force is given.`,
+		RunE: runProjectShell,
+	}
+
+	cmd.Flags().Bool("force", false, "Overwrite generated files that were edited by hand")
+	return cmd
+}
+
+func runProjectShell(cmd *cobra.Command, _ []string) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	service := project.NewService(filesystem.NewOSFileSystem(), root)
+	changed, err := service.SyncProjectEnvironmentWithOptions(project.SyncOptions{Force: force})
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		fmt.Printf("✨ Generated project shell in %s\n", project.ShellDir)
+	} else {
+		fmt.Println("Project shell is up to date")
+	}
+
+	shell := filepath.Base(os.Getenv("SHELL"))
+	installed, hooked := project.DirenvStatus(shell)
+	if !installed || !hooked {
+		fmt.Println("\n⚠️  direnv is not set up, so the project shell will not activate automatically:")
+		for _, step := range project.DirenvSetupInstructions(shell, installed) {
+			fmt.Printf("   • %s\n", step)
+		}
+		fmt.Println("   Or enter the shell manually with: nix develop ./" + project.ShellDir)
+	}
+
+	return nil
+}
+
+/*
+newProjectLockCmd creates the command that records the versions the project's
+packages resolve to in .nix-foundry/lock.yaml.
+*/
+func newProjectLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lock",
+		Short: "Lock the project packages to their current versions",
+		Long: `Lock the project packages to their current versions.
+This command resolves nixpkgs and pinned flake references to their current
+revisions and records each package's version in .nix-foundry/lock.yaml. While the
+lockfile is in sync with the project configuration, the project shell uses the
+locked revisions.`,
+		RunE: runProjectLock,
+	}
+}
+
+func runProjectLock(_ *cobra.Command, _ []string) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	if lockErr := project.NewService(filesystem.NewOSFileSystem(), root).Lock(); lockErr != nil {
+		return lockErr
+	}
+
+	fmt.Printf("✨ Wrote %s\n", project.LockFile)
+	return nil
+}
+
+/*
+newProjectInfoCmd creates the command that describes the generated project shell
+from its manifest.
+*/
+func newProjectInfoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "info",
+		Short: "Show what generated the project shell",
+		Long: `Show what generated the project shell.
+This command prints the manifest in .nix-foundry/shell: the nix-foundry version
+and sources the shell was generated from, and the files it manages. Files that
+were edited by hand since they were generated are marked as modified.`,
+		Args: cobra.NoArgs,
+		RunE: runProjectInfo,
+	}
+}
+
+func runProjectInfo(_ *cobra.Command, _ []string) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	service := project.NewService(filesystem.NewOSFileSystem(), root)
+	manifest, err := service.ReadManifest()
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		fmt.Println("The project shell has not been generated yet; run 'nix-foundry project shell'")
+		return nil
+	}
+	modified, err := service.ModifiedFiles(manifest)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📄 %s\n", project.ManifestFile)
+	fmt.Printf("Generated by: nix-foundry %s (%s)\n", manifest.Version, manifest.Template)
+	fmt.Printf("Created:      %s\n", manifest.Created.Local().Format(time.RFC1123))
+	fmt.Printf("Updated:      %s\n", manifest.Updated.Local().Format(time.RFC1123))
+	fmt.Println("\nSources:")
+	for _, source := range manifest.Sources {
+		fmt.Printf("  %s (sha256 %.12s)\n", source.Path, source.Hash)
+	}
+	fmt.Println("\nManaged files:")
+	for _, file := range manifest.Files {
+		if slices.Contains(modified, file.Path) {
+			fmt.Printf("  %s ⚠️  modified by hand\n", file.Path)
+			continue
+		}
+		fmt.Printf("  %s\n", file.Path)
+	}
+	fmt.Println("\nEdit .nix-foundry/config.yaml and run 'nix-foundry project shell' to change the shell.")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(NewProjectCmd())
+}
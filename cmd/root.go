@@ -1,12 +1,31 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/output"
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/selfupdate"
 	"github.com/spf13/cobra"
 )
 
+/*
+defaultLogFile is the value of --log-file when the flag is given without a path,
+selecting the log file under the configuration directory.
+*/
+const defaultLogFile = "default"
+
+var logCloser io.Closer
+
 var rootCmd = &cobra.Command{
 	Use:   "nix-foundry",
 	Short: "A tool for managing Nix environments across platforms",
@@ -14,18 +33,120 @@ var rootCmd = &cobra.Command{
 It provides a unified interface for installing, configuring, and managing
 Nix packages and environments across macOS, Linux, and Windows Subsystem
 for Linux (WSL).`,
+	Version:           selfupdate.Version,
+	PersistentPreRunE: beforeCommand,
 }
 
 /*
 Execute adds all child commands to the root command and sets flags appropriately.
 */
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cmdexec.SetContext(ctx)
+
+	err := rootCmd.ExecuteContext(ctx)
+	if logCloser != nil {
+		_ = logCloser.Close()
+	}
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+/*
+beforeCommand runs before every command. It checks the --output format, moves
+files left by earlier versions to their current locations, configures logging
+and, unless --quiet is given, checks for a newer release.
+*/
+func beforeCommand(cmd *cobra.Command, args []string) error {
+	outputFormat, _ := cmd.Flags().GetString(output.FlagName)
+	if _, formatErr := output.ParseFormat(outputFormat); formatErr != nil {
+		return formatErr
+	}
+	migrateErr := migrateLegacyLayout()
+	if loggingErr := configureLogging(cmd, args); loggingErr != nil {
+		return loggingErr
+	}
+	if migrateErr != nil {
+		logging.Warn("failed to move files to the state directory", "error", migrateErr)
+	}
+	if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet {
+		checkForUpdate(cmd)
+	}
+	return nil
+}
+
+/*
+migrateLegacyLayout moves state that earlier versions kept in the configuration
+directory to the state directory (see paths.Resolver.MigrateLegacyLayout).
+*/
+func migrateLegacyLayout() error {
+	resolver, resolveErr := paths.NewResolver()
+	if resolveErr != nil {
+		return resolveErr
+	}
+	return resolver.MigrateLegacyLayout()
+}
+
+/*
+configureLogging sets up the logger from the --verbose, --quiet, --log-level,
+--log-json and --log-file flags before any command runs. Without any of the
+level flags, the level is taken from settings.logLevel in the user config.
+*/
+func configureLogging(cmd *cobra.Command, _ []string) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	level, _ := cmd.Flags().GetString("log-level")
+	logJSON, _ := cmd.Flags().GetBool("log-json")
+	logFile, _ := cmd.Flags().GetString("log-file")
+
+	if level != "" && (verbose || quiet) {
+		return fmt.Errorf("--log-level cannot be combined with --verbose or --quiet")
+	}
+
+	var settingErr error
+	if level == "" && !verbose && !quiet {
+		if configured := configuredLogLevel(); configured != "" {
+			if _, settingErr = logging.ParseLevel(configured); settingErr == nil {
+				level = configured
+			}
+		}
+	}
+
+	if logFile == defaultLogFile {
+		path, pathErr := logging.DefaultLogFile()
+		if pathErr != nil {
+			return fmt.Errorf("failed to determine log file location: %w", pathErr)
+		}
+		logFile = path
+	}
+
+	closer, configureErr := logging.Configure(logging.Options{Verbose: verbose, Quiet: quiet, Level: level, JSON: logJSON, File: logFile})
+	if configureErr != nil {
+		return fmt.Errorf("failed to configure logging: %w", configureErr)
+	}
+	logCloser = closer
+
+	if settingErr != nil {
+		logging.Warn("ignoring settings.logLevel", "error", settingErr)
+	}
+	return nil
+}
+
+/*
+configuredLogLevel returns settings.logLevel from the user config, or an empty
+string when there is no readable user config.
+*/
+func configuredLogLevel() string {
+	userConfig, configErr := config.GetConfigService().GetConfig(schema.UserConfig, "")
+	if configErr != nil {
+		return ""
+	}
+	return userConfig.Settings.LogLevel
+}
+
 /*
 GetRootCommand returns the root cobra command.
 This is used by the documentation generator.
@@ -36,4 +157,10 @@ func GetRootCommand() *cobra.Command {
 
 func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only show errors")
+	rootCmd.PersistentFlags().String("log-level", "", "Log level: debug, info, warn or error (defaults to settings.logLevel)")
+	rootCmd.PersistentFlags().Bool("log-json", false, "Write diagnostics to stderr as JSON")
+	rootCmd.PersistentFlags().String("log-file", "", "Write a JSON log to this file (defaults to ~/.local/state/nix-foundry/logs/nix-foundry.log when no path is given)")
+	rootCmd.PersistentFlags().Lookup("log-file").NoOptDefVal = defaultLogFile
+	rootCmd.PersistentFlags().StringP(output.FlagName, "o", string(output.Table), "Output format of list commands: table, json or yaml")
 }
@@ -3,38 +3,70 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
 	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
-	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 	"github.com/shawnkhoffman/nix-foundry/pkg/tui"
 	"github.com/spf13/cobra"
 )
 
 var (
-	force bool
+	force            bool
+	aggressive       bool
+	dryRun           bool
+	keepBackups      bool
+	uninstallYes     bool
+	uninstallWithNix bool
 )
 
 var uninstallCmd = &cobra.Command{
 	Use:   "uninstall",
 	Short: "Uninstall Nix Foundry",
 	Long: `Uninstall Nix Foundry.
-This command will remove Nix Foundry and optionally uninstall Nix.`,
+This command lists everything nix-foundry added to the system and, after
+confirmation, removes it: the nix-foundry binary, the managed blocks in shell
+configuration files and the gitconfig, the /Applications symlinks it created,
+and the configuration, state and cache directories. Nix and the packages it
+installed are kept unless you choose to uninstall Nix as well. Running it again
+reports what it expected but no longer found.
+
+Without an interactive terminal, as in CI, pass --yes to uninstall without
+asking, and --nix to uninstall Nix as well.`,
 	RunE: runUninstall,
 }
 
 func init() {
 	rootCmd.AddCommand(uninstallCmd)
 	uninstallCmd.Flags().BoolVar(&force, "force", false, "Force uninstallation even if errors occur")
+	uninstallCmd.Flags().BoolVar(&aggressive, "aggressive", false, "Also remove unmarked Nix-related lines from shell files (prints each line removed)")
+	uninstallCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print what would be removed without changing anything")
+	uninstallCmd.Flags().BoolVar(&keepBackups, "keep-backups", false, "Keep the .nix-foundry.bak backups of edited files")
+	uninstallCmd.Flags().BoolVarP(&uninstallYes, "yes", "y", false, "Uninstall without asking for confirmation")
+	uninstallCmd.Flags().BoolVar(&uninstallWithNix, "nix", false, "Also uninstall Nix (used with --yes)")
 }
 
 func runUninstall(_ *cobra.Command, _ []string) error {
-	uninstallNix, confirmed, err := tui.RunUninstallTUI()
+	configSvc := config.GetConfigService()
+	opts := config.SelfUninstallOptions{KeepBackups: keepBackups}
+	inventory, err := configSvc.SelfUninstallInventory(opts)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to list nix-foundry files: %w", err)
+	}
+
+	if dryRun {
+		fmt.Println("Dry run: nothing will be changed.")
+		printUninstallInventory(inventory)
+		return printUninstallPlan()
+	}
+
+	printUninstallInventory(inventory)
+	uninstallNix, confirmed := uninstallWithNix, true
+	if !uninstallYes {
+		uninstallNix, confirmed, err = tui.RunUninstallTUI()
+		if err != nil {
+			return err
+		}
 	}
 
 	if !confirmed {
@@ -45,23 +77,20 @@ func runUninstall(_ *cobra.Command, _ []string) error {
 		fs := filesystem.NewOSFileSystem()
 		installer := nix.NewInstaller(fs)
 
-		if uninstallErr := installer.Uninstall(force); uninstallErr != nil {
+		if uninstallErr := installer.Uninstall(force, aggressive); uninstallErr != nil {
 			return fmt.Errorf("failed to uninstall Nix: %w", uninstallErr)
 		}
 	}
 
-	configPath, err := schema.GetConfigPath()
-	if err != nil {
-		return fmt.Errorf("failed to get config path: %w", err)
-	}
-
-	configDir := filepath.Dir(configPath)
-	if removeErr := os.RemoveAll(configDir); removeErr != nil {
-		return fmt.Errorf("failed to remove config directory: %w", removeErr)
+	removed, removeErr := configSvc.SelfUninstall(opts)
+	for _, item := range removed {
+		fmt.Printf("🗑️  Removed %s: %s\n", item.Description, item.Path)
 	}
-
-	if pathErr := removeFromPath(); pathErr != nil {
-		fmt.Printf("Warning: Failed to remove nix-foundry from PATH: %v\n", pathErr)
+	if removeErr != nil {
+		if !force {
+			return fmt.Errorf("failed to uninstall nix-foundry: %w", removeErr)
+		}
+		fmt.Printf("Warning: %v\n", removeErr)
 	}
 
 	fmt.Println("✨ Nix Foundry uninstalled successfully")
@@ -71,37 +100,83 @@ func runUninstall(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
-func removeFromPath() error {
-	homeDir, err := os.UserHomeDir()
+/*
+printUninstallInventory prints what nix-foundry added to the system, and what it
+expected to find but did not.
+*/
+func printUninstallInventory(inventory []config.UninstallItem) {
+	fmt.Println("\nNix Foundry files to remove:")
+	found := false
+	for _, item := range inventory {
+		if !item.Missing {
+			fmt.Printf("  %s: %s\n", item.Description, item.Path)
+			found = true
+		}
+	}
+	if !found {
+		fmt.Println("  (none)")
+	}
+	for _, item := range inventory {
+		if item.Missing {
+			fmt.Printf("⚠️  Expected but not found: %s: %s\n", item.Description, item.Path)
+		}
+	}
+}
+
+/*
+printUninstallPlan prints the Nix files the uninstall would remove without touching the system.
+*/
+func printUninstallPlan() error {
+	installer := nix.NewInstaller(filesystem.NewOSFileSystem())
+	plan, err := installer.PlanUninstall()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return fmt.Errorf("failed to plan uninstallation: %w", err)
 	}
 
-	rcFiles := []string{
-		filepath.Join(homeDir, ".bashrc"),
-		filepath.Join(homeDir, ".zshrc"),
+	if flavor := installer.DetectFlavor(); flavor.IsForeign() {
+		fmt.Printf("\nNix was installed by %s. Uninstall will not remove the files below;\nit delegates to that installer's uninstaller or explains how to remove it.\n", flavor)
 	}
 
-	for _, rcFile := range rcFiles {
-		if _, statErr := os.Stat(rcFile); statErr == nil {
-			content, readErr := os.ReadFile(rcFile)
-			if readErr != nil {
-				continue
-			}
+	if plan.IsEmpty() {
+		fmt.Println("\nNo Nix installation files found.")
+		return nil
+	}
 
-			lines := strings.Split(string(content), "\n")
-			var newLines []string
-			for _, line := range lines {
-				if !strings.Contains(line, "# Add nix-foundry to PATH") &&
-					!strings.Contains(line, "export PATH=\"$PATH:$HOME/.local/bin\"") {
-					newLines = append(newLines, line)
-				}
-			}
+	if len(plan.Services) > 0 {
+		fmt.Println("\nServices to stop and unload:")
+		for _, service := range plan.Services {
+			fmt.Printf("  %s\n", service)
+		}
+	}
 
-			newContent := strings.Join(newLines, "\n")
-			if writeErr := os.WriteFile(rcFile, []byte(newContent), 0644); writeErr != nil {
-				continue
+	if len(plan.Volumes) > 0 {
+		fmt.Println("\nVolumes to delete:")
+		for _, volume := range plan.Volumes {
+			fmt.Printf("  %s\n", volume)
+		}
+	}
+
+	if len(plan.Paths) > 0 {
+		fmt.Println("\nPaths to remove:")
+		for _, path := range plan.Paths {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+
+	for _, edit := range plan.ShellEdits {
+		fmt.Printf("\nLines to remove from %s:\n", edit.Path)
+		for _, line := range edit.Lines {
+			fmt.Printf("  - %s\n", line)
+		}
+		if len(edit.LegacyLines) == 0 {
+			continue
+		}
+		if aggressive {
+			for _, line := range edit.LegacyLines {
+				fmt.Printf("  - %s\n", line)
 			}
+		} else {
+			fmt.Printf("  (%d unmarked Nix-related line(s) kept; use --aggressive to remove them)\n", len(edit.LegacyLines))
 		}
 	}
 
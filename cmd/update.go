@@ -0,0 +1,109 @@
+// Package cmd provides the command-line interface for Nix Foundry.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/selfupdate"
+	"github.com/spf13/cobra"
+)
+
+/*
+startupCheckTimeout bounds the update check that runs before commands, so an
+unreachable GitHub never holds up the command.
+*/
+const startupCheckTimeout = 3 * time.Second
+
+var updateCheckOnly bool
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update nix-foundry to the latest release",
+	Long: `Update nix-foundry to the latest release.
+This command downloads the latest release for this platform from GitHub, verifies
+its checksum, and replaces the running binary. Use --check to only report whether
+an update is available.`,
+	RunE: runUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().BoolVar(&updateCheckOnly, "check", false, "Only check whether an update is available")
+}
+
+func runUpdate(cmd *cobra.Command, _ []string) error {
+	updater := selfupdate.NewUpdater()
+	release, latestErr := updater.Latest(cmd.Context())
+	if latestErr != nil {
+		return latestErr
+	}
+
+	if selfupdate.Version == "dev" {
+		fmt.Printf("This is a development build; the latest release is %s\n", release.Version)
+		return nil
+	}
+	if !release.IsNewer() {
+		fmt.Printf("✅ nix-foundry %s is up to date\n", selfupdate.Version)
+		return nil
+	}
+	if updateCheckOnly {
+		fmt.Printf("⬆️  nix-foundry %s is available (installed: %s). Run 'nix-foundry update' to install it.\n", release.Version, selfupdate.Version)
+		return nil
+	}
+
+	executable, exeErr := os.Executable()
+	if exeErr != nil {
+		return fmt.Errorf("failed to locate the nix-foundry binary: %w", exeErr)
+	}
+	if resolved, resolveErr := filepath.EvalSymlinks(executable); resolveErr == nil {
+		executable = resolved
+	}
+
+	fmt.Printf("Updating nix-foundry %s to %s...\n", selfupdate.Version, release.Version)
+	if updateErr := updater.Update(cmd.Context(), release, executable); updateErr != nil {
+		return fmt.Errorf("failed to update nix-foundry: %w", updateErr)
+	}
+	fmt.Printf("✨ nix-foundry updated to %s\n", release.Version)
+	return nil
+}
+
+/*
+checkForUpdate tells the user when a newer release is available. It only runs
+when settings.autoUpdate is enabled, at most once per settings.updateInterval,
+and never for the update command itself or development builds. Failures are
+only logged, since the check must not get in the way of the command.
+*/
+func checkForUpdate(cmd *cobra.Command) {
+	if cmd == updateCmd || selfupdate.Version == "dev" {
+		return
+	}
+
+	activeConfig, configErr := config.GetConfigService().GetActiveConfig()
+	if configErr != nil || !activeConfig.Settings.AutoUpdate {
+		return
+	}
+	now := time.Now()
+	if !selfupdate.CheckDue(activeConfig.Settings.UpdateInterval, now) {
+		return
+	}
+	if recordErr := selfupdate.RecordCheck(now); recordErr != nil {
+		logging.Debug("failed to record update check", "error", recordErr)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), startupCheckTimeout)
+	defer cancel()
+	release, latestErr := selfupdate.NewUpdater().Latest(ctx)
+	if latestErr != nil {
+		logging.Debug("update check failed", "error", latestErr)
+		return
+	}
+	if release.IsNewer() {
+		fmt.Fprintf(os.Stderr, "⬆️  nix-foundry %s is available (installed: %s). Run 'nix-foundry update' to install it.\n", release.Version, selfupdate.Version)
+	}
+}
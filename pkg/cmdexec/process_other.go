@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cmdexec
+
+import "os/exec"
+
+/*
+configureProcess leaves cancellation to exec.CommandContext, which kills the
+command on platforms without process groups.
+*/
+func configureProcess(*exec.Cmd, bool) {}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package cmdexec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+/*
+configureProcess arranges for a cancelled command to receive SIGINT, the same
+signal the user would send with Ctrl+C. Without a terminal, commands run in their
+own process group so the signal also reaches any processes they started, such as
+nix builders spawned by a shell. At a terminal they stay in the foreground group
+so that they can still prompt, for example for a sudo password, and Ctrl+C
+reaches them directly.
+*/
+func configureProcess(cmd *exec.Cmd, interactive bool) {
+	if !interactive {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		if !interactive {
+			if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGINT); err == nil {
+				return nil
+			}
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Package cmdexec provides an abstraction over external command execution.
+Services run commands through the Runner interface so that tests can
+substitute a fake implementation instead of invoking real binaries.
+*/
+package cmdexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+/*
+waitDelay is how long a cancelled command is given to exit after being
+interrupted before it is killed.
+*/
+const waitDelay = 10 * time.Second
+
+/*
+outputTailSize is the number of trailing bytes of a command's output that are
+kept for error messages.
+*/
+const outputTailSize = 4096
+
+/*
+Runner executes external commands.
+Run streams the command's output to the terminal, while Output captures
+and returns the command's standard output.
+*/
+type Runner interface {
+	Run(name string, args ...string) error
+	Output(name string, args ...string) ([]byte, error)
+}
+
+/*
+baseContext is the context commands run under unless a runner was given its own
+with WithContext. The root command replaces it with a context that is cancelled
+on SIGINT and SIGTERM.
+*/
+var baseContext atomic.Pointer[context.Context]
+
+/*
+SetContext sets the context that runners without their own context use for every
+command. Cancelling it interrupts all running commands.
+*/
+func SetContext(ctx context.Context) {
+	baseContext.Store(&ctx)
+}
+
+/*
+Context returns the context set with SetContext, or context.Background if none
+was set. Work other than commands, such as downloads, can use it to stop when
+the program is interrupted.
+*/
+func Context() context.Context {
+	if base := baseContext.Load(); base != nil {
+		return *base
+	}
+	return context.Background()
+}
+
+/*
+OSRunner implements Runner using the os/exec package.
+Streamed output goes to the terminal unless the runner was created with WithOutput.
+Commands are interrupted when the runner's context is cancelled or, if a timeout
+is set, when the command runs for longer than the timeout.
+*/
+type OSRunner struct {
+	out     io.Writer
+	ctx     context.Context
+	timeout time.Duration
+}
+
+/*
+NewOSRunner creates a new runner that executes commands on the host system.
+*/
+func NewOSRunner() Runner {
+	return &OSRunner{}
+}
+
+/*
+Error is returned when a command fails. Output holds the end of what the command
+printed, so that the cause of a failure is part of the error message, and Stderr
+holds the end of its standard error alone. ExitCode is -1 if the command did not
+exit normally.
+*/
+type Error struct {
+	Command  string
+	Output   string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%s: %v", e.Command, e.Err)
+	if output := strings.TrimSpace(e.Output); output != "" {
+		message += "\n" + output
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+/*
+Run executes the command with stdout and stderr attached to the terminal.
+*/
+func (r *OSRunner) Run(name string, args ...string) error {
+	ctx, cancel := r.commandContext()
+	defer cancel()
+
+	tail, stderrTail := &tailBuffer{}, &tailBuffer{}
+	cmd := r.command(ctx, name, args)
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if r.out != nil {
+		stdout, stderr = r.out, r.out
+	}
+	cmd.Stdout = io.MultiWriter(stdout, tail)
+	cmd.Stderr = io.MultiWriter(stderr, tail, stderrTail)
+
+	return r.wrapError(ctx, name, args, cmd.Run(), tail, stderrTail)
+}
+
+/*
+Output executes the command and returns its standard output.
+Standard error is forwarded to the terminal.
+*/
+func (r *OSRunner) Output(name string, args ...string) ([]byte, error) {
+	ctx, cancel := r.commandContext()
+	defer cancel()
+
+	tail := &tailBuffer{}
+	cmd := r.command(ctx, name, args)
+	stderr := io.Writer(os.Stderr)
+	if r.out != nil {
+		stderr = r.out
+	}
+	cmd.Stderr = io.MultiWriter(stderr, tail)
+
+	output, err := cmd.Output()
+	return output, r.wrapError(ctx, name, args, err, tail, tail)
+}
+
+/*
+WithOutput returns a copy of the runner that writes streamed output to w.
+*/
+func (r *OSRunner) WithOutput(w io.Writer) Runner {
+	clone := *r
+	clone.out = w
+	return &clone
+}
+
+/*
+WithContext returns a copy of the runner that runs commands under ctx.
+*/
+func (r *OSRunner) WithContext(ctx context.Context) Runner {
+	clone := *r
+	clone.ctx = ctx
+	return &clone
+}
+
+/*
+WithTimeout returns a copy of the runner that interrupts each command after d.
+A zero duration disables the timeout.
+*/
+func (r *OSRunner) WithTimeout(d time.Duration) Runner {
+	clone := *r
+	clone.timeout = d
+	return &clone
+}
+
+/*
+commandContext returns the context for a single command, applying the timeout.
+*/
+func (r *OSRunner) commandContext() (context.Context, context.CancelFunc) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = Context()
+	}
+
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+/*
+command creates the exec.Cmd for name. Cancelling ctx interrupts the command and,
+where supported, every process it started; it is killed if it has not exited
+after waitDelay.
+*/
+func (r *OSRunner) command(ctx context.Context, name string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = waitDelay
+	configureProcess(cmd, isTerminal(os.Stdin))
+	return cmd
+}
+
+/*
+wrapError turns a failed command into an *Error, reporting timeouts and
+cancellation instead of the signal that ended the command.
+*/
+func (r *OSRunner) wrapError(ctx context.Context, name string, args []string, err error, tail, stderrTail *tailBuffer) error {
+	if err == nil {
+		return nil
+	}
+
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("timed out after %s: %w", r.timeout, context.DeadlineExceeded)
+	case errors.Is(ctx.Err(), context.Canceled):
+		err = fmt.Errorf("interrupted: %w", context.Canceled)
+	}
+
+	return &Error{
+		Command:  strings.Join(append([]string{name}, args...), " "),
+		Output:   tail.String(),
+		Stderr:   stderrTail.String(),
+		ExitCode: exitCode,
+		Err:      err,
+	}
+}
+
+/*
+isTerminal reports whether f is attached to a terminal.
+*/
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+/*
+tailBuffer keeps the last outputTailSize bytes written to it.
+*/
+type tailBuffer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > outputTailSize {
+		b.data = b.data[len(b.data)-outputTailSize:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
+
+/*
+WithOutput returns a runner that writes the streamed output of runner to w
+instead of the terminal. Runners that do not support redirecting their output
+are returned unchanged.
+*/
+func WithOutput(runner Runner, w io.Writer) Runner {
+	if redirectable, ok := runner.(interface{ WithOutput(io.Writer) Runner }); ok {
+		return redirectable.WithOutput(w)
+	}
+	return runner
+}
+
+/*
+WithContext returns a runner that runs the commands of runner under ctx.
+Runners that do not support contexts are returned unchanged.
+*/
+func WithContext(runner Runner, ctx context.Context) Runner {
+	if contextual, ok := runner.(interface {
+		WithContext(context.Context) Runner
+	}); ok {
+		return contextual.WithContext(ctx)
+	}
+	return runner
+}
+
+/*
+WithTimeout returns a runner that interrupts each command of runner after d.
+Runners that do not support timeouts are returned unchanged.
+*/
+func WithTimeout(runner Runner, d time.Duration) Runner {
+	if bounded, ok := runner.(interface {
+		WithTimeout(time.Duration) Runner
+	}); ok {
+		return bounded.WithTimeout(d)
+	}
+	return runner
+}
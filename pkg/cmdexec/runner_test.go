@@ -0,0 +1,55 @@
+//go:build unix
+
+package cmdexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOSRunnerTimeout(t *testing.T) {
+	var out bytes.Buffer
+	runner := WithTimeout(WithOutput(NewOSRunner(), &out), 200*time.Millisecond)
+
+	start := time.Now()
+	err := runner.Run("sh", "-c", "echo starting build; sleep 30")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() returned after %s, expected the command to be interrupted", elapsed)
+	}
+	if !strings.Contains(err.Error(), "timed out after 200ms") || !strings.Contains(err.Error(), "starting build") {
+		t.Errorf("expected the timeout and command output in the error, got %q", err)
+	}
+	if !strings.Contains(out.String(), "starting build") {
+		t.Errorf("expected output to still be streamed, got %q", out.String())
+	}
+}
+
+func TestOSRunnerContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := WithContext(NewOSRunner(), ctx)
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err := runner.Output("sh", "-c", "sleep 30")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Output() error = %v, want a cancellation error", err)
+	}
+}
+
+func TestOSRunnerErrorIncludesOutput(t *testing.T) {
+	_, err := WithOutput(NewOSRunner(), &bytes.Buffer{}).Output("sh", "-c", "echo 'error: attribute missing' >&2; exit 1")
+
+	var cmdErr *Error
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Output() error = %v, want *Error", err)
+	}
+	if !strings.Contains(cmdErr.Stderr, "attribute missing") || cmdErr.ExitCode != 1 || !strings.HasPrefix(cmdErr.Command, "sh -c") {
+		t.Errorf("unexpected error details: %+v", cmdErr)
+	}
+}
@@ -0,0 +1,500 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	bundleManifestName  = "manifest.json"
+	bundleFormatVersion = 2
+
+	// checksummedBundleFormat is the first bundle format whose manifest records
+	// the checksums of the files in the bundle.
+	checksummedBundleFormat = 2
+
+	// maxBundleFileSize and maxBundleSize bound how much of a bundle is read into
+	// memory, so that a corrupt or hostile bundle cannot exhaust it.
+	maxBundleFileSize = 10 << 20
+	maxBundleSize     = 32 << 20
+)
+
+/*
+BundleManifest describes the contents of a configuration bundle and the machine
+it was exported from. Dotfiles lists the dotfiles included with the
+configurations, and MissingDotfiles those that were asked for but did not exist.
+Checksums maps each of those files to the SHA-256 of its content, so a bundle
+that was corrupted or altered after export is rejected on import.
+*/
+type BundleManifest struct {
+	FormatVersion   int               `json:"formatVersion"`
+	ConfigVersion   string            `json:"configVersion"`
+	Platform        string            `json:"platform"`
+	System          string            `json:"system"`
+	HomeDir         string            `json:"homeDir"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Files           []string          `json:"files"`
+	Dotfiles        []BundleDotfile   `json:"dotfiles,omitempty"`
+	MissingDotfiles []string          `json:"missingDotfiles,omitempty"`
+	Checksums       map[string]string `json:"checksums,omitempty"`
+}
+
+/*
+ExportBundle packages the user configuration and all team configurations into a
+single tar.gz at bundlePath, together with a manifest describing the source machine.
+When the user configuration sets bundle.includeDotfiles, its shell configuration
+file and bundle dotfiles are added under dotfiles/.
+*/
+func (s *Service) ExportBundle(bundlePath string) error {
+	configPath, pathErr := schema.GetConfigPath()
+	if pathErr != nil {
+		return fmt.Errorf("failed to get config path: %w", pathErr)
+	}
+	configDir := filepath.Dir(configPath)
+
+	if !s.fs.Exists(configPath) {
+		return fmt.Errorf("no user configuration found at %s", configPath)
+	}
+
+	files := []string{"config.yaml"}
+	teamsDir := filepath.Join(configDir, "teams")
+	if s.fs.Exists(teamsDir) {
+		entries, readDirErr := s.fs.ReadDir(teamsDir)
+		if readDirErr != nil {
+			return fmt.Errorf("failed to read teams directory: %w", readDirErr)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
+				files = append(files, path.Join("teams", entry.Name()))
+			}
+		}
+	}
+
+	homeDir, homeErr := platform.GetRealUserHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+
+	contents := make(map[string][]byte, len(files))
+	for _, name := range files {
+		content, readErr := s.fs.ReadFile(filepath.Join(configDir, filepath.FromSlash(name)))
+		if readErr != nil {
+			return fmt.Errorf("failed to read %s: %w", name, readErr)
+		}
+		contents[name] = content
+	}
+
+	userConfig := &schema.Config{}
+	if unmarshalErr := yaml.Unmarshal(contents["config.yaml"], userConfig); unmarshalErr != nil {
+		return fmt.Errorf("failed to parse user config: %w", unmarshalErr)
+	}
+
+	dotfiles, missingDotfiles, dotfileContents, dotfilesErr := s.bundleDotfiles(userConfig, homeDir)
+	if dotfilesErr != nil {
+		return dotfilesErr
+	}
+
+	manifest := BundleManifest{
+		FormatVersion:   bundleFormatVersion,
+		ConfigVersion:   userConfig.Version,
+		Platform:        string(platform.GetPlatform()),
+		System:          platform.GetNixSystem(),
+		HomeDir:         homeDir,
+		CreatedAt:       time.Now().UTC(),
+		Files:           files,
+		Dotfiles:        dotfiles,
+		MissingDotfiles: missingDotfiles,
+		Checksums:       make(map[string]string, len(files)+len(dotfiles)),
+	}
+	for _, name := range files {
+		manifest.Checksums[name] = bundleChecksum(contents[name])
+	}
+	for _, dotfile := range dotfiles {
+		manifest.Checksums[dotfile.Name] = bundleChecksum(dotfileContents[dotfile.Name])
+	}
+	manifestContent, marshalErr := json.MarshalIndent(manifest, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode manifest: %w", marshalErr)
+	}
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	addFile := func(name string, content []byte) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: manifest.CreatedAt,
+		}
+		if headerErr := tarWriter.WriteHeader(header); headerErr != nil {
+			return headerErr
+		}
+		_, writeErr := tarWriter.Write(content)
+		return writeErr
+	}
+
+	if addErr := addFile(bundleManifestName, manifestContent); addErr != nil {
+		return fmt.Errorf("failed to write bundle: %w", addErr)
+	}
+	for _, name := range files {
+		if addErr := addFile(name, contents[name]); addErr != nil {
+			return fmt.Errorf("failed to write bundle: %w", addErr)
+		}
+	}
+	for _, dotfile := range dotfiles {
+		if addErr := addFile(dotfile.Name, dotfileContents[dotfile.Name]); addErr != nil {
+			return fmt.Errorf("failed to write bundle: %w", addErr)
+		}
+	}
+
+	if closeErr := tarWriter.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write bundle: %w", closeErr)
+	}
+	if closeErr := gzipWriter.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write bundle: %w", closeErr)
+	}
+
+	if writeErr := s.fs.WriteFile(bundlePath, buf.Bytes(), 0600); writeErr != nil {
+		return fmt.Errorf("failed to write bundle: %w", writeErr)
+	}
+
+	return nil
+}
+
+/*
+ImportBundle restores configurations from a bundle created by ExportBundle.
+Home directory paths recorded on the source machine are rewritten to the current
+user's home directory, and the user configuration is validated after import.
+Existing user and team configurations are only overwritten when force is true.
+Dotfiles in the bundle are not restored; see ImportBundleWithOptions.
+*/
+func (s *Service) ImportBundle(bundlePath string, force bool) error {
+	return s.ImportBundleWithOptions(bundlePath, BundleImportOptions{Force: force})
+}
+
+/*
+ImportBundleWithOptions restores a bundle like ImportBundle, and then restores
+its dotfiles into the home directory as opts describes.
+*/
+func (s *Service) ImportBundleWithOptions(bundlePath string, opts BundleImportOptions) error {
+	content, readErr := s.fs.ReadFile(bundlePath)
+	if readErr != nil {
+		return fmt.Errorf("failed to read bundle: %w", readErr)
+	}
+
+	manifest, files, extractErr := readBundle(content)
+	if extractErr != nil {
+		return extractErr
+	}
+
+	configPath, pathErr := schema.GetConfigPath()
+	if pathErr != nil {
+		return fmt.Errorf("failed to get config path: %w", pathErr)
+	}
+	configDir := filepath.Dir(configPath)
+
+	for _, name := range manifest.Files {
+		target := filepath.Join(configDir, filepath.FromSlash(name))
+		if s.fs.Exists(target) && !opts.Force {
+			return fmt.Errorf("configuration already exists at %s; use --force to overwrite it", target)
+		}
+	}
+
+	homeDir, homeErr := platform.GetRealUserHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+
+	if manifest.System != platform.GetNixSystem() {
+		fmt.Printf("Note: Bundle was exported on %s and is being imported on %s\n", manifest.System, platform.GetNixSystem())
+	}
+
+	userConfig := &schema.Config{}
+	for _, name := range manifest.Files {
+		data := rewriteHomeDir(files[name], manifest.HomeDir, homeDir)
+		files[name] = data
+
+		parsed, decodeErr := decodeConfig(data, schema.FormatYAML, name)
+		if decodeErr != nil {
+			return fmt.Errorf("invalid configuration %s in bundle: %w", name, decodeErr)
+		}
+		if name == "config.yaml" {
+			userConfig = parsed
+		}
+	}
+
+	if validateErr := schema.ValidateConfig(userConfig); validateErr != nil {
+		return fmt.Errorf("imported configuration is invalid: %w", validateErr)
+	}
+
+	for _, name := range manifest.Files {
+		target := filepath.Join(configDir, filepath.FromSlash(name))
+		if mkdirErr := s.fs.MkdirAll(filepath.Dir(target), 0775); mkdirErr != nil {
+			return fmt.Errorf("failed to create config directory: %w", mkdirErr)
+		}
+		if writeErr := s.fs.AtomicWriteFile(target, files[name], 0664); writeErr != nil {
+			return fmt.Errorf("failed to write %s: %w", name, writeErr)
+		}
+	}
+
+	for _, dotfile := range manifest.Dotfiles {
+		files[dotfile.Name] = rewriteHomeDir(files[dotfile.Name], manifest.HomeDir, homeDir)
+	}
+	return s.restoreDotfiles(manifest, files, homeDir, opts)
+}
+
+/*
+rewriteHomeDir replaces the home directory from with to in data wherever it is a
+whole path: followed by a slash, a quote, whitespace, a YAML or PATH separator,
+or the end of data. Paths that only start with from, such as /home/alice when
+from is /home/al, are left alone.
+*/
+func rewriteHomeDir(data []byte, from, to string) []byte {
+	if from == "" || from == to {
+		return data
+	}
+
+	var out bytes.Buffer
+	rest := data
+	for {
+		idx := bytes.Index(rest, []byte(from))
+		if idx < 0 {
+			out.Write(rest)
+			return out.Bytes()
+		}
+		end := idx + len(from)
+		out.Write(rest[:idx])
+		if end == len(rest) || isHomeDirBoundary(rest[end]) {
+			out.WriteString(to)
+		} else {
+			out.WriteString(from)
+		}
+		rest = rest[end:]
+	}
+}
+
+/*
+isHomeDirBoundary reports whether c can follow a home directory that is a whole
+path rather than the start of a longer name.
+*/
+func isHomeDirBoundary(c byte) bool {
+	switch c {
+	case '/', '"', '\'', ' ', '\t', '\r', '\n', ',', ':', ']', '}':
+		return true
+	}
+	return false
+}
+
+/*
+readBundle extracts the manifest and the configuration files and dotfiles listed
+in it from a bundle. Only config.yaml, teams/<name>.yaml and dotfiles/<path>
+entries are accepted; other entries, including symlinks and directories, are
+skipped without being read. A file larger than maxBundleFileSize, or files
+adding up to more than maxBundleSize, make the bundle invalid.
+*/
+func readBundle(content []byte) (*BundleManifest, map[string][]byte, error) {
+	gzipReader, gzipErr := gzip.NewReader(bytes.NewReader(content))
+	if gzipErr != nil {
+		return nil, nil, fmt.Errorf("invalid bundle: %w", gzipErr)
+	}
+	defer func() { _ = gzipReader.Close() }()
+
+	files := make(map[string][]byte)
+	total := 0
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nil, nil, fmt.Errorf("invalid bundle: %w", nextErr)
+		}
+		if header.Typeflag != tar.TypeReg || (header.Name != bundleManifestName && !isBundleConfigPath(header.Name) && !isBundleDotfilePath(header.Name)) {
+			continue
+		}
+
+		data, readErr := io.ReadAll(io.LimitReader(tarReader, maxBundleFileSize+1))
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("invalid bundle: %w", readErr)
+		}
+		if len(data) > maxBundleFileSize {
+			return nil, nil, fmt.Errorf("invalid bundle: %s is larger than %d MiB", header.Name, maxBundleFileSize>>20)
+		}
+		if total += len(data); total > maxBundleSize {
+			return nil, nil, fmt.Errorf("invalid bundle: contents are larger than %d MiB", maxBundleSize>>20)
+		}
+		files[header.Name] = data
+	}
+
+	manifestContent, ok := files[bundleManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid bundle: missing %s", bundleManifestName)
+	}
+
+	manifest := &BundleManifest{}
+	if jsonErr := json.Unmarshal(manifestContent, manifest); jsonErr != nil {
+		return nil, nil, fmt.Errorf("invalid bundle manifest: %w", jsonErr)
+	}
+	if manifest.FormatVersion > bundleFormatVersion {
+		return nil, nil, fmt.Errorf("bundle format %d is newer than supported format %d; upgrade nix-foundry", manifest.FormatVersion, bundleFormatVersion)
+	}
+
+	for _, name := range manifest.Files {
+		if !isBundleConfigPath(name) {
+			return nil, nil, fmt.Errorf("invalid bundle: unexpected file %q", name)
+		}
+		if _, ok := files[name]; !ok {
+			return nil, nil, fmt.Errorf("invalid bundle: missing %s", name)
+		}
+	}
+	for _, dotfile := range manifest.Dotfiles {
+		if !isBundleDotfilePath(dotfile.Name) {
+			return nil, nil, fmt.Errorf("invalid bundle: unexpected dotfile %q", dotfile.Name)
+		}
+		if _, ok := files[dotfile.Name]; !ok {
+			return nil, nil, fmt.Errorf("invalid bundle: missing %s", dotfile.Name)
+		}
+	}
+	if _, ok := files["config.yaml"]; !ok {
+		return nil, nil, fmt.Errorf("invalid bundle: missing config.yaml")
+	}
+	if checksumErr := verifyBundleChecksums(manifest, files); checksumErr != nil {
+		return nil, nil, checksumErr
+	}
+
+	return manifest, files, nil
+}
+
+/*
+verifyBundleChecksums checks the configuration files and dotfiles listed in the
+manifest against the checksums it records. Bundles in a format from before
+checksums were recorded are accepted without them.
+*/
+func verifyBundleChecksums(manifest *BundleManifest, files map[string][]byte) error {
+	if manifest.FormatVersion < checksummedBundleFormat {
+		return nil
+	}
+	names := append([]string{}, manifest.Files...)
+	for _, dotfile := range manifest.Dotfiles {
+		names = append(names, dotfile.Name)
+	}
+	for _, name := range names {
+		checksum, ok := manifest.Checksums[name]
+		if !ok {
+			return fmt.Errorf("invalid bundle: no checksum for %s", name)
+		}
+		if bundleChecksum(files[name]) != checksum {
+			return fmt.Errorf("invalid bundle: checksum mismatch for %s; the bundle was modified or corrupted after export", name)
+		}
+	}
+	return nil
+}
+
+/*
+bundleChecksum returns the hex-encoded SHA-256 of content.
+*/
+func bundleChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+isBundleConfigPath reports whether name is a configuration path allowed in a bundle.
+*/
+func isBundleConfigPath(name string) bool {
+	if name == "config.yaml" {
+		return true
+	}
+	dir, file := path.Split(name)
+	return dir == "teams/" && strings.HasSuffix(file, ".yaml") && !strings.Contains(file, "..") && file != ".yaml"
+}
+
+/*
+ExportConfig writes the user configuration to exportPath as a single file in the
+given format.
+*/
+func (s *Service) ExportConfig(exportPath string, format schema.Format) error {
+	configPath, pathErr := schema.GetConfigPath()
+	if pathErr != nil {
+		return fmt.Errorf("failed to get config path: %w", pathErr)
+	}
+
+	content, readErr := s.fs.ReadFile(configPath)
+	if readErr != nil {
+		return fmt.Errorf("failed to read user config: %w", readErr)
+	}
+	content, migrateErr := migrateConfigFile(s.fs, configPath, content)
+	if migrateErr != nil {
+		return migrateErr
+	}
+
+	config := &schema.Config{}
+	if unmarshalErr := yaml.Unmarshal(content, config); unmarshalErr != nil {
+		return fmt.Errorf("failed to parse user config: %w", unmarshalErr)
+	}
+
+	output, marshalErr := schema.MarshalConfig(config, format)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode config as %s: %w", format, marshalErr)
+	}
+
+	if writeErr := s.fs.WriteFile(exportPath, output, 0644); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", exportPath, writeErr)
+	}
+	return nil
+}
+
+/*
+ImportConfig reads a single configuration file in the given format, migrates it to
+the current schema version, validates it, and saves it as YAML in the location for
+its type. An existing configuration is only overwritten when force is true.
+*/
+func (s *Service) ImportConfig(importPath string, format schema.Format, force bool) error {
+	content, readErr := s.fs.ReadFile(importPath)
+	if readErr != nil {
+		return fmt.Errorf("failed to read %s: %w", importPath, readErr)
+	}
+
+	config, decodeErr := decodeConfig(content, format, importPath)
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if config.Type == "" {
+		config.Type = schema.UserConfig
+	}
+
+	if validateErr := schema.ValidateConfig(config); validateErr != nil {
+		return fmt.Errorf("imported configuration is invalid: %w", validateErr)
+	}
+
+	if config.Type == schema.TeamConfig && !isBundleConfigPath(path.Join("teams", config.Metadata.Name+".yaml")) {
+		return fmt.Errorf("invalid team name %q", config.Metadata.Name)
+	}
+
+	configPath, pathErr := configPathFor(config)
+	if pathErr != nil {
+		return pathErr
+	}
+	if s.fs.Exists(configPath) && !force {
+		return fmt.Errorf("configuration already exists at %s; use --force to overwrite it", configPath)
+	}
+
+	return s.SaveConfig(config)
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	service, sourceHome := newTestService(t)
+
+	configDir := filepath.Join(sourceHome, ".config", "nix-foundry")
+	writeTestFile(t, filepath.Join(configDir, "config.yaml"), "type: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\nmetadata:\n  description: "+sourceHome+"/dotfiles\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), "type: team\nmetadata:\n  name: platform\nnix:\n  packages:\n    core: [kubectl]\n")
+
+	bundlePath := filepath.Join(t.TempDir(), "env.tar.gz")
+	if err := service.ExportBundle(bundlePath); err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+
+	targetHome := t.TempDir()
+	t.Setenv("HOME", targetHome)
+	if err := service.ImportBundle(bundlePath, false); err != nil {
+		t.Fatalf("ImportBundle() error = %v", err)
+	}
+
+	imported, err := os.ReadFile(filepath.Join(targetHome, ".config", "nix-foundry", "config.yaml"))
+	if err != nil {
+		t.Fatalf("user config not imported: %v", err)
+	}
+	if !strings.Contains(string(imported), targetHome+"/dotfiles") || strings.Contains(string(imported), sourceHome) {
+		t.Errorf("home directory not rewritten:\n%s", imported)
+	}
+
+	if _, err := os.Stat(filepath.Join(targetHome, ".config", "nix-foundry", "teams", "platform.yaml")); err != nil {
+		t.Errorf("team config not imported: %v", err)
+	}
+
+	if err := service.ImportBundle(bundlePath, false); err == nil {
+		t.Error("expected import to refuse overwriting an existing config without force")
+	}
+
+	teamPath := filepath.Join(targetHome, ".config", "nix-foundry", "teams", "platform.yaml")
+	if err := os.Remove(filepath.Join(targetHome, ".config", "nix-foundry", "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, teamPath, "type: team\nmetadata:\n  name: platform\n")
+	if err := service.ImportBundle(bundlePath, false); err == nil || !strings.Contains(err.Error(), teamPath) {
+		t.Errorf("ImportBundle() error = %v, want a refusal to overwrite %s", err, teamPath)
+	}
+	if content, _ := os.ReadFile(teamPath); string(content) != "type: team\nmetadata:\n  name: platform\n" {
+		t.Errorf("team config was overwritten without force:\n%s", content)
+	}
+
+	if err := service.ImportBundle(bundlePath, true); err != nil {
+		t.Errorf("ImportBundle() with force error = %v", err)
+	}
+}
+
+func TestRewriteHomeDir(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "path below home", data: "dir: /home/al/dotfiles\n", want: "dir: /Users/al/dotfiles\n"},
+		{name: "home itself", data: "home: /home/al\n", want: "home: /Users/al\n"},
+		{name: "quoted", data: `dir: "/home/al"`, want: `dir: "/Users/al"`},
+		{name: "end of data", data: "/home/al", want: "/Users/al"},
+		{name: "flow sequence", data: "[/home/al, /home/al/bin]", want: "[/Users/al, /Users/al/bin]"},
+		{name: "PATH list", data: "PATH=/home/al/bin:/home/al:/usr/bin", want: "PATH=/Users/al/bin:/Users/al:/usr/bin"},
+		{name: "other user with the same prefix", data: "dir: /home/alice/dotfiles\n", want: "dir: /home/alice/dotfiles\n"},
+		{name: "longer name", data: "/home/al.bak and /home/al/x", want: "/home/al.bak and /Users/al/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(rewriteHomeDir([]byte(tt.data), "/home/al", "/Users/al")); got != tt.want {
+				t.Errorf("rewriteHomeDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportBundleRejectsInvalidConfig(t *testing.T) {
+	service, home := newTestService(t)
+
+	configPath := filepath.Join(home, ".config", "nix-foundry", "config.yaml")
+	writeTestFile(t, configPath, "type: user\n")
+
+	bundlePath := filepath.Join(t.TempDir(), "env.tar.gz")
+	if err := service.ExportBundle(bundlePath); err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+
+	if err := os.Remove(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ImportBundle(bundlePath, false); err == nil {
+		t.Fatal("expected validation error for config without a shell")
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Error("invalid config should not be written")
+	}
+}
+
+func TestIsBundleConfigPath(t *testing.T) {
+	tests := map[string]bool{
+		"config.yaml":          true,
+		"teams/platform.yaml":  true,
+		"teams/../config.yaml": false,
+		"../config.yaml":       false,
+		"/etc/passwd":          false,
+		"teams/sub/team.yaml":  false,
+		"manifest.json":        false,
+	}
+	for name, want := range tests {
+		if got := isBundleConfigPath(name); got != want {
+			t.Errorf("isBundleConfigPath(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+/*
+bundleEntry is a tar entry of a hand-built bundle. Entries with a Linkname are
+written as symlinks.
+*/
+type bundleEntry struct {
+	name     string
+	content  []byte
+	linkname string
+}
+
+func buildBundle(t *testing.T, manifestFiles []string, entries ...bundleEntry) []byte {
+	t.Helper()
+	checksums := make(map[string]string)
+	for _, entry := range entries {
+		checksums[entry.name] = bundleChecksum(entry.content)
+	}
+	manifest, err := json.Marshal(BundleManifest{FormatVersion: bundleFormatVersion, Files: manifestFiles, Checksums: checksums})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append([]bundleEntry{{name: bundleManifestName, content: manifest}}, entries...)
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.linkname != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Linkname: entry.linkname, Typeflag: tar.TypeSymlink}
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write(entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadBundleRejectsHostileArchives(t *testing.T) {
+	config := []byte("type: user\nsettings:\n  shell: zsh\n")
+	large := bytes.Repeat([]byte("#"), maxBundleFileSize-1)
+
+	tests := []struct {
+		name    string
+		bundle  []byte
+		wantErr string
+	}{
+		{
+			name:    "path traversal",
+			bundle:  buildBundle(t, []string{"config.yaml", "../../.ssh/authorized_keys"}, bundleEntry{name: "config.yaml", content: config}, bundleEntry{name: "../../.ssh/authorized_keys", content: []byte("ssh-ed25519 AAAA")}),
+			wantErr: "unexpected file",
+		},
+		{
+			name:    "absolute path",
+			bundle:  buildBundle(t, []string{"config.yaml", "/etc/profile"}, bundleEntry{name: "config.yaml", content: config}, bundleEntry{name: "/etc/profile", content: []byte("export EVIL=1")}),
+			wantErr: "unexpected file",
+		},
+		{
+			name:    "symlink in place of a config",
+			bundle:  buildBundle(t, []string{"config.yaml"}, bundleEntry{name: "config.yaml", linkname: "/etc/passwd"}),
+			wantErr: "missing config.yaml",
+		},
+		{
+			name:    "oversized file",
+			bundle:  buildBundle(t, []string{"config.yaml"}, bundleEntry{name: "config.yaml", content: append(large, "##"...)}),
+			wantErr: "larger than",
+		},
+		{
+			name: "decompression bomb",
+			bundle: buildBundle(t, []string{"config.yaml"},
+				bundleEntry{name: "config.yaml", content: config},
+				bundleEntry{name: "teams/a.yaml", content: large},
+				bundleEntry{name: "teams/b.yaml", content: large},
+				bundleEntry{name: "teams/c.yaml", content: large},
+				bundleEntry{name: "teams/d.yaml", content: large}),
+			wantErr: "contents are larger than",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readBundle(tt.bundle); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readBundle() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	manifest, files, err := readBundle(buildBundle(t, []string{"config.yaml"}, bundleEntry{name: "config.yaml", content: config}, bundleEntry{name: "notes.txt", content: []byte("ignored")}))
+	if err != nil {
+		t.Fatalf("readBundle() error = %v", err)
+	}
+	if len(manifest.Files) != 1 || files["notes.txt"] != nil {
+		t.Errorf("files = %v, want entries outside the allowed paths skipped", files)
+	}
+}
+
+func TestReadBundleVerifiesChecksums(t *testing.T) {
+	config := []byte("type: user\nsettings:\n  shell: zsh\n")
+	tampered := []byte("type: user\nsettings:\n  shell: bash\n")
+
+	writeBundle := func(manifest BundleManifest, content []byte) []byte {
+		manifestContent, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		tarWriter := tar.NewWriter(gzipWriter)
+		for name, data := range map[string][]byte{bundleManifestName: manifestContent, "config.yaml": content} {
+			if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tarWriter.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tarWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gzipWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	manifest := BundleManifest{FormatVersion: bundleFormatVersion, Files: []string{"config.yaml"}, Checksums: map[string]string{"config.yaml": bundleChecksum(config)}}
+	if _, _, err := readBundle(writeBundle(manifest, config)); err != nil {
+		t.Errorf("readBundle() error = %v", err)
+	}
+	if _, _, err := readBundle(writeBundle(manifest, tampered)); err == nil || !strings.Contains(err.Error(), "checksum mismatch for config.yaml") {
+		t.Errorf("readBundle() of a tampered bundle error = %v, want a checksum mismatch", err)
+	}
+
+	unchecked := BundleManifest{FormatVersion: bundleFormatVersion, Files: []string{"config.yaml"}}
+	if _, _, err := readBundle(writeBundle(unchecked, config)); err == nil || !strings.Contains(err.Error(), "no checksum") {
+		t.Errorf("readBundle() without checksums error = %v, want it rejected", err)
+	}
+
+	legacy := BundleManifest{FormatVersion: 1, Files: []string{"config.yaml"}}
+	if _, _, err := readBundle(writeBundle(legacy, config)); err != nil {
+		t.Errorf("readBundle() of a format 1 bundle error = %v, want it accepted without checksums", err)
+	}
+}
+
+func TestExportImportConfigFormats(t *testing.T) {
+	service, sourceHome := newTestService(t)
+	writeTestFile(t, filepath.Join(sourceHome, ".config", "nix-foundry", "config.yaml"),
+		"version: 1.0.0\ntype: user\nsettings:\n  shell: zsh\n  updateInterval: 24h\nnix:\n  manager: nix-env\n  packages:\n    core: [git, nodejs@20]\n")
+
+	exportDir := t.TempDir()
+
+	var imported []string
+	for _, name := range []string{"config.yaml", "config.json", "config.toml"} {
+		t.Setenv("HOME", sourceHome)
+		exportPath := filepath.Join(exportDir, name)
+		format, err := schema.FormatFromPath(exportPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := service.ExportConfig(exportPath, format); err != nil {
+			t.Fatalf("ExportConfig(%s) error = %v", name, err)
+		}
+
+		targetHome := t.TempDir()
+		t.Setenv("HOME", targetHome)
+		if err := service.ImportConfig(exportPath, format, false); err != nil {
+			t.Fatalf("ImportConfig(%s) error = %v", name, err)
+		}
+		if err := service.ImportConfig(exportPath, format, false); err == nil {
+			t.Errorf("ImportConfig(%s) overwrote an existing config without force", name)
+		}
+
+		content, err := os.ReadFile(filepath.Join(targetHome, ".config", "nix-foundry", "config.yaml"))
+		if err != nil {
+			t.Fatalf("config not imported from %s: %v", name, err)
+		}
+		imported = append(imported, string(content))
+	}
+
+	for idx := 1; idx < len(imported); idx++ {
+		if imported[idx] != imported[0] {
+			t.Errorf("import produced different YAML:\n%s\nwant:\n%s", imported[idx], imported[0])
+		}
+	}
+	if !strings.Contains(imported[0], "- nodejs@20") {
+		t.Errorf("imported config lost packages:\n%s", imported[0])
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+ConflictError is returned by apply when the configured packages cannot be
+installed together.
+*/
+type ConflictError struct {
+	Conflicts []packages.Conflict
+}
+
+func (e *ConflictError) Error() string {
+	lines := make([]string, 0, len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		lines = append(lines, "  "+conflict.String())
+	}
+	return "conflicting packages; remove all but one of each:\n" + strings.Join(lines, "\n")
+}
+
+/*
+packageConflicts returns the conflicts among the packages configured in p: the
+core and optional packages, those of enabled groups, and pinned packages.
+*/
+func packageConflicts(p schema.Packages) ([]packages.Conflict, error) {
+	var names []string
+	for _, pinned := range p.Pinned {
+		names = append(names, pinned.Name)
+	}
+	names = mergeNames(mergeNames(p.Core, p.Optional), mergeNames(p.EnabledPackages(), names))
+	return packages.DetectConflicts(names)
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+/*
+bundleDotfilesDir is the directory of a bundle that dotfiles are stored under,
+by their path relative to the home directory.
+*/
+const bundleDotfilesDir = "dotfiles/"
+
+/*
+DotfileMode decides how dotfiles in a bundle are restored on import.
+*/
+type DotfileMode string
+
+const (
+	// DotfilesSkip leaves the dotfiles on this machine untouched.
+	DotfilesSkip DotfileMode = "skip"
+	// DotfilesOverwrite replaces dotfiles with their content from the bundle.
+	DotfilesOverwrite DotfileMode = "overwrite"
+	// DotfilesMerge writes dotfiles that do not exist yet and only updates the
+	// nix-foundry managed block of those that do.
+	DotfilesMerge DotfileMode = "merge"
+)
+
+/*
+ParseDotfileMode parses the value of the --dotfiles flag.
+*/
+func ParseDotfileMode(value string) (DotfileMode, error) {
+	switch mode := DotfileMode(value); mode {
+	case DotfilesSkip, DotfilesOverwrite, DotfilesMerge:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid dotfiles mode %q (valid options: skip, overwrite, merge)", value)
+}
+
+/*
+BundleDotfile is a dotfile stored in a bundle: its name in the bundle and its
+path on the machine it was exported from.
+*/
+type BundleDotfile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+/*
+DotfileChange describes a dotfile about to be restored from a bundle, for the
+user to confirm.
+*/
+type DotfileChange struct {
+	Path     string
+	Exists   bool
+	Existing []byte
+	Content  []byte
+}
+
+/*
+Diff returns the lines removed from and added to the dotfile, prefixed with "-"
+and "+".
+*/
+func (c DotfileChange) Diff() []string {
+	return lineDiff(string(c.Existing), string(c.Content))
+}
+
+/*
+BundleImportOptions controls how ImportBundleWithOptions restores a bundle.
+Force overwrites an existing user configuration. Dotfiles decides how the
+dotfiles in the bundle are restored and defaults to DotfilesSkip.
+ConfirmDotfile, if set, is asked before each dotfile is written and the dotfile
+is skipped unless it returns true.
+*/
+type BundleImportOptions struct {
+	Force          bool
+	Dotfiles       DotfileMode
+	ConfirmDotfile func(DotfileChange) bool
+}
+
+/*
+bundleDotfiles reads the dotfiles config asks to export: the configuration file
+of its shell and its bundle dotfiles. Dotfiles that do not exist are returned in
+missing instead.
+*/
+func (s *Service) bundleDotfiles(config *schema.Config, homeDir string) (dotfiles []BundleDotfile, missing []string, contents map[string][]byte, err error) {
+	if !config.Bundle.IncludeDotfiles {
+		return nil, nil, nil, nil
+	}
+
+	var paths []string
+	if config.Settings.Shell != "" {
+		rcFile, pathErr := platform.ShellConfigPath(homeDir, config.Settings.Shell)
+		if pathErr != nil {
+			return nil, nil, nil, pathErr
+		}
+		paths = append(paths, rcFile)
+	}
+	for _, dotfile := range config.Bundle.Dotfiles {
+		rel, relErr := schema.DotfilePath(dotfile)
+		if relErr != nil {
+			return nil, nil, nil, relErr
+		}
+		paths = append(paths, filepath.Join(homeDir, filepath.FromSlash(rel)))
+	}
+
+	contents = make(map[string][]byte)
+	for _, dotfilePath := range paths {
+		rel, relErr := filepath.Rel(homeDir, dotfilePath)
+		if relErr != nil {
+			return nil, nil, nil, fmt.Errorf("failed to locate %s in the home directory: %w", dotfilePath, relErr)
+		}
+		name := bundleDotfilesDir + filepath.ToSlash(rel)
+		if _, seen := contents[name]; seen {
+			continue
+		}
+
+		content, readErr := s.fs.ReadFile(dotfilePath)
+		if os.IsNotExist(readErr) {
+			fmt.Printf("Note: %s does not exist and is not included in the bundle\n", dotfilePath)
+			missing = append(missing, dotfilePath)
+			continue
+		}
+		if readErr != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read %s: %w", dotfilePath, readErr)
+		}
+		if len(content) > maxBundleFileSize {
+			return nil, nil, nil, fmt.Errorf("%s is larger than %d MiB and cannot be included in a bundle", dotfilePath, maxBundleFileSize>>20)
+		}
+
+		contents[name] = content
+		dotfiles = append(dotfiles, BundleDotfile{Name: name, Path: dotfilePath})
+	}
+	return dotfiles, missing, contents, nil
+}
+
+/*
+restoreDotfiles writes the dotfiles of a bundle into homeDir as opts describes.
+A dotfile that already exists is backed up to <file>.nix-foundry.bak once, before
+it is first replaced.
+*/
+func (s *Service) restoreDotfiles(manifest *BundleManifest, files map[string][]byte, homeDir string, opts BundleImportOptions) error {
+	for _, missing := range manifest.MissingDotfiles {
+		fmt.Printf("Note: %s did not exist when the bundle was exported\n", missing)
+	}
+	if len(manifest.Dotfiles) == 0 {
+		return nil
+	}
+	if opts.Dotfiles == "" || opts.Dotfiles == DotfilesSkip {
+		fmt.Printf("Note: The bundle contains %d dotfiles; use --dotfiles=merge or --dotfiles=overwrite to restore them\n", len(manifest.Dotfiles))
+		return nil
+	}
+
+	for _, dotfile := range manifest.Dotfiles {
+		target := filepath.Join(homeDir, filepath.FromSlash(strings.TrimPrefix(dotfile.Name, bundleDotfilesDir)))
+		existing, readErr := s.fs.ReadFile(target)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			return fmt.Errorf("failed to read %s: %w", target, readErr)
+		}
+
+		change := DotfileChange{Path: target, Exists: readErr == nil, Existing: existing, Content: files[dotfile.Name]}
+		if change.Exists && opts.Dotfiles == DotfilesMerge {
+			change.Content = mergeDotfile(existing, change.Content)
+		}
+		if change.Exists && bytes.Equal(existing, change.Content) {
+			fmt.Printf("%s is up to date\n", target)
+			continue
+		}
+		if opts.ConfirmDotfile != nil && !opts.ConfirmDotfile(change) {
+			fmt.Printf("Skipped %s\n", target)
+			continue
+		}
+
+		if writeErr := s.writeDotfile(change); writeErr != nil {
+			return writeErr
+		}
+		fmt.Printf("✨ Restored %s\n", target)
+	}
+	return nil
+}
+
+/*
+writeDotfile writes a restored dotfile, keeping the mode of the file it replaces
+and backing that file up first.
+*/
+func (s *Service) writeDotfile(change DotfileChange) error {
+	perm := os.FileMode(0644)
+	if change.Exists {
+		if info, statErr := s.fs.Stat(change.Path); statErr == nil {
+			perm = info.Mode().Perm()
+		}
+		backupFile := change.Path + ".nix-foundry.bak"
+		if !s.fs.Exists(backupFile) {
+			if backupErr := s.fs.WriteFile(backupFile, change.Existing, perm); backupErr != nil {
+				return fmt.Errorf("failed to back up %s: %w", change.Path, backupErr)
+			}
+		}
+	} else if mkdirErr := s.fs.MkdirAll(filepath.Dir(change.Path), 0755); mkdirErr != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", change.Path, mkdirErr)
+	}
+
+	if writeErr := s.fs.WriteFile(change.Path, change.Content, perm); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", change.Path, writeErr)
+	}
+	return nil
+}
+
+/*
+mergeDotfile returns existing with its nix-foundry managed block replaced by the
+one in bundled. Without a managed block in bundled, existing is kept as it is.
+*/
+func mergeDotfile(existing, bundled []byte) []byte {
+	block, ok := shell.ManagedBlock(string(bundled))
+	if !ok {
+		return existing
+	}
+	return []byte(shell.UpsertManagedBlock(string(existing), block))
+}
+
+/*
+isBundleDotfilePath reports whether name is a dotfile path allowed in a bundle.
+*/
+func isBundleDotfilePath(name string) bool {
+	rel, ok := strings.CutPrefix(name, bundleDotfilesDir)
+	if !ok {
+		return false
+	}
+	_, relErr := schema.DotfilePath("~/" + rel)
+	return relErr == nil
+}
+
+/*
+maxDiffCells bounds the work lineDiff does to find the common lines of two
+files; larger files are shown as entirely removed and added.
+*/
+const maxDiffCells = 1 << 20
+
+/*
+lineDiff returns the lines that differ between before and after, removed lines
+prefixed with "- " and added lines with "+ ", in file order.
+*/
+func lineDiff(before, after string) []string {
+	oldLines := splitLines(before)
+	newLines := splitLines(after)
+
+	var diff []string
+	if len(oldLines)*len(newLines) > maxDiffCells {
+		for _, line := range oldLines {
+			diff = append(diff, "- "+line)
+		}
+		for _, line := range newLines {
+			diff = append(diff, "+ "+line)
+		}
+		return diff
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:].
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			i++
+			j++
+		case j < len(newLines) && (i == len(oldLines) || common[i][j+1] >= common[i+1][j]):
+			diff = append(diff, "+ "+newLines[j])
+			j++
+		default:
+			diff = append(diff, "- "+oldLines[i])
+			i++
+		}
+	}
+	return diff
+}
+
+/*
+splitLines splits content into lines without their trailing newlines.
+*/
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+func TestBundleDotfiles(t *testing.T) {
+	service, sourceHome := newTestService(t)
+
+	writeTestFile(t, filepath.Join(sourceHome, ".config", "nix-foundry", "config.yaml"),
+		"type: user\nsettings:\n  shell: zsh\nbundle:\n  includeDotfiles: true\n  dotfiles: [~/.gitconfig, ~/.vimrc]\n")
+	sourceBlock := shell.WrapManagedBlock("export PATH=\"$PATH:" + sourceHome + "/bin\"")
+	writeTestFile(t, filepath.Join(sourceHome, ".zshrc"), "alias gs='git status'\n\n"+sourceBlock)
+	sourceGitconfig := "[user]\n\tname = Tester\n[core]\n\texcludesfile = " + sourceHome + "-shared/ignore\n"
+	writeTestFile(t, filepath.Join(sourceHome, ".gitconfig"), sourceGitconfig)
+
+	bundlePath := filepath.Join(t.TempDir(), "env.tar.gz")
+	if err := service.ExportBundle(bundlePath); err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(bundlePath)
+	manifest, files, err := readBundle(content)
+	if err != nil {
+		t.Fatalf("readBundle() error = %v", err)
+	}
+	wantDotfiles := []BundleDotfile{
+		{Name: "dotfiles/.zshrc", Path: filepath.Join(sourceHome, ".zshrc")},
+		{Name: "dotfiles/.gitconfig", Path: filepath.Join(sourceHome, ".gitconfig")},
+	}
+	if !reflect.DeepEqual(manifest.Dotfiles, wantDotfiles) || len(files) != 4 {
+		t.Errorf("manifest dotfiles = %+v with %d files, want %+v", manifest.Dotfiles, len(files), wantDotfiles)
+	}
+	if !reflect.DeepEqual(manifest.MissingDotfiles, []string{filepath.Join(sourceHome, ".vimrc")}) {
+		t.Errorf("missing dotfiles = %v, want ~/.vimrc noted", manifest.MissingDotfiles)
+	}
+
+	targetHome := t.TempDir()
+	t.Setenv("HOME", targetHome)
+	writeTestFile(t, filepath.Join(targetHome, ".zshrc"), "alias ll='ls -l'\n")
+
+	if err := service.ImportBundle(bundlePath, false); err != nil {
+		t.Fatalf("ImportBundle() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(targetHome, ".gitconfig")); !os.IsNotExist(err) {
+		t.Error("dotfiles restored without --dotfiles")
+	}
+
+	var confirmed []string
+	opts := BundleImportOptions{
+		Force:    true,
+		Dotfiles: DotfilesMerge,
+		ConfirmDotfile: func(change DotfileChange) bool {
+			confirmed = append(confirmed, filepath.Base(change.Path))
+			return true
+		},
+	}
+	if err := service.ImportBundleWithOptions(bundlePath, opts); err != nil {
+		t.Fatalf("ImportBundleWithOptions(merge) error = %v", err)
+	}
+	if !reflect.DeepEqual(confirmed, []string{".zshrc", ".gitconfig"}) {
+		t.Errorf("confirmed %v, want both dotfiles", confirmed)
+	}
+	targetBlock := shell.WrapManagedBlock("export PATH=\"$PATH:" + targetHome + "/bin\"")
+	if got, _ := os.ReadFile(filepath.Join(targetHome, ".zshrc")); string(got) != "alias ll='ls -l'\n\n"+targetBlock {
+		t.Errorf(".zshrc = %q, want the local alias kept and the managed block merged", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(targetHome, ".zshrc.nix-foundry.bak")); string(got) != "alias ll='ls -l'\n" {
+		t.Errorf("backup = %q, want the original .zshrc", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(targetHome, ".gitconfig")); string(got) != sourceGitconfig {
+		t.Errorf(".gitconfig = %q, want paths that only share the home directory's prefix kept", got)
+	}
+
+	opts.Dotfiles = DotfilesOverwrite
+	opts.ConfirmDotfile = func(DotfileChange) bool { return false }
+	if err := service.ImportBundleWithOptions(bundlePath, opts); err != nil {
+		t.Fatalf("ImportBundleWithOptions(overwrite) error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(targetHome, ".zshrc")); string(got) != "alias ll='ls -l'\n\n"+targetBlock {
+		t.Errorf(".zshrc = %q, want it unchanged when the overwrite is declined", got)
+	}
+
+	opts.ConfirmDotfile = nil
+	if err := service.ImportBundleWithOptions(bundlePath, opts); err != nil {
+		t.Fatalf("ImportBundleWithOptions(overwrite) error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(targetHome, ".zshrc")); string(got) != "alias gs='git status'\n\n"+targetBlock {
+		t.Errorf(".zshrc = %q, want the bundled file", got)
+	}
+}
+
+func TestIsBundleDotfilePath(t *testing.T) {
+	tests := map[string]bool{
+		"dotfiles/.zshrc":                   true,
+		"dotfiles/.config/fish/config.fish": true,
+		"dotfiles/../config.yaml":           false,
+		"dotfiles//etc/passwd":              false,
+		"dotfiles/":                         false,
+		"dotfiles/./.zshrc":                 false,
+		".zshrc":                            false,
+	}
+	for name, want := range tests {
+		if got := isBundleDotfilePath(name); got != want {
+			t.Errorf("isBundleDotfilePath(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc\n", "a\nc\nd\n")
+	want := []string{"- b", "+ d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lineDiff() = %v, want %v", got, want)
+	}
+	if got := lineDiff("", "new\n"); !reflect.DeepEqual(got, []string{"+ new"}) {
+		t.Errorf("lineDiff() for a new file = %v, want [+ new]", got)
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+neovimPluginsFile is where the lazy.nvim plugin spec generated from
+editors.neovim.plugins is written, relative to the home directory. Neovim finds
+it as the Lua module nix-foundry.plugins.
+*/
+var neovimPluginsFile = filepath.Join(".config", "nvim", "lua", "nix-foundry", "plugins.lua")
+
+/*
+manageEditors brings the extensions and plugins of the configured editors up to
+date. Editors without configured extensions or plugins are left alone.
+*/
+func (s *Service) manageEditors(editors schema.Editors) error {
+	if validateErr := schema.ValidateEditors(editors); validateErr != nil {
+		return validateErr
+	}
+	if len(editors.VSCode.Extensions) > 0 {
+		if vscodeErr := s.manageVSCodeExtensions(editors.VSCode.Extensions); vscodeErr != nil {
+			return vscodeErr
+		}
+	}
+	if len(editors.Neovim.Plugins) > 0 {
+		if neovimErr := s.writeNeovimPlugins(editors.Neovim.Plugins); neovimErr != nil {
+			return neovimErr
+		}
+	}
+	return nil
+}
+
+/*
+manageVSCodeExtensions installs and uninstalls VS Code extensions so that the
+installed ones match the configured ones. When code is not on the PATH, a
+warning is printed and nothing is changed. Like Homebrew packages, a failed
+installation is reported and skipped, while a failed removal is an error.
+*/
+func (s *Service) manageVSCodeExtensions(extensions []string) error {
+	code := packages.NewVSCode(s.runner)
+	if !code.Available() {
+		fmt.Println("⚠️  The code command is not on your PATH, skipping VS Code extensions")
+		return nil
+	}
+
+	installed, listErr := code.ListExtensions()
+	if listErr != nil {
+		return listErr
+	}
+	diff := schema.DiffExtensions(installed, extensions)
+
+	for _, id := range diff.ToRemove {
+		fmt.Printf("Removing VS Code extension: %s\n", id)
+		if removeErr := code.UninstallExtension(id); removeErr != nil {
+			return fmt.Errorf("failed to remove extension %s: %w", id, removeErr)
+		}
+	}
+	installedCount := 0
+	for _, id := range diff.ToInstall {
+		fmt.Printf("Installing VS Code extension: %s\n", id)
+		if installErr := code.InstallExtension(id); installErr != nil {
+			fmt.Printf("⚠️  Skipping extension %s due to installation failure: %v\n", id, installErr)
+			continue
+		}
+		installedCount++
+	}
+
+	if len(diff.ToInstall)+len(diff.ToRemove) == 0 {
+		fmt.Println("No VS Code extension changes needed")
+	} else {
+		fmt.Printf("VS Code extensions: %d installed, %d removed\n", installedCount, len(diff.ToRemove))
+	}
+	return nil
+}
+
+/*
+writeNeovimPlugins writes the configured plugins as a lazy.nvim plugin spec. The
+file is only rewritten when the plugins change.
+*/
+func (s *Service) writeNeovimPlugins(plugins []string) error {
+	homeDir, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+	pluginsFile := filepath.Join(homeDir, neovimPluginsFile)
+
+	content := neovimPluginSpec(plugins)
+	if existing, readErr := s.fs.ReadFile(pluginsFile); readErr == nil && string(existing) == content {
+		fmt.Println("No Neovim plugin changes needed")
+		return nil
+	}
+
+	if mkdirErr := s.fs.MkdirAll(filepath.Dir(pluginsFile), 0755); mkdirErr != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", pluginsFile, mkdirErr)
+	}
+	if writeErr := s.fs.AtomicWriteFile(pluginsFile, []byte(content), 0644); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", pluginsFile, writeErr)
+	}
+	fmt.Printf("✨ Wrote %d Neovim plugins to %s\n", len(plugins), pluginsFile)
+	fmt.Println(`   Load them with: require("lazy").setup(require("nix-foundry.plugins"))`)
+	return nil
+}
+
+/*
+neovimPluginSpec renders plugins as a Lua module returning a lazy.nvim spec.
+Plugin names are validated by schema.ValidateEditors and need no escaping.
+*/
+func neovimPluginSpec(plugins []string) string {
+	var b strings.Builder
+	b.WriteString("-- Generated by nix-foundry from editors.neovim.plugins. Do not edit.\n")
+	b.WriteString("return {\n")
+	for _, plugin := range plugins {
+		fmt.Fprintf(&b, "  { %q },\n", plugin)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+codeMissing makes a fakeRunner behave as if the code CLI was not installed.
+*/
+var codeMissing = map[string]error{"code --": errors.New("code: command not found")}
+
+func TestManageVSCodeExtensions(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{"code --version": "1.90.0\n", "code --list-extensions": "golang.Go\nms-python.python\n"}}
+	service := &Service{fs: filesystem.NewMemFS(), runner: runner}
+
+	if err := service.manageEditors(schema.Editors{VSCode: schema.VSCode{Extensions: []string{"golang.go", "esbenp.prettier-vscode"}}}); err != nil {
+		t.Fatalf("manageEditors() error = %v", err)
+	}
+	want := []string{"code --version", "code --list-extensions", "code --uninstall-extension ms-python.python", "code --install-extension esbenp.prettier-vscode"}
+	if !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("commands = %v, want %v", runner.commands, want)
+	}
+
+	missing := &fakeRunner{failures: codeMissing}
+	service.runner = missing
+	if err := service.manageEditors(schema.Editors{VSCode: schema.VSCode{Extensions: []string{"golang.go"}}}); err != nil || missing.count("-extension") != 0 {
+		t.Errorf("without code, manageEditors() = %v with commands %v; want it skipped", err, missing.commands)
+	}
+}
+
+func TestWriteNeovimPlugins(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	fs := filesystem.NewMemFS()
+	service := &Service{fs: fs, runner: &fakeRunner{failures: codeMissing}}
+
+	editors := schema.Editors{Neovim: schema.Neovim{Plugins: []string{"nvim-treesitter/nvim-treesitter", "folke/tokyonight.nvim"}}}
+	if err := service.manageEditors(editors); err != nil {
+		t.Fatalf("manageEditors() error = %v", err)
+	}
+	pluginsFile := filepath.Join(home, neovimPluginsFile)
+	content := readMemFile(fs, pluginsFile)
+	for _, want := range []string{`{ "nvim-treesitter/nvim-treesitter" },`, `{ "folke/tokyonight.nvim" },`, "return {\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("plugins.lua missing %q:\n%s", want, content)
+		}
+	}
+
+	if err := service.manageEditors(schema.Editors{Neovim: schema.Neovim{Plugins: []string{"not a plugin"}}}); err == nil {
+		t.Error("expected an error for an invalid plugin")
+	}
+	if readMemFile(fs, pluginsFile) != content {
+		t.Error("plugins.lua changed after an invalid configuration")
+	}
+}
+
+func TestMergeConfigsEditors(t *testing.T) {
+	service := &Service{}
+	team := &schema.Config{Editors: schema.Editors{VSCode: schema.VSCode{Extensions: []string{"golang.go"}}}}
+	user := &schema.Config{Editors: schema.Editors{
+		VSCode: schema.VSCode{Extensions: []string{"esbenp.prettier-vscode", "golang.go"}},
+		Neovim: schema.Neovim{Plugins: []string{"folke/lazy.nvim"}},
+	}}
+
+	merged := service.mergeConfigs(team, user)
+	if !reflect.DeepEqual(merged.Editors.VSCode.Extensions, []string{"esbenp.prettier-vscode", "golang.go"}) {
+		t.Errorf("Extensions = %v, want the team and user extensions", merged.Editors.VSCode.Extensions)
+	}
+	if !reflect.DeepEqual(merged.Editors.Neovim.Plugins, []string{"folke/lazy.nvim"}) {
+		t.Errorf("Plugins = %v", merged.Editors.Neovim.Plugins)
+	}
+}
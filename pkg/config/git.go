@@ -0,0 +1,323 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+/*
+gitInclude is an include in the managed block of the user's gitconfig. Gitdir is
+empty for the unconditional include of the global identity, and is the project
+root, with a trailing slash, for the includeIf of a project identity.
+*/
+type gitInclude struct {
+	gitdir string
+	path   string
+}
+
+/*
+userGitConfig returns the gitconfig nix-foundry adds its includes to: ~/.gitconfig,
+or the XDG gitconfig when only that one exists.
+*/
+func (s *Service) userGitConfig(homeDir string) string {
+	gitconfig := filepath.Join(homeDir, ".gitconfig")
+	if s.fs.Exists(gitconfig) {
+		return gitconfig
+	}
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		xdgConfigHome = filepath.Join(homeDir, ".config")
+	}
+	if xdgGitConfig := filepath.Join(xdgConfigHome, "git", "config"); s.fs.Exists(xdgGitConfig) {
+		return xdgGitConfig
+	}
+	return gitconfig
+}
+
+/*
+manageGit writes the git identity of config to a gitconfig fragment in the config
+directory and includes it from the user's gitconfig inside a managed block, so
+settings the user wrote themselves are never changed. A global identity is
+included unconditionally; a project identity only for repositories in the
+current project, with includeIf. Includes of other projects are kept. Removing
+the identity from the config removes its fragment and include.
+*/
+func (s *Service) manageGit(config *schema.Config) error {
+	homeDir, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+	configDir, dirErr := schema.GetConfigDir()
+	if dirErr != nil {
+		return fmt.Errorf("failed to get config directory: %w", dirErr)
+	}
+
+	gitconfig := s.userGitConfig(homeDir)
+	existing, readErr := s.fs.ReadFile(gitconfig)
+	if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", gitconfig, readErr)
+	}
+	block, _ := shell.ManagedBlock(string(existing))
+	includes := parseGitIncludes(block)
+
+	git := config.Git
+	scope := git.ScopeFor(config.Type)
+
+	globalFragment := filepath.Join(configDir, "gitconfig")
+	switch {
+	case scope == schema.GitScopeGlobal && !git.IsEmpty():
+		if writeErr := s.writeGitFragment(globalFragment, git, ""); writeErr != nil {
+			return writeErr
+		}
+		includes = setGitInclude(includes, gitInclude{path: globalFragment})
+	case config.Type != schema.ProjectConfig:
+		if removeErr := s.removeGitFragment(globalFragment); removeErr != nil {
+			return removeErr
+		}
+		includes = setGitInclude(includes, gitInclude{})
+	}
+
+	if config.Type == schema.ProjectConfig {
+		root, rootErr := os.Getwd()
+		if rootErr != nil {
+			return fmt.Errorf("failed to get project directory: %w", rootErr)
+		}
+		gitdir := strings.TrimSuffix(filepath.ToSlash(root), "/") + "/"
+		projectFragment := filepath.Join(configDir, "git", projectGitFragmentName(gitdir))
+		if scope == schema.GitScopeProject && !git.IsEmpty() {
+			if writeErr := s.writeGitFragment(projectFragment, git, gitdir); writeErr != nil {
+				return writeErr
+			}
+			includes = setGitInclude(includes, gitInclude{gitdir: gitdir, path: projectFragment})
+		} else {
+			if removeErr := s.removeGitFragment(projectFragment); removeErr != nil {
+				return removeErr
+			}
+			includes = setGitInclude(includes, gitInclude{gitdir: gitdir})
+		}
+	}
+
+	var content string
+	if len(includes) == 0 {
+		content = withoutGitIncludes(string(existing))
+	} else {
+		content = shell.UpsertManagedBlock(string(existing), shell.WrapManagedBlock(renderGitIncludes(includes)))
+	}
+	if content == string(existing) {
+		return nil
+	}
+
+	perm := os.FileMode(0644)
+	if info, statErr := s.fs.Stat(gitconfig); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	if readErr == nil {
+		backupFile := gitconfig + ".nix-foundry.bak"
+		if !s.fs.Exists(backupFile) {
+			if backupErr := s.fs.WriteFile(backupFile, existing, perm); backupErr != nil {
+				return fmt.Errorf("failed to back up %s: %w", gitconfig, backupErr)
+			}
+		}
+	}
+	if mkdirErr := s.fs.MkdirAll(filepath.Dir(gitconfig), 0755); mkdirErr != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", gitconfig, mkdirErr)
+	}
+	if writeErr := s.fs.AtomicWriteFile(gitconfig, []byte(content), perm); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", gitconfig, writeErr)
+	}
+	fmt.Printf("✨ Updated the git includes in %s\n", gitconfig)
+	return nil
+}
+
+/*
+removeGitIncludes strips the managed block from the user's gitconfig, leaving
+the rest of the file as it is. It is a no-op when there is no managed block.
+*/
+func (s *Service) removeGitIncludes() error {
+	homeDir, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+	gitconfig := s.userGitConfig(homeDir)
+	existing, readErr := s.fs.ReadFile(gitconfig)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return nil
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed to read %s: %w", gitconfig, readErr)
+	}
+	if _, ok := shell.ManagedBlock(string(existing)); !ok {
+		return nil
+	}
+
+	content := withoutGitIncludes(string(existing))
+	perm := os.FileMode(0644)
+	if info, statErr := s.fs.Stat(gitconfig); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	if writeErr := s.fs.AtomicWriteFile(gitconfig, []byte(content), perm); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", gitconfig, writeErr)
+	}
+	return nil
+}
+
+/*
+withoutGitIncludes removes the managed block from a gitconfig along with the
+blank line that separated it from the user's settings.
+*/
+func withoutGitIncludes(content string) string {
+	if _, ok := shell.ManagedBlock(content); !ok {
+		return content
+	}
+	stripped, _ := shell.RemoveNixFoundryBlocks(content)
+	stripped = strings.TrimRight(stripped, "\n")
+	if stripped == "" {
+		return ""
+	}
+	return stripped + "\n"
+}
+
+/*
+writeGitFragment writes git as a gitconfig fragment to path. The file is only
+rewritten when the identity changes.
+*/
+func (s *Service) writeGitFragment(path string, git schema.Git, gitdir string) error {
+	content := gitFragment(git, gitdir)
+	if existing, readErr := s.fs.ReadFile(path); readErr == nil && string(existing) == content {
+		return nil
+	}
+	if mkdirErr := s.fs.MkdirAll(filepath.Dir(path), 0755); mkdirErr != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, mkdirErr)
+	}
+	if writeErr := s.fs.AtomicWriteFile(path, []byte(content), 0644); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", path, writeErr)
+	}
+	fmt.Printf("✨ Wrote git identity to %s\n", path)
+	return nil
+}
+
+func (s *Service) removeGitFragment(path string) error {
+	if !s.fs.Exists(path) {
+		return nil
+	}
+	if removeErr := s.fs.Remove(path); removeErr != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, removeErr)
+	}
+	return nil
+}
+
+/*
+gitFragment renders git as the [user] section of a gitconfig.
+*/
+func gitFragment(git schema.Git, gitdir string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by nix-foundry from the git section of your config. Do not edit.\n")
+	if gitdir != "" {
+		fmt.Fprintf(&b, "# Included for repositories in %s\n", gitdir)
+	}
+	b.WriteString("[user]\n")
+	if git.Name != "" {
+		fmt.Fprintf(&b, "\tname = %s\n", quoteGitValue(git.Name))
+	}
+	if git.Email != "" {
+		fmt.Fprintf(&b, "\temail = %s\n", quoteGitValue(git.Email))
+	}
+	if git.SigningKey != "" {
+		fmt.Fprintf(&b, "\tsigningkey = %s\n", quoteGitValue(git.SigningKey))
+	}
+	return b.String()
+}
+
+/*
+quoteGitValue quotes a gitconfig value so it is read back exactly, including
+leading spaces and the comment characters # and ;.
+*/
+func quoteGitValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+/*
+projectGitFragmentName names the fragment of a project after a hash of its root,
+which is stable and safe to use as a file name.
+*/
+func projectGitFragmentName(gitdir string) string {
+	sum := sha256.Sum256([]byte(gitdir))
+	return hex.EncodeToString(sum[:])[:12] + ".gitconfig"
+}
+
+/*
+setGitInclude replaces the include with the same gitdir as include, or adds it.
+An include without a path is removed instead.
+*/
+func setGitInclude(includes []gitInclude, include gitInclude) []gitInclude {
+	var result []gitInclude
+	found := false
+	for _, existing := range includes {
+		if existing.gitdir != include.gitdir {
+			result = append(result, existing)
+			continue
+		}
+		if include.path != "" && !found {
+			result = append(result, include)
+		}
+		found = true
+	}
+	if !found && include.path != "" {
+		if include.gitdir == "" {
+			result = append([]gitInclude{include}, result...)
+		} else {
+			result = append(result, include)
+		}
+	}
+	return result
+}
+
+/*
+renderGitIncludes renders includes as gitconfig sections. The global include
+comes first so that the project identities included after it take precedence.
+*/
+func renderGitIncludes(includes []gitInclude) string {
+	var b strings.Builder
+	for _, include := range includes {
+		if include.gitdir == "" {
+			b.WriteString("[include]\n")
+		} else {
+			fmt.Fprintf(&b, "[includeIf \"gitdir:%s\"]\n", include.gitdir)
+		}
+		fmt.Fprintf(&b, "\tpath = %s\n", include.path)
+	}
+	return b.String()
+}
+
+/*
+parseGitIncludes reads back the includes renderGitIncludes wrote to a managed
+block. Lines it does not recognize are ignored.
+*/
+func parseGitIncludes(block string) []gitInclude {
+	var includes []gitInclude
+	var current *gitInclude
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "[include]":
+			current = &gitInclude{}
+		case strings.HasPrefix(line, `[includeIf "gitdir:`) && strings.HasSuffix(line, `"]`):
+			current = &gitInclude{gitdir: strings.TrimSuffix(strings.TrimPrefix(line, `[includeIf "gitdir:`), `"]`)}
+		case current != nil && strings.HasPrefix(line, "path = "):
+			current.path = strings.TrimPrefix(line, "path = ")
+			includes = append(includes, *current)
+			current = nil
+		}
+	}
+	return includes
+}
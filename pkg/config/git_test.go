@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func TestManageGit(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SUDO_USER", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	fs := filesystem.NewMemFS()
+	service := &Service{fs: fs, runner: &fakeRunner{}}
+
+	gitconfig := filepath.Join(home, ".gitconfig")
+	userSettings := "[user]\n\tname = Existing\n[core]\n\teditor = vim\n"
+	writeMemFile(t, fs, gitconfig, userSettings, 0644)
+
+	configDir, _ := schema.GetConfigDir()
+	globalFragment := filepath.Join(configDir, "gitconfig")
+	user := &schema.Config{Type: schema.UserConfig, Git: schema.Git{Name: "Jane Doe", Email: "jane@example.com"}}
+	if err := service.manageGit(user); err != nil {
+		t.Fatalf("manageGit() error = %v", err)
+	}
+	if fragment := readMemFile(fs, globalFragment); !strings.Contains(fragment, "\temail = \"jane@example.com\"\n") {
+		t.Errorf("global fragment = %q, want the configured email", fragment)
+	}
+	content := readMemFile(fs, gitconfig)
+	if !strings.HasPrefix(content, userSettings) || !strings.Contains(content, "[include]\n\tpath = "+globalFragment+"\n") {
+		t.Errorf("gitconfig = %q, want the user's settings followed by an include of %s", content, globalFragment)
+	}
+	if readMemFile(fs, gitconfig+".nix-foundry.bak") != userSettings {
+		t.Error("the original gitconfig was not backed up")
+	}
+
+	project := &schema.Config{Type: schema.ProjectConfig, Git: schema.Git{Email: "jane@work.example.com"}}
+	if err := service.manageGit(project); err != nil {
+		t.Fatalf("manageGit() for a project error = %v", err)
+	}
+	cwd, _ := os.Getwd()
+	gitdir := filepath.ToSlash(cwd) + "/"
+	content = readMemFile(fs, gitconfig)
+	if !strings.Contains(content, "[include]\n") || !strings.Contains(content, `[includeIf "gitdir:`+gitdir+`"]`) {
+		t.Errorf("gitconfig = %q, want the global include and an includeIf for %s", content, gitdir)
+	}
+	if strings.Index(content, "[include]") > strings.Index(content, "[includeIf") {
+		t.Error("the project include must come after the global include to take precedence")
+	}
+
+	if err := service.manageGit(&schema.Config{Type: schema.ProjectConfig}); err != nil {
+		t.Fatalf("manageGit() without a project identity error = %v", err)
+	}
+	if content := readMemFile(fs, gitconfig); strings.Contains(content, "includeIf") || !strings.Contains(content, "[include]") {
+		t.Errorf("gitconfig = %q, want only the global include", content)
+	}
+
+	if err := service.removeGitIncludes(); err != nil {
+		t.Fatalf("removeGitIncludes() error = %v", err)
+	}
+	if content := readMemFile(fs, gitconfig); content != userSettings {
+		t.Errorf("after removal gitconfig = %q, want %q", content, userSettings)
+	}
+}
+
+func TestMergeGit(t *testing.T) {
+	team := &schema.Config{Type: schema.TeamConfig, Git: schema.Git{Email: "dev@example.com"}}
+	user := &schema.Config{Type: schema.UserConfig, Git: schema.Git{Name: "Jane Doe"}}
+	project := &schema.Config{Type: schema.ProjectConfig, Git: schema.Git{Email: "jane@work.example.com"}}
+
+	merged := mergeGit(team, user)
+	want := schema.Git{Scope: schema.GitScopeGlobal, Name: "Jane Doe", Email: "dev@example.com"}
+	if merged != want {
+		t.Errorf("mergeGit(team, user) = %+v, want %+v", merged, want)
+	}
+
+	merged = mergeGit(user, project)
+	want = schema.Git{Scope: schema.GitScopeProject, Email: "jane@work.example.com"}
+	if merged != want {
+		t.Errorf("mergeGit(user, project) = %+v, want %+v", merged, want)
+	}
+
+	if merged := mergeGit(&schema.Config{Type: schema.UserConfig}, &schema.Config{Type: schema.ProjectConfig}); merged != (schema.Git{}) {
+		t.Errorf("mergeGit() without identities = %+v, want it empty", merged)
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+/*
+newTestService returns a Service on the OS filesystem for a fresh home directory,
+and that directory. SUDO_USER and the XDG and NIX_FOUNDRY_CONFIG_DIR overrides
+are cleared so that every nix-foundry path resolves inside the home directory.
+Commands go to a fakeRunner that reports no installed packages.
+*/
+func newTestService(t *testing.T) (*Service, string) {
+	t.Helper()
+	t.Setenv("SUDO_USER", "")
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME", "NIX_FOUNDRY_CONFIG_DIR"} {
+		t.Setenv(env, "")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	service := NewService(filesystem.NewOSFileSystem())
+	service.runner = &fakeRunner{installed: "{}"}
+	return service, home
+}
+
+/*
+fakeRunner is the cmdexec.Runner of the tests in this package. It records every
+command it is given. A command containing a key of failures fails with its error;
+otherwise a query is answered with the output of the longest key of outputs the
+command contains. Without a match, the package queries apply makes are answered
+from installed and brew, and other commands succeed without output.
+*/
+type fakeRunner struct {
+	mu        sync.Mutex
+	installed string
+	brew      string
+	outputs   map[string]string
+	failures  map[string]error
+	commands  []string
+}
+
+func (r *fakeRunner) Run(name string, args ...string) error {
+	_, err := r.respond(name, args)
+	return err
+}
+
+func (r *fakeRunner) Output(name string, args ...string) ([]byte, error) {
+	return r.respond(name, args)
+}
+
+func (r *fakeRunner) respond(name string, args []string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, command)
+
+	for substr, failure := range r.failures {
+		if strings.Contains(command, substr) {
+			return nil, failure
+		}
+	}
+	if output, ok := r.output(command); ok {
+		return []byte(output), nil
+	}
+
+	switch {
+	case strings.Contains(command, "nix-env -q --json"):
+		return []byte(r.installed), nil
+	case strings.Contains(command, "nix-collect-garbage"):
+		return []byte("deleting '/nix/store/abc-jq-1.7'\n3 store paths deleted, 12.50 MiB freed\n"), nil
+	case strings.HasPrefix(command, "brew "):
+		if r.brew == "" {
+			return nil, fmt.Errorf("brew: command not found")
+		}
+		return []byte(r.brew), nil
+	case command == "apt-get --version":
+		return nil, nil
+	case strings.HasSuffix(command, " --version"):
+		return nil, fmt.Errorf("%s: command not found", name)
+	case strings.HasPrefix(command, "dpkg-query"):
+		return []byte("openvpn installed\ncurl installed\n"), nil
+	}
+	return nil, nil
+}
+
+/*
+output returns the value of the longest key of r.outputs that command contains.
+*/
+func (r *fakeRunner) output(command string) (string, bool) {
+	var match string
+	found := false
+	for substr := range r.outputs {
+		if strings.Contains(command, substr) && (!found || len(substr) > len(match)) {
+			match, found = substr, true
+		}
+	}
+	return r.outputs[match], found
+}
+
+/*
+count returns the number of recorded commands that contain substr.
+*/
+func (r *fakeRunner) count(substr string) int {
+	n := 0
+	for _, command := range r.recorded() {
+		if strings.Contains(command, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+/*
+scripts returns the commands of the scripts run so far with bash -c.
+*/
+func (r *fakeRunner) scripts() []string {
+	var ran []string
+	for _, command := range r.recorded() {
+		if script, ok := strings.CutPrefix(command, "bash -c "); ok {
+			ran = append(ran, script)
+		}
+	}
+	return ran
+}
+
+/*
+recorded returns a copy of the commands recorded so far.
+*/
+func (r *fakeRunner) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.commands...)
+}
+
+/*
+reset forgets the commands recorded so far.
+*/
+func (r *fakeRunner) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+/*
+writeMemFile writes content to path in fs with perm, creating its parent
+directories.
+*/
+func writeMemFile(t *testing.T, fs *filesystem.MemFS, path, content string, perm os.FileMode) {
+	t.Helper()
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+readMemFile returns the content of path in fs, or an empty string when it does
+not exist.
+*/
+func readMemFile(fs *filesystem.MemFS, path string) string {
+	content, _ := fs.ReadFile(path)
+	return string(content)
+}
+
+/*
+memFileMode returns the permissions of path in fs, or 0 when it does not exist.
+*/
+func memFileMode(fs *filesystem.MemFS, path string) os.FileMode {
+	info, statErr := fs.Stat(path)
+	if statErr != nil {
+		return 0
+	}
+	return info.Mode().Perm()
+}
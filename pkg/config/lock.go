@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/project"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ApplyLockFile is the name of the lock file written by apply. It is kept next to
+the project configuration inside a project, so it can be committed with it, and
+next to the user configuration otherwise.
+*/
+const ApplyLockFile = "nix-foundry.lock"
+
+/*
+ApplyLock records the nixpkgs revision packages are installed from, the
+configured nixpkgs reference it was resolved from, and the version each
+configured package resolved to when the configuration was last applied. Pinned
+packages are recorded with their pinned flake reference.
+*/
+type ApplyLock struct {
+	Ref      string                  `yaml:"ref,omitempty"`
+	Nixpkgs  string                  `yaml:"nixpkgs"`
+	Packages []project.LockedPackage `yaml:"packages"`
+}
+
+/*
+ref returns the nixpkgs reference the lock was resolved from. Locks written
+before the reference was recorded were resolved from the default one.
+*/
+func (l *ApplyLock) ref() string {
+	if l.Ref == "" {
+		return schema.DefaultNixpkgsRef
+	}
+	return l.Ref
+}
+
+/*
+LockDrift lists the differences between the packages of a configuration and its
+lock file: configured packages the lock has no entry for, and lock entries for
+packages that are no longer configured.
+*/
+type LockDrift struct {
+	Unlocked []string
+	Stale    []string
+}
+
+/*
+IsEmpty reports whether the configuration and the lock file agree.
+*/
+func (d LockDrift) IsEmpty() bool {
+	return len(d.Unlocked) == 0 && len(d.Stale) == 0
+}
+
+/*
+ApplyLockPath returns the path of the lock file for the current directory.
+*/
+func (s *Service) ApplyLockPath() (string, error) {
+	projectPath := filepath.Join(".nix-foundry", "config.yaml")
+	if s.fs.Exists(projectPath) {
+		return filepath.Join(".nix-foundry", ApplyLockFile), nil
+	}
+
+	configDir, dirErr := schema.GetConfigDir()
+	if dirErr != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", dirErr)
+	}
+	return filepath.Join(configDir, ApplyLockFile), nil
+}
+
+/*
+ReadApplyLock returns the lock file for the current directory, or nil if there
+is none yet.
+*/
+func (s *Service) ReadApplyLock() (*ApplyLock, error) {
+	lockPath, pathErr := s.ApplyLockPath()
+	if pathErr != nil {
+		return nil, pathErr
+	}
+
+	content, readErr := s.fs.ReadFile(lockPath)
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock file: %w", readErr)
+	}
+
+	lock := &ApplyLock{}
+	if unmarshalErr := yaml.Unmarshal(content, lock); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", lockPath, unmarshalErr)
+	}
+	if refErr := schema.ValidateFlakeRef(lock.Nixpkgs); refErr != nil {
+		return nil, fmt.Errorf("invalid nixpkgs reference in lock file %s: %w", lockPath, refErr)
+	}
+	if pkgErr := project.ValidateLockedPackages(lock.Packages); pkgErr != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", lockPath, pkgErr)
+	}
+	return lock, nil
+}
+
+/*
+lockedNixpkgs returns the nixpkgs revision to install the packages of config
+from, along with the current lock file. Unless update is set or the configured
+nixpkgs changed, the revision recorded in the lock file is used; otherwise the
+configured nixpkgs is resolved to the revision it points at now. An empty
+revision means packages are installed without a lock, which happens when the
+revision cannot be resolved, for example without network access.
+*/
+func (s *Service) lockedNixpkgs(config *schema.Config, update bool) (string, *ApplyLock) {
+	lock, lockErr := s.ReadApplyLock()
+	if lockErr != nil {
+		logging.Warn("ignoring the lock file", "error", lockErr)
+		lock = nil
+	}
+
+	ref := config.Nix.NixpkgsRef()
+	if lock != nil && !update {
+		if lock.ref() == ref {
+			return lock.Nixpkgs, lock
+		}
+		fmt.Printf("🔒 nixpkgs changed from %s to %s; locking its current revision\n", lock.ref(), ref)
+	}
+
+	nixpkgs, resolveErr := project.ResolveFlakeRef(s.runner, ref)
+	if resolveErr != nil {
+		logging.Warn("could not resolve the nixpkgs revision; installing packages without a lock", "nixpkgs", ref, "error", resolveErr)
+		return "", lock
+	}
+	return nixpkgs, lock
+}
+
+/*
+writeApplyLock records the versions the packages of config resolve to in
+nixpkgs and writes the lock file if it changed. Entries of previous with the same
+source are reused, so only new packages are evaluated. With update set, or when
+the nixpkgs revision changed, the version changes since previous are printed.
+*/
+func (s *Service) writeApplyLock(config *schema.Config, previous *ApplyLock, nixpkgs string, update bool) error {
+	lock, resolveErr := s.resolveApplyLock(config, previous, nixpkgs)
+	if resolveErr != nil {
+		return resolveErr
+	}
+
+	lockPath, pathErr := s.ApplyLockPath()
+	if pathErr != nil {
+		return pathErr
+	}
+	content, marshalErr := yaml.Marshal(lock)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal lock file: %w", marshalErr)
+	}
+
+	existing, _ := s.fs.ReadFile(lockPath)
+	if !bytes.Equal(existing, content) {
+		if mkdirErr := s.fs.MkdirAll(filepath.Dir(lockPath), 0755); mkdirErr != nil {
+			return fmt.Errorf("failed to create lock file directory: %w", mkdirErr)
+		}
+		if writeErr := s.fs.WriteFile(lockPath, content, 0644); writeErr != nil {
+			return fmt.Errorf("failed to write lock file: %w", writeErr)
+		}
+	}
+
+	switch {
+	case previous == nil:
+		fmt.Printf("🔒 Locked packages to %s in %s\n", nixpkgs, lockPath)
+	case update, previous.Nixpkgs != nixpkgs:
+		changes := lockChanges(previous, lock)
+		if len(changes) == 0 {
+			fmt.Printf("🔒 %s is up to date\n", lockPath)
+			break
+		}
+		fmt.Printf("🔒 Updated %s:\n", lockPath)
+		for _, change := range changes {
+			fmt.Printf("   • %s\n", change)
+		}
+	}
+	return nil
+}
+
+/*
+resolveApplyLock returns the lock for the packages of config, installed from
+nixpkgs unless they are pinned.
+*/
+func (s *Service) resolveApplyLock(config *schema.Config, previous *ApplyLock, nixpkgs string) (*ApplyLock, error) {
+	known := make(map[string]project.LockedPackage)
+	if previous != nil {
+		for _, pkg := range previous.Packages {
+			known[pkg.Name] = pkg
+		}
+	}
+
+	lock := &ApplyLock{Ref: config.Nix.NixpkgsRef(), Nixpkgs: nixpkgs}
+	for _, pkg := range lockablePackages(config.Nix.Packages) {
+		source := nixpkgs
+		if pinnedRef, pinned := config.Nix.Packages.PinnedRef(pkg); pinned {
+			source = pinnedRef
+		}
+
+		if entry, ok := known[pkg]; ok && entry.Source == source {
+			lock.Packages = append(lock.Packages, entry)
+			continue
+		}
+		locked, lockErr := project.LockPackage(s.runner, pkg, source)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		lock.Packages = append(lock.Packages, locked)
+	}
+	return lock, nil
+}
+
+/*
+CheckLockDrift compares the packages of config with the lock file for the
+current directory. It reports no drift when there is no lock file.
+*/
+func (s *Service) CheckLockDrift(config *schema.Config) (LockDrift, error) {
+	lock, lockErr := s.ReadApplyLock()
+	if lockErr != nil || lock == nil {
+		return LockDrift{}, lockErr
+	}
+
+	locked := make(map[string]bool, len(lock.Packages))
+	for _, pkg := range lock.Packages {
+		locked[pkg.Name] = true
+	}
+
+	var drift LockDrift
+	configured := make(map[string]bool)
+	for _, pkg := range lockablePackages(config.Nix.Packages) {
+		configured[pkg] = true
+		if !locked[pkg] {
+			drift.Unlocked = append(drift.Unlocked, pkg)
+		}
+	}
+	for _, pkg := range lock.Packages {
+		if !configured[pkg.Name] {
+			drift.Stale = append(drift.Stale, pkg.Name)
+		}
+	}
+	return drift, nil
+}
+
+/*
+lockablePackages returns every package apply installs for pkgs, sorted and
+without duplicates: core, optional, pinned, and the packages of enabled groups.
+*/
+func lockablePackages(pkgs schema.Packages) []string {
+	names := append(append([]string{}, pkgs.Core...), pkgs.Optional...)
+	for _, pinned := range pkgs.Pinned {
+		names = append(names, pinned.Name)
+	}
+	return mergeNames(names, pkgs.EnabledPackages())
+}
+
+/*
+lockChanges describes how the lock changed from previous to current, one line
+per package whose version changed, was added, or was removed.
+*/
+func lockChanges(previous, current *ApplyLock) []string {
+	var changes []string
+	if previous.Nixpkgs != current.Nixpkgs {
+		changes = append(changes, fmt.Sprintf("nixpkgs %s → %s", previous.Nixpkgs, current.Nixpkgs))
+	}
+
+	before := make(map[string]string, len(previous.Packages))
+	for _, pkg := range previous.Packages {
+		before[pkg.Name] = pkg.Version
+	}
+	for _, pkg := range current.Packages {
+		version, ok := before[pkg.Name]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s %s (added)", pkg.Name, pkg.Version))
+		case version != pkg.Version:
+			changes = append(changes, fmt.Sprintf("%s %s → %s", pkg.Name, version, pkg.Version))
+		}
+		delete(before, pkg.Name)
+	}
+
+	var removed []string
+	for name := range before {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, fmt.Sprintf("%s (removed)", name))
+	}
+	return changes
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/*
+lockOutputs returns the fakeRunner outputs of the nix commands used to lock
+packages: nixpkgs resolves to rev, and each package evaluates to its entry in
+versions.
+*/
+func lockOutputs(rev string, versions map[string]string) map[string]string {
+	outputs := map[string]string{
+		"flake metadata": fmt.Sprintf(`{"locked": {"type": "github", "owner": "NixOS", "repo": "nixpkgs", "rev": %q}}`, rev),
+	}
+	for pkg, version := range versions {
+		outputs["#"+pkg+".version"] = version
+	}
+	return outputs
+}
+
+func TestApplyLock(t *testing.T) {
+	service, home := newTestService(t)
+	configPath := filepath.Join(home, ".config", "nix-foundry", "config.yaml")
+	writeTestFile(t, configPath, "type: user\nnix:\n  packages:\n    core: [git, jq]\n")
+
+	versions := map[string]string{"git": "2.44.0", "jq": "1.7", "ripgrep": "14.0.0"}
+	runner := &fakeRunner{installed: "{}", outputs: lockOutputs("aaaa", versions)}
+	service.runner = runner
+
+	if err := service.ApplyConfig(); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	lock, err := service.ReadApplyLock()
+	if err != nil || lock == nil {
+		t.Fatalf("ReadApplyLock() = %v, %v; want the lock written by apply", lock, err)
+	}
+	if lock.Nixpkgs != "github:NixOS/nixpkgs/aaaa" || len(lock.Packages) != 2 || lock.Packages[0].Version != "2.44.0" {
+		t.Errorf("lock = %+v, want git and jq locked to nixpkgs aaaa", lock)
+	}
+	if n := runner.count("archive/aaaa.tar.gz"); n != 2 {
+		t.Errorf("installed %d packages from the locked revision, want 2", n)
+	}
+
+	runner.outputs = lockOutputs("bbbb", versions)
+	writeTestFile(t, configPath, "type: user\nnix:\n  packages:\n    core: [git, jq, ripgrep]\n")
+	if err := service.ApplyConfig(); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	if n := runner.count("archive/aaaa.tar.gz' -iA ripgrep"); n != 1 {
+		t.Errorf("ripgrep was installed %d times from the locked revision, want 1", n)
+	}
+	lock, _ = service.ReadApplyLock()
+	if lock.Nixpkgs != "github:NixOS/nixpkgs/aaaa" || lock.Packages[0].Version != "2.44.0" || lock.Packages[2].Version != "14.0.0" {
+		t.Errorf("lock = %+v, want the locked revision kept and ripgrep added", lock)
+	}
+
+	runner.outputs = lockOutputs("bbbb", map[string]string{"git": "2.45.1", "jq": "1.7", "ripgrep": "14.1.0"})
+	if err := service.ApplyConfigWithOptions(ApplyOptions{UpdateLock: true}); err != nil {
+		t.Fatalf("ApplyConfigWithOptions(UpdateLock) error = %v", err)
+	}
+	updated, _ := service.ReadApplyLock()
+	if updated.Nixpkgs != "github:NixOS/nixpkgs/bbbb" || updated.Packages[0].Version != "2.45.1" {
+		t.Errorf("lock = %+v, want nixpkgs bbbb after --update-lock", updated)
+	}
+	want := []string{
+		"nixpkgs github:NixOS/nixpkgs/aaaa → github:NixOS/nixpkgs/bbbb",
+		"git 2.44.0 → 2.45.1",
+		"ripgrep 14.0.0 → 14.1.0",
+	}
+	if got := lockChanges(lock, updated); !reflect.DeepEqual(got, want) {
+		t.Errorf("lockChanges() = %v, want %v", got, want)
+	}
+
+	writeTestFile(t, configPath, "type: user\nnix:\n  packages:\n    core: [git, fd]\n")
+	activeConfig, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err := service.CheckLockDrift(activeConfig)
+	if err != nil {
+		t.Fatalf("CheckLockDrift() error = %v", err)
+	}
+	if !reflect.DeepEqual(drift, LockDrift{Unlocked: []string{"fd"}, Stale: []string{"jq", "ripgrep"}}) {
+		t.Errorf("CheckLockDrift() = %+v, want fd unlocked and jq, ripgrep stale", drift)
+	}
+}
+
+func TestApplyWithoutLock(t *testing.T) {
+	service, home := newTestService(t)
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"), "type: user\nnix:\n  packages:\n    core: [git]\n")
+
+	runner := &fakeRunner{installed: "{}"}
+	service.runner = runner
+
+	if err := service.ApplyConfig(); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	if lock, _ := service.ReadApplyLock(); lock != nil {
+		t.Errorf("lock = %+v, want none when nixpkgs cannot be resolved", lock)
+	}
+	if runner.count("-iA nixpkgs.git") != 1 || runner.count("nix-env -f") != 0 {
+		t.Errorf("commands = %v, want git installed from the default channel", runner.commands)
+	}
+}
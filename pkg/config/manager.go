@@ -7,11 +7,14 @@ package config
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
 	"gopkg.in/yaml.v3"
 )
 
@@ -58,22 +61,16 @@ func (m *Manager) InstallPackage(pkg string) error {
 		return fmt.Errorf("no active configuration")
 	}
 
-	var cmd *exec.Cmd
-	switch m.activeConfig.Nix.Manager {
-	case "nix-env":
-		cmd = exec.Command("bash", "-c", fmt.Sprintf(
-			". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-				"NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 "+
-				"/nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
-			pkg))
-	default:
+	if m.activeConfig.Nix.Manager != "nix-env" {
 		return fmt.Errorf("unsupported package manager: %s", m.activeConfig.Nix.Manager)
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	runner := cmdexec.WithTimeout(cmdexec.NewOSRunner(), m.activeConfig.Settings.CommandTimeout)
+	if err := runner.Run("bash", "-c", fmt.Sprintf(
+		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
+			"NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 "+
+			"/nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
+		pkg)); err != nil {
 		return fmt.Errorf("failed to install package %s: %w", pkg, err)
 	}
 
@@ -99,26 +96,18 @@ func (m *Manager) ConfigureShell() error {
 		return fmt.Errorf("failed to get home directory: %w", homeDirErr)
 	}
 
-	var rcFile string
-	switch m.activeConfig.Settings.Shell {
-	case "bash":
-		rcFile = filepath.Join(homeDir, ".bashrc")
-	case "zsh":
-		rcFile = filepath.Join(homeDir, ".zshrc")
-	case "fish":
-		rcFile = filepath.Join(homeDir, ".config", "fish", "config.fish")
-	default:
-		return fmt.Errorf("unsupported shell: %s", m.activeConfig.Settings.Shell)
+	userShell := m.activeConfig.Settings.Shell
+	rcFile, pathErr := platform.ShellConfigPath(homeDir, userShell)
+	if pathErr != nil {
+		return pathErr
 	}
 
-	if m.activeConfig.Settings.Shell == "fish" {
-		if mkdirErr := os.MkdirAll(filepath.Dir(rcFile), 0755); mkdirErr != nil {
-			return fmt.Errorf("failed to create fish config directory: %w", mkdirErr)
-		}
+	if mkdirErr := os.MkdirAll(filepath.Dir(rcFile), 0755); mkdirErr != nil {
+		return fmt.Errorf("failed to create %s config directory: %w", userShell, mkdirErr)
 	}
 
 	var content string
-	switch m.activeConfig.Settings.Shell {
+	switch userShell {
 	case "fish":
 		content = `
 # Nix
@@ -128,6 +117,8 @@ else if test -e "$HOME/.nix-profile/etc/profile.d/nix.fish"
     source "$HOME/.nix-profile/etc/profile.d/nix.fish"
 end
 `
+	case "nushell":
+		content = "\n# Nix\n" + shell.ManagedBlockContent(userShell) + "\n"
 	default:
 		content = `
 # Nix
@@ -186,6 +177,10 @@ func (m *Manager) LoadUserConfig() error {
 		}
 		return fmt.Errorf("failed to read config: %w", readErr)
 	}
+	content, migrateErr := migrateConfigFile(filesystem.NewOSFileSystem(), configPath, content)
+	if migrateErr != nil {
+		return migrateErr
+	}
 
 	config := &schema.Config{}
 	if unmarshalErr := yaml.Unmarshal(content, config); unmarshalErr != nil {
@@ -204,16 +199,19 @@ func (m *Manager) LoadUserConfig() error {
 LoadTeamConfig loads a team configuration by name from disk.
 */
 func (m *Manager) LoadTeamConfig(name string) error {
-	homeDir, homeDirErr := os.UserHomeDir()
-	if homeDirErr != nil {
-		return fmt.Errorf("failed to get home directory: %w", homeDirErr)
+	configPath, pathErr := schema.GetTeamConfigPath(name)
+	if pathErr != nil {
+		return fmt.Errorf("failed to get config path: %w", pathErr)
 	}
 
-	configPath := filepath.Join(homeDir, ".config", "nix-foundry", "teams", name+".yaml")
 	content, readErr := os.ReadFile(configPath)
 	if readErr != nil {
 		return fmt.Errorf("failed to read team config: %w", readErr)
 	}
+	content, migrateErr := migrateConfigFile(filesystem.NewOSFileSystem(), configPath, content)
+	if migrateErr != nil {
+		return migrateErr
+	}
 
 	config := &schema.Config{}
 	if unmarshalErr := yaml.Unmarshal(content, config); unmarshalErr != nil {
@@ -240,6 +238,10 @@ func (m *Manager) LoadProjectConfig() error {
 		}
 		return fmt.Errorf("failed to read project config: %w", readErr)
 	}
+	content, migrateErr := migrateConfigFile(filesystem.NewOSFileSystem(), configPath, content)
+	if migrateErr != nil {
+		return migrateErr
+	}
 
 	config := &schema.Config{}
 	if unmarshalErr := yaml.Unmarshal(content, config); unmarshalErr != nil {
@@ -321,6 +323,9 @@ func mergeSettings(base, override schema.Settings) schema.Settings {
 	if override.UpdateInterval != 0 {
 		result.UpdateInterval = override.UpdateInterval
 	}
+	if override.CommandTimeout != 0 {
+		result.CommandTimeout = override.CommandTimeout
+	}
 	result.AutoUpdate = override.AutoUpdate
 
 	return result
@@ -335,6 +340,9 @@ func mergeNix(base, override schema.Nix) schema.Nix {
 	if override.Manager != "" {
 		result.Manager = override.Manager
 	}
+	if override.Nixpkgs.Ref != "" {
+		result.Nixpkgs = override.Nixpkgs
+	}
 
 	result.Packages = mergePackages(base.Packages, override.Packages)
 	result.Scripts = append(base.Scripts, override.Scripts...)
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+migrateConfigFile upgrades configuration content read from path to the current
+schema version. When migrations are applied, the original file is backed up to
+<path>.<version>.bak and replaced by the migrated configuration, which logs them.
+*/
+func migrateConfigFile(fs filesystem.FileSystem, path string, content []byte) ([]byte, error) {
+	migrated, applied, migrateErr := schema.MigrateConfig(content)
+	if migrateErr != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, migrateErr)
+	}
+	if len(applied) == 0 {
+		return content, nil
+	}
+
+	perm := os.FileMode(0644)
+	if info, statErr := fs.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	backupFile := fmt.Sprintf("%s.%s.bak", path, applied[0].From)
+	if backupErr := fs.WriteFile(backupFile, content, perm); backupErr != nil {
+		return nil, fmt.Errorf("failed to back up %s before migrating it: %w", path, backupErr)
+	}
+	if writeErr := fs.AtomicWriteFile(path, migrated, perm); writeErr != nil {
+		return nil, fmt.Errorf("failed to write migrated %s: %w", path, writeErr)
+	}
+
+	logMigrations(path, applied)
+	logging.Info("saved the previous configuration", "path", backupFile)
+	return migrated, nil
+}
+
+/*
+decodeConfig parses configuration content in the given format, upgrading it to
+the current schema version in memory. Unlike migrateConfigFile it never rewrites
+source, which only names the content in errors and log messages.
+*/
+func decodeConfig(content []byte, format schema.Format, source string) (*schema.Config, error) {
+	migrated, applied, migrateErr := migrateContent(content, format)
+	if migrateErr != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", source, migrateErr)
+	}
+	logMigrations(source, applied)
+
+	config := &schema.Config{}
+	if unmarshalErr := schema.UnmarshalConfig(migrated, format, config); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse %s as %s: %w", source, format, unmarshalErr)
+	}
+	return config, nil
+}
+
+/*
+migrateContent applies schema.MigrateConfig to content in any format and returns
+the result in the same format. Migrations operate on YAML, so JSON and TOML are
+converted through a generic document in both directions.
+*/
+func migrateContent(content []byte, format schema.Format) ([]byte, []schema.AppliedMigration, error) {
+	document := content
+	if format == schema.FormatTOML {
+		var values map[string]interface{}
+		if decodeErr := toml.Unmarshal(content, &values); decodeErr != nil {
+			return nil, nil, decodeErr
+		}
+		converted, encodeErr := yaml.Marshal(values)
+		if encodeErr != nil {
+			return nil, nil, encodeErr
+		}
+		document = converted
+	}
+
+	// JSON is a subset of YAML and needs no conversion on the way in.
+	migrated, applied, migrateErr := schema.MigrateConfig(document)
+	if migrateErr != nil || len(applied) == 0 {
+		return content, applied, migrateErr
+	}
+	if format == schema.FormatYAML {
+		return migrated, applied, nil
+	}
+
+	var values map[string]interface{}
+	if decodeErr := yaml.Unmarshal(migrated, &values); decodeErr != nil {
+		return nil, nil, decodeErr
+	}
+	var buf bytes.Buffer
+	var encodeErr error
+	if format == schema.FormatTOML {
+		encodeErr = toml.NewEncoder(&buf).Encode(values)
+	} else {
+		encodeErr = json.NewEncoder(&buf).Encode(values)
+	}
+	if encodeErr != nil {
+		return nil, nil, encodeErr
+	}
+	return buf.Bytes(), applied, nil
+}
+
+/*
+logMigrations reports the migrations applied to the configuration at path.
+*/
+func logMigrations(path string, applied []schema.AppliedMigration) {
+	for _, migration := range applied {
+		logging.Info("migrated configuration", "path", path, "from", migration.From, "to", migration.To, "change", migration.Description)
+	}
+}
+
+/*
+LoadConfigFile reads the configuration file at path, in the format given by its
+extension, and upgrades it to the current schema version without modifying it.
+Use GetConfig for the configurations nix-foundry manages, which are migrated in
+place.
+*/
+func (s *Service) LoadConfigFile(path string) (*schema.Config, error) {
+	format, formatErr := schema.FormatFromPath(path)
+	if formatErr != nil {
+		return nil, formatErr
+	}
+	content, readErr := s.fs.ReadFile(path)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, readErr)
+	}
+	return decodeConfig(content, format, path)
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func TestMigrateConfigFile(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	path := "/home/user/.config/nix-foundry/config.yaml"
+	original := []byte("version: 1.0.0\ntype: user\nnix:\n  packages:\n    additional: [jq]\n")
+	writeMemFile(t, fs, path, string(original), 0644)
+
+	migrated, err := migrateConfigFile(fs, path, original)
+	if err != nil {
+		t.Fatalf("migrateConfigFile() error = %v", err)
+	}
+	if readMemFile(fs, path) != string(migrated) || !strings.Contains(string(migrated), "optional:") {
+		t.Errorf("config was not rewritten with the migration:\n%s", readMemFile(fs, path))
+	}
+	if readMemFile(fs, path+".1.0.0.bak") != string(original) {
+		t.Errorf("backup = %q, want the original config", readMemFile(fs, path+".1.0.0.bak"))
+	}
+
+	if _, err := migrateConfigFile(fs, path, []byte("version: 9.0.0\n")); !errors.As(err, new(*schema.UnsupportedVersionError)) {
+		t.Errorf("migrateConfigFile() error = %v, want an UnsupportedVersionError", err)
+	}
+}
+
+func TestGetConfigMigratesLegacyVersion(t *testing.T) {
+	service, home := newTestService(t)
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"), "version: 'v1'\ntype: user\nnix:\n  packages:\n    additional: [jq]\n")
+
+	config, err := service.GetConfig(schema.UserConfig, "")
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if config.Version != schema.CurrentVersion || !reflect.DeepEqual(config.Nix.Packages.Optional, []string{"jq"}) {
+		t.Errorf("config = version %q, optional %v; want it migrated from v1", config.Version, config.Nix.Packages.Optional)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := map[string]string{
+		"config.yaml": "version: 1.0.0\nnix:\n  packages:\n    additional: [jq]\n",
+		"config.json": `{"version": "1.0.0", "settings": {"updateInterval": 3600000000000}, "nix": {"packages": {"additional": ["jq"]}}}`,
+		"config.toml": "version = \"1.0.0\"\n[nix.packages]\nadditional = [\"jq\"]\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			fs := filesystem.NewMemFS()
+			path := "/tmp/" + name
+			writeMemFile(t, fs, path, content, 0644)
+
+			config, err := NewService(fs).LoadConfigFile(path)
+			if err != nil {
+				t.Fatalf("LoadConfigFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(config.Nix.Packages.Optional, []string{"jq"}) {
+				t.Errorf("optional = %v, want the migrated additional packages", config.Nix.Packages.Optional)
+			}
+			if readMemFile(fs, path) != content {
+				t.Error("LoadConfigFile() modified the file")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+)
+
+/*
+installProgress reports the progress of a package installation run: a numbered
+line when each package starts and finishes, the interesting lines of Nix's own
+output in between, and a summary once every package is done. Lines from
+concurrent installations are written whole, one at a time. Without a terminal,
+as in CI, every line starts with a timestamp so that slow steps show in the log.
+*/
+type installProgress struct {
+	mu         sync.Mutex
+	out        io.Writer
+	total      int
+	started    int
+	begin      time.Time
+	timestamps bool
+	now        func() time.Time
+}
+
+/*
+newInstallProgress returns the progress of installing total packages, written
+to out. Timestamps are added when out is not a terminal or runs in CI.
+*/
+func newInstallProgress(out io.Writer, total int) *installProgress {
+	timestamps := true
+	if f, ok := out.(*os.File); ok {
+		timestamps = !platform.IsTerminal(f) || platform.IsCI()
+	}
+	return &installProgress{out: out, total: total, begin: time.Now(), timestamps: timestamps, now: time.Now}
+}
+
+/*
+start reports that pkg is being installed, from source when it is set, and
+returns the time it started.
+*/
+func (p *installProgress) start(pkg, source string) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started++
+	now := p.now()
+	from := ""
+	if source != "" {
+		from = " from " + source
+	}
+	p.println(fmt.Sprintf("[%d/%d] Installing %s%s (elapsed %s)", p.started, p.total, pkg, from, formatElapsed(now.Sub(p.begin))))
+	return now
+}
+
+/*
+finish reports the outcome of installing pkg, after the messages the install
+wrote to messages.
+*/
+func (p *installProgress) finish(pkg string, started time.Time, messages []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, _ = p.out.Write(messages)
+	took := formatElapsed(p.now().Sub(started))
+	if err != nil {
+		p.println(fmt.Sprintf("❌ %s failed after %s", pkg, took))
+		return
+	}
+	p.println(fmt.Sprintf("✨ Installed %s in %s", pkg, took))
+}
+
+/*
+detail reports a line of Nix's output while pkg is being installed.
+*/
+func (p *installProgress) detail(pkg, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.println(fmt.Sprintf("   %s: %s", pkg, line))
+}
+
+/*
+summary prints a table of the installed and failed packages and how long each
+took. Nothing is printed for a single package, whose finish line says it all.
+*/
+func (p *installProgress) summary(results []installResult) {
+	if len(results) < 2 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	installed := 0
+	for _, result := range results {
+		if result.err == nil {
+			installed++
+		}
+	}
+	p.println(fmt.Sprintf("Installed %d of %d packages in %s:", installed, len(results), formatElapsed(p.now().Sub(p.begin))))
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  PACKAGE\tSTATUS\tTIME")
+	for _, result := range results {
+		status := "installed"
+		if result.err != nil {
+			status = "failed"
+		}
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\n", result.pkg, status, formatElapsed(result.duration))
+	}
+	_ = w.Flush()
+}
+
+/*
+nixOutput returns a writer for the output of the commands installing pkg that
+reports the interesting lines (see isNixProgressLine) and drops the rest. The
+full output of a failed command is still part of its error.
+*/
+func (p *installProgress) nixOutput(pkg string) io.Writer {
+	return &nixProgressWriter{progress: p, pkg: pkg}
+}
+
+func (p *installProgress) println(line string) {
+	if p.timestamps {
+		line = p.now().Format("15:04:05") + " " + line
+	}
+	_, _ = fmt.Fprintln(p.out, line)
+}
+
+/*
+nixProgressWriter splits the output of Nix into lines, including the lines Nix
+redraws with carriage returns, and passes the interesting ones to its progress.
+*/
+type nixProgressWriter struct {
+	progress *installProgress
+	pkg      string
+	partial  []byte
+}
+
+func (w *nixProgressWriter) Write(data []byte) (int, error) {
+	w.partial = append(w.partial, data...)
+	for {
+		idx := bytes.IndexAny(w.partial, "\r\n")
+		if idx < 0 {
+			return len(data), nil
+		}
+		line := strings.TrimSpace(string(w.partial[:idx]))
+		w.partial = w.partial[idx+1:]
+		if isNixProgressLine(line) {
+			w.progress.detail(w.pkg, line)
+		}
+	}
+}
+
+/*
+isNixProgressLine reports whether a line of Nix's output says what is being
+downloaded or built, such as "these 3 paths will be fetched (12.5 MiB download,
+48.1 MiB unpacked):" or "building '/nix/store/...-ripgrep-14.1.0.drv'...".
+The per-path copying lines and build logs are left out.
+*/
+func isNixProgressLine(line string) bool {
+	switch {
+	case strings.Contains(line, "will be fetched"), strings.Contains(line, "will be built"):
+		return true
+	case strings.HasPrefix(line, "building '"), strings.HasPrefix(line, "downloading '"), strings.HasPrefix(line, "installing '"):
+		return true
+	}
+	return false
+}
+
+/*
+formatElapsed formats d as minutes and seconds, such as 0:42 or 12:05.
+*/
+func formatElapsed(d time.Duration) string {
+	seconds := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstallProgress(t *testing.T) {
+	var out bytes.Buffer
+	clock := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	progress := newInstallProgress(&out, 2)
+	progress.begin = clock
+	progress.now = func() time.Time { return clock }
+
+	started := progress.start("ripgrep", "github:NixOS/nixpkgs/abc")
+	nixOutput := progress.nixOutput("ripgrep")
+	_, _ = nixOutput.Write([]byte("these 2 paths will be fetched (1.5 MiB download, 4.2 MiB unpacked):\n  /nix/store/abc-ripgrep-14.1.0\ncopying path '/nix/store/abc-ripgrep-14.1.0' from 'https://cache.nixos.org'...\nbuilding '/nix/store/"))
+	_, _ = nixOutput.Write([]byte("def-ripgrep.drv'...\r[1/2 built] compiling\n"))
+	clock = clock.Add(42 * time.Second)
+	progress.finish("ripgrep", started, []byte("Warning: Failed to symlink ripgrep\n"), nil)
+
+	started = progress.start("fd", "")
+	clock = clock.Add(3 * time.Second)
+	progress.finish("fd", started, nil, errors.New("build failed"))
+
+	progress.summary([]installResult{
+		{pkg: "ripgrep", duration: 42 * time.Second},
+		{pkg: "fd", err: errors.New("build failed"), duration: 3 * time.Second},
+	})
+
+	want := []string{
+		"09:30:00 [1/2] Installing ripgrep from github:NixOS/nixpkgs/abc (elapsed 0:00)",
+		"09:30:00    ripgrep: these 2 paths will be fetched (1.5 MiB download, 4.2 MiB unpacked):",
+		"09:30:00    ripgrep: building '/nix/store/def-ripgrep.drv'...",
+		"Warning: Failed to symlink ripgrep",
+		"09:30:42 ✨ Installed ripgrep in 0:42",
+		"09:30:42 [2/2] Installing fd (elapsed 0:42)",
+		"09:30:45 ❌ fd failed after 0:03",
+		"09:30:45 Installed 1 of 2 packages in 0:45:",
+		"  PACKAGE  STATUS     TIME",
+		"  ripgrep  installed  0:42",
+		"  fd       failed     0:03",
+	}
+	if got := strings.Split(strings.TrimRight(out.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("progress output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestIsNixProgressLine(t *testing.T) {
+	tests := map[string]bool{
+		"this path will be fetched (0.10 MiB download, 0.35 MiB unpacked):":          true,
+		"these 3 derivations will be built:":                                         true,
+		"building '/nix/store/abc-hello-2.12.drv'...":                                true,
+		"downloading 'https://github.com/NixOS/nixpkgs/archive/abc.tar.gz'...":       true,
+		"installing 'ripgrep-14.1.0'":                                                true,
+		"copying path '/nix/store/abc-hello-2.12' from 'https://cache.nixos.org'...": false,
+		"checking for gcc... yes":                                                    false,
+		"":                                                                           false,
+	}
+	for line, want := range tests {
+		if got := isNixProgressLine(line); got != want {
+			t.Errorf("isNixProgressLine(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                              "0:00",
+		42 * time.Second:               "0:42",
+		12*time.Minute + 5*time.Second: "12:05",
+		1500 * time.Millisecond:        "0:02",
+	}
+	for d, want := range tests {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -6,18 +6,31 @@ applying, and merging of configurations across different scopes (user, team, pro
 package config
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
+	"github.com/shawnkhoffman/nix-foundry/pkg/nixerrors"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
 	"gopkg.in/yaml.v3"
 )
 
@@ -27,7 +40,10 @@ It handles all aspects of configuration including initialization, saving,
 applying, and merging of configurations across different scopes (user, team, project).
 */
 type Service struct {
-	fs filesystem.FileSystem
+	fs              filesystem.FileSystem
+	runner          cmdexec.Runner
+	applicationsDir string
+	storeDir        string
 }
 
 /*
@@ -36,7 +52,10 @@ The filesystem abstraction allows for flexible storage backends and easier testi
 */
 func NewService(fs filesystem.FileSystem) *Service {
 	return &Service{
-		fs: fs,
+		fs:              fs,
+		runner:          cmdexec.NewOSRunner(),
+		applicationsDir: "/Applications",
+		storeDir:        "/nix/store",
 	}
 }
 
@@ -68,7 +87,7 @@ func (s *Service) InitConfig() error {
 		return fmt.Errorf("failed to marshal config: %w", marshalErr)
 	}
 
-	if writeErr := s.fs.WriteFile(configPath, content, 0664); writeErr != nil {
+	if writeErr := s.fs.AtomicWriteFile(configPath, content, 0664); writeErr != nil {
 		return fmt.Errorf("failed to write config: %w", writeErr)
 	}
 
@@ -84,28 +103,9 @@ if it doesn't exist. The location depends on the configuration type:
 - ProjectConfig: ./.nix-foundry/config.yaml
 */
 func (s *Service) SaveConfig(config *schema.Config) error {
-	var configPath string
-
-	switch config.Type {
-	case schema.UserConfig:
-		var pathErr error
-		configPath, pathErr = schema.GetConfigPath()
-		if pathErr != nil {
-			return fmt.Errorf("failed to get config path: %w", pathErr)
-		}
-
-	case schema.TeamConfig:
-		userHomeDir, homeDirErr := os.UserHomeDir()
-		if homeDirErr != nil {
-			return fmt.Errorf("failed to get home directory: %w", homeDirErr)
-		}
-		configPath = filepath.Join(userHomeDir, ".config", "nix-foundry", "teams", config.Metadata.Name+".yaml")
-
-	case schema.ProjectConfig:
-		configPath = filepath.Join(".nix-foundry", "config.yaml")
-
-	default:
-		return fmt.Errorf("invalid config type: %s", config.Type)
+	configPath, pathErr := configPathFor(config)
+	if pathErr != nil {
+		return pathErr
 	}
 
 	configDir := filepath.Dir(configPath)
@@ -118,112 +118,318 @@ func (s *Service) SaveConfig(config *schema.Config) error {
 		return fmt.Errorf("failed to marshal config: %w", marshalErr)
 	}
 
-	if writeErr := s.fs.WriteFile(configPath, content, 0664); writeErr != nil {
+	if writeErr := s.fs.AtomicWriteFile(configPath, content, 0664); writeErr != nil {
 		return fmt.Errorf("failed to write config: %w", writeErr)
 	}
 
 	return nil
 }
 
+/*
+configPathFor returns the file a configuration is saved to, based on its type.
+*/
+func configPathFor(config *schema.Config) (string, error) {
+	switch config.Type {
+	case schema.UserConfig:
+		configPath, pathErr := schema.GetConfigPath()
+		if pathErr != nil {
+			return "", fmt.Errorf("failed to get config path: %w", pathErr)
+		}
+		return configPath, nil
+
+	case schema.TeamConfig:
+		configPath, pathErr := schema.GetTeamConfigPath(config.Metadata.Name)
+		if pathErr != nil {
+			return "", fmt.Errorf("failed to get config path: %w", pathErr)
+		}
+		return configPath, nil
+
+	case schema.ProjectConfig:
+		return filepath.Join(".nix-foundry", "config.yaml"), nil
+
+	default:
+		return "", fmt.Errorf("invalid config type: %s", config.Type)
+	}
+}
+
 /*
 ApplyConfig applies the active configuration to the system. This includes:
 1. Configuring the shell environment if specified in user config
 2. Managing packages (installing new ones, removing old ones)
-3. Running any configured scripts (with change detection)
+3. Managing Homebrew formulae and casks on macOS
+4. Checking system packages on Linux
+5. Installing editor extensions and writing editor plugin lists
+6. Running any configured scripts (with change detection)
+7. Recording the nixpkgs revision and package versions in the lock file
 
 Returns an error if any step of the application process fails.
 */
 func (s *Service) ApplyConfig() error {
-	return s.ApplyConfigWithOptions(false)
+	return s.ApplyConfigWithOptions(ApplyOptions{})
+}
+
+/*
+ApplyOptions controls how ApplyConfigWithOptions applies the active configuration.
+*/
+type ApplyOptions struct {
+	// ForceScripts runs scripts even when they are unchanged since they last ran.
+	ForceScripts bool
+	// AllowScripts runs scripts that come from team and project configs.
+	AllowScripts bool
+	// AllowSystemPackages installs missing system packages, which runs commands with sudo.
+	AllowSystemPackages bool
+	// ConfirmScripts is called with the scripts about to run, and no scripts run
+	// unless it returns true. Scripts run without confirmation when it is nil.
+	ConfirmScripts func(scripts []schema.Script) bool
+	// SelectProfile applies Profile instead of the active profile, and makes it the
+	// active profile once the configuration is applied. An empty Profile selects
+	// the base configuration without a profile.
+	SelectProfile bool
+	Profile       string
+	// UpdateLock resolves nixpkgs to its current revision instead of the one in
+	// the lock file, and records the new versions once the configuration is applied.
+	UpdateLock bool
+}
+
+/*
+ConfigForApply returns the configuration that applying with opts would use: the
+active configuration, with the profile selected in opts in place of the active
+one when opts.SelectProfile is set. Unlike a stale active profile, an unknown
+selected profile is an error.
+*/
+func (s *Service) ConfigForApply(opts ApplyOptions) (*schema.Config, error) {
+	if !opts.SelectProfile {
+		return s.GetActiveConfig()
+	}
+	mergedConfig, mergeErr := s.loadMergedConfig()
+	if mergeErr != nil {
+		return nil, mergeErr
+	}
+	return withProfile(mergedConfig, opts.Profile)
 }
 
 /*
 ApplyConfigWithOptions applies the active configuration with additional options.
-Supports forcing script execution regardless of change detection.
+Every command run while applying is bounded by settings.commandTimeout when it
+is set, and each script by its own timeout.
 */
-func (s *Service) ApplyConfigWithOptions(forceScripts bool) error {
-	activeConfig, configErr := s.GetActiveConfig()
+func (s *Service) ApplyConfigWithOptions(opts ApplyOptions) error {
+	activeConfig, configErr := s.ConfigForApply(opts)
 	if configErr != nil {
 		return fmt.Errorf("failed to get active config: %w", configErr)
 	}
 
+	if timeout := activeConfig.Settings.CommandTimeout; timeout > 0 {
+		bounded := *s
+		bounded.runner = cmdexec.WithTimeout(s.runner, timeout)
+		s = &bounded
+	}
+
 	if activeConfig.Type == schema.UserConfig && activeConfig.Settings.Shell != "" {
-		if shellErr := s.configureShell(activeConfig.Settings.Shell); shellErr != nil {
+		if shellErr := s.configureShell(activeConfig.Settings.Shell, activeConfig.Env); shellErr != nil {
 			return fmt.Errorf("failed to configure shell: %w", shellErr)
 		}
 	}
 
-	if pkgErr := s.managePackages(activeConfig); pkgErr != nil {
+	nixpkgs, previousLock := s.lockedNixpkgs(activeConfig, opts.UpdateLock)
+	if pkgErr := s.managePackages(activeConfig, nixpkgs); pkgErr != nil {
 		return fmt.Errorf("failed to manage packages: %w", pkgErr)
 	}
 
-	if scriptErr := s.runScripts(activeConfig, forceScripts); scriptErr != nil {
+	if runtime.GOOS == "darwin" && !activeConfig.Homebrew.IsEmpty() {
+		if brewErr := s.manageHomebrew(activeConfig.Homebrew); brewErr != nil {
+			return fmt.Errorf("failed to manage Homebrew packages: %w", brewErr)
+		}
+	}
+
+	if !activeConfig.SystemPackages.IsEmpty() {
+		if systemErr := s.manageSystemPackages(activeConfig.SystemPackages, opts.AllowSystemPackages); systemErr != nil {
+			return fmt.Errorf("failed to manage system packages: %w", systemErr)
+		}
+	}
+
+	if !activeConfig.Editors.IsEmpty() {
+		if editorsErr := s.manageEditors(activeConfig.Editors); editorsErr != nil {
+			return fmt.Errorf("failed to manage editor extensions: %w", editorsErr)
+		}
+	}
+
+	if gitErr := s.manageGit(activeConfig); gitErr != nil {
+		return fmt.Errorf("failed to configure git: %w", gitErr)
+	}
+
+	if scriptErr := s.runScripts(activeConfig, opts); scriptErr != nil {
 		return fmt.Errorf("failed to run scripts: %w", scriptErr)
 	}
 
+	if opts.SelectProfile {
+		if profileErr := s.saveActiveProfile(opts.Profile); profileErr != nil {
+			return fmt.Errorf("failed to save active profile: %w", profileErr)
+		}
+	}
+
+	if nixpkgs != "" {
+		if lockErr := s.writeApplyLock(activeConfig, previousLock, nixpkgs, opts.UpdateLock); lockErr != nil {
+			return fmt.Errorf("failed to update lock file: %w", lockErr)
+		}
+	}
+
 	return nil
 }
 
 /*
-configureShell configures the specified shell with Nix environment settings.
-It creates the appropriate shell configuration file (.bashrc, .zshrc, or config.fish)
-and adds the necessary Nix initialization commands. If the shell configuration
-already contains Nix initialization, it skips the modification.
+ApplyPlan describes the changes applying the active configuration would make.
+ShellFile is empty when the active configuration does not manage a shell.
+*/
+type ApplyPlan struct {
+	ToInstall    []string
+	ToRemove     []string
+	Conflicts    []packages.Conflict
+	ShellFile    string
+	ShellChanged bool
+	Scripts      []ScriptPlan
+}
+
+/*
+PlanApply computes what ApplyConfig would do for the active configuration
+without changing anything: the packages it would install and remove, the packages
+that conflict with each other, whether it would rewrite the shell configuration,
+and which scripts would run.
+*/
+func (s *Service) PlanApply() (*ApplyPlan, error) {
+	return s.PlanApplyWithOptions(ApplyOptions{})
+}
+
+/*
+PlanApplyWithOptions computes what ApplyConfigWithOptions would do with the same
+options.
+*/
+func (s *Service) PlanApplyWithOptions(opts ApplyOptions) (*ApplyPlan, error) {
+	activeConfig, configErr := s.ConfigForApply(opts)
+	if configErr != nil {
+		return nil, fmt.Errorf("failed to get active config: %w", configErr)
+	}
+
+	plan := &ApplyPlan{}
+	if activeConfig.Type == schema.UserConfig && activeConfig.Settings.Shell != "" {
+		update, shellErr := s.planShellUpdate(activeConfig.Settings.Shell, activeConfig.Env)
+		if shellErr != nil {
+			return nil, fmt.Errorf("failed to plan shell configuration: %w", shellErr)
+		}
+		plan.ShellFile = update.rcFile
+		plan.ShellChanged = update.changed()
+	}
+
+	pm, pmErr := packages.NewPackageManager(activeConfig.Nix.Manager, s.runner)
+	if pmErr != nil {
+		return nil, pmErr
+	}
+	installedPackages, queryErr := pm.ListInstalled()
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to query installed packages: %w", queryErr)
+	}
+	diff := schema.DiffPackages(installedPackages, activeConfig.Nix.Packages)
+	plan.ToInstall = diff.ToInstall
+	plan.ToRemove = diff.ToRemove
+
+	conflicts, conflictErr := packageConflicts(activeConfig.Nix.Packages)
+	if conflictErr != nil {
+		return nil, conflictErr
+	}
+	plan.Conflicts = conflicts
+
+	scripts, scriptErr := s.PlanScripts(activeConfig, opts.ForceScripts, opts.AllowScripts)
+	if scriptErr != nil {
+		return nil, fmt.Errorf("failed to plan scripts: %w", scriptErr)
+	}
+	plan.Scripts = scripts
+
+	return plan, nil
+}
+
+/*
+shellUpdate is the change configureShell makes to a shell configuration file.
 */
-func (s *Service) configureShell(shell string) error {
+type shellUpdate struct {
+	rcFile   string
+	existing []byte
+	exists   bool
+	content  string
+}
+
+func (u shellUpdate) changed() bool {
+	return u.content != string(u.existing)
+}
+
+/*
+planShellUpdate returns the shell configuration file for userShell and its
+content once the nix-foundry managed block, including the exports of env, is
+up to date. It does not write anything.
+*/
+func (s *Service) planShellUpdate(userShell string, env map[string]string) (shellUpdate, error) {
 	userHomeDir, homeDirErr := os.UserHomeDir()
 	if homeDirErr != nil {
-		return fmt.Errorf("failed to get home directory: %w", homeDirErr)
+		return shellUpdate{}, fmt.Errorf("failed to get home directory: %w", homeDirErr)
 	}
 
-	var rcFile string
-	switch shell {
-	case "bash":
-		rcFile = filepath.Join(userHomeDir, ".bashrc")
-	case "zsh":
-		rcFile = filepath.Join(userHomeDir, ".zshrc")
-	case "fish":
-		rcFile = filepath.Join(userHomeDir, ".config", "fish", "config.fish")
-	default:
-		return fmt.Errorf("unsupported shell: %s", shell)
+	rcFile, pathErr := platform.ShellConfigPath(userHomeDir, userShell)
+	if pathErr != nil {
+		return shellUpdate{}, pathErr
 	}
+	update := shellUpdate{rcFile: rcFile}
 
-	if shell == "fish" {
+	block := shell.ManagedBlockWithEnv(userShell, env)
+
+	existingContent, readErr := s.fs.ReadFile(update.rcFile)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return shellUpdate{}, fmt.Errorf("failed to read shell config: %w", readErr)
+	}
+	update.existing = existingContent
+	update.exists = readErr == nil
+	update.content = shell.UpsertManagedBlock(string(existingContent), block)
+	return update, nil
+}
+
+/*
+configureShell configures the specified shell with Nix environment settings.
+It creates the appropriate shell configuration file (.bashrc, .zshrc, config.fish, or config.nu)
+and adds the necessary Nix initialization commands and the exports of env inside
+the nix-foundry managed block, leaving the rest of the file untouched and
+preserving its mode. The original file is backed up to <rcfile>.nix-foundry.bak
+once, before it is first modified. If the managed block is already up to date,
+the file is not written.
+*/
+func (s *Service) configureShell(userShell string, env map[string]string) error {
+	update, planErr := s.planShellUpdate(userShell, env)
+	if planErr != nil {
+		return planErr
+	}
+	if !update.changed() {
+		return nil
+	}
+
+	rcFile := update.rcFile
+	if !s.fs.Exists(filepath.Dir(rcFile)) {
 		if mkdirErr := s.fs.MkdirAll(filepath.Dir(rcFile), 0775); mkdirErr != nil {
-			return fmt.Errorf("failed to create fish config directory: %w", mkdirErr)
+			return fmt.Errorf("failed to create %s config directory: %w", userShell, mkdirErr)
 		}
 	}
 
-	var content string
-	switch shell {
-	case "fish":
-		content = `
-# Nix
-if test -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
-    source '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
-else if test -e "$HOME/.nix-profile/etc/profile.d/nix.fish"
-    source "$HOME/.nix-profile/etc/profile.d/nix.fish"
-end
-`
-	default:
-		content = `
-# Nix
-if [ -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh' ]; then
-    . '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh'
-elif [ -e "$HOME/.nix-profile/etc/profile.d/nix.sh" ]; then
-    . "$HOME/.nix-profile/etc/profile.d/nix.sh"
-fi
-`
-	}
-
-	existingContent, readErr := s.fs.ReadFile(rcFile)
-	if readErr == nil && len(existingContent) > 0 {
-		if strings.Contains(string(existingContent), "# Nix") {
-			return nil
+	perm := os.FileMode(0664)
+	if update.exists {
+		if info, statErr := s.fs.Stat(rcFile); statErr == nil {
+			perm = info.Mode().Perm()
+		}
+
+		backupFile := rcFile + ".nix-foundry.bak"
+		if !s.fs.Exists(backupFile) {
+			if backupErr := s.fs.WriteFile(backupFile, update.existing, perm); backupErr != nil {
+				return fmt.Errorf("failed to back up shell config: %w", backupErr)
+			}
 		}
 	}
 
-	if writeErr := s.fs.WriteFile(rcFile, []byte(content), 0664); writeErr != nil {
+	if writeErr := s.fs.WriteFile(rcFile, []byte(update.content), perm); writeErr != nil {
 		return fmt.Errorf("failed to write shell config: %w", writeErr)
 	}
 
@@ -231,77 +437,280 @@ fi
 }
 
 /*
-installPackage installs a single package using nix-env.
-It configures the environment to allow unfree and unsupported system packages,
-and streams the installation output to the user.
-*/
-func (s *Service) installPackage(pkg string) error {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
-		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-			"NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 "+
-			"/nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
-		pkg))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err != nil && s.isPermissionError(err) {
-		fmt.Println("\n⚠️  INSTALLATION FAILED - PERMISSION DENIED!")
-		fmt.Println("This is likely because Nix doesn't have Full Disk Access permission on macOS.")
-		fmt.Println("To fix this:")
-		fmt.Println("1. Open System Preferences → Privacy & Security → Full Disk Access")
-		fmt.Println("2. Click the '+' button and add 'nix'")
-		fmt.Println("3. Re-run 'nix-foundry config apply' after granting permission")
-		fmt.Println()
+installPackage installs a single package using the configured package manager.
+When source is set, such as the flake reference a package is pinned to or the
+locked nixpkgs revision, the package is installed from that reference. The package
+managers allow unfree and unsupported system packages. Messages are written to out
+so that concurrent installations can buffer their output per package.
+*/
+func (s *Service) installPackage(pm packages.PackageManager, out io.Writer, pkg string, source string) error {
+	var err error
+	if source != "" {
+		err = pm.InstallFrom(source, schema.PackageAttribute(pkg))
+	} else {
+		err = pm.Install(schema.PackageAttribute(pkg))
+	}
+	err = nixerrors.Classify(err)
+	if errors.Is(err, nixerrors.ErrPermissionDenied) && runtime.GOOS == "darwin" {
+		fmt.Fprintln(out, "\n⚠️  INSTALLATION FAILED - PERMISSION DENIED!")
+		fmt.Fprintln(out, "This is likely because Nix doesn't have Full Disk Access permission on macOS.")
+		fmt.Fprintln(out, "To fix this:")
+		fmt.Fprintln(out, "1. Open System Preferences → Privacy & Security → Full Disk Access")
+		fmt.Fprintln(out, "2. Click the '+' button and add 'nix'")
+		fmt.Fprintln(out, "3. Re-run 'nix-foundry config apply' after granting permission")
+		fmt.Fprintln(out)
 	} else if err == nil && runtime.GOOS == "darwin" {
-		if symlinkErr := s.symlinkMacOSApps(pkg); symlinkErr != nil {
-			fmt.Printf("Warning: Failed to symlink %s to Applications: %v\n", pkg, symlinkErr)
+		if symlinkErr := s.symlinkMacOSApps(pm, out, pkg); symlinkErr != nil {
+			fmt.Fprintf(out, "Warning: Failed to symlink %s to Applications: %v\n", pkg, symlinkErr)
 		}
 	}
 	return err
 }
 
 /*
-runScripts executes the scripts defined in the configuration.
-Scripts only run when their content has changed (hash-based detection)
-or when force is true. This prevents unnecessary re-execution.
+installPackages installs packages concurrently using a bounded pool of workers,
+reporting their progress as it goes (see installProgress). Each package gets its
+own package manager, whose output is reduced to the lines saying what Nix
+downloads and builds. Other messages about a package are buffered and written
+together once it has finished, so output from different packages never
+interleaves. A failure does not stop the remaining installations; the result for
+every package is returned in input order. Packages that are not pinned are
+installed from nixpkgs when it is set.
+*/
+func (s *Service) installPackages(config *schema.Config, pkgs []string, nixpkgs string) []installResult {
+	concurrency := installConcurrency(config.Nix.InstallConcurrency, len(pkgs))
+	if concurrency > 1 {
+		logging.Debug("installing packages in parallel", "workers", concurrency)
+	}
+
+	progress := newInstallProgress(os.Stdout, len(pkgs))
+	results := runInstallPool(pkgs, concurrency, func(pkg string) error {
+		source, pinned := config.Nix.Packages.PinnedRef(pkg)
+		if !pinned {
+			source = nixpkgs
+		}
+
+		started := progress.start(pkg, source)
+		var buf bytes.Buffer
+		pm, pmErr := packages.NewPackageManager(config.Nix.Manager, cmdexec.WithOutput(s.runner, progress.nixOutput(pkg)))
+		if pmErr != nil {
+			progress.finish(pkg, started, nil, pmErr)
+			return pmErr
+		}
+		installErr := s.installPackage(pm, &buf, pkg, source)
+		progress.finish(pkg, started, buf.Bytes(), installErr)
+		return installErr
+	})
+	progress.summary(results)
+	return results
+}
+
+/*
+installResult records the outcome of installing a single package.
+*/
+type installResult struct {
+	pkg      string
+	err      error
+	duration time.Duration
+}
+
+/*
+installConcurrency returns the number of parallel installers to use. A configured
+value of zero or less defaults to the number of CPUs, and the result never exceeds
+the number of packages.
+*/
+func installConcurrency(configured, packageCount int) int {
+	concurrency := configured
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if concurrency > packageCount {
+		concurrency = packageCount
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
+}
+
+/*
+runInstallPool calls install for every package using at most concurrency workers
+and collects the results, with how long each install took, in input order.
+*/
+func runInstallPool(pkgs []string, concurrency int, install func(pkg string) error) []installResult {
+	results := make([]installResult, len(pkgs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				started := time.Now()
+				err := install(pkgs[idx])
+				results[idx] = installResult{pkg: pkgs[idx], err: err, duration: time.Since(started)}
+			}
+		}()
+	}
+
+	for idx := range pkgs {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+/*
+ScriptPlan describes whether a script runs on the next apply. Reason explains why
+a script is skipped.
 */
-func (s *Service) runScripts(config *schema.Config, force bool) error {
+type ScriptPlan struct {
+	Script schema.Script `yaml:"script" json:"script"`
+	Run    bool          `yaml:"run" json:"run"`
+	Reason string        `yaml:"reason,omitempty" json:"reason,omitempty"`
+}
+
+/*
+PlanScripts returns the scripts of config in the order they run, and whether each
+one would run on this machine. Scripts are skipped when they come from a team or
+project config and allowScripts is false, when they are limited to other
+platforms, when a script they require is skipped for either reason, or when their
+content is unchanged since they last ran and force is false.
+*/
+func (s *Service) PlanScripts(config *schema.Config, force, allowScripts bool) ([]ScriptPlan, error) {
+	ordered, orderErr := schema.OrderScripts(config.Nix.Scripts)
+	if orderErr != nil {
+		return nil, orderErr
+	}
+
+	scriptHashes := s.loadScriptHashes(s.getScriptHashFile())
+	excluded := make(map[string]bool)
+	plans := make([]ScriptPlan, 0, len(ordered))
+
+	for _, script := range ordered {
+		plan := ScriptPlan{Script: script}
+
+		if !allowScripts && script.Scope != "" && script.Scope != schema.UserConfig {
+			plan.Reason = fmt.Sprintf("from a %s config, which needs --allow-scripts", script.Scope)
+			excluded[script.Name] = true
+		} else if !script.RunsHere() {
+			plan.Reason = "only runs on " + strings.Join(script.Platforms, ", ")
+			excluded[script.Name] = true
+		} else if required := firstMatch(script.Requires, excluded); required != "" {
+			plan.Reason = fmt.Sprintf("requires %s, which does not run here", required)
+			excluded[script.Name] = true
+		} else if !force && s.hashScript(script) == scriptHashes[s.scriptKey(config, script)] {
+			plan.Reason = "unchanged"
+		} else {
+			plan.Run = true
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+/*
+runScripts executes the scripts defined in the configuration, in the order given
+by PlanScripts. Scripts only run when their content has changed (hash-based
+detection) or when opts.ForceScripts is true. This prevents unnecessary
+re-execution. Scripts from team and project configs only run with
+opts.AllowScripts, and no script runs unless opts.ConfirmScripts accepts them.
+Each script is interrupted after its timeout. A failing script stops the
+remaining scripts unless it sets continueOnError, in which case only the scripts
+requiring it are skipped.
+*/
+func (s *Service) runScripts(config *schema.Config, opts ApplyOptions) error {
+	plans, planErr := s.PlanScripts(config, opts.ForceScripts, opts.AllowScripts)
+	if planErr != nil {
+		return planErr
+	}
+
+	if opts.ConfirmScripts != nil {
+		var pending []schema.Script
+		for _, plan := range plans {
+			if plan.Run {
+				pending = append(pending, plan.Script)
+			}
+		}
+		if len(pending) > 0 && !opts.ConfirmScripts(pending) {
+			fmt.Println("⏭️  Scripts not confirmed, skipping")
+			return nil
+		}
+	}
+
 	hashFile := s.getScriptHashFile()
 	scriptHashes := s.loadScriptHashes(hashFile)
 	hasChanges := false
+	failed := make(map[string]bool)
+
+	saveHashes := func() {
+		if !hasChanges {
+			return
+		}
+		if saveErr := s.saveScriptHashes(hashFile, scriptHashes); saveErr != nil {
+			logging.Warn("failed to save script hashes", "error", saveErr)
+		}
+	}
+	defer saveHashes()
 
-	for _, script := range config.Nix.Scripts {
-		scriptKey := fmt.Sprintf("%s_%s", config.Metadata.Name, script.Name)
-		currentHash := s.hashScript(script)
-		lastHash := scriptHashes[scriptKey]
+	for _, plan := range plans {
+		script := plan.Script
 
-		shouldRun := force || currentHash != lastHash || script.RunOnce && lastHash == ""
+		if !plan.Run {
+			if plan.Reason == "unchanged" {
+				fmt.Printf("⏭️  Script '%s' unchanged, skipping\n", script.Name)
+			} else {
+				fmt.Printf("⏭️  Script '%s' skipped: %s\n", script.Name, plan.Reason)
+			}
+			continue
+		}
 
-		if !shouldRun {
-			fmt.Printf("⏭️  Script '%s' unchanged, skipping\n", script.Name)
+		if required := firstMatch(script.Requires, failed); required != "" {
+			fmt.Printf("⏭️  Script '%s' skipped: required script %s failed\n", script.Name, required)
+			failed[script.Name] = true
 			continue
 		}
 
 		fmt.Printf("🔧 Running script: %s\n", script.Name)
-		cmd := exec.Command("bash", "-c", string(script.Commands))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if execErr := cmd.Run(); execErr != nil {
-			return fmt.Errorf("failed to run script %s: %w", script.Name, execErr)
+		runner := cmdexec.WithTimeout(s.runner, script.EffectiveTimeout())
+		if execErr := runner.Run("bash", "-c", string(script.Commands)); execErr != nil {
+			if !script.ContinueOnError {
+				return fmt.Errorf("failed to run script %s: %w", script.Name, execErr)
+			}
+			logging.Warn("script failed, continuing", "script", script.Name, "error", execErr)
+			failed[script.Name] = true
+			continue
 		}
 
-		scriptHashes[scriptKey] = currentHash
+		scriptHashes[s.scriptKey(config, script)] = s.hashScript(script)
 		hasChanges = true
 	}
 
-	if hasChanges {
-		if saveErr := s.saveScriptHashes(hashFile, scriptHashes); saveErr != nil {
-			fmt.Printf("Warning: Failed to save script hashes: %v\n", saveErr)
+	return nil
+}
+
+/*
+scriptKey returns the key a script's hash is stored under.
+*/
+func (s *Service) scriptKey(config *schema.Config, script schema.Script) string {
+	return fmt.Sprintf("%s_%s", config.Metadata.Name, script.Name)
+}
+
+/*
+firstMatch returns the first of names that is set in set, or "" if none is.
+*/
+func firstMatch(names []string, set map[string]bool) string {
+	for _, name := range names {
+		if set[name] {
+			return name
 		}
 	}
-
-	return nil
+	return ""
 }
 
 /*
@@ -317,9 +726,8 @@ func (s *Service) hashScript(script schema.Script) string {
 getScriptHashFile returns the path to the script hash storage file.
 */
 func (s *Service) getScriptHashFile() string {
-	configPath, _ := schema.GetConfigPath()
-	configDir := filepath.Dir(configPath)
-	return filepath.Join(configDir, "script-hashes.json")
+	stateDir, _ := paths.StateDir()
+	return filepath.Join(stateDir, "script-hashes.json")
 }
 
 /*
@@ -352,16 +760,36 @@ func (s *Service) saveScriptHashes(hashFile string, hashes map[string]string) er
 		return err
 	}
 
+	if err := s.fs.MkdirAll(filepath.Dir(hashFile), 0755); err != nil {
+		return err
+	}
 	return s.fs.WriteFile(hashFile, content, 0644)
 }
 
 /*
 managePackages handles the complete package management lifecycle.
-It queries currently installed packages using nix-env -q, compares with the desired
-configuration, and installs/removes packages as needed.
+It queries currently installed packages using the package manager selected by
+nix.manager (nix-env or nix-profile), compares with the desired
+configuration, and installs/removes packages as needed. Packages are installed
+from the nixpkgs revision nixpkgs when it is set. Nothing is changed when the
+configured packages conflict with each other; a *ConflictError is returned
+instead.
 */
-func (s *Service) managePackages(config *schema.Config) error {
-	installedPackages, queryErr := s.getInstalledPackages()
+func (s *Service) managePackages(config *schema.Config, nixpkgs string) error {
+	conflicts, conflictErr := packageConflicts(config.Nix.Packages)
+	if conflictErr != nil {
+		return conflictErr
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+
+	pm, pmErr := packages.NewPackageManager(config.Nix.Manager, s.runner)
+	if pmErr != nil {
+		return pmErr
+	}
+
+	installedPackages, queryErr := pm.ListInstalled()
 	if queryErr != nil {
 		return fmt.Errorf("failed to query installed packages: %w", queryErr)
 	}
@@ -371,34 +799,136 @@ func (s *Service) managePackages(config *schema.Config) error {
 	if len(diff.ToRemove) > 0 {
 		fmt.Printf("Removing %d packages...\n", len(diff.ToRemove))
 		for _, pkg := range diff.ToRemove {
-			if removeErr := s.removePackage(pkg); removeErr != nil {
+			if removeErr := s.removePackage(pm, pkg); removeErr != nil {
 				return fmt.Errorf("failed to remove package %s: %w", pkg, removeErr)
 			}
 		}
 	}
 
+	var results []installResult
 	if len(diff.ToInstall) > 0 {
 		fmt.Printf("Installing %d packages...\n", len(diff.ToInstall))
-		for _, pkg := range diff.ToInstall {
-			if installErr := s.installPackage(pkg); installErr != nil {
-				s.handlePackageInstallationFailure(pkg, installErr)
-				fmt.Printf("⚠️  Skipping %s due to installation failure\n", pkg)
-				continue
+		results = s.installPackages(config, diff.ToInstall, nixpkgs)
+		for _, result := range results {
+			if result.err != nil {
+				s.handlePackageInstallationFailure(result.pkg, result.err)
+				fmt.Printf("⚠️  Skipping %s due to installation failure\n", result.pkg)
 			}
 		}
 	}
 
-	if len(diff.ToRemove) > 0 && len(diff.ToInstall) == 0 {
-		fmt.Println("Running garbage collection to clean up removed packages...")
-		if gcErr := s.runTargetedGarbageCollection(diff.ToRemove); gcErr != nil {
-			fmt.Printf("Warning: Garbage collection failed: %v\n", gcErr)
-		}
+	if config.Nix.AutoGC && len(diff.ToRemove) > 0 {
+		s.runGarbageCollection()
 	}
 
 	if len(diff.ToInstall) == 0 && len(diff.ToRemove) == 0 {
 		fmt.Println("No package changes needed")
 	}
 
+	if summary := failureSummary(results); summary != "" {
+		fmt.Printf("⚠️  %s\n", summary)
+	}
+
+	return nil
+}
+
+/*
+manageHomebrew installs and removes Homebrew formulae and casks so that the
+installed ones match the homebrew section of the config. Only formulae installed
+on request are considered, so dependencies are left to Homebrew. When brew is not
+installed, a warning is printed and nothing is changed. Like Nix packages, a
+failed installation is reported and skipped, while a failed removal is an error.
+*/
+func (s *Service) manageHomebrew(homebrew schema.Homebrew) error {
+	brew := packages.NewHomebrew(s.runner)
+	if !brew.Available() {
+		fmt.Println("⚠️  Homebrew is not installed, skipping Homebrew formulae and casks")
+		return nil
+	}
+
+	installedFormulae, installedCasks, queryErr := brew.ListInstalled()
+	if queryErr != nil {
+		return queryErr
+	}
+
+	formulae := schema.DiffHomebrew(installedFormulae, homebrew.Formulae)
+	casks := schema.DiffHomebrew(installedCasks, homebrew.Casks)
+
+	for _, name := range formulae.ToRemove {
+		fmt.Printf("Removing Homebrew formula: %s\n", name)
+		if removeErr := brew.RemoveFormula(name); removeErr != nil {
+			return fmt.Errorf("failed to remove formula %s: %w", name, removeErr)
+		}
+	}
+	for _, name := range casks.ToRemove {
+		fmt.Printf("Removing Homebrew cask: %s\n", name)
+		if removeErr := brew.RemoveCask(name); removeErr != nil {
+			return fmt.Errorf("failed to remove cask %s: %w", name, removeErr)
+		}
+	}
+
+	for _, name := range formulae.ToInstall {
+		fmt.Printf("Installing Homebrew formula: %s\n", name)
+		if installErr := brew.InstallFormula(name); installErr != nil {
+			fmt.Printf("⚠️  Skipping formula %s due to installation failure: %v\n", name, installErr)
+		}
+	}
+	for _, name := range casks.ToInstall {
+		fmt.Printf("Installing Homebrew cask: %s\n", name)
+		if installErr := brew.InstallCask(name); installErr != nil {
+			fmt.Printf("⚠️  Skipping cask %s due to installation failure: %v\n", name, installErr)
+		}
+	}
+
+	if len(formulae.ToInstall)+len(formulae.ToRemove)+len(casks.ToInstall)+len(casks.ToRemove) == 0 {
+		fmt.Println("No Homebrew changes needed")
+	}
+
+	return nil
+}
+
+/*
+manageSystemPackages installs the configured system packages that are missing.
+Installing them needs sudo, so unless allow is true the install command is only
+printed. The section is skipped with a message outside Linux and on distributions
+without the configured backend. System packages are never removed.
+*/
+func (s *Service) manageSystemPackages(system schema.SystemPackages, allow bool) error {
+	if runtime.GOOS != "linux" {
+		fmt.Println("ℹ️  System packages are only managed on Linux, skipping")
+		return nil
+	}
+
+	manager, managerErr := packages.NewSystemManager(system.Backend, s.runner)
+	if managerErr != nil {
+		return managerErr
+	}
+	if !manager.Available() {
+		fmt.Printf("ℹ️  %s is not available on this system, skipping system packages\n", manager.Backend())
+		return nil
+	}
+
+	missing, queryErr := manager.Missing(system.Packages)
+	if queryErr != nil {
+		return queryErr
+	}
+	if len(missing) == 0 {
+		fmt.Println("No system package changes needed")
+		return nil
+	}
+
+	command := manager.InstallCommand(missing)
+	if !allow {
+		fmt.Printf("⚠️  %d system packages are not installed. Install them with:\n", len(missing))
+		fmt.Printf("  %s\n", strings.Join(command, " "))
+		fmt.Println("Or re-run with --allow-system-packages to install them now.")
+		return nil
+	}
+
+	fmt.Printf("Installing system packages: %s\n", strings.Join(command, " "))
+	if installErr := s.runner.Run(command[0], command[1:]...); installErr != nil {
+		return fmt.Errorf("failed to install %s packages: %w", manager.Backend(), installErr)
+	}
 	return nil
 }
 
@@ -407,104 +937,122 @@ handlePackageInstallationFailure provides helpful error messages and suggestions
 for common package installation failures, without hard-coding package-specific logic.
 */
 func (s *Service) handlePackageInstallationFailure(pkg string, err error) {
-	errorStr := err.Error()
-
 	fmt.Printf("❌ Failed to install %s: %v\n", pkg, err)
 
-	if strings.Contains(errorStr, "Operation not permitted") {
+	switch nixerrors.Kind(err) {
+	case nixerrors.ErrPermissionDenied:
 		fmt.Println("💡 Suggestions:")
 		fmt.Println("   • This package may have build issues on your system")
 		fmt.Println("   • Consider installing manually or using an alternative package manager")
 		fmt.Println("   • Check if the package is available through other sources")
-	}
-
-	if strings.Contains(errorStr, "unfree license") {
+	case nixerrors.ErrUnfreeLicense:
 		fmt.Println("💡 Suggestion: This package requires unfree license acceptance")
 		fmt.Println("   • The installer already sets NIXPKGS_ALLOW_UNFREE=1")
 		fmt.Println("   • You may need to accept the license manually")
+	case nixerrors.ErrNoSuchAttribute:
+		fmt.Println("💡 Suggestion: This package does not exist in nixpkgs")
+		fmt.Printf("   • Search for the correct name with 'nix-foundry search %s'\n", pkg)
+		fmt.Println("   • Run 'nix-foundry config validate' to check all configured packages")
+	case nixerrors.ErrHashMismatch:
+		fmt.Println("💡 Suggestion: A downloaded source did not match its expected hash")
+		fmt.Println("   • The upstream source may have changed; try updating your channel or flake input")
+	case nixerrors.ErrNetworkFailure:
+		fmt.Println("💡 Suggestion: A download failed")
+		fmt.Println("   • Check your network connection and proxy settings, then re-run 'nix-foundry config apply'")
 	}
 
 	fmt.Println()
 }
 
 /*
-removePackage removes a single package using nix-env.
-It configures the environment and streams the removal output to the user.
+failureSummary describes the failed installations by kind, for example
+"3 packages failed: 2 not found, 1 unfree license". Failures that could not be
+classified are counted as "other". It returns an empty string if nothing failed.
 */
-func (s *Service) removePackage(pkg string) error {
-	fmt.Printf("Removing package: %s\n", pkg)
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
-		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-			"/nix/var/nix/profiles/default/bin/nix-env -e %s",
-		pkg))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err == nil && runtime.GOOS == "darwin" {
-		if cleanupErr := s.CleanupMacOSAppSymlinks(pkg); cleanupErr != nil {
-			fmt.Printf("Warning: Failed to cleanup symlinks for %s: %v\n", pkg, cleanupErr)
+func failureSummary(results []installResult) string {
+	kinds := []error{
+		nixerrors.ErrNoSuchAttribute,
+		nixerrors.ErrUnfreeLicense,
+		nixerrors.ErrPermissionDenied,
+		nixerrors.ErrHashMismatch,
+		nixerrors.ErrNetworkFailure,
+	}
+
+	counts := make(map[error]int)
+	failed, other := 0, 0
+	for _, result := range results {
+		if result.err == nil {
+			continue
+		}
+		failed++
+		if kind := nixerrors.Kind(result.err); kind != nil {
+			counts[kind]++
+		} else {
+			other++
 		}
 	}
-	return err
+	if failed == 0 {
+		return ""
+	}
+
+	var parts []string
+	for _, kind := range kinds {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	if other > 0 {
+		parts = append(parts, fmt.Sprintf("%d other", other))
+	}
+
+	noun := "packages"
+	if failed == 1 {
+		noun = "package"
+	}
+	return fmt.Sprintf("%d %s failed: %s", failed, noun, strings.Join(parts, ", "))
 }
 
 /*
-runTargetedGarbageCollection runs garbage collection only when we're purely removing packages.
-This avoids cleaning up build artifacts for packages we just installed in the same operation.
+removePackage removes a single package using the configured package manager.
+On macOS, the package's store paths are resolved before removal so that its
+application symlinks can be cleaned up afterwards.
 */
-func (s *Service) runTargetedGarbageCollection(removedPackages []string) error {
-	fmt.Printf("  Cleaning up store paths for: %s\n", strings.Join(removedPackages, ", "))
-
-	cmd := exec.Command("bash", "-c",
-		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-			"/nix/var/nix/profiles/default/bin/nix-collect-garbage")
+func (s *Service) removePackage(pm packages.PackageManager, pkg string) error {
+	fmt.Printf("Removing package: %s\n", pkg)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("garbage collection failed: %s: %w", output, err)
+	var storePaths []string
+	if runtime.GOOS == "darwin" {
+		storePaths, _ = pm.OutPaths(pkg)
 	}
 
-	outputStr := string(output)
-	if strings.Contains(outputStr, "freed") {
-		lines := strings.Split(outputStr, "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "freed") || strings.Contains(line, "deleting") {
-				fmt.Printf("  %s\n", strings.TrimSpace(line))
-			}
+	err := pm.Remove(pkg)
+	if err == nil && runtime.GOOS == "darwin" {
+		if cleanupErr := s.CleanupMacOSAppSymlinks(storePaths); cleanupErr != nil {
+			logging.Warn("failed to clean up symlinks", "package", pkg, "error", cleanupErr)
 		}
 	}
-
-	return nil
+	return err
 }
 
 /*
-getInstalledPackages queries nix-env to get a list of currently installed packages.
-Uses JSON output for accurate package name parsing, avoiding issues with compound package names.
+runGarbageCollection runs a single garbage collection pass to reclaim the store
+paths freed by package removals and reports how much space was reclaimed.
+Failures are reported as warnings since the removals themselves succeeded.
 */
-func (s *Service) getInstalledPackages() ([]string, error) {
-	cmd := exec.Command("bash", "-c",
-		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-			"/nix/var/nix/profiles/default/bin/nix-env -q --json")
-
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to query installed packages: %w", err)
-	}
+func (s *Service) runGarbageCollection() {
+	fmt.Println("Running garbage collection to clean up removed packages...")
 
-	var packages map[string]map[string]interface{}
-	if jsonErr := json.Unmarshal(output, &packages); jsonErr != nil {
-		return nil, fmt.Errorf("failed to parse package JSON: %w", jsonErr)
+	result, gcErr := nix.CollectGarbage(s.runner, s.fs, false)
+	if gcErr != nil {
+		logging.Warn("garbage collection failed", "error", gcErr)
+		return
 	}
 
-	var packageNames []string
-	for _, pkg := range packages {
-		if pname, ok := pkg["pname"].(string); ok {
-			packageNames = append(packageNames, pname)
-		}
+	if result.Freed != "" {
+		fmt.Printf("  🗑️  Reclaimed %s (%d store paths deleted)\n", result.Freed, result.PathsDeleted)
+	} else {
+		fmt.Println("  No store paths were freed")
 	}
-
-	return packageNames, nil
 }
 
 /*
@@ -529,21 +1077,21 @@ func (s *Service) ListConfigs() ([]*schema.Config, error) {
 		if readErr != nil {
 			return nil, fmt.Errorf("failed to read user config: %w", readErr)
 		}
+		fileContent, migrateErr := migrateConfigFile(s.fs, configPath, fileContent)
+		if migrateErr != nil {
+			return nil, migrateErr
+		}
 
 		userConfig := &schema.Config{}
 		if unmarshalErr := yaml.Unmarshal(fileContent, userConfig); unmarshalErr != nil {
 			return nil, fmt.Errorf("failed to parse user config: %w", unmarshalErr)
 		}
+		setScriptScope(userConfig, schema.UserConfig)
 
 		configs = append(configs, userConfig)
 	}
 
-	userHomeDir, homeDirErr := os.UserHomeDir()
-	if homeDirErr != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", homeDirErr)
-	}
-
-	teamsDir := filepath.Join(userHomeDir, ".config", "nix-foundry", "teams")
+	teamsDir := filepath.Join(filepath.Dir(configPath), "teams")
 	if s.fs.Exists(teamsDir) {
 		entries, readDirErr := os.ReadDir(teamsDir)
 		if readDirErr != nil {
@@ -552,10 +1100,15 @@ func (s *Service) ListConfigs() ([]*schema.Config, error) {
 
 		for _, entry := range entries {
 			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
-				fileContent, readErr := s.fs.ReadFile(filepath.Join(teamsDir, entry.Name()))
+				teamPath := filepath.Join(teamsDir, entry.Name())
+				fileContent, readErr := s.fs.ReadFile(teamPath)
 				if readErr != nil {
 					continue
 				}
+				fileContent, migrateErr := migrateConfigFile(s.fs, teamPath, fileContent)
+				if migrateErr != nil {
+					return nil, migrateErr
+				}
 
 				teamConfig := &schema.Config{}
 				if unmarshalErr := yaml.Unmarshal(fileContent, teamConfig); unmarshalErr != nil {
@@ -573,76 +1126,473 @@ func (s *Service) ListConfigs() ([]*schema.Config, error) {
 		if readErr != nil {
 			return nil, fmt.Errorf("failed to read project config: %w", readErr)
 		}
+		fileContent, migrateErr := migrateConfigFile(s.fs, projectConfigPath, fileContent)
+		if migrateErr != nil {
+			return nil, migrateErr
+		}
 
 		projectConfig := &schema.Config{}
 		if unmarshalErr := yaml.Unmarshal(fileContent, projectConfig); unmarshalErr != nil {
 			return nil, fmt.Errorf("failed to parse project config: %w", unmarshalErr)
 		}
 
-		configs = append(configs, projectConfig)
+		configs = append(configs, projectConfig)
+	}
+
+	return configs, nil
+}
+
+/*
+GetActiveConfig returns the active configuration for the current context.
+It performs the following steps:
+1. Loads the user configuration
+2. If the user config extends a team config, merges them (see resolveTeamChain)
+3. If the current directory has a project config, merges that on top
+4. Applies the active profile (see ActiveProfile), if any
+
+The merging follows the override principle where later configs take precedence
+over earlier ones, so the precedence is team, then user, then project (highest).
+An active profile that no longer exists is ignored with a warning, so the next
+apply removes the packages only it contributed.
+*/
+func (s *Service) GetActiveConfig() (*schema.Config, error) {
+	mergedConfig, mergeErr := s.loadMergedConfig()
+	if mergeErr != nil {
+		return nil, mergeErr
+	}
+
+	profile := s.ActiveProfile()
+	activeConfig, profileErr := withProfile(mergedConfig, profile)
+	if profileErr != nil {
+		logging.Warn("ignoring the active profile", "profile", profile, "error", profileErr)
+		return mergedConfig, nil
+	}
+	return activeConfig, nil
+}
+
+/*
+loadMergedConfig loads the user config and merges its team chain and the project
+config of the current directory, without applying a profile. The files that
+contributed are logged as a debug message, the team nearest to the user first.
+*/
+func (s *Service) loadMergedConfig() (*schema.Config, error) {
+	var sources []string
+	userConfig := schema.NewDefaultConfig()
+	configPath, pathErr := schema.GetConfigPath()
+	if pathErr != nil {
+		return nil, fmt.Errorf("failed to get config path: %w", pathErr)
+	}
+
+	if s.fs.Exists(configPath) {
+		sources = append(sources, configPath)
+		fileContent, readErr := s.fs.ReadFile(configPath)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read user config: %w", readErr)
+		}
+		fileContent, migrateErr := migrateConfigFile(s.fs, configPath, fileContent)
+		if migrateErr != nil {
+			return nil, migrateErr
+		}
+
+		if unmarshalErr := yaml.Unmarshal(fileContent, userConfig); unmarshalErr != nil {
+			return nil, fmt.Errorf("failed to parse user config: %w", unmarshalErr)
+		}
+	}
+
+	if userConfig.Base != "" {
+		teamConfig, teams, teamErr := s.resolveTeamChain(userConfig.Base)
+		if teamErr != nil {
+			return nil, fmt.Errorf("failed to get team config: %w", teamErr)
+		}
+		userConfig = s.mergeConfigs(teamConfig, userConfig)
+		for _, team := range teams {
+			teamPath, _ := schema.GetTeamConfigPath(team)
+			sources = append(sources, teamPath)
+		}
+	}
+
+	projectPath := filepath.Join(".nix-foundry", "config.yaml")
+	if s.fs.Exists(projectPath) {
+		projectConfig, projectErr := s.GetConfig(schema.ProjectConfig, "")
+		if projectErr != nil {
+			return nil, fmt.Errorf("failed to get project config: %w", projectErr)
+		}
+		userConfig = s.layerProjectConfig(userConfig, projectConfig)
+		sources = append(sources, projectPath)
+	}
+
+	logging.Debug("loaded active configuration", "sources", sources)
+	return userConfig, nil
+}
+
+/*
+withProfile returns a copy of config with the named profile applied: its packages
+are added to the core packages and its env takes precedence. An empty name
+returns config unchanged.
+*/
+func withProfile(config *schema.Config, name string) (*schema.Config, error) {
+	if name == "" {
+		return config, nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(config.ProfileNames(), ", "))
+	}
+
+	result := *config
+	result.Nix.Packages.Core = mergeNames(config.Nix.Packages.Core, profile.Packages)
+	result.Env = mergeEnv(config.Env, profile.Env)
+	return &result, nil
+}
+
+/*
+ActiveProfile returns the name of the profile applied on top of the configuration,
+as last selected with ApplyOptions.SelectProfile, or an empty string when none is.
+*/
+func (s *Service) ActiveProfile() string {
+	content, readErr := s.fs.ReadFile(s.getProfileFile())
+	if readErr != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+/*
+saveActiveProfile records name as the active profile. An empty name clears it.
+*/
+func (s *Service) saveActiveProfile(name string) error {
+	profileFile := s.getProfileFile()
+	if name == "" {
+		if !s.fs.Exists(profileFile) {
+			return nil
+		}
+		return s.fs.Remove(profileFile)
+	}
+	if mkdirErr := s.fs.MkdirAll(filepath.Dir(profileFile), 0755); mkdirErr != nil {
+		return mkdirErr
+	}
+	return s.fs.WriteFile(profileFile, []byte(name+"\n"), 0644)
+}
+
+/*
+getProfileFile returns the path to the file recording the active profile.
+*/
+func (s *Service) getProfileFile() string {
+	stateDir, _ := paths.StateDir()
+	return filepath.Join(stateDir, "active-profile")
+}
+
+/*
+layerProjectConfig merges the project config on top of the user config, which
+already includes its teams. Project settings, packages and environment variables
+take precedence, but the result keeps the user config's identity (type, base and
+metadata) and its autoUpdate setting, which concerns nix-foundry itself rather
+than the project.
+*/
+func (s *Service) layerProjectConfig(userConfig, projectConfig *schema.Config) *schema.Config {
+	merged := s.mergeConfigs(userConfig, projectConfig)
+	merged.Version = userConfig.Version
+	merged.Kind = userConfig.Kind
+	merged.Type = userConfig.Type
+	merged.Base = userConfig.Base
+	merged.Metadata = userConfig.Metadata
+	merged.Settings.AutoUpdate = userConfig.Settings.AutoUpdate
+	return merged
+}
+
+/*
+GetValue returns the value at a dotted path, such as settings.shell, in the
+active configuration. See schema.GetValue for the path syntax.
+*/
+func (s *Service) GetValue(path string) (interface{}, error) {
+	activeConfig, configErr := s.GetActiveConfig()
+	if configErr != nil {
+		return nil, fmt.Errorf("failed to get active config: %w", configErr)
+	}
+	return schema.GetValue(activeConfig, path)
+}
+
+/*
+SetValue sets the value at a dotted path in the user configuration. The change
+is only saved if the resulting configuration is valid.
+*/
+func (s *Service) SetValue(path, value string) error {
+	return s.updateUserConfig(func(config *schema.Config) error {
+		return schema.SetValue(config, path, value)
+	})
+}
+
+/*
+AppendValue adds value to the list at a dotted path, such as nix.packages.core,
+in the user configuration.
+*/
+func (s *Service) AppendValue(path, value string) error {
+	return s.updateUserConfig(func(config *schema.Config) error {
+		return schema.AppendValue(config, path, value)
+	})
+}
+
+/*
+RemoveValue removes value from the list at a dotted path in the user
+configuration.
+*/
+func (s *Service) RemoveValue(path, value string) error {
+	return s.updateUserConfig(func(config *schema.Config) error {
+		return schema.RemoveValue(config, path, value)
+	})
+}
+
+/*
+updateUserConfig loads the user configuration, applies update to it, and saves
+it if the result passes validation.
+*/
+func (s *Service) updateUserConfig(update func(*schema.Config) error) error {
+	config, configErr := s.GetConfig(schema.UserConfig, "")
+	if configErr != nil {
+		return fmt.Errorf("failed to load user config: %w", configErr)
+	}
+
+	if updateErr := update(config); updateErr != nil {
+		return updateErr
+	}
+	if config.Type != schema.UserConfig {
+		return fmt.Errorf("the type of the user configuration cannot be changed")
+	}
+
+	if validateErr := schema.ValidateConfig(config); validateErr != nil {
+		return fmt.Errorf("invalid configuration: %w", validateErr)
+	}
+
+	if saveErr := s.SaveConfig(config); saveErr != nil {
+		return fmt.Errorf("failed to save config: %w", saveErr)
+	}
+	return nil
+}
+
+/*
+setScriptScope records that the scripts of config were loaded as a configType
+config. The scope comes from where the file was loaded, not from its type field,
+so a team config cannot claim to be a user config.
+*/
+func setScriptScope(config *schema.Config, configType schema.ConfigType) {
+	for idx := range config.Nix.Scripts {
+		config.Nix.Scripts[idx].Scope = configType
+	}
+}
+
+/*
+maxTeamDepth is the maximum number of team configs in a base chain.
+*/
+const maxTeamDepth = 10
+
+/*
+resolveTeamChain loads the team config called name and the teams it extends
+through their Base field, and merges them so that each team overrides the team
+it extends. It also returns the names of the teams in the chain, starting with
+name. It returns an error if a team in the chain is missing, the chain refers
+back to itself, or it is longer than maxTeamDepth.
+*/
+func (s *Service) resolveTeamChain(name string) (*schema.Config, []string, error) {
+	var chain []*schema.Config
+	var names []string
+	seen := make(map[string]bool)
+
+	for current := name; current != ""; {
+		if seen[current] {
+			return nil, nil, fmt.Errorf("team config %q is part of a base cycle", current)
+		}
+		if len(chain) == maxTeamDepth {
+			return nil, nil, fmt.Errorf("team config %q exceeds the maximum inheritance depth of %d", name, maxTeamDepth)
+		}
+		seen[current] = true
+
+		teamConfig, teamErr := s.GetConfig(schema.TeamConfig, current)
+		if teamErr != nil {
+			if len(chain) > 0 {
+				return nil, nil, fmt.Errorf("team config %q extends %q: %w", chain[len(chain)-1].Metadata.Name, current, teamErr)
+			}
+			return nil, nil, teamErr
+		}
+		if teamConfig.Metadata.Name == "" {
+			teamConfig.Metadata.Name = current
+		}
+
+		chain = append(chain, teamConfig)
+		names = append(names, current)
+		current = teamConfig.Base
 	}
 
-	return configs, nil
+	merged := chain[len(chain)-1]
+	for idx := len(chain) - 2; idx >= 0; idx-- {
+		merged = s.mergeConfigs(merged, chain[idx])
+	}
+	return merged, names, nil
 }
 
 /*
-GetActiveConfig returns the active configuration for the current context.
-It performs the following steps:
-1. Loads the user configuration
-2. If the user config extends a team config, merges them
-3. If the resulting config extends a project config, merges that as well
-
-The merging follows the override principle where later configs take precedence
-over earlier ones in the chain.
+mergeConfigs merges two configurations, with the override configuration taking precedence.
+It handles merging of all configuration aspects including metadata, settings,
+and Nix-specific configurations while preserving the override hierarchy.
 */
-func (s *Service) GetActiveConfig() (*schema.Config, error) {
-	userConfig := schema.NewDefaultConfig()
-	configPath, pathErr := schema.GetConfigPath()
-	if pathErr != nil {
-		return nil, fmt.Errorf("failed to get config path: %w", pathErr)
+func (s *Service) mergeConfigs(base, override *schema.Config) *schema.Config {
+	result := &schema.Config{
+		Version:        override.Version,
+		Kind:           override.Kind,
+		Type:           override.Type,
+		Base:           override.Base,
+		Metadata:       override.Metadata,
+		Settings:       s.mergeSettings(base.Settings, override.Settings),
+		Nix:            s.mergeNix(base.Nix, override.Nix),
+		Homebrew:       mergeHomebrew(base.Homebrew, override.Homebrew),
+		SystemPackages: mergeSystemPackages(base.SystemPackages, override.SystemPackages),
+		Editors:        mergeEditors(base.Editors, override.Editors),
+		Git:            mergeGit(base, override),
+		Env:            mergeEnv(base.Env, override.Env),
+		Profiles:       mergeProfiles(base.Profiles, override.Profiles),
 	}
+	return result
+}
 
-	if s.fs.Exists(configPath) {
-		fileContent, readErr := s.fs.ReadFile(configPath)
-		if readErr != nil {
-			return nil, fmt.Errorf("failed to read user config: %w", readErr)
+/*
+mergeProfiles merges two sets of profiles. Profiles with the same name are
+combined: their packages are merged and override env values take precedence.
+*/
+func mergeProfiles(base, override map[string]schema.Profile) map[string]schema.Profile {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	result := make(map[string]schema.Profile, len(base)+len(override))
+	for name, profile := range base {
+		result[name] = profile
+	}
+	for name, profile := range override {
+		result[name] = schema.Profile{
+			Packages: mergeNames(result[name].Packages, profile.Packages),
+			Env:      mergeEnv(result[name].Env, profile.Env),
 		}
+	}
+	return result
+}
 
-		if unmarshalErr := yaml.Unmarshal(fileContent, userConfig); unmarshalErr != nil {
-			return nil, fmt.Errorf("failed to parse user config: %w", unmarshalErr)
-		}
+/*
+mergeHomebrew merges two Homebrew sections, combining their formulae and casks
+without duplicates, the same way package lists are merged.
+*/
+func mergeHomebrew(base, override schema.Homebrew) schema.Homebrew {
+	return schema.Homebrew{
+		Formulae: mergeNames(base.Formulae, override.Formulae),
+		Casks:    mergeNames(base.Casks, override.Casks),
+	}
+}
+
+/*
+mergeEditors merges two editor sections, combining their extensions and plugins
+without duplicates, so team configs can contribute to the user's editors.
+*/
+func mergeEditors(base, override schema.Editors) schema.Editors {
+	return schema.Editors{
+		VSCode: schema.VSCode{Extensions: mergeNames(base.VSCode.Extensions, override.VSCode.Extensions)},
+		Neovim: schema.Neovim{Plugins: mergeNames(base.Neovim.Plugins, override.Neovim.Plugins)},
 	}
+}
 
-	if userConfig.Base != "" {
-		teamConfig, teamErr := s.GetConfig(schema.TeamConfig, userConfig.Base)
-		if teamErr != nil {
-			return nil, fmt.Errorf("failed to get team config: %w", teamErr)
+/*
+mergeGit merges the git identities of two configurations. Identities of the same
+scope are merged field by field; a project identity replaces a global one. The
+scope of the result is resolved from the type of the config it came from.
+*/
+func mergeGit(base, override *schema.Config) schema.Git {
+	baseGit, overrideGit := base.Git, override.Git
+	if overrideGit.IsEmpty() {
+		if !baseGit.IsEmpty() {
+			baseGit.Scope = baseGit.ScopeFor(base.Type)
 		}
-		userConfig = s.mergeConfigs(teamConfig, userConfig)
+		return baseGit
+	}
+	overrideGit.Scope = overrideGit.ScopeFor(override.Type)
+	if baseGit.IsEmpty() || overrideGit.Scope != baseGit.ScopeFor(base.Type) {
+		return overrideGit
 	}
+	baseGit.Scope = overrideGit.Scope
+	if overrideGit.Name != "" {
+		baseGit.Name = overrideGit.Name
+	}
+	if overrideGit.Email != "" {
+		baseGit.Email = overrideGit.Email
+	}
+	if overrideGit.SigningKey != "" {
+		baseGit.SigningKey = overrideGit.SigningKey
+	}
+	return baseGit
+}
 
-	projectConfig, projectErr := s.GetConfig(schema.ProjectConfig, "")
-	if projectErr == nil && userConfig.Base == projectConfig.Metadata.Name {
-		userConfig = s.mergeConfigs(projectConfig, userConfig)
+/*
+mergeSystemPackages merges two system package sections. Packages are combined
+when both use the same backend; otherwise the override's section replaces the
+base, since package names differ between backends.
+*/
+func mergeSystemPackages(base, override schema.SystemPackages) schema.SystemPackages {
+	if override.IsEmpty() {
+		return base
+	}
+	if base.IsEmpty() || base.Backend != override.Backend {
+		return override
+	}
+	return schema.SystemPackages{
+		Backend:  base.Backend,
+		Packages: mergeNames(base.Packages, override.Packages),
 	}
+}
 
-	return userConfig, nil
+/*
+mergeNames returns the union of two name lists in sorted order.
+*/
+func mergeNames(base, override []string) []string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(base)+len(override))
+	var result []string
+	for _, name := range append(append([]string{}, base...), override...) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
 }
 
 /*
-mergeConfigs merges two configurations, with the override configuration taking precedence.
-It handles merging of all configuration aspects including metadata, settings,
-and Nix-specific configurations while preserving the override hierarchy.
+mergeOrdered returns the names in base followed by the names in override that
+are not in base, each listed once in the order it first appears.
 */
-func (s *Service) mergeConfigs(base, override *schema.Config) *schema.Config {
-	result := &schema.Config{
-		Version:  override.Version,
-		Kind:     override.Kind,
-		Type:     override.Type,
-		Base:     override.Base,
-		Metadata: override.Metadata,
-		Settings: s.mergeSettings(base.Settings, override.Settings),
-		Nix:      s.mergeNix(base.Nix, override.Nix),
+func mergeOrdered(base, override []string) []string {
+	seen := make(map[string]bool, len(base)+len(override))
+	result := make([]string, 0, len(base)+len(override))
+	for _, name := range append(append([]string{}, base...), override...) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+/*
+mergeEnv merges two sets of environment variables, with override values taking
+precedence.
+*/
+func mergeEnv(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(base)+len(override))
+	for name, value := range base {
+		result[name] = value
+	}
+	for name, value := range override {
+		result[name] = value
 	}
 	return result
 }
@@ -663,20 +1613,31 @@ func (s *Service) mergeSettings(base, override schema.Settings) schema.Settings
 	if override.UpdateInterval != 0 {
 		result.UpdateInterval = override.UpdateInterval
 	}
+	if override.CommandTimeout != 0 {
+		result.CommandTimeout = override.CommandTimeout
+	}
 	result.AutoUpdate = override.AutoUpdate
 	return result
 }
 
 /*
 mergeNix merges two Nix configurations, combining their package lists and scripts.
-It preserves the override's manager setting if specified, and concatenates
-script lists from both configurations.
+It preserves the override's manager, nixpkgs and install concurrency settings
+if specified, enables automatic garbage collection if either configuration
+enables it, and concatenates script lists from both configurations.
 */
 func (s *Service) mergeNix(base, override schema.Nix) schema.Nix {
 	result := base
 	if override.Manager != "" {
 		result.Manager = override.Manager
 	}
+	if override.Nixpkgs.Ref != "" {
+		result.Nixpkgs = override.Nixpkgs
+	}
+	result.AutoGC = base.AutoGC || override.AutoGC
+	if override.InstallConcurrency != 0 {
+		result.InstallConcurrency = override.InstallConcurrency
+	}
 	result.Packages = s.mergePackages(base.Packages, override.Packages)
 	result.Scripts = append(base.Scripts, override.Scripts...)
 	return result
@@ -685,39 +1646,66 @@ func (s *Service) mergeNix(base, override schema.Nix) schema.Nix {
 /*
 mergePackages merges two package lists while maintaining uniqueness.
 It handles both core and optional packages, ensuring no duplicates exist
-in the final package lists. The function uses maps for efficient deduplication
-before converting back to slices for the final result.
+in the final package lists. Pins from the override replace pins for the
+same package. Packages keep the order they are listed in, base first, so the
+merged configuration is the same on every run.
 */
 func (s *Service) mergePackages(base, override schema.Packages) schema.Packages {
 	result := schema.Packages{
-		Core:     make([]string, 0),
-		Optional: make([]string, 0),
+		Core:     mergeOrdered(base.Core, override.Core),
+		Optional: mergeOrdered(base.Optional, override.Optional),
 	}
 
-	coreMap := make(map[string]bool)
-	optionalMap := make(map[string]bool)
-
-	for _, pkg := range base.Core {
-		coreMap[pkg] = true
+	for _, pinned := range base.Pinned {
+		result.Pin(pinned.Name, pinned.FlakeRef)
 	}
-	for _, pkg := range base.Optional {
-		optionalMap[pkg] = true
+	for _, pinned := range override.Pinned {
+		result.Pin(pinned.Name, pinned.FlakeRef)
 	}
 
-	for _, pkg := range override.Core {
-		coreMap[pkg] = true
+	result.Groups = mergeGroups(base.Groups, override.Groups)
+	result.GroupOverrides = mergeGroupOverrides(base.GroupOverrides, override.GroupOverrides)
+
+	return result
+}
+
+/*
+mergeGroups merges two sets of package groups. Groups with the same name are
+combined: their packages are merged and the group is enabled by default if
+either config enables it by default.
+*/
+func mergeGroups(base, override map[string]schema.PackageGroup) map[string]schema.PackageGroup {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	result := make(map[string]schema.PackageGroup, len(base)+len(override))
+	for name, group := range base {
+		result[name] = group
 	}
-	for _, pkg := range override.Optional {
-		optionalMap[pkg] = true
+	for name, group := range override {
+		result[name] = schema.PackageGroup{
+			Packages: mergeNames(result[name].Packages, group.Packages),
+			Default:  result[name].Default || group.Default,
+		}
 	}
+	return result
+}
 
-	for pkg := range coreMap {
-		result.Core = append(result.Core, pkg)
+/*
+mergeGroupOverrides merges the groups enabled or disabled in two configs, with
+override values taking precedence.
+*/
+func mergeGroupOverrides(base, override map[string]bool) map[string]bool {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
 	}
-	for pkg := range optionalMap {
-		result.Optional = append(result.Optional, pkg)
+	result := make(map[string]bool, len(base)+len(override))
+	for name, enabled := range base {
+		result[name] = enabled
+	}
+	for name, enabled := range override {
+		result[name] = enabled
 	}
-
 	return result
 }
 
@@ -739,11 +1727,11 @@ func (s *Service) GetConfig(configType schema.ConfigType, name string) (*schema.
 		}
 
 	case schema.TeamConfig:
-		userHomeDir, homeDirErr := os.UserHomeDir()
-		if homeDirErr != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", homeDirErr)
+		var pathErr error
+		configPath, pathErr = schema.GetTeamConfigPath(name)
+		if pathErr != nil {
+			return nil, fmt.Errorf("failed to get config path: %w", pathErr)
 		}
-		configPath = filepath.Join(userHomeDir, ".config", "nix-foundry", "teams", name+".yaml")
 
 	case schema.ProjectConfig:
 		configPath = filepath.Join(".nix-foundry", "config.yaml")
@@ -760,11 +1748,16 @@ func (s *Service) GetConfig(configType schema.ConfigType, name string) (*schema.
 	if readErr != nil {
 		return nil, fmt.Errorf("failed to read config: %w", readErr)
 	}
+	fileContent, migrateErr := migrateConfigFile(s.fs, configPath, fileContent)
+	if migrateErr != nil {
+		return nil, migrateErr
+	}
 
 	config := &schema.Config{}
 	if unmarshalErr := yaml.Unmarshal(fileContent, config); unmarshalErr != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", unmarshalErr)
 	}
+	setScriptScope(config, configType)
 
 	return config, nil
 }
@@ -772,18 +1765,22 @@ func (s *Service) GetConfig(configType schema.ConfigType, name string) (*schema.
 /*
 UninstallConfig removes all Nix Foundry configuration files and directories.
 This includes:
-1. User configuration directory (~/.config/nix-foundry)
-2. Project configuration directory (./.nix-foundry)
+1. The managed include block in the user's gitconfig (see manageGit)
+2. User configuration directory (see schema.GetConfigDir)
+3. Project configuration directory (./.nix-foundry)
 
 Returns an error if any deletion operation fails.
 */
 func (s *Service) UninstallConfig() error {
-	userHomeDir, homeDirErr := os.UserHomeDir()
-	if homeDirErr != nil {
-		return fmt.Errorf("failed to get home directory: %w", homeDirErr)
+	configDir, dirErr := schema.GetConfigDir()
+	if dirErr != nil {
+		return fmt.Errorf("failed to get config directory: %w", dirErr)
+	}
+
+	if gitErr := s.removeGitIncludes(); gitErr != nil {
+		return gitErr
 	}
 
-	configDir := filepath.Join(userHomeDir, ".config", "nix-foundry")
 	if removeErr := s.fs.Remove(configDir); removeErr != nil {
 		return fmt.Errorf("failed to remove config directory: %w", removeErr)
 	}
@@ -820,11 +1817,11 @@ func (s *Service) InitConfigWithType(configType schema.ConfigType, name string)
 
 	switch configType {
 	case schema.TeamConfig:
-		userHomeDir, homeDirErr := os.UserHomeDir()
-		if homeDirErr != nil {
-			return fmt.Errorf("failed to get home directory: %w", homeDirErr)
+		var pathErr error
+		configPath, pathErr = schema.GetTeamConfigPath(name)
+		if pathErr != nil {
+			return fmt.Errorf("failed to get config path: %w", pathErr)
 		}
-		configPath = filepath.Join(userHomeDir, ".config", "nix-foundry", "teams", name+".yaml")
 
 	case schema.ProjectConfig:
 		configPath = filepath.Join(".nix-foundry", "config.yaml")
@@ -844,52 +1841,31 @@ func (s *Service) InitConfigWithType(configType schema.ConfigType, name string)
 		return fmt.Errorf("failed to marshal config: %w", marshalErr)
 	}
 
-	if writeErr := s.fs.WriteFile(configPath, content, 0664); writeErr != nil {
+	if writeErr := s.fs.AtomicWriteFile(configPath, content, 0664); writeErr != nil {
 		return fmt.Errorf("failed to write config: %w", writeErr)
 	}
 
 	return nil
 }
 
-/*
-isPermissionError checks if an error is likely caused by macOS permission issues.
-*/
-func (s *Service) isPermissionError(err error) bool {
-	if runtime.GOOS != "darwin" {
-		return false
-	}
-
-	errorMsg := strings.ToLower(err.Error())
-	return strings.Contains(errorMsg, "operation not permitted") ||
-		strings.Contains(errorMsg, "permission denied") ||
-		strings.Contains(errorMsg, "mkdir: /nix/store") ||
-		strings.Contains(errorMsg, "cannot create directory")
-}
-
 /*
 symlinkMacOSApps automatically creates symlinks for GUI applications in /Applications
 so they appear in Launchpad and Finder. This searches for .app bundles in the
-individual package store paths and symlinks them to the system Applications folder.
+package's store output paths and symlinks them to the system Applications folder.
 */
-func (s *Service) symlinkMacOSApps(pkg string) error {
+func (s *Service) symlinkMacOSApps(pm packages.PackageManager, out io.Writer, pkg string) error {
 	packageName := pkg
 	if strings.Contains(pkg, ".") {
 		parts := strings.Split(pkg, ".")
 		packageName = parts[len(parts)-1]
 	}
 
-	cmd := exec.Command("find", "/nix/store", "-name", "*"+packageName+"*", "-type", "d", "-maxdepth", "1")
-	output, err := cmd.Output()
+	storePaths, err := pm.OutPaths(packageName)
 	if err != nil {
 		return nil
 	}
 
-	storePaths := strings.Split(strings.TrimSpace(string(output)), "\n")
 	for _, storePath := range storePaths {
-		if storePath == "" {
-			continue
-		}
-
 		err := filepath.Walk(storePath, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return nil
@@ -897,20 +1873,24 @@ func (s *Service) symlinkMacOSApps(pkg string) error {
 
 			if info.IsDir() && strings.HasSuffix(info.Name(), ".app") {
 				appName := info.Name()
-				targetPath := filepath.Join("/Applications", appName)
+				targetPath := filepath.Join(s.applicationsDir, appName)
 
 				if _, statErr := os.Lstat(targetPath); statErr == nil {
-					return nil
+					return filepath.SkipDir
 				}
 
 				if symlinkErr := os.Symlink(path, targetPath); symlinkErr != nil {
-					fmt.Printf("\n📱 GUI App Installed: %s\n", appName)
-					fmt.Printf("   To make it visible in Launchpad, run:\n")
-					fmt.Printf("   sudo ln -sf \"%s\" \"%s\"\n", path, targetPath)
-					fmt.Printf("   Or manually drag it from Finder to Applications folder\n\n")
+					fmt.Fprintf(out, "\n📱 GUI App Installed: %s\n", appName)
+					fmt.Fprintf(out, "   To make it visible in Launchpad, run:\n")
+					fmt.Fprintf(out, "   sudo ln -sf \"%s\" \"%s\"\n", path, targetPath)
+					fmt.Fprintf(out, "   Or manually drag it from Finder to Applications folder\n\n")
 				} else {
-					fmt.Printf("✨ Symlinked %s to Applications for Launchpad visibility\n", appName)
+					fmt.Fprintf(out, "✨ Symlinked %s to Applications for Launchpad visibility\n", appName)
+					if recordErr := s.recordAppSymlink(targetPath, path); recordErr != nil {
+						logging.Warn("failed to record application symlink", "app", appName, "error", recordErr)
+					}
 				}
+				return filepath.SkipDir
 			}
 			return nil
 		})
@@ -924,124 +1904,230 @@ func (s *Service) symlinkMacOSApps(pkg string) error {
 }
 
 /*
-cleanupMacOSAppSymlinks cleans up any symlinks for GUI applications after removal on macOS.
-Instead of relying on package name matching (which fails for packages like 'vscode' -> 'Visual Studio Code.app'),
-this implementation finds the actual Nix store path for the removed package and removes all symlinks pointing to it.
+appSymlinksMu serializes updates to the application symlink record, which
+packages installed concurrently write to.
+*/
+var appSymlinksMu sync.Mutex
+
+/*
+getAppSymlinksFile returns the path to the file recording the application
+symlinks nix-foundry created and the store paths they point at.
+*/
+func (s *Service) getAppSymlinksFile() string {
+	stateDir, _ := paths.StateDir()
+	return filepath.Join(stateDir, "app-symlinks.json")
+}
+
+/*
+loadAppSymlinks loads the recorded application symlinks, keyed by symlink path.
 */
-func (s *Service) CleanupMacOSAppSymlinks(pkg string) error {
-	storePaths, err := s.getNixStorePathsForPackage(pkg)
+func (s *Service) loadAppSymlinks() map[string]string {
+	links := make(map[string]string)
+
+	content, err := s.fs.ReadFile(s.getAppSymlinksFile())
 	if err != nil {
-		return s.CleanupOrphanedNixSymlinks()
+		return links
 	}
 
-	applicationsDir := "/Applications"
-	entries, err := os.ReadDir(applicationsDir)
+	if err := json.Unmarshal(content, &links); err != nil {
+		return make(map[string]string)
+	}
+	return links
+}
+
+/*
+recordAppSymlink records that nix-foundry created the symlink at linkPath pointing
+at target, so that uninstalling removes it and leaves other symlinks alone.
+*/
+func (s *Service) recordAppSymlink(linkPath, target string) error {
+	appSymlinksMu.Lock()
+	defer appSymlinksMu.Unlock()
+
+	links := s.loadAppSymlinks()
+	links[linkPath] = target
+
+	content, err := json.Marshal(links)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".app") {
-			continue
-		}
+	linksFile := s.getAppSymlinksFile()
+	if err := s.fs.MkdirAll(filepath.Dir(linksFile), 0755); err != nil {
+		return err
+	}
+	return s.fs.WriteFile(linksFile, content, 0644)
+}
 
-		entryPath := filepath.Join(applicationsDir, entry.Name())
+/*
+CleanupMacOSAppSymlinks cleans up symlinks for GUI applications after removal on macOS.
+Symlinks are matched by the store path they resolve into rather than by name, so apps
+whose display name differs from the package (vscode -> Visual Studio Code.app) and
+helper apps are removed too. Symlinks pointing at store paths that no longer exist
+are removed as well.
+*/
+func (s *Service) CleanupMacOSAppSymlinks(storePaths []string) error {
+	entries, err := os.ReadDir(s.applicationsDir)
+	if err != nil {
+		return nil
+	}
 
-		linkInfo, err := os.Lstat(entryPath)
-		if err != nil || linkInfo.Mode()&os.ModeSymlink == 0 {
-			continue
-		}
+	for _, entry := range entries {
+		entryPath := filepath.Join(s.applicationsDir, entry.Name())
 
-		target, err := os.Readlink(entryPath)
-		if err != nil {
+		target, ok := s.nixSymlinkTarget(entryPath)
+		if !ok {
 			continue
 		}
 
+		owned := false
 		for _, storePath := range storePaths {
-			if strings.HasPrefix(target, storePath) {
-				if removeErr := os.Remove(entryPath); removeErr != nil {
-					fmt.Printf("Warning: Failed to remove symlink for %s: %v\n", entry.Name(), removeErr)
-				} else {
-					fmt.Printf("🗑️  Removed symlink for %s\n", entry.Name())
-				}
+			if isWithinPath(target, storePath) {
+				owned = true
 				break
 			}
 		}
+
+		if !owned {
+			if _, statErr := os.Stat(target); !os.IsNotExist(statErr) {
+				continue
+			}
+		}
+
+		if removeErr := os.Remove(entryPath); removeErr != nil {
+			logging.Warn("failed to remove symlink", "app", entry.Name(), "error", removeErr)
+		} else {
+			fmt.Printf("🗑️  Removed symlink for %s\n", entry.Name())
+		}
 	}
 
 	return nil
 }
 
 /*
-getNixStorePathsForPackage gets the Nix store paths for a given package name.
-This is used to identify which symlinks need to be cleaned up.
+CleanupOrphanedNixSymlinks removes all symlinks in /Applications that point to non-existent Nix store paths.
 */
-func (s *Service) getNixStorePathsForPackage(pkg string) ([]string, error) {
-	packageName := pkg
-	if strings.Contains(pkg, ".") {
-		parts := strings.Split(pkg, ".")
-		packageName = parts[len(parts)-1]
-	}
+func (s *Service) CleanupOrphanedNixSymlinks() error {
+	return s.CleanupMacOSAppSymlinks(nil)
+}
 
-	cmd := exec.Command("find", "/nix/store", "-name", "*"+packageName+"*", "-type", "d", "-maxdepth", "1")
-	output, err := cmd.Output()
+/*
+CleanOrphanedAppSymlinks removes symlinks in the Applications directory that point
+into the Nix store at paths that no longer exist or that no installed package
+references anymore. The reference check is skipped if the installed packages
+cannot be queried, so that only dangling symlinks are removed in that case.
+Symlinks that do not point into the Nix store are never touched. It returns the
+names of the removed symlinks.
+*/
+func (s *Service) CleanOrphanedAppSymlinks() ([]string, error) {
+	entries, err := os.ReadDir(s.applicationsDir)
 	if err != nil {
-		return nil, err
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", s.applicationsDir, err)
+	}
+
+	referenced, referencedErr := s.installedStorePaths()
+	if referencedErr != nil {
+		logging.Warn("could not query installed packages, only removing dangling symlinks", "error", referencedErr)
 	}
 
-	storePaths := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var validPaths []string
-	for _, path := range storePaths {
-		if path != "" {
-			validPaths = append(validPaths, path)
+	var removed []string
+	for _, entry := range entries {
+		entryPath := filepath.Join(s.applicationsDir, entry.Name())
+
+		target, ok := s.nixSymlinkTarget(entryPath)
+		if !ok {
+			continue
+		}
+
+		orphaned := false
+		if _, statErr := os.Stat(target); os.IsNotExist(statErr) {
+			orphaned = true
+		} else if referencedErr == nil {
+			orphaned = true
+			for _, storePath := range referenced {
+				if isWithinPath(target, storePath) {
+					orphaned = false
+					break
+				}
+			}
+		}
+		if !orphaned {
+			continue
+		}
+
+		if removeErr := os.Remove(entryPath); removeErr != nil {
+			return removed, fmt.Errorf("failed to remove symlink %s: %w", entry.Name(), removeErr)
 		}
+		removed = append(removed, entry.Name())
 	}
 
-	return validPaths, nil
+	return removed, nil
 }
 
 /*
-cleanupOrphanedNixSymlinks removes all symlinks in /Applications that point to non-existent Nix store paths.
-This is a fallback cleanup method when we can't determine specific package store paths.
+installedStorePaths returns the store paths of all packages installed with the
+package manager of the active configuration.
 */
-func (s *Service) CleanupOrphanedNixSymlinks() error {
-	applicationsDir := "/Applications"
-	entries, err := os.ReadDir(applicationsDir)
-	if err != nil {
-		return nil
+func (s *Service) installedStorePaths() ([]string, error) {
+	manager := ""
+	if config, configErr := s.GetActiveConfig(); configErr == nil {
+		manager = config.Nix.Manager
 	}
 
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".app") {
-			continue
-		}
+	pm, pmErr := packages.NewPackageManager(manager, s.runner)
+	if pmErr != nil {
+		return nil, pmErr
+	}
 
-		entryPath := filepath.Join(applicationsDir, entry.Name())
+	installed, listErr := pm.ListInstalled()
+	if listErr != nil {
+		return nil, listErr
+	}
 
-		linkInfo, err := os.Lstat(entryPath)
-		if err != nil || linkInfo.Mode()&os.ModeSymlink == 0 {
-			continue
+	var storePaths []string
+	for _, pkg := range installed {
+		paths, pathsErr := pm.OutPaths(pkg)
+		if pathsErr != nil {
+			return nil, pathsErr
 		}
+		storePaths = append(storePaths, paths...)
+	}
+	return storePaths, nil
+}
 
-		target, err := os.Readlink(entryPath)
-		if err != nil {
-			continue
-		}
+/*
+nixSymlinkTarget returns the absolute target of path if it is a symlink into the
+Nix store.
+*/
+func (s *Service) nixSymlinkTarget(path string) (string, bool) {
+	linkInfo, err := os.Lstat(path)
+	if err != nil || linkInfo.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
 
-		if !strings.Contains(target, "/nix/store/") {
-			continue
-		}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	target = filepath.Clean(target)
 
-		if _, statErr := os.Stat(target); os.IsNotExist(statErr) {
-			if removeErr := os.Remove(entryPath); removeErr != nil {
-				fmt.Printf("Warning: Failed to remove orphaned symlink for %s: %v\n", entry.Name(), removeErr)
-			} else {
-				fmt.Printf("🗑️  Removed orphaned symlink for %s\n", entry.Name())
-			}
-		}
+	if !isWithinPath(target, s.storeDir) {
+		return "", false
 	}
+	return target, true
+}
 
-	return nil
+/*
+isWithinPath reports whether path is dir or lies underneath it.
+*/
+func isWithinPath(path, dir string) bool {
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
 }
 
 /*
@@ -1061,3 +2147,85 @@ func (s *Service) ResetScriptHashes() error {
 
 	return nil
 }
+
+/*
+SetPackageGroup enables or disables a package group of the active configuration
+for the user, overriding the group's default. The choice is saved in the user
+configuration and takes effect on the next apply.
+*/
+func (s *Service) SetPackageGroup(name string, enabled bool) error {
+	activeConfig, configErr := s.GetActiveConfig()
+	if configErr != nil {
+		return fmt.Errorf("failed to get active config: %w", configErr)
+	}
+	if _, ok := activeConfig.Nix.Packages.Groups[name]; !ok {
+		return fmt.Errorf("unknown package group %q", name)
+	}
+
+	return s.updateUserConfig(func(config *schema.Config) error {
+		if config.Nix.Packages.GroupOverrides == nil {
+			config.Nix.Packages.GroupOverrides = make(map[string]bool)
+		}
+		config.Nix.Packages.GroupOverrides[name] = enabled
+		return nil
+	})
+}
+
+/*
+AddPackagePreset adds the packages of a bundled preset (see packages.Presets) to
+the core packages of the user configuration, skipping those already there. It
+returns the packages that were added, so adding a preset again adds nothing.
+*/
+func (s *Service) AddPackagePreset(name string) ([]string, error) {
+	preset, presetErr := packages.LookupPreset(name)
+	if presetErr != nil {
+		return nil, presetErr
+	}
+
+	var added []string
+	updateErr := s.updateUserConfig(func(config *schema.Config) error {
+		existing := make(map[string]bool)
+		for _, pkg := range append(append([]string{}, config.Nix.Packages.Core...), config.Nix.Packages.Optional...) {
+			existing[pkg] = true
+		}
+		for _, pkg := range preset.Packages {
+			if !existing[pkg] {
+				existing[pkg] = true
+				added = append(added, pkg)
+			}
+		}
+		config.Nix.Packages.Core = append(config.Nix.Packages.Core, added...)
+		return nil
+	})
+	if updateErr != nil {
+		return nil, updateErr
+	}
+	return added, nil
+}
+
+/*
+PinPackage pins a package in the user configuration to a flake reference, such as
+a specific nixpkgs revision. The reference is validated before the configuration is
+saved. The package is installed from the pinned reference on the next apply.
+*/
+func (s *Service) PinPackage(name, ref string) error {
+	if specErr := schema.ValidatePackageSpec(name); specErr != nil {
+		return specErr
+	}
+	if refErr := schema.ValidateFlakeRef(ref); refErr != nil {
+		return refErr
+	}
+
+	config, configErr := s.GetConfig(schema.UserConfig, "")
+	if configErr != nil {
+		return fmt.Errorf("failed to load user config: %w", configErr)
+	}
+
+	config.Nix.Packages.Pin(name, ref)
+
+	if saveErr := s.SaveConfig(config); saveErr != nil {
+		return fmt.Errorf("failed to save config: %w", saveErr)
+	}
+
+	return nil
+}
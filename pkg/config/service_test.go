@@ -2,8 +2,24 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/nixerrors"
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 )
 
@@ -163,3 +179,803 @@ func TestGetInstalledPackagesParser(t *testing.T) {
 		t.Errorf("Expected package not found: %s", pkg)
 	}
 }
+
+func TestMergePackagesKeepsPins(t *testing.T) {
+	service := &Service{}
+	merged := service.mergePackages(
+		schema.Packages{Pinned: []schema.PinnedPackage{{Name: "ripgrep", FlakeRef: "nixpkgs/nixos-23.11"}}},
+		schema.Packages{Pinned: []schema.PinnedPackage{
+			{Name: "ripgrep", FlakeRef: "nixpkgs/nixos-24.05"},
+			{Name: "jq", FlakeRef: "github:NixOS/nixpkgs/4a8b7c1d"},
+		}},
+	)
+
+	if ref, ok := merged.PinnedRef("ripgrep"); !ok || ref != "nixpkgs/nixos-24.05" {
+		t.Errorf("ripgrep pin = %q, want override pin", ref)
+	}
+	if _, ok := merged.PinnedRef("jq"); !ok {
+		t.Errorf("expected jq pin to be kept")
+	}
+}
+
+func TestManagePackagesAutoGC(t *testing.T) {
+	installed := `{"0": {"pname": "git"}, "1": {"pname": "jq"}, "2": {"pname": "curl"}}`
+
+	tests := []struct {
+		name     string
+		autoGC   bool
+		packages []string
+		wantGC   int
+	}{
+		{name: "removals with autoGC", autoGC: true, packages: []string{"git"}, wantGC: 1},
+		{name: "removals and installs with autoGC", autoGC: true, packages: []string{"git", "ripgrep"}, wantGC: 1},
+		{name: "only installs with autoGC", autoGC: true, packages: []string{"git", "jq", "curl", "ripgrep"}, wantGC: 0},
+		{name: "removals without autoGC", autoGC: false, packages: []string{"git"}, wantGC: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{installed: installed}
+			service := NewService(filesystem.NewMemFS())
+			service.runner = runner
+
+			config := &schema.Config{Nix: schema.Nix{
+				AutoGC:   tt.autoGC,
+				Packages: schema.Packages{Core: tt.packages},
+			}}
+			if err := service.managePackages(config, ""); err != nil {
+				t.Fatalf("managePackages() error = %v", err)
+			}
+
+			if got := runner.count("nix-collect-garbage"); got != tt.wantGC {
+				t.Errorf("garbage collection ran %d times, want %d", got, tt.wantGC)
+			}
+		})
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	service, home := newTestService(t)
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"),
+		"type: user\nsettings:\n  shell: zsh\nnix:\n  manager: nix-env\n  packages:\n    core: [git, ripgrep]\n  scripts:\n    - name: setup\n      commands: echo setup\n")
+
+	runner := &fakeRunner{installed: `{"0": {"pname": "git"}, "1": {"pname": "jq"}}`}
+	service.runner = runner
+
+	plan, err := service.PlanApply()
+	if err != nil {
+		t.Fatalf("PlanApply() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(plan.ToInstall, []string{"ripgrep"}) {
+		t.Errorf("ToInstall = %v, want [ripgrep]", plan.ToInstall)
+	}
+	if !reflect.DeepEqual(plan.ToRemove, []string{"jq"}) {
+		t.Errorf("ToRemove = %v, want [jq]", plan.ToRemove)
+	}
+	if plan.ShellFile != filepath.Join(home, ".zshrc") || !plan.ShellChanged {
+		t.Errorf("shell plan = %q changed %v, want %s to change", plan.ShellFile, plan.ShellChanged, filepath.Join(home, ".zshrc"))
+	}
+	if len(plan.Scripts) != 1 || !plan.Scripts[0].Run {
+		t.Errorf("Scripts = %+v, want setup to run", plan.Scripts)
+	}
+
+	if len(runner.commands) != 1 {
+		t.Errorf("PlanApply ran %v, want only the installed package query", runner.commands)
+	}
+	if _, statErr := os.Stat(filepath.Join(home, ".zshrc")); !os.IsNotExist(statErr) {
+		t.Error("PlanApply wrote the shell config")
+	}
+}
+
+func TestApplyProfiles(t *testing.T) {
+	service, home := newTestService(t)
+	configPath := filepath.Join(home, ".config", "nix-foundry", "config.yaml")
+	writeTestFile(t, configPath, "type: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\nenv:\n  EDITOR: vim\nprofiles:\n  work:\n    packages: [openconnect]\n    env:\n      EDITOR: code\n  personal: {}\n")
+
+	runner := &fakeRunner{installed: `{"0": {"pname": "git"}, "1": {"pname": "openconnect"}}`}
+	service.runner = runner
+
+	work := ApplyOptions{SelectProfile: true, Profile: "work"}
+	workConfig, err := service.ConfigForApply(work)
+	if err != nil {
+		t.Fatalf("ConfigForApply() error = %v", err)
+	}
+	if !reflect.DeepEqual(workConfig.Nix.Packages.Core, []string{"git", "openconnect"}) || workConfig.Env["EDITOR"] != "code" {
+		t.Errorf("work config core = %v env = %v, want the profile merged over the base", workConfig.Nix.Packages.Core, workConfig.Env)
+	}
+	if _, err := service.ConfigForApply(ApplyOptions{SelectProfile: true, Profile: "gaming"}); err == nil || !strings.Contains(err.Error(), "personal, work") {
+		t.Errorf("ConfigForApply() error = %v, want an unknown profile listing the available ones", err)
+	}
+
+	plan, err := service.PlanApplyWithOptions(work)
+	if err != nil {
+		t.Fatalf("PlanApplyWithOptions() error = %v", err)
+	}
+	if len(plan.ToInstall) != 0 || len(plan.ToRemove) != 0 {
+		t.Errorf("plan = %+v, want no package changes with the work profile", plan)
+	}
+	if service.ActiveProfile() != "" {
+		t.Error("planning selected the profile, want it only selected by an apply")
+	}
+
+	if err := service.saveActiveProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	activeConfig, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatalf("GetActiveConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(activeConfig.Nix.Packages.Core, []string{"git", "openconnect"}) {
+		t.Errorf("Core = %v, want the saved profile applied", activeConfig.Nix.Packages.Core)
+	}
+
+	writeTestFile(t, configPath, "type: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n")
+	plan, err = service.PlanApply()
+	if err != nil {
+		t.Fatalf("PlanApply() error = %v", err)
+	}
+	if !reflect.DeepEqual(plan.ToRemove, []string{"openconnect"}) {
+		t.Errorf("ToRemove = %v, want the packages only the removed profile contributed", plan.ToRemove)
+	}
+
+	if err := service.saveActiveProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if service.ActiveProfile() != "" {
+		t.Errorf("ActiveProfile() = %q after clearing it", service.ActiveProfile())
+	}
+}
+
+func TestPackageGroups(t *testing.T) {
+	service, home := newTestService(t)
+	configDir := filepath.Join(home, ".config", "nix-foundry")
+	writeTestFile(t, filepath.Join(configDir, "config.yaml"), "type: user\nbase: platform\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n    groups:\n      kubernetes:\n        packages: [k9s]\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), "type: team\nmetadata:\n  name: platform\nnix:\n  packages:\n    core: [git]\n    groups:\n      kubernetes:\n        packages: [kubectl, helm]\n        default: true\n      frontend:\n        packages: [nodejs]\n")
+
+	service.runner = &fakeRunner{installed: `{"0": {"pname": "git"}}`}
+
+	plan, err := service.PlanApply()
+	if err != nil {
+		t.Fatalf("PlanApply() error = %v", err)
+	}
+	sort.Strings(plan.ToInstall)
+	if !reflect.DeepEqual(plan.ToInstall, []string{"helm", "k9s", "kubectl"}) {
+		t.Errorf("ToInstall = %v, want the merged kubernetes group enabled by default", plan.ToInstall)
+	}
+
+	if err := service.SetPackageGroup("frontend", true); err != nil {
+		t.Fatalf("SetPackageGroup(frontend) error = %v", err)
+	}
+	if err := service.SetPackageGroup("kubernetes", false); err != nil {
+		t.Fatalf("SetPackageGroup(kubernetes) error = %v", err)
+	}
+	if err := service.SetPackageGroup("observability", true); err == nil {
+		t.Error("expected an error for an unknown package group")
+	}
+
+	activeConfig, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatalf("GetActiveConfig() error = %v", err)
+	}
+	want := []schema.GroupStatus{
+		{Name: "frontend", Packages: []string{"nodejs"}, Enabled: true, Reason: schema.GroupReasonOverride},
+		{Name: "kubernetes", Packages: []string{"helm", "k9s", "kubectl"}, Enabled: false, Reason: schema.GroupReasonOverride},
+	}
+	if got := activeConfig.Nix.Packages.GroupStatuses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupStatuses() = %+v, want %+v", got, want)
+	}
+
+	plan, err = service.PlanApply()
+	if err != nil {
+		t.Fatalf("PlanApply() error = %v", err)
+	}
+	if !reflect.DeepEqual(plan.ToInstall, []string{"nodejs"}) || len(plan.ToRemove) != 0 {
+		t.Errorf("plan = %+v, want only the frontend group installed", plan)
+	}
+}
+
+func TestApplyRejectsConflictingPackages(t *testing.T) {
+	service, home := newTestService(t)
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"), "type: user\nnix:\n  packages:\n    core: [git, gcc]\n    optional: [clang]\n")
+
+	runner := &fakeRunner{installed: `{"0": {"pname": "git"}}`}
+	service.runner = runner
+
+	plan, err := service.PlanApply()
+	if err != nil {
+		t.Fatalf("PlanApply() error = %v", err)
+	}
+	if len(plan.Conflicts) != 1 || !reflect.DeepEqual(plan.Conflicts[0].Packages, []string{"gcc", "clang"}) {
+		t.Errorf("Conflicts = %+v, want gcc and clang", plan.Conflicts)
+	}
+
+	var conflictErr *ConflictError
+	if err := service.ApplyConfig(); !errors.As(err, &conflictErr) {
+		t.Fatalf("ApplyConfig() error = %v, want a ConflictError", err)
+	}
+	if runner.count("-i") != 0 {
+		t.Errorf("packages were installed despite the conflict: %v", runner.commands)
+	}
+}
+
+func TestAddPackagePreset(t *testing.T) {
+	service, home := newTestService(t)
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"), "type: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n    optional: [yarn]\n")
+
+	added, err := service.AddPackagePreset("web")
+	if err != nil {
+		t.Fatalf("AddPackagePreset(web) error = %v", err)
+	}
+	if !reflect.DeepEqual(added, []string{"nodejs", "pnpm"}) {
+		t.Errorf("added = %v, want the web packages not configured yet", added)
+	}
+
+	added, err = service.AddPackagePreset("web")
+	if err != nil || len(added) != 0 {
+		t.Errorf("adding web again = %v, %v; want nothing added", added, err)
+	}
+	if _, err := service.AddPackagePreset("gamedev"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+
+	config, err := service.GetConfig(schema.UserConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Nix.Packages.Core, []string{"git", "nodejs", "pnpm"}) {
+		t.Errorf("Core = %v, want the preset added once", config.Nix.Packages.Core)
+	}
+}
+
+func TestConfigDirFromEnvironment(t *testing.T) {
+	service, home := newTestService(t)
+	configDir := filepath.Join(t.TempDir(), "foundry")
+	t.Setenv(paths.ConfigDirEnv, configDir)
+
+	if err := service.InitConfig(); err != nil {
+		t.Fatalf("InitConfig() error = %v", err)
+	}
+	if err := service.InitConfigWithType(schema.TeamConfig, "platform"); err != nil {
+		t.Fatalf("InitConfigWithType() error = %v", err)
+	}
+	if err := service.saveActiveProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.saveScriptHashes(service.getScriptHashFile(), map[string]string{"setup": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"config.yaml", filepath.Join("teams", "platform.yaml"), "active-profile", "script-hashes.json"} {
+		if _, err := os.Stat(filepath.Join(configDir, name)); err != nil {
+			t.Errorf("%s was not written under %s: %v", name, paths.ConfigDirEnv, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config", "nix-foundry")); !os.IsNotExist(err) {
+		t.Errorf("the default config directory was used, stat error = %v", err)
+	}
+
+	configs, err := service.ListConfigs()
+	if err != nil {
+		t.Fatalf("ListConfigs() error = %v", err)
+	}
+	if len(configs) != 2 {
+		t.Errorf("ListConfigs() found %d configs, want the user and team configs under %s", len(configs), configDir)
+	}
+}
+
+func TestManageHomebrew(t *testing.T) {
+	runner := &fakeRunner{brew: `{
+		"formulae": [
+			{"full_name": "wget", "installed": [{"installed_on_request": true}]},
+			{"full_name": "openssl@3", "installed": [{"installed_on_request": false}]}
+		],
+		"casks": [{"full_token": "firefox"}, {"full_token": "slack"}]
+	}`}
+	service := NewService(filesystem.NewMemFS())
+	service.runner = runner
+
+	homebrew := schema.Homebrew{Formulae: []string{"jq"}, Casks: []string{"firefox", "visual-studio-code"}}
+	if err := service.manageHomebrew(homebrew); err != nil {
+		t.Fatalf("manageHomebrew() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"brew uninstall wget",
+		"brew uninstall --cask slack",
+		"brew install jq",
+		"brew install --cask visual-studio-code",
+	} {
+		if runner.count(want) != 1 {
+			t.Errorf("expected %q to run once, commands: %v", want, runner.commands)
+		}
+	}
+	if runner.count("openssl") != 0 || runner.count("install --cask firefox") != 0 {
+		t.Errorf("unexpected commands: %v", runner.commands)
+	}
+
+	missing := &fakeRunner{}
+	service.runner = missing
+	if err := service.manageHomebrew(homebrew); err != nil {
+		t.Errorf("manageHomebrew() without brew error = %v, want a skipped step", err)
+	}
+	if len(missing.commands) != 1 {
+		t.Errorf("commands without brew = %v, want only the availability check", missing.commands)
+	}
+}
+
+func TestMergeConfigsHomebrew(t *testing.T) {
+	service := NewService(filesystem.NewMemFS())
+	merged := service.mergeConfigs(
+		&schema.Config{Homebrew: schema.Homebrew{Formulae: []string{"wget", "jq"}, Casks: []string{"slack"}}},
+		&schema.Config{Homebrew: schema.Homebrew{Formulae: []string{"jq"}, Casks: []string{"firefox"}}},
+	)
+	if !reflect.DeepEqual(merged.Homebrew.Formulae, []string{"jq", "wget"}) {
+		t.Errorf("Formulae = %v, want [jq wget]", merged.Homebrew.Formulae)
+	}
+	if !reflect.DeepEqual(merged.Homebrew.Casks, []string{"firefox", "slack"}) {
+		t.Errorf("Casks = %v, want [firefox slack]", merged.Homebrew.Casks)
+	}
+}
+
+func TestManageSystemPackages(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("system packages are only managed on Linux")
+	}
+
+	system := schema.SystemPackages{Backend: "apt", Packages: []string{"openvpn", "corp-cert-helper"}}
+
+	runner := &fakeRunner{}
+	service := NewService(filesystem.NewMemFS())
+	service.runner = runner
+	if err := service.manageSystemPackages(system, false); err != nil {
+		t.Fatalf("manageSystemPackages() error = %v", err)
+	}
+	if runner.count("sudo") != 0 {
+		t.Errorf("installed system packages without --allow-system-packages: %v", runner.commands)
+	}
+
+	if err := service.manageSystemPackages(system, true); err != nil {
+		t.Fatalf("manageSystemPackages() error = %v", err)
+	}
+	if runner.count("sudo apt-get install -y corp-cert-helper") != 1 || runner.count("openvpn") != 0 {
+		t.Errorf("commands = %v, want only the missing package installed", runner.commands)
+	}
+
+	missing := &fakeRunner{}
+	service.runner = missing
+	if err := service.manageSystemPackages(schema.SystemPackages{Backend: "dnf", Packages: []string{"openvpn"}}, true); err != nil {
+		t.Errorf("manageSystemPackages() on a distribution without dnf error = %v, want a skipped step", err)
+	}
+	if len(missing.commands) != 1 {
+		t.Errorf("commands without dnf = %v, want only the availability check", missing.commands)
+	}
+}
+
+func TestRunInstallPool(t *testing.T) {
+	pkgs := []string{"git", "jq", "curl", "ripgrep", "fd", "bat", "htop"}
+	failing := map[string]bool{"jq": true, "fd": true}
+
+	var running, maxRunning int32
+	results := runInstallPool(pkgs, 3, func(pkg string) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if failing[pkg] {
+			return fmt.Errorf("build failed")
+		}
+		return nil
+	})
+
+	if maxRunning > 3 {
+		t.Errorf("observed %d concurrent installs, want at most 3", maxRunning)
+	}
+	if maxRunning < 2 {
+		t.Errorf("observed %d concurrent installs, expected installs to run in parallel", maxRunning)
+	}
+
+	if len(results) != len(pkgs) {
+		t.Fatalf("got %d results, want %d", len(results), len(pkgs))
+	}
+	for idx, result := range results {
+		if result.pkg != pkgs[idx] {
+			t.Errorf("results[%d].pkg = %q, want %q", idx, result.pkg, pkgs[idx])
+		}
+		if (result.err != nil) != failing[result.pkg] {
+			t.Errorf("result for %s: err = %v, want failure %v", result.pkg, result.err, failing[result.pkg])
+		}
+	}
+}
+
+func TestInstallConcurrency(t *testing.T) {
+	if got := installConcurrency(4, 10); got != 4 {
+		t.Errorf("installConcurrency(4, 10) = %d, want 4", got)
+	}
+	if got := installConcurrency(8, 2); got != 2 {
+		t.Errorf("installConcurrency(8, 2) = %d, want 2", got)
+	}
+	if got := installConcurrency(0, 100); got != runtime.NumCPU() {
+		t.Errorf("installConcurrency(0, 100) = %d, want %d", got, runtime.NumCPU())
+	}
+	if got := installConcurrency(0, 0); got != 1 {
+		t.Errorf("installConcurrency(0, 0) = %d, want 1", got)
+	}
+}
+
+func TestFailureSummary(t *testing.T) {
+	failure := func(stderr string) error {
+		return nixerrors.Classify(&cmdexec.Error{Command: "nix-env", Stderr: stderr, ExitCode: 1, Err: fmt.Errorf("exit status 1")})
+	}
+
+	results := []installResult{
+		{pkg: "git"},
+		{pkg: "ripgerp", err: failure("error: attribute 'ripgerp' in selection path 'nixpkgs.ripgerp' not found")},
+		{pkg: "vscode", err: failure("error: Package 'vscode' has an unfree license ('unfree'), refusing to evaluate.")},
+		{pkg: "jqq", err: failure("error: attribute 'jqq' in selection path 'nixpkgs.jqq' not found")},
+		{pkg: "broken", err: failure("error: builder for '/nix/store/abc.drv' failed with exit code 2")},
+	}
+
+	want := "4 packages failed: 2 not found, 1 unfree license, 1 other"
+	if got := failureSummary(results); got != want {
+		t.Errorf("failureSummary() = %q, want %q", got, want)
+	}
+	if got := failureSummary(results[:1]); got != "" {
+		t.Errorf("failureSummary() without failures = %q, want empty", got)
+	}
+	if got := failureSummary(results[:2]); got != "1 package failed: 1 not found" {
+		t.Errorf("failureSummary() = %q, want a singular summary", got)
+	}
+}
+
+func TestGetActiveConfigTeamChain(t *testing.T) {
+	service, home := newTestService(t)
+
+	configDir := filepath.Join(home, ".config", "nix-foundry")
+	writeTestFile(t, filepath.Join(configDir, "config.yaml"), "type: user\nbase: payments\nsettings:\n  shell: zsh\nnix:\n  packages:\n    optional: [jq]\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "payments.yaml"), "type: team\nbase: platform\nmetadata:\n  name: payments\nsettings:\n  logLevel: warn\nnix:\n  packages:\n    core: [terraform]\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), "type: team\nbase: acme\nmetadata:\n  name: platform\nnix:\n  packages:\n    core: [kubectl]\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "acme.yaml"), "type: team\nmetadata:\n  name: acme\nsettings:\n  logLevel: debug\nnix:\n  manager: nix-profile\n  packages:\n    core: [git]\n")
+
+	config, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatalf("GetActiveConfig() error = %v", err)
+	}
+
+	if core := config.Nix.Packages.Core; !reflect.DeepEqual(core, []string{"git", "kubectl", "terraform"}) {
+		t.Errorf("Core = %v, want packages from all three teams, root team first", core)
+	}
+	if config.Base != "payments" || config.Settings.Shell != "zsh" {
+		t.Errorf("user settings not preserved: base = %q, shell = %q", config.Base, config.Settings.Shell)
+	}
+
+	team, names, err := service.resolveTeamChain("payments")
+	if err != nil {
+		t.Fatalf("resolveTeamChain() error = %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"payments", "platform", "acme"}) {
+		t.Errorf("names = %v, want the chain starting with payments", names)
+	}
+	if team.Settings.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q, want the nearest team's value", team.Settings.LogLevel)
+	}
+	if team.Nix.Manager != "nix-profile" {
+		t.Errorf("Manager = %q, want the value inherited from the top of the chain", team.Nix.Manager)
+	}
+
+	writeTestFile(t, filepath.Join(configDir, "teams", "acme.yaml"), "type: team\nbase: payments\nmetadata:\n  name: acme\n")
+	if _, err := service.GetActiveConfig(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("GetActiveConfig() error = %v, want a cycle error", err)
+	}
+
+	writeTestFile(t, filepath.Join(configDir, "teams", "acme.yaml"), "type: team\nbase: missing\nmetadata:\n  name: acme\n")
+	if _, err := service.GetActiveConfig(); err == nil || !strings.Contains(err.Error(), `"acme" extends "missing"`) {
+		t.Errorf("GetActiveConfig() error = %v, want a missing link error", err)
+	}
+}
+
+func TestGetActiveConfigProjectOverrides(t *testing.T) {
+	service, home := newTestService(t)
+
+	configDir := filepath.Join(home, ".config", "nix-foundry")
+	writeTestFile(t, filepath.Join(configDir, "config.yaml"), "type: user\nbase: platform\nmetadata:\n  name: mine\nsettings:\n  shell: zsh\n  logLevel: info\n  autoUpdate: true\nnix:\n  packages:\n    optional: [jq]\nenv:\n  EDITOR: vim\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), "type: team\nmetadata:\n  name: platform\nsettings:\n  logLevel: warn\nnix:\n  packages:\n    core: [git]\n")
+
+	projectDir := t.TempDir()
+	writeTestFile(t, filepath.Join(projectDir, ".nix-foundry", "config.yaml"), "type: project\nmetadata:\n  name: webapp\nsettings:\n  logLevel: debug\nnix:\n  packages:\n    core: [nodejs]\nenv:\n  EDITOR: code\n")
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(workDir) })
+
+	config, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatalf("GetActiveConfig() error = %v", err)
+	}
+
+	if config.Settings.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want the project's value to override user and team", config.Settings.LogLevel)
+	}
+	if config.Env["EDITOR"] != "code" {
+		t.Errorf("EDITOR = %q, want the project's value", config.Env["EDITOR"])
+	}
+	if core := config.Nix.Packages.Core; !reflect.DeepEqual(core, []string{"git", "nodejs"}) {
+		t.Errorf("Core = %v, want the team and project packages", core)
+	}
+	if !reflect.DeepEqual(config.Nix.Packages.Optional, []string{"jq"}) {
+		t.Errorf("Optional = %v, want the user packages kept", config.Nix.Packages.Optional)
+	}
+	if config.Type != schema.UserConfig || config.Metadata.Name != "mine" || config.Base != "platform" {
+		t.Errorf("type = %q name = %q base = %q, want the user config's identity", config.Type, config.Metadata.Name, config.Base)
+	}
+	if config.Settings.Shell != "zsh" || !config.Settings.AutoUpdate {
+		t.Errorf("shell = %q autoUpdate = %v, want user settings the project does not set", config.Settings.Shell, config.Settings.AutoUpdate)
+	}
+
+	writeTestFile(t, filepath.Join(projectDir, ".nix-foundry", "config.yaml"), "nix: [unclosed\n")
+	if _, err := service.GetActiveConfig(); err == nil || !strings.Contains(err.Error(), "project config") {
+		t.Errorf("GetActiveConfig() error = %v, want an unreadable project config reported", err)
+	}
+}
+
+func TestGetActiveConfigCombinations(t *testing.T) {
+	project := "version: 1.1.0\ntype: project\nmetadata:\n  name: webapp\nnix:\n  packages:\n    core: [nodejs]\n"
+
+	tests := []struct {
+		name     string
+		user     string
+		team     string
+		wantCore []string
+		wantLog  []string
+	}{
+		{
+			name:     "project only",
+			wantCore: []string{"nodejs"},
+			wantLog:  []string{".nix-foundry/config.yaml"},
+		},
+		{
+			name:     "user and project",
+			user:     "version: 1.1.0\ntype: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n",
+			wantCore: []string{"git", "nodejs"},
+			wantLog:  []string{"config.yaml", ".nix-foundry/config.yaml"},
+		},
+		{
+			name:     "user, team and project",
+			user:     "version: 1.1.0\ntype: user\nbase: platform\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n",
+			team:     "version: 1.1.0\ntype: team\nmetadata:\n  name: platform\nnix:\n  packages:\n    core: [kubectl]\n",
+			wantCore: []string{"kubectl", "git", "nodejs"},
+			wantLog:  []string{"config.yaml", "teams/platform.yaml", ".nix-foundry/config.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, home := newTestService(t)
+			configDir := filepath.Join(home, ".config", "nix-foundry")
+			if tt.user != "" {
+				writeTestFile(t, filepath.Join(configDir, "config.yaml"), tt.user)
+			}
+			if tt.team != "" {
+				writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), tt.team)
+			}
+
+			projectDir := t.TempDir()
+			writeTestFile(t, filepath.Join(projectDir, ".nix-foundry", "config.yaml"), project)
+			workDir, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(projectDir); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = os.Chdir(workDir) })
+
+			logFile := filepath.Join(t.TempDir(), "nix-foundry.log")
+			closer, err := logging.Configure(logging.Options{Quiet: true, File: logFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _, _ = logging.Configure(logging.Options{}) })
+
+			config, err := service.GetActiveConfig()
+			if err != nil {
+				t.Fatalf("GetActiveConfig() error = %v", err)
+			}
+			_ = closer.Close()
+
+			if core := config.Nix.Packages.Core; !reflect.DeepEqual(core, tt.wantCore) {
+				t.Errorf("Core = %v, want %v", core, tt.wantCore)
+			}
+
+			content, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var record struct {
+				Msg     string   `json:"msg"`
+				Sources []string `json:"sources"`
+			}
+			if err := json.Unmarshal(content, &record); err != nil {
+				t.Fatalf("log is not a single JSON record: %v\n%s", err, content)
+			}
+			if len(record.Sources) != len(tt.wantLog) {
+				t.Fatalf("logged sources %v, want %v", record.Sources, tt.wantLog)
+			}
+			for idx, want := range tt.wantLog {
+				if !strings.HasSuffix(filepath.ToSlash(record.Sources[idx]), want) {
+					t.Errorf("logged source %d = %q, want %s", idx, record.Sources[idx], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetValueValidatesBeforeSaving(t *testing.T) {
+	service, home := newTestService(t)
+
+	configPath := filepath.Join(home, ".config", "nix-foundry", "config.yaml")
+	writeTestFile(t, configPath, "type: user\nsettings:\n  shell: zsh\nnix:\n  packages:\n    core: [git]\n")
+
+	if err := service.AppendValue("nix.packages.core", "nodejs@20"); err != nil {
+		t.Fatalf("AppendValue() error = %v", err)
+	}
+	if got, err := service.GetValue("nix.packages.core"); err != nil || !reflect.DeepEqual(got, []string{"git", "nodejs@20"}) {
+		t.Errorf("GetValue() = %v, %v, want the appended package saved", got, err)
+	}
+
+	before, _ := os.ReadFile(configPath)
+	for path, value := range map[string]string{"settings.shell": "", "nix.installConcurrency": "-1", "type": "team"} {
+		if err := service.SetValue(path, value); err == nil {
+			t.Errorf("SetValue(%q, %q) succeeded, want the invalid change rejected", path, value)
+		}
+	}
+	if after, _ := os.ReadFile(configPath); string(after) != string(before) {
+		t.Errorf("config changed by rejected updates:\n%s", after)
+	}
+}
+
+/*
+scriptFailures makes a fakeRunner fail the scripts whose commands contain "fail".
+*/
+var scriptFailures = map[string]error{"fail": fmt.Errorf("exit status 1")}
+
+func TestRunScriptsOrderingAndFilters(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	t.Setenv("SUDO_USER", "")
+
+	otherOS := "darwin"
+	if runtime.GOOS == "darwin" {
+		otherOS = "linux"
+	}
+
+	config := schema.NewDefaultConfig()
+	config.Nix.Scripts = []schema.Script{
+		{Name: "app", Commands: "echo app", Requires: []string{"deps"}},
+		{Name: "deps", Commands: "echo deps"},
+		{Name: "brew", Commands: "echo brew", Platforms: []string{otherOS}},
+		{Name: "casks", Commands: "echo casks", Requires: []string{"brew"}},
+		{Name: "optional", Commands: "fail optional", ContinueOnError: true},
+		{Name: "after-optional", Commands: "echo after-optional", Requires: []string{"optional"}},
+		{Name: "last", Commands: "echo last"},
+	}
+
+	runner := &fakeRunner{failures: scriptFailures}
+	service := NewService(filesystem.NewMemFS())
+	service.runner = runner
+
+	plans, err := service.PlanScripts(config, false, false)
+	if err != nil {
+		t.Fatalf("PlanScripts() error = %v", err)
+	}
+	var planned []string
+	for _, plan := range plans {
+		planned = append(planned, fmt.Sprintf("%s:%v", plan.Script.Name, plan.Run))
+	}
+	wantPlan := []string{"deps:true", "app:true", "brew:false", "casks:false", "optional:true", "after-optional:true", "last:true"}
+	if !reflect.DeepEqual(planned, wantPlan) {
+		t.Errorf("PlanScripts() = %v, want %v", planned, wantPlan)
+	}
+
+	if err := service.runScripts(config, ApplyOptions{}); err != nil {
+		t.Fatalf("runScripts() error = %v", err)
+	}
+	wantRan := []string{"echo deps", "echo app", "fail optional", "echo last"}
+	if !reflect.DeepEqual(runner.scripts(), wantRan) {
+		t.Errorf("ran %v, want %v", runner.scripts(), wantRan)
+	}
+
+	runner.reset()
+	if err := service.runScripts(config, ApplyOptions{}); err != nil {
+		t.Fatalf("second runScripts() error = %v", err)
+	}
+	if !reflect.DeepEqual(runner.scripts(), []string{"fail optional"}) {
+		t.Errorf("second run ran %v, want only the failed script again", runner.scripts())
+	}
+
+	config.Nix.Scripts[4].ContinueOnError = false
+	runner.reset()
+	if err := service.runScripts(config, ApplyOptions{}); err == nil {
+		t.Error("runScripts() succeeded although a script failed without continueOnError")
+	}
+
+	config.Nix.Scripts[1].Requires = []string{"app"}
+	if _, err := service.PlanScripts(config, false, false); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("PlanScripts() error = %v, want a cycle error", err)
+	}
+}
+
+func TestRunScriptsTeamScriptsNeedAllowScripts(t *testing.T) {
+	service, home := newTestService(t)
+
+	configDir := filepath.Join(home, ".config", "nix-foundry")
+	writeTestFile(t, filepath.Join(configDir, "config.yaml"), "type: user\nbase: platform\nsettings:\n  shell: zsh\nnix:\n  scripts:\n    - name: mine\n      commands: echo mine\n")
+	writeTestFile(t, filepath.Join(configDir, "teams", "platform.yaml"), "type: user\nmetadata:\n  name: platform\nnix:\n  packages:\n    core: [git]\n  scripts:\n    - name: team-setup\n      commands: echo team\n    - name: after-team\n      commands: echo after\n      requires: [team-setup]\n")
+
+	runner := &fakeRunner{failures: scriptFailures}
+	service.runner = runner
+
+	config, err := service.GetActiveConfig()
+	if err != nil {
+		t.Fatalf("GetActiveConfig() error = %v", err)
+	}
+
+	if err := service.runScripts(config, ApplyOptions{}); err != nil {
+		t.Fatalf("runScripts() error = %v", err)
+	}
+	if !reflect.DeepEqual(runner.scripts(), []string{"echo mine"}) {
+		t.Errorf("ran %v without --allow-scripts, want only the user script", runner.scripts())
+	}
+
+	var confirmed []string
+	runner.reset()
+	declined := ApplyOptions{AllowScripts: true, ConfirmScripts: func(scripts []schema.Script) bool {
+		for _, script := range scripts {
+			confirmed = append(confirmed, script.Name)
+		}
+		return false
+	}}
+	if err := service.runScripts(config, declined); err != nil {
+		t.Fatalf("runScripts() error = %v", err)
+	}
+	if len(runner.scripts()) != 0 {
+		t.Errorf("ran %v although the scripts were not confirmed", runner.scripts())
+	}
+	if !reflect.DeepEqual(confirmed, []string{"team-setup", "after-team"}) {
+		t.Errorf("asked to confirm %v, want the team scripts", confirmed)
+	}
+
+	if err := service.runScripts(config, ApplyOptions{AllowScripts: true}); err != nil {
+		t.Fatalf("runScripts() error = %v", err)
+	}
+	if !reflect.DeepEqual(runner.scripts(), []string{"echo team", "echo after"}) {
+		t.Errorf("ran %v with --allow-scripts, want the team scripts", runner.scripts())
+	}
+}
+
+func TestRunScriptsTimeout(t *testing.T) {
+	service, _ := newTestService(t)
+	config := schema.NewDefaultConfig()
+	config.Nix.Scripts = []schema.Script{{Name: "slow", Commands: "sleep 5", Timeout: 100 * time.Millisecond}}
+
+	service.runner = cmdexec.WithOutput(cmdexec.NewOSRunner(), io.Discard)
+
+	start := time.Now()
+	err := service.runScripts(config, ApplyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runScripts() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("script ran for %v, want it interrupted after its timeout", elapsed)
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+func TestConfigureShell(t *testing.T) {
+	home := "/home/tester"
+	rcFile := filepath.Join(home, ".zshrc")
+	backupFile := rcFile + ".nix-foundry.bak"
+	block := shell.WrapManagedBlock(shell.ManagedBlockContent("zsh"))
+
+	tests := []struct {
+		name        string
+		existing    *string
+		mode        os.FileMode
+		wantContent string
+		wantMode    os.FileMode
+		wantBackup  bool
+	}{
+		{
+			name:        "existing file keeps its content and mode",
+			existing:    stringPtr("export PS1='> '\n"),
+			mode:        0600,
+			wantContent: "export PS1='> '\n\n" + block,
+			wantMode:    0600,
+			wantBackup:  true,
+		},
+		{
+			name:        "block is inserted after a shebang",
+			existing:    stringPtr("#!/bin/zsh\nexport PS1='> '\n"),
+			mode:        0644,
+			wantContent: "#!/bin/zsh\n" + block + "\nexport PS1='> '\n",
+			wantMode:    0644,
+			wantBackup:  true,
+		},
+		{
+			name:        "missing file is created",
+			wantContent: block,
+			wantMode:    0664,
+		},
+		{
+			name:        "already configured file is left alone",
+			existing:    stringPtr("export PS1='> '\n\n" + block),
+			mode:        0600,
+			wantContent: "export PS1='> '\n\n" + block,
+			wantMode:    0600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+
+			fs := filesystem.NewMemFS()
+			if tt.existing != nil {
+				writeMemFile(t, fs, rcFile, *tt.existing, tt.mode)
+			}
+			service := NewService(fs)
+
+			if err := service.configureShell("zsh", nil); err != nil {
+				t.Fatalf("configureShell() error = %v", err)
+			}
+
+			if got := readMemFile(fs, rcFile); got != tt.wantContent {
+				t.Errorf("rc file content = %q, want %q", got, tt.wantContent)
+			}
+			if got := memFileMode(fs, rcFile); got != tt.wantMode {
+				t.Errorf("rc file mode = %v, want %v", got, tt.wantMode)
+			}
+
+			if fs.Exists(backupFile) != tt.wantBackup {
+				t.Fatalf("backup exists = %v, want %v", fs.Exists(backupFile), tt.wantBackup)
+			}
+			if tt.wantBackup && readMemFile(fs, backupFile) != *tt.existing {
+				t.Errorf("backup content = %q, want %q", readMemFile(fs, backupFile), *tt.existing)
+			}
+
+			if err := service.configureShell("zsh", nil); err != nil {
+				t.Fatalf("second configureShell() error = %v", err)
+			}
+			if got := readMemFile(fs, rcFile); got != tt.wantContent {
+				t.Errorf("configureShell() is not idempotent, got %q", got)
+			}
+			if strings.Count(readMemFile(fs, rcFile), shell.ManagedBlockStart) != 1 {
+				t.Errorf("expected exactly one managed block")
+			}
+		})
+	}
+}
+
+func TestConfigureShellKeepsFirstBackup(t *testing.T) {
+	home := "/home/tester"
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".bashrc")
+	backupFile := rcFile + ".nix-foundry.bak"
+
+	fs := filesystem.NewMemFS()
+	writeMemFile(t, fs, rcFile, "alias ll='ls -l'\n", 0644)
+	writeMemFile(t, fs, backupFile, "original\n", 0644)
+	service := NewService(fs)
+
+	if err := service.configureShell("bash", nil); err != nil {
+		t.Fatalf("configureShell() error = %v", err)
+	}
+	if got := readMemFile(fs, backupFile); got != "original\n" {
+		t.Errorf("existing backup was overwritten: %q", got)
+	}
+}
+
+func TestConfigureShellUpdatesEnv(t *testing.T) {
+	home := "/home/tester"
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".zshrc")
+
+	fs := filesystem.NewMemFS()
+	writeMemFile(t, fs, rcFile, "alias ll='ls -l'\n\n"+shell.WrapManagedBlock(shell.ManagedBlockContent("zsh")), 0644)
+	service := NewService(fs)
+
+	if err := service.configureShell("zsh", map[string]string{"EDITOR": "vim"}); err != nil {
+		t.Fatalf("configureShell() error = %v", err)
+	}
+	content := readMemFile(fs, rcFile)
+	if !strings.Contains(content, "export EDITOR='vim'\n"+shell.ManagedBlockEnd) || !strings.HasPrefix(content, "alias ll='ls -l'\n") {
+		t.Errorf("env not added to the managed block:\n%s", content)
+	}
+
+	if err := service.configureShell("zsh", nil); err != nil {
+		t.Fatalf("configureShell() error = %v", err)
+	}
+	if strings.Contains(readMemFile(fs, rcFile), "EDITOR") {
+		t.Errorf("removed env is still exported:\n%s", readMemFile(fs, rcFile))
+	}
+	if strings.Count(readMemFile(fs, rcFile), shell.ManagedBlockStart) != 1 {
+		t.Errorf("expected exactly one managed block")
+	}
+}
+
+func TestConfigureShellNushell(t *testing.T) {
+	home := "/home/tester"
+	t.Setenv("HOME", home)
+	rcFile := filepath.Join(home, ".config", "nushell", "config.nu")
+
+	fs := filesystem.NewMemFS()
+	service := NewService(fs)
+	if err := service.configureShell("nushell", map[string]string{"EDITOR": "hx"}); err != nil {
+		t.Fatalf("configureShell() error = %v", err)
+	}
+	if !fs.Exists(filepath.Dir(rcFile)) {
+		t.Errorf("nushell config directory was not created")
+	}
+	content := readMemFile(fs, rcFile)
+	if !strings.Contains(content, "$env.PATH = ($env.PATH | split row (char esep)") || !strings.Contains(content, `$env.EDITOR = "hx"`) {
+		t.Errorf("rc file does not use nushell syntax:\n%s", content)
+	}
+
+	if err := service.configureShell("tcsh", nil); err == nil || !strings.Contains(err.Error(), "valid options: bash, zsh, fish, nushell") {
+		t.Errorf("configureShell(tcsh) error = %v, want the supported shells listed", err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
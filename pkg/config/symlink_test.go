@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+func TestCleanupMacOSAppSymlinks(t *testing.T) {
+	root := t.TempDir()
+	applicationsDir := filepath.Join(root, "Applications")
+	storeDir := filepath.Join(root, "nix", "store")
+
+	vscode := filepath.Join(storeDir, "abc123-vscode-1.85.0")
+	toolbox := filepath.Join(storeDir, "def456-jetbrains-toolbox-2.1")
+	other := filepath.Join(storeDir, "ghi789-firefox-120.0")
+	missing := filepath.Join(storeDir, "jkl012-slack-4.35")
+
+	for _, dir := range []string{
+		applicationsDir,
+		filepath.Join(vscode, "Applications", "Visual Studio Code.app"),
+		filepath.Join(toolbox, "Applications", "JetBrains Toolbox.app", "Contents", "Helpers", "Toolbox Helper.app"),
+		filepath.Join(other, "Applications", "Firefox.app"),
+		filepath.Join(root, "Manual.app"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"Visual Studio Code.app": filepath.Join(vscode, "Applications", "Visual Studio Code.app"),
+		"Toolbox Helper.app":     filepath.Join(toolbox, "Applications", "JetBrains Toolbox.app", "Contents", "Helpers", "Toolbox Helper.app"),
+		"Firefox.app":            filepath.Join(other, "Applications", "Firefox.app"),
+		"Slack.app":              filepath.Join(missing, "Applications", "Slack.app"),
+		"Manual.app":             filepath.Join(root, "Manual.app"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(applicationsDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := &Service{applicationsDir: applicationsDir, storeDir: storeDir}
+	if err := service.CleanupMacOSAppSymlinks([]string{vscode, toolbox}); err != nil {
+		t.Fatalf("CleanupMacOSAppSymlinks() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(applicationsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	sort.Strings(remaining)
+
+	want := []string{"Firefox.app", "Manual.app"}
+	if len(remaining) != len(want) || remaining[0] != want[0] || remaining[1] != want[1] {
+		t.Errorf("remaining applications = %v, want %v", remaining, want)
+	}
+}
+
+func TestCleanOrphanedAppSymlinks(t *testing.T) {
+	root := t.TempDir()
+	storeDir := filepath.Join(root, "nix", "store")
+
+	vscode := filepath.Join(storeDir, "abc123-vscode-1.85.0")
+	oldFirefox := filepath.Join(storeDir, "ghi789-firefox-119.0")
+	slack := filepath.Join(storeDir, "jkl012-slack-4.35")
+
+	for _, dir := range []string{
+		filepath.Join(vscode, "Applications", "Visual Studio Code.app"),
+		filepath.Join(oldFirefox, "Applications", "Firefox.app"),
+		filepath.Join(root, "Manual.app"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"Visual Studio Code.app": filepath.Join(vscode, "Applications", "Visual Studio Code.app"),
+		"Firefox.app":            filepath.Join(oldFirefox, "Applications", "Firefox.app"),
+		"Slack.app":              filepath.Join(slack, "Applications", "Slack.app"),
+		"Manual.app":             filepath.Join(root, "Manual.app"),
+		"Broken.app":             filepath.Join(root, "missing", "Broken.app"),
+	}
+	tests := []struct {
+		name        string
+		runner      *fakeRunner
+		wantRemoved []string
+	}{
+		{
+			name:        "unreferenced and dangling store symlinks",
+			runner:      &fakeRunner{installed: `{"0": {"pname": "vscode"}}`, outputs: map[string]string{"--out-path vscode": "vscode  " + vscode + "\n"}},
+			wantRemoved: []string{"Firefox.app", "Slack.app"},
+		},
+		{
+			name:        "only dangling symlinks when packages cannot be queried",
+			runner:      &fakeRunner{failures: map[string]error{"nix-env": fmt.Errorf("nix not available")}},
+			wantRemoved: []string{"Slack.app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appsDir := filepath.Join(t.TempDir(), "Applications")
+			if err := os.MkdirAll(appsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, target := range links {
+				if err := os.Symlink(target, filepath.Join(appsDir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			service := NewService(filesystem.NewMemFS())
+			service.runner = tt.runner
+			service.applicationsDir = appsDir
+			service.storeDir = storeDir
+
+			removed, err := service.CleanOrphanedAppSymlinks()
+			if err != nil {
+				t.Fatalf("CleanOrphanedAppSymlinks() error = %v", err)
+			}
+			sort.Strings(removed)
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+
+			for name := range links {
+				_, statErr := os.Lstat(filepath.Join(appsDir, name))
+				wasRemoved := false
+				for _, r := range tt.wantRemoved {
+					wasRemoved = wasRemoved || r == name
+				}
+				if wasRemoved != os.IsNotExist(statErr) {
+					t.Errorf("%s: removed = %v, want %v", name, os.IsNotExist(statErr), wasRemoved)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+legacyPathComment and legacyPathExport are the lines installers before managed
+blocks added to rc files to put ~/.local/bin on PATH.
+*/
+const (
+	legacyPathComment = "# Add nix-foundry to PATH"
+	legacyPathExport  = `export PATH="$PATH:$HOME/.local/bin"`
+)
+
+/*
+SelfUninstallOptions configures SelfUninstall.
+*/
+type SelfUninstallOptions struct {
+	// KeepBackups leaves the <file>.nix-foundry.bak backups made of the files
+	// nix-foundry edited, such as the shell configuration file.
+	KeepBackups bool
+	// Confirm is called with the inventory before anything is removed, and
+	// nothing is removed unless it returns true. Nil removes without asking.
+	Confirm func(inventory []UninstallItem) bool
+}
+
+/*
+UninstallItem is something nix-foundry added to the system, found by
+SelfUninstallInventory. Missing items were expected but not found, and are only
+reported.
+*/
+type UninstallItem struct {
+	Description string
+	Path        string
+	Missing     bool
+	remove      func() error
+}
+
+/*
+SelfUninstallInventory lists what nix-foundry added to the system: the installed
+binary, the managed blocks in shell configuration files and the gitconfig, the
+application symlinks it created that still point at the same store path, and the configuration, state and cache
+directories. Nix, the packages it installed and project directories are not
+included. The binary, the configuration directory and the managed block in the
+configured shell's configuration file are reported as missing when they do not
+exist, so running it again after an uninstall lists nothing to remove.
+*/
+func (s *Service) SelfUninstallInventory(opts SelfUninstallOptions) ([]UninstallItem, error) {
+	homeDir, homeErr := platform.GetRealUserHomeDir()
+	if homeErr != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", homeErr)
+	}
+	configDir, dirErr := schema.GetConfigDir()
+	if dirErr != nil {
+		return nil, fmt.Errorf("failed to get config directory: %w", dirErr)
+	}
+
+	var inventory []UninstallItem
+
+	configuredShell := ""
+	if content, readErr := s.fs.ReadFile(filepath.Join(configDir, "config.yaml")); readErr == nil {
+		userConfig := &schema.Config{}
+		if yaml.Unmarshal(content, userConfig) == nil {
+			configuredShell = userConfig.Settings.Shell
+		}
+	}
+	for _, shellName := range platform.SupportedShells {
+		rcFile, pathErr := platform.ShellConfigPath(homeDir, shellName)
+		if pathErr != nil {
+			continue
+		}
+		item, found := s.managedBlockItem("shell initialization block", rcFile, withoutShellBlocks)
+		if found {
+			inventory = append(inventory, item)
+		} else if shellName == configuredShell {
+			inventory = append(inventory, UninstallItem{Description: "shell initialization block", Path: rcFile, Missing: true})
+		}
+		inventory = append(inventory, s.backupItems(rcFile, opts)...)
+	}
+
+	gitconfig := s.userGitConfig(homeDir)
+	if item, found := s.managedBlockItem("git include block", gitconfig, withoutGitIncludes); found {
+		inventory = append(inventory, item)
+	}
+	inventory = append(inventory, s.backupItems(gitconfig, opts)...)
+
+	appSymlinks := s.loadAppSymlinks()
+	linkPaths := make([]string, 0, len(appSymlinks))
+	for linkPath := range appSymlinks {
+		linkPaths = append(linkPaths, linkPath)
+	}
+	sort.Strings(linkPaths)
+	for _, linkPath := range linkPaths {
+		if target, ok := s.nixSymlinkTarget(linkPath); ok && target == filepath.Clean(appSymlinks[linkPath]) {
+			inventory = append(inventory, UninstallItem{Description: "application symlink", Path: linkPath, remove: removePath(linkPath)})
+		}
+	}
+
+	binary := filepath.Join(homeDir, ".local", "bin", "nix-foundry")
+	if _, statErr := os.Lstat(binary); statErr == nil {
+		inventory = append(inventory, UninstallItem{Description: "nix-foundry binary", Path: binary, remove: removePath(binary)})
+	} else {
+		inventory = append(inventory, UninstallItem{Description: "nix-foundry binary", Path: binary, Missing: true})
+	}
+
+	for _, dir := range []struct {
+		description string
+		path        func() (string, error)
+	}{
+		{description: "state directory", path: paths.StateDir},
+		{description: "cache directory", path: paths.CacheDir},
+	} {
+		dirPath, pathErr := dir.path()
+		if pathErr != nil || dirPath == configDir || isWithinPath(dirPath, configDir) {
+			continue
+		}
+		if _, statErr := os.Stat(dirPath); statErr == nil {
+			inventory = append(inventory, UninstallItem{Description: dir.description, Path: dirPath, remove: removePath(dirPath)})
+		}
+	}
+
+	if _, statErr := os.Stat(configDir); statErr == nil {
+		inventory = append(inventory, UninstallItem{Description: "configuration directory", Path: configDir, remove: removePath(configDir)})
+	} else {
+		inventory = append(inventory, UninstallItem{Description: "configuration directory", Path: configDir, Missing: true})
+	}
+
+	return inventory, nil
+}
+
+/*
+SelfUninstall removes what nix-foundry added to the system, as listed by
+SelfUninstallInventory, and leaves Nix and the packages it installed alone. The
+inventory is passed to opts.Confirm first. Items that fail to be removed do not
+stop the others from being removed. It returns the removed items.
+*/
+func (s *Service) SelfUninstall(opts SelfUninstallOptions) ([]UninstallItem, error) {
+	inventory, inventoryErr := s.SelfUninstallInventory(opts)
+	if inventoryErr != nil {
+		return nil, inventoryErr
+	}
+	if opts.Confirm != nil && !opts.Confirm(inventory) {
+		return nil, fmt.Errorf("uninstallation cancelled")
+	}
+
+	var removed []UninstallItem
+	var errs []error
+	for _, item := range inventory {
+		if item.Missing {
+			continue
+		}
+		if removeErr := item.remove(); removeErr != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s %s: %w", item.Description, item.Path, removeErr))
+			continue
+		}
+		removed = append(removed, item)
+	}
+	return removed, errors.Join(errs...)
+}
+
+/*
+managedBlockItem returns an item that strips what nix-foundry wrote into path
+with strip, and whether there is anything to strip.
+*/
+func (s *Service) managedBlockItem(description, path string, strip func(string) string) (UninstallItem, bool) {
+	content, readErr := s.fs.ReadFile(path)
+	if readErr != nil || strip(string(content)) == string(content) {
+		return UninstallItem{}, false
+	}
+
+	return UninstallItem{Description: description, Path: path, remove: func() error {
+		current, currentErr := s.fs.ReadFile(path)
+		if currentErr != nil {
+			return currentErr
+		}
+		perm := os.FileMode(0644)
+		if info, statErr := s.fs.Stat(path); statErr == nil {
+			perm = info.Mode().Perm()
+		}
+		return s.fs.AtomicWriteFile(path, []byte(strip(string(current))), perm)
+	}}, true
+}
+
+/*
+backupItems returns the backup nix-foundry made of path before editing it,
+unless opts keeps backups.
+*/
+func (s *Service) backupItems(path string, opts SelfUninstallOptions) []UninstallItem {
+	backupFile := path + ".nix-foundry.bak"
+	if opts.KeepBackups || !s.fs.Exists(backupFile) {
+		return nil
+	}
+	return []UninstallItem{{Description: "backup", Path: backupFile, remove: removePath(backupFile)}}
+}
+
+/*
+withoutShellBlocks removes the nix-foundry managed blocks from a shell
+configuration file, along with the PATH lines written before managed blocks
+existed. Blocks written by the Nix installer are kept.
+*/
+func withoutShellBlocks(content string) string {
+	stripped, _ := shell.RemoveNixFoundryBlocks(content)
+
+	var kept []string
+	for _, line := range strings.Split(stripped, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == legacyPathComment || trimmed == legacyPathExport {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+/*
+removePath returns a function that removes path and anything below it, and
+succeeds when path no longer exists.
+*/
+func removePath(path string) func() error {
+	return func() error {
+		return os.RemoveAll(path)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+func TestSelfUninstall(t *testing.T) {
+	service, home := newTestService(t)
+
+	root := t.TempDir()
+	applicationsDir := filepath.Join(root, "Applications")
+	storeDir := filepath.Join(root, "nix", "store")
+	app := filepath.Join(storeDir, "abc123-firefox-120.0", "Applications", "Firefox.app")
+	for _, dir := range []string{applicationsDir, app, filepath.Join(root, "Manual.app")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(app, filepath.Join(applicationsDir, "Firefox.app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "Manual.app"), filepath.Join(applicationsDir, "Manual.app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(app, filepath.Join(applicationsDir, "Other.app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.recordAppSymlink(filepath.Join(applicationsDir, "Firefox.app"), app); err != nil {
+		t.Fatal(err)
+	}
+
+	installerBlock := "# Nix\n. /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh\n# End Nix\n"
+	zshrc := filepath.Join(home, ".zshrc")
+	writeTestFile(t, zshrc, "alias ll='ls -l'\n"+installerBlock+shell.WrapManagedBlock(shell.ManagedBlockContent("zsh")))
+	writeTestFile(t, zshrc+".nix-foundry.bak", "alias ll='ls -l'\n")
+	writeTestFile(t, filepath.Join(home, ".config", "nix-foundry", "config.yaml"), "type: user\nsettings:\n  shell: zsh\n")
+	writeTestFile(t, filepath.Join(home, ".local", "bin", "nix-foundry"), "binary")
+	writeTestFile(t, filepath.Join(home, ".local", "state", "nix-foundry", "nix-foundry.log"), "log")
+
+	service.applicationsDir = applicationsDir
+	service.storeDir = storeDir
+
+	if _, err := service.SelfUninstall(SelfUninstallOptions{Confirm: func([]UninstallItem) bool { return false }}); err == nil {
+		t.Fatal("SelfUninstall() without confirmation succeeded, want it cancelled")
+	}
+	if _, err := os.Stat(filepath.Join(home, ".local", "bin", "nix-foundry")); err != nil {
+		t.Fatalf("a cancelled uninstall removed the binary: %v", err)
+	}
+
+	var inventory []UninstallItem
+	removed, err := service.SelfUninstall(SelfUninstallOptions{KeepBackups: true, Confirm: func(items []UninstallItem) bool {
+		inventory = items
+		return true
+	}})
+	if err != nil {
+		t.Fatalf("SelfUninstall() error = %v", err)
+	}
+	if len(removed) != len(inventory) {
+		t.Errorf("removed %d of %d inventory items", len(removed), len(inventory))
+	}
+	var removedPaths []string
+	for _, item := range removed {
+		removedPaths = append(removedPaths, item.Path)
+	}
+	for _, want := range []string{zshrc, filepath.Join(applicationsDir, "Firefox.app"), filepath.Join(home, ".local", "bin", "nix-foundry"), filepath.Join(home, ".local", "state", "nix-foundry"), filepath.Join(home, ".config", "nix-foundry")} {
+		if !strings.Contains(strings.Join(removedPaths, "\n"), want) {
+			t.Errorf("removed = %v, want %s", removedPaths, want)
+		}
+	}
+
+	content, _ := os.ReadFile(zshrc)
+	if string(content) != "alias ll='ls -l'\n"+installerBlock {
+		t.Errorf(".zshrc = %q, want the user's lines and the Nix installer block kept", content)
+	}
+	if _, err := os.Lstat(filepath.Join(applicationsDir, "Manual.app")); err != nil {
+		t.Errorf("a symlink outside the Nix store was removed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(applicationsDir, "Other.app")); err != nil {
+		t.Errorf("a Nix store symlink nix-foundry did not create was removed: %v", err)
+	}
+	if _, err := os.Stat(zshrc + ".nix-foundry.bak"); err != nil {
+		t.Errorf("the backup was removed despite KeepBackups: %v", err)
+	}
+
+	removed, err = service.SelfUninstall(SelfUninstallOptions{Confirm: func(items []UninstallItem) bool {
+		inventory = items
+		return true
+	}})
+	if err != nil {
+		t.Fatalf("second SelfUninstall() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].Path != zshrc+".nix-foundry.bak" {
+		t.Errorf("second SelfUninstall() removed %v, want only the backup", removed)
+	}
+	var missing []string
+	for _, item := range inventory {
+		if item.Missing {
+			missing = append(missing, item.Description)
+		}
+	}
+	if want := "nix-foundry binary, configuration directory"; strings.Join(missing, ", ") != want {
+		t.Errorf("missing = %v, want %s", missing, want)
+	}
+}
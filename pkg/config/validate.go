@@ -0,0 +1,17 @@
+package config
+
+import (
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+CheckPackages checks that the core and optional packages in the configuration, and
+those of its enabled groups, exist in nixpkgs. Pinned packages are skipped since they are resolved from their
+own flake reference. With offline set, nixpkgs is not queried and every package
+is reported as unverified.
+*/
+func (s *Service) CheckPackages(config *schema.Config, offline bool) []packages.PackageCheck {
+	manager := packages.NewManagerWithRunner(s.fs, s.runner)
+	return manager.CheckPackages(config.Nix.Packages.AllPackages(), offline)
+}
@@ -0,0 +1,145 @@
+/*
+Package doctor checks the health of a Nix Foundry setup. It gathers the checks
+that are otherwise spread over several commands, such as whether Nix is installed
+and whether the configuration is valid, and reports them together with hints on
+how to fix what failed.
+*/
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+Check is a single health check. A failing critical check means Nix Foundry cannot
+work; other failures are reported as warnings. Hint tells the user how to fix a
+failure.
+*/
+type Check struct {
+	Name     string
+	Critical bool
+	Hint     string
+	Run      func() error
+}
+
+/*
+Result is the outcome of a check. Err is nil when the check passed.
+*/
+type Result struct {
+	Check
+	Err error
+}
+
+/*
+NixInstallation reports whether Nix is installed. It is implemented by
+nix.Installer.
+*/
+type NixInstallation interface {
+	IsInstalled() bool
+}
+
+/*
+Environment holds what the checks inspect, so that tests can replace it.
+PlatformSupported returns an error when Nix cannot run on this platform,
+ActiveConfig loads the merged configuration, and Path is the value of $PATH.
+*/
+type Environment struct {
+	PlatformSupported func() error
+	Nix               NixInstallation
+	ActiveConfig      func() (*schema.Config, error)
+	HomeDir           string
+	Path              string
+}
+
+/*
+Checks returns the health checks for env in the order they are reported.
+*/
+func Checks(env Environment) []Check {
+	localBin := filepath.Join(env.HomeDir, ".local", "bin")
+
+	return []Check{
+		{
+			Name:     "Platform",
+			Critical: true,
+			Run:      env.PlatformSupported,
+		},
+		{
+			Name:     "Nix installation",
+			Critical: true,
+			Hint:     "Run 'nix-foundry install' to install Nix",
+			Run: func() error {
+				if !env.Nix.IsInstalled() {
+					return fmt.Errorf("Nix is not installed")
+				}
+				return nil
+			},
+		},
+		{
+			Name:     "Configuration",
+			Critical: true,
+			Hint:     "Run 'nix-foundry config init' to create a configuration, or 'nix-foundry config validate' for details",
+			Run: func() error {
+				activeConfig, configErr := env.ActiveConfig()
+				if configErr != nil {
+					return configErr
+				}
+				return schema.ValidateConfig(activeConfig)
+			},
+		},
+		{
+			Name: "PATH",
+			Hint: "Run 'nix-foundry config apply' to add it to your shell configuration, then restart your shell",
+			Run: func() error {
+				if !slices.Contains(filepath.SplitList(env.Path), localBin) {
+					return fmt.Errorf("%s is not on PATH", localBin)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+/*
+Run runs every check, continuing after failures, and returns their results.
+*/
+func Run(checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, Result{Check: check, Err: check.Run()})
+	}
+	return results
+}
+
+/*
+Report writes a line per result to w, followed by the hint for each failure. It
+returns an error if a critical check failed.
+*/
+func Report(w io.Writer, results []Result) error {
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+			fmt.Fprintf(w, "✅ %s\n", result.Name)
+			continue
+		case result.Critical:
+			failed++
+			fmt.Fprintf(w, "❌ %s: %v\n", result.Name, result.Err)
+		default:
+			fmt.Fprintf(w, "⚠️  %s: %v\n", result.Name, result.Err)
+		}
+		if result.Hint != "" {
+			fmt.Fprintf(w, "   • %s\n", result.Hint)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d critical check(s) failed", failed)
+	}
+	fmt.Fprintln(w, "✨ No critical problems found")
+	return nil
+}
@@ -0,0 +1,79 @@
+package doctor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+type fakeNix struct{ installed bool }
+
+func (f fakeNix) IsInstalled() bool { return f.installed }
+
+func healthyEnvironment() Environment {
+	return Environment{
+		PlatformSupported: func() error { return nil },
+		Nix:               fakeNix{installed: true},
+		ActiveConfig: func() (*schema.Config, error) {
+			config := schema.NewDefaultConfig()
+			config.Settings.Shell = "zsh"
+			return config, nil
+		},
+		HomeDir: "/home/user",
+		Path:    "/usr/bin:/home/user/.local/bin",
+	}
+}
+
+func TestReportHealthy(t *testing.T) {
+	var out bytes.Buffer
+	if err := Report(&out, Run(Checks(healthyEnvironment()))); err != nil {
+		t.Fatalf("Report() error = %v\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), "❌") || strings.Contains(out.String(), "⚠️") {
+		t.Errorf("expected every check to pass, got:\n%s", out.String())
+	}
+}
+
+func TestReportNixNotInstalled(t *testing.T) {
+	env := healthyEnvironment()
+	env.Nix = fakeNix{installed: false}
+	env.Path = "/usr/bin"
+
+	var out bytes.Buffer
+	err := Report(&out, Run(Checks(env)))
+	if err == nil {
+		t.Fatal("expected an error when Nix is not installed")
+	}
+
+	report := out.String()
+	if !strings.Contains(report, "❌ Nix installation: Nix is not installed\n   • Run 'nix-foundry install' to install Nix") {
+		t.Errorf("expected the Nix check to fail with a hint, got:\n%s", report)
+	}
+	if !strings.Contains(report, "⚠️  PATH: /home/user/.local/bin is not on PATH") {
+		t.Errorf("expected a PATH warning, got:\n%s", report)
+	}
+	if !strings.Contains(report, "✅ Configuration") {
+		t.Errorf("expected the remaining checks to run, got:\n%s", report)
+	}
+	if !strings.Contains(err.Error(), "1 critical") {
+		t.Errorf("error = %v, want one critical failure; the PATH warning is not critical", err)
+	}
+}
+
+func TestReportInvalidConfig(t *testing.T) {
+	env := healthyEnvironment()
+	env.ActiveConfig = func() (*schema.Config, error) {
+		return nil, errors.New("failed to parse user config")
+	}
+
+	var out bytes.Buffer
+	if err := Report(&out, Run(Checks(env))); err == nil {
+		t.Fatal("expected an error for an unreadable configuration")
+	}
+	if !strings.Contains(out.String(), "❌ Configuration: failed to parse user config") {
+		t.Errorf("expected the configuration check to fail, got:\n%s", out.String())
+	}
+}
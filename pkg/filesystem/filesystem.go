@@ -8,6 +8,7 @@ package filesystem
 import (
 	"io"
 	"os"
+	"path/filepath"
 )
 
 /*
@@ -17,11 +18,15 @@ This abstraction allows for easier testing and platform independence.
 type FileSystem interface {
 	ReadFile(path string) ([]byte, error)
 	WriteFile(path string, data []byte, perm os.FileMode) error
+	AtomicWriteFile(path string, data []byte, perm os.FileMode) error
 	Remove(path string) error
 	MkdirAll(path string, perm os.FileMode) error
 	CreateDir(path string) error
 	Exists(path string) bool
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.DirEntry, error)
 	Copy(src, dst string) error
+	Chmod(path string, mode os.FileMode) error
 }
 
 /*
@@ -52,6 +57,53 @@ func (fs *OSFileSystem) WriteFile(path string, data []byte, perm os.FileMode) er
 	return os.WriteFile(path, data, perm)
 }
 
+/*
+AtomicWriteFile replaces the file at path with data so that readers see either
+the old or the new content, never a partial write, and the new content survives
+a crash once it returns. The data is written to a temporary file in the same
+directory, synced, and renamed over path, and the directory is then synced to
+persist the rename. The temporary file is removed if any step fails.
+*/
+func (fs *OSFileSystem) AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmpFile, createErr := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if createErr != nil {
+		return createErr
+	}
+	tmpPath := tmpFile.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, writeErr := tmpFile.Write(data); writeErr != nil {
+		return writeErr
+	}
+	if chmodErr := tmpFile.Chmod(perm); chmodErr != nil {
+		return chmodErr
+	}
+	if syncErr := tmpFile.Sync(); syncErr != nil {
+		return syncErr
+	}
+	if closeErr := tmpFile.Close(); closeErr != nil {
+		return closeErr
+	}
+	if renameErr := os.Rename(tmpPath, path); renameErr != nil {
+		return renameErr
+	}
+	renamed = true
+
+	dirFile, openErr := os.Open(dir)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() { _ = dirFile.Close() }()
+	return dirFile.Sync()
+}
+
 /*
 Remove removes a file or directory.
 */
@@ -84,6 +136,27 @@ func (fs *OSFileSystem) Exists(path string) bool {
 	return err == nil
 }
 
+/*
+Stat returns file information for the given path.
+*/
+func (fs *OSFileSystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+/*
+ReadDir returns the entries of a directory sorted by name.
+*/
+func (fs *OSFileSystem) ReadDir(path string) ([]os.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+/*
+Chmod changes the mode of a file.
+*/
+func (fs *OSFileSystem) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
 /*
 Copy copies a file from src to dst.
 It creates any necessary parent directories and preserves file permissions.
@@ -95,15 +168,24 @@ func (fs *OSFileSystem) Copy(src, dst string) error {
 	}
 	defer func() { _ = srcFile.Close() }()
 
-	mkdirErr := fs.MkdirAll(dst, 0755)
+	info, statErr := srcFile.Stat()
+	if statErr != nil {
+		return statErr
+	}
+
+	mkdirErr := fs.MkdirAll(filepath.Dir(dst), 0755)
 	if mkdirErr != nil {
 		return mkdirErr
 	}
 
-	dstFile, createErr := os.Create(dst)
+	dstFile, createErr := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if createErr != nil {
 		return createErr
 	}
+	if chmodErr := dstFile.Chmod(info.Mode().Perm()); chmodErr != nil {
+		_ = dstFile.Close()
+		return chmodErr
+	}
 	defer func() { _ = dstFile.Close() }()
 
 	_, copyErr := io.Copy(dstFile, srcFile)
@@ -0,0 +1,95 @@
+package filesystem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAtomicWriteFileNeverPartial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := [][]byte{
+		bytes.Repeat([]byte("a"), 1<<20),
+		bytes.Repeat([]byte("b"), 1<<20),
+	}
+
+	fs := NewOSFileSystem()
+	if err := fs.AtomicWriteFile(path, contents[0], 0644); err != nil {
+		t.Fatalf("AtomicWriteFile() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var partial []int
+	var mu sync.Mutex
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				data, err := os.ReadFile(path)
+				if err != nil || (!bytes.Equal(data, contents[0]) && !bytes.Equal(data, contents[1])) {
+					mu.Lock()
+					partial = append(partial, len(data))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for idx := range 50 {
+		if err := fs.AtomicWriteFile(path, contents[idx%2], 0644); err != nil {
+			t.Errorf("AtomicWriteFile() error = %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if len(partial) > 0 {
+		t.Errorf("readers observed %d partial or missing files (sizes %v)", len(partial), partial)
+	}
+}
+
+func TestAtomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	fs := NewOSFileSystem()
+	if err := fs.AtomicWriteFile(path, []byte("shell: zsh\n"), 0640); err != nil {
+		t.Fatalf("AtomicWriteFile() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.AtomicWriteFile(blocked, []byte("data"), 0644); err == nil {
+		t.Error("expected an error when replacing a non-empty directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("directory contains %v, want no temporary files left behind", names)
+	}
+}
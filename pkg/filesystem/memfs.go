@@ -0,0 +1,308 @@
+package filesystem
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+MemFS implements FileSystem in memory. It keeps directories and permissions and
+follows the OS semantics that callers rely on: writing a file requires its parent
+directory to exist, a directory must be empty to be removed, and missing paths
+report errors matching os.ErrNotExist. Paths are cleaned, so a/../b and b refer
+to the same entry. It is safe for concurrent use.
+*/
+type MemFS struct {
+	mu      sync.RWMutex
+	entries map[string]*memEntry
+}
+
+type memEntry struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+/*
+NewMemFS returns an empty in-memory filesystem containing only the root directory.
+*/
+func NewMemFS() *MemFS {
+	return &MemFS{entries: map[string]*memEntry{
+		string(filepath.Separator): {mode: os.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+/*
+ReadFile returns a copy of the file's content.
+*/
+func (m *MemFS) ReadFile(path string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path = filepath.Clean(path)
+	entry, ok := m.entries[path]
+	if !ok {
+		return nil, pathError("open", path, fs.ErrNotExist)
+	}
+	if entry.mode.IsDir() {
+		return nil, pathError("read", path, syscall.EISDIR)
+	}
+	return append([]byte(nil), entry.data...), nil
+}
+
+/*
+WriteFile writes data to a file, creating it with perm if it does not exist.
+The mode of an existing file is kept.
+*/
+func (m *MemFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeFile(filepath.Clean(path), data, perm, false)
+}
+
+/*
+AtomicWriteFile replaces the file with data and sets its mode to perm. Writes
+to memory are always atomic.
+*/
+func (m *MemFS) AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeFile(filepath.Clean(path), data, perm, true)
+}
+
+func (m *MemFS) writeFile(path string, data []byte, perm os.FileMode, replace bool) error {
+	if parentErr := m.checkParent("open", path); parentErr != nil {
+		return parentErr
+	}
+
+	entry, ok := m.entries[path]
+	if ok && entry.mode.IsDir() {
+		return pathError("open", path, syscall.EISDIR)
+	}
+	if !ok || replace {
+		entry = &memEntry{mode: perm.Perm()}
+		m.entries[path] = entry
+	}
+	entry.data = append([]byte(nil), data...)
+	entry.modTime = time.Now()
+	return nil
+}
+
+/*
+Remove removes a file or an empty directory.
+*/
+func (m *MemFS) Remove(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	entry, ok := m.entries[path]
+	if !ok {
+		return pathError("remove", path, fs.ErrNotExist)
+	}
+	if entry.mode.IsDir() && m.hasChildren(path) {
+		return pathError("remove", path, syscall.ENOTEMPTY)
+	}
+	delete(m.entries, path)
+	return nil
+}
+
+/*
+MkdirAll creates a directory and any missing parents with perm. It succeeds if
+the directory already exists and fails if a file is in the way.
+*/
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(filepath.Clean(path), perm)
+}
+
+func (m *MemFS) mkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for current := path; ; current = filepath.Dir(current) {
+		if entry, ok := m.entries[current]; ok {
+			if !entry.mode.IsDir() {
+				return pathError("mkdir", current, syscall.ENOTDIR)
+			}
+			break
+		}
+		missing = append(missing, current)
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	for idx := len(missing) - 1; idx >= 0; idx-- {
+		m.entries[missing[idx]] = &memEntry{mode: os.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+/*
+CreateDir creates a directory if it doesn't exist.
+*/
+func (m *MemFS) CreateDir(path string) error {
+	return m.MkdirAll(path, 0755)
+}
+
+/*
+Exists checks if a path exists.
+*/
+func (m *MemFS) Exists(path string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.entries[filepath.Clean(path)]
+	return ok
+}
+
+/*
+Stat returns file information for the given path.
+*/
+func (m *MemFS) Stat(path string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path = filepath.Clean(path)
+	entry, ok := m.entries[path]
+	if !ok {
+		return nil, pathError("stat", path, fs.ErrNotExist)
+	}
+	return memFileInfo{name: filepath.Base(path), size: int64(len(entry.data)), mode: entry.mode, modTime: entry.modTime}, nil
+}
+
+/*
+ReadDir returns the entries of a directory sorted by name.
+*/
+func (m *MemFS) ReadDir(path string) ([]os.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path = filepath.Clean(path)
+	entry, ok := m.entries[path]
+	if !ok {
+		return nil, pathError("open", path, fs.ErrNotExist)
+	}
+	if !entry.mode.IsDir() {
+		return nil, pathError("readdirent", path, syscall.ENOTDIR)
+	}
+
+	var entries []os.DirEntry
+	for child, childEntry := range m.entries {
+		if child == path || filepath.Dir(child) != path {
+			continue
+		}
+		info := memFileInfo{name: filepath.Base(child), size: int64(len(childEntry.data)), mode: childEntry.mode, modTime: childEntry.modTime}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Name() < entries[b].Name() })
+	return entries, nil
+}
+
+/*
+Copy copies a file from src to dst, creating any necessary parent directories and
+preserving the file's permissions.
+*/
+func (m *MemFS) Copy(src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, dst = filepath.Clean(src), filepath.Clean(dst)
+	entry, ok := m.entries[src]
+	if !ok {
+		return pathError("open", src, fs.ErrNotExist)
+	}
+	if entry.mode.IsDir() {
+		return pathError("read", src, syscall.EISDIR)
+	}
+
+	if mkdirErr := m.mkdirAll(filepath.Dir(dst), 0755); mkdirErr != nil {
+		return mkdirErr
+	}
+	return m.writeFile(dst, entry.data, entry.mode.Perm(), true)
+}
+
+/*
+Chmod changes the permissions of a file or directory.
+*/
+func (m *MemFS) Chmod(path string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	entry, ok := m.entries[path]
+	if !ok {
+		return pathError("chmod", path, fs.ErrNotExist)
+	}
+	entry.mode = entry.mode.Type() | mode.Perm()
+	return nil
+}
+
+/*
+Paths returns every file and directory in the filesystem in sorted order. It is
+meant for assertions in tests.
+*/
+func (m *MemFS) Paths() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]string, 0, len(m.entries))
+	for path := range m.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+/*
+checkParent returns an error unless the parent directory of path exists.
+*/
+func (m *MemFS) checkParent(op, path string) error {
+	parent, ok := m.entries[filepath.Dir(path)]
+	if !ok {
+		return pathError(op, path, fs.ErrNotExist)
+	}
+	if !parent.mode.IsDir() {
+		return pathError(op, path, syscall.ENOTDIR)
+	}
+	return nil
+}
+
+/*
+hasChildren reports whether any entry is inside dir.
+*/
+func (m *MemFS) hasChildren(dir string) bool {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	for path := range m.entries {
+		if path != dir && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathError(op, path string, err error) error {
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+/*
+memFileInfo describes a MemFS entry.
+*/
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,154 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+/*
+errKind describes an error by the condition callers check for, so that errors
+from MemFS and the OS can be compared.
+*/
+func errKind(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not exist"
+	case errors.Is(err, syscall.ENOTDIR):
+		return "not a directory"
+	case errors.Is(err, syscall.EISDIR):
+		return "is a directory"
+	case errors.Is(err, syscall.ENOTEMPTY):
+		return "not empty"
+	default:
+		return "error: " + err.Error()
+	}
+}
+
+/*
+fsScenario runs the operations the services rely on against fsys under root and
+returns a log of everything observable.
+*/
+func fsScenario(fsys FileSystem, root string) []string {
+	var log []string
+	record := func(op string, err error) {
+		log = append(log, fmt.Sprintf("%s: %s", op, errKind(err)))
+	}
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{root}, elem...)...)
+	}
+	stat := func(op string, name string) {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			record(op, err)
+			return
+		}
+		log = append(log, fmt.Sprintf("%s: dir=%v mode=%v", op, info.IsDir(), info.Mode().Perm()))
+	}
+	list := func(op string, name string) {
+		entries, err := fsys.ReadDir(name)
+		record(op, err)
+		for _, entry := range entries {
+			log = append(log, fmt.Sprintf("%s entry: %s dir=%v", op, entry.Name(), entry.IsDir()))
+		}
+	}
+	read := func(op string, name string) {
+		data, err := fsys.ReadFile(name)
+		record(op, err)
+		if err == nil {
+			log = append(log, fmt.Sprintf("%s content: %q", op, data))
+		}
+	}
+
+	record("write without parent", fsys.WriteFile(path("missing", "config.yaml"), []byte("x"), 0644))
+	record("atomic write without parent", fsys.AtomicWriteFile(path("missing", "config.yaml"), []byte("x"), 0644))
+	record("mkdirall", fsys.MkdirAll(path("a", "b"), 0755))
+	record("mkdirall existing", fsys.MkdirAll(path("a", "b"), 0755))
+	stat("stat dir", path("a"))
+
+	record("write", fsys.WriteFile(path("a", "b", "file"), []byte("one"), 0644))
+	read("read", path("a", ".", "b", "file"))
+	record("rewrite", fsys.WriteFile(path("a", "b", "file"), []byte("two"), 0600))
+	stat("stat after rewrite", path("a", "b", "file"))
+	record("chmod", fsys.Chmod(path("a", "b", "file"), 0600))
+	stat("stat after chmod", path("a", "b", "file"))
+	record("atomic write", fsys.AtomicWriteFile(path("a", "b", "file"), []byte("three"), 0640))
+	read("read after atomic write", path("a", "b", "file"))
+	stat("stat after atomic write", path("a", "b", "file"))
+
+	record("write sibling", fsys.WriteFile(path("a", "sibling"), []byte("x"), 0644))
+	list("readdir", path("a"))
+	list("readdir file", path("a", "b", "file"))
+	list("readdir missing", path("missing"))
+	record("remove sibling", fsys.Remove(path("a", "sibling")))
+
+	record("mkdirall over file", fsys.MkdirAll(path("a", "b", "file", "sub"), 0755))
+	record("write under file", fsys.WriteFile(path("a", "b", "file", "sub"), []byte("x"), 0644))
+	read("read dir", path("a"))
+	record("write dir", fsys.WriteFile(path("a"), []byte("x"), 0644))
+	record("remove non-empty dir", fsys.Remove(path("a")))
+
+	record("copy", fsys.Copy(path("a", "b", "file"), path("c", "d", "copy")))
+	read("read copy", path("c", "d", "copy"))
+	stat("stat copy", path("c", "d", "copy"))
+	record("copy missing", fsys.Copy(path("a", "missing"), path("c", "other")))
+
+	record("remove", fsys.Remove(path("a", "b", "file")))
+	log = append(log, fmt.Sprintf("exists after remove: %v", fsys.Exists(path("a", "b", "file"))))
+	record("remove missing", fsys.Remove(path("a", "b", "file")))
+	record("remove empty dir", fsys.Remove(path("a", "b")))
+	record("chmod missing", fsys.Chmod(path("a", "b"), 0644))
+	read("read missing", path("a", "b", "file"))
+	stat("stat missing", path("a", "b"))
+	record("create dir", fsys.CreateDir(path("e")))
+	log = append(log, fmt.Sprintf("exists after create dir: %v", fsys.Exists(path("e"))))
+
+	return log
+}
+
+func TestMemFSMatchesOSFileSystem(t *testing.T) {
+	osRoot := t.TempDir()
+	want := fsScenario(NewOSFileSystem(), osRoot)
+
+	memFS := NewMemFS()
+	if err := memFS.MkdirAll(osRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	got := fsScenario(memFS, osRoot)
+
+	if !reflect.DeepEqual(got, want) {
+		for idx := range max(len(got), len(want)) {
+			var gotLine, wantLine string
+			if idx < len(got) {
+				gotLine = got[idx]
+			}
+			if idx < len(want) {
+				wantLine = want[idx]
+			}
+			if gotLine != wantLine {
+				t.Errorf("MemFS %q, OS %q", gotLine, wantLine)
+			}
+		}
+	}
+}
+
+func TestMemFSPaths(t *testing.T) {
+	memFS := NewMemFS()
+	if err := memFS.MkdirAll("/home/user/.config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := memFS.WriteFile("/home/user/.config/../.zshrc", []byte("export A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/home", "/home/user", "/home/user/.config", "/home/user/.zshrc"}
+	if got := memFS.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths() = %v, want %v", got, want)
+	}
+}
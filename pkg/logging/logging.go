@@ -0,0 +1,214 @@
+/*
+Package logging provides leveled, structured logging for Nix Foundry.
+Diagnostics are written to stderr in a human readable form and, when a log file
+is configured, to a rotating JSON log. User-facing status lines are not logged
+and continue to be printed to stdout by the commands themselves.
+*/
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+)
+
+/*
+Options configures the logger. Verbose enables debug output on the console and
+Quiet limits it to errors; Level selects the console level by name instead (see
+ParseLevel) and cannot be combined with either. JSON writes console records as
+JSON rather than human readable lines. File is the path of the JSON log file;
+file logging is disabled when it is empty.
+*/
+type Options struct {
+	Verbose bool
+	Quiet   bool
+	Level   string
+	JSON    bool
+	File    string
+}
+
+var logger atomic.Pointer[slog.Logger]
+
+/*
+console is where console records are written. Tests replace it.
+*/
+var console io.Writer = os.Stderr
+
+func init() {
+	logger.Store(slog.New(newConsoleHandler(console, slog.LevelInfo)))
+}
+
+/*
+Configure replaces the logger according to opts. The returned closer flushes and
+closes the log file and must be called before the program exits.
+*/
+func Configure(opts Options) (io.Closer, error) {
+	if opts.Verbose && opts.Quiet {
+		return nil, fmt.Errorf("verbose and quiet cannot be used together")
+	}
+
+	if opts.Level != "" && (opts.Verbose || opts.Quiet) {
+		return nil, fmt.Errorf("a log level cannot be combined with verbose or quiet")
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case opts.Verbose:
+		level = slog.LevelDebug
+	case opts.Quiet:
+		level = slog.LevelError
+	case opts.Level != "":
+		parsed, parseErr := ParseLevel(opts.Level)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		level = parsed
+	}
+
+	var consoleHandler slog.Handler = newConsoleHandler(console, level)
+	if opts.JSON {
+		consoleHandler = slog.NewJSONHandler(console, &slog.HandlerOptions{Level: level})
+	}
+	handlers := []slog.Handler{consoleHandler}
+
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		if mkdirErr := os.MkdirAll(filepath.Dir(opts.File), 0755); mkdirErr != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", mkdirErr)
+		}
+
+		file, openErr := newRotatingFile(opts.File, defaultMaxLogSize, defaultMaxLogBackups)
+		if openErr != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", openErr)
+		}
+
+		handlers = append(handlers, slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		closer = file
+	}
+
+	logger.Store(slog.New(&multiHandler{handlers: handlers}))
+	return closer, nil
+}
+
+/*
+ParseLevel returns the level with the given name: debug, info, warn (or warning)
+or error.
+*/
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", name)
+	}
+}
+
+/*
+DefaultLogFile returns the default location of the log file, logs/nix-foundry.log
+in the state directory.
+*/
+func DefaultLogFile() (string, error) {
+	stateDir, err := paths.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "logs", "nix-foundry.log"), nil
+}
+
+/*
+Logger returns the current logger.
+*/
+func Logger() *slog.Logger {
+	return logger.Load()
+}
+
+/*
+Debug logs a diagnostic message that is only shown with --verbose or
+--log-level debug.
+*/
+func Debug(msg string, args ...any) {
+	Logger().Debug(msg, args...)
+}
+
+/*
+Info logs an informational message.
+*/
+func Info(msg string, args ...any) {
+	Logger().Info(msg, args...)
+}
+
+/*
+Warn logs a problem that does not stop the current operation.
+*/
+func Warn(msg string, args ...any) {
+	Logger().Warn(msg, args...)
+}
+
+/*
+Error logs a failure.
+*/
+func Error(msg string, args ...any) {
+	Logger().Error(msg, args...)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+/*
+multiHandler sends each record to every handler that accepts its level.
+*/
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, handler := range h.handlers {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &multiHandler{handlers: handlers}
+}
+
+func (h *multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &multiHandler{handlers: handlers}
+}
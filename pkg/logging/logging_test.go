@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	var out bytes.Buffer
+	log := slog.New(newConsoleHandler(&out, slog.LevelInfo))
+
+	log.Debug("hidden")
+	log.Info("installing", "package", "ripgrep")
+	log.With("component", "gc").Warn("garbage collection failed", "error", "exit status 1")
+	log.Error("failed")
+
+	want := "installing package=ripgrep\n" +
+		"Warning: garbage collection failed component=gc error=\"exit status 1\"\n" +
+		"Error: failed\n"
+	if out.String() != want {
+		t.Errorf("console output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestConfigureWritesJSONLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "nix-foundry.log")
+
+	closer, err := Configure(Options{Quiet: true, File: path})
+	if err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	t.Cleanup(func() { _, _ = Configure(Options{}) })
+
+	Debug("checking installation", "path", "/nix/store")
+	if closeErr := closer.Close(); closeErr != nil {
+		t.Fatalf("Close() error = %v", closeErr)
+	}
+
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		t.Fatalf("failed to read log file: %v", readErr)
+	}
+
+	var record map[string]any
+	if jsonErr := json.Unmarshal(bytes.TrimSpace(content), &record); jsonErr != nil {
+		t.Fatalf("log file is not JSON: %v\n%s", jsonErr, content)
+	}
+	if record["level"] != "DEBUG" || record["msg"] != "checking installation" || record["path"] != "/nix/store" {
+		t.Errorf("unexpected log record: %v", record)
+	}
+}
+
+func TestConfigureRejectsVerboseAndQuiet(t *testing.T) {
+	if _, err := Configure(Options{Verbose: true, Quiet: true}); err == nil {
+		t.Error("Configure() expected an error for verbose and quiet together")
+	}
+}
+
+func TestConfigureLevel(t *testing.T) {
+	var out bytes.Buffer
+	console = &out
+	t.Cleanup(func() {
+		console = os.Stderr
+		_, _ = Configure(Options{})
+	})
+
+	if _, err := Configure(Options{}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	Debug("hidden by default")
+	if out.Len() != 0 {
+		t.Errorf("default level emitted %q, want debug records suppressed", out.String())
+	}
+
+	if _, err := Configure(Options{Level: "debug"}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	Debug("resolving packages", "count", 3)
+	if got := out.String(); got != "Debug: resolving packages count=3\n" {
+		t.Errorf("debug level emitted %q, want the debug record", got)
+	}
+
+	out.Reset()
+	if _, err := Configure(Options{Level: "warn", JSON: true}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	Info("hidden at warn")
+	Warn("disk almost full", "free", "1GiB")
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("console output is not a single JSON record: %v\n%s", err, out.String())
+	}
+	if record["level"] != "WARN" || record["msg"] != "disk almost full" || record["free"] != "1GiB" {
+		t.Errorf("unexpected JSON record: %v", record)
+	}
+
+	if _, err := Configure(Options{Level: "loud"}); err == nil {
+		t.Error("Configure() expected an error for an unknown level")
+	}
+	if _, err := Configure(Options{Level: "debug", Quiet: true}); err == nil {
+		t.Error("Configure() expected an error for a level together with quiet")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+
+	file, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, writeErr := file.Write([]byte(line)); writeErr != nil {
+			t.Fatalf("Write() error = %v", writeErr)
+		}
+	}
+	_ = file.Close()
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range want {
+		got, readErr := os.ReadFile(name)
+		if readErr != nil || string(got) != content {
+			t.Errorf("%s = %q (%v), want %q", filepath.Base(name), got, readErr, content)
+		}
+	}
+	if _, statErr := os.Stat(path + ".3"); !os.IsNotExist(statErr) {
+		t.Errorf("expected at most 2 backups, found %s.3", path)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 3 || !strings.HasPrefix(entries[0].Name(), "test.log") {
+		t.Errorf("unexpected files after rotation: %v", entries)
+	}
+}
+
+func TestDefaultLogFileInStateDir(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv(paths.ConfigDirEnv, "")
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	path, err := DefaultLogFile()
+	if err != nil {
+		t.Fatalf("DefaultLogFile() error = %v", err)
+	}
+	if want := filepath.Join(stateHome, "nix-foundry", "logs", "nix-foundry.log"); path != want {
+		t.Errorf("DefaultLogFile() = %q, want %q", path, want)
+	}
+}
@@ -0,0 +1,232 @@
+package nix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/retry"
+)
+
+const defaultDownloadTimeout = 10 * time.Minute
+
+/*
+DownloadProgress is called as a download makes progress. total is -1 when the
+server does not report the size.
+*/
+type DownloadProgress func(downloaded, total int64)
+
+/*
+Downloader fetches a URL into a local file.
+*/
+type Downloader interface {
+	Download(ctx context.Context, url, dest string, progress DownloadProgress) error
+}
+
+/*
+HTTPDownloader downloads files with net/http. Interrupted downloads are resumed
+with Range requests into a partial file, and failed attempts are retried with
+exponential backoff and jitter.
+*/
+type HTTPDownloader struct {
+	client *http.Client
+	policy retry.Policy
+}
+
+/*
+NewHTTPDownloader creates a downloader with the default retry policy.
+*/
+func NewHTTPDownloader() *HTTPDownloader {
+	return &HTTPDownloader{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 30 * time.Second,
+				TLSHandshakeTimeout:   15 * time.Second,
+			},
+		},
+		policy: retry.DefaultPolicy(),
+	}
+}
+
+/*
+SetMaxAttempts sets how many times a download is attempted before giving up.
+*/
+func (d *HTTPDownloader) SetMaxAttempts(attempts int) {
+	d.policy.MaxAttempts = attempts
+}
+
+/*
+Download fetches url into dest. Data is written to dest.part first and only
+renamed to dest once the received size matches the size reported by the server.
+*/
+func (d *HTTPDownloader) Download(ctx context.Context, url, dest string, progress DownloadProgress) error {
+	partPath := dest + ".part"
+
+	policy := d.policy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		fmt.Printf("Download interrupted (%v); retrying in %s (attempt %d/%d)...\n", err, delay.Round(time.Millisecond), attempt, policy.MaxAttempts)
+	}
+	downloadErr := policy.Do(ctx, func() error {
+		return d.attempt(ctx, url, partPath, progress)
+	})
+
+	var exhausted *retry.ExhaustedError
+	switch {
+	case downloadErr == nil:
+		if renameErr := os.Rename(partPath, dest); renameErr != nil {
+			return fmt.Errorf("failed to move download into place: %w", renameErr)
+		}
+		return nil
+	case errors.As(downloadErr, &exhausted):
+		return fmt.Errorf("download of %s failed after %d attempts: %w", url, exhausted.Attempts, exhausted.Err)
+	case ctx.Err() != nil:
+		return fmt.Errorf("download of %s timed out: %w", url, downloadErr)
+	default:
+		_ = os.Remove(partPath)
+		return downloadErr
+	}
+}
+
+/*
+attempt performs a single request, resuming from the size of the partial file.
+*/
+func (d *HTTPDownloader) attempt(ctx context.Context, url, partPath string, progress DownloadProgress) error {
+	var offset int64
+	if info, statErr := os.Stat(partPath); statErr == nil {
+		offset = info.Size()
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if reqErr != nil {
+		return retry.Permanent(fmt.Errorf("invalid download URL: %w", reqErr))
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, respErr := d.client.Do(req)
+	if respErr != nil {
+		return respErr
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	total := int64(-1)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+		total = resp.ContentLength
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		_ = os.Remove(partPath)
+		return fmt.Errorf("server rejected resume request")
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("server returned %s", resp.Status)
+	default:
+		return retry.Permanent(fmt.Errorf("server returned %s for %s", resp.Status, url))
+	}
+
+	file, openErr := os.OpenFile(partPath, flags, 0644)
+	if openErr != nil {
+		return retry.Permanent(fmt.Errorf("failed to open download file: %w", openErr))
+	}
+	defer func() { _ = file.Close() }()
+
+	written, copyErr := io.Copy(file, &progressReader{
+		reader:     resp.Body,
+		downloaded: offset,
+		total:      total,
+		progress:   progress,
+	})
+	if copyErr != nil {
+		return copyErr
+	}
+
+	if total >= 0 && offset+written != total {
+		return fmt.Errorf("incomplete download: received %d of %d bytes", offset+written, total)
+	}
+
+	return nil
+}
+
+/*
+contentRangeTotal parses the complete length from a Content-Range header such as
+"bytes 100-199/200". It returns -1 when the length is unknown.
+*/
+func contentRangeTotal(header string) int64 {
+	slash := strings.LastIndex(header, "/")
+	if slash < 0 {
+		return -1
+	}
+	total, parseErr := strconv.ParseInt(header[slash+1:], 10, 64)
+	if parseErr != nil {
+		return -1
+	}
+	return total
+}
+
+/*
+progressReader reports the number of bytes read to a DownloadProgress callback.
+*/
+type progressReader struct {
+	reader     io.Reader
+	downloaded int64
+	total      int64
+	progress   DownloadProgress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.downloaded += int64(n)
+	if r.progress != nil && n > 0 {
+		r.progress(r.downloaded, r.total)
+	}
+	return n, err
+}
+
+/*
+CurlDownloader downloads files by shelling out to curl. It is useful where proxies
+are only configured for curl.
+*/
+type CurlDownloader struct {
+	runner      cmdexec.Runner
+	maxAttempts int
+}
+
+/*
+NewCurlDownloader creates a downloader that runs curl through runner.
+*/
+func NewCurlDownloader(runner cmdexec.Runner) *CurlDownloader {
+	return &CurlDownloader{runner: runner, maxAttempts: retry.DefaultMaxAttempts}
+}
+
+/*
+SetMaxAttempts sets how many times a download is attempted before giving up.
+*/
+func (d *CurlDownloader) SetMaxAttempts(attempts int) {
+	d.maxAttempts = attempts
+}
+
+/*
+Download fetches url into dest with curl, which retries transient failures with
+its own backoff and fails right away on errors such as 404. Progress is rendered
+by curl itself.
+*/
+func (d *CurlDownloader) Download(_ context.Context, url, dest string, _ DownloadProgress) error {
+	retries := d.maxAttempts - 1
+	if retries < 0 {
+		retries = 0
+	}
+	return d.runner.Run("curl", "-fL", "--retry", strconv.Itoa(retries), "--progress-bar", url, "-o", dest)
+}
@@ -0,0 +1,163 @@
+package nix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDownloader() *HTTPDownloader {
+	downloader := NewHTTPDownloader()
+	downloader.policy.MaxAttempts = 4
+	downloader.policy.Jitter = 0
+	downloader.policy.Sleep = func(time.Duration) {}
+	return downloader
+}
+
+func TestHTTPDownloaderResumesInterruptedDownload(t *testing.T) {
+	content := strings.Repeat("nix install script\n", 200)
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		if first {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(content[:1000]))
+			return
+		}
+
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+			t.Errorf("expected a Range request on retry, got %q", r.Header.Get("Range"))
+			start = 0
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)-start))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(content[start:]))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "install.sh")
+	var lastDownloaded, lastTotal int64
+	err := newTestDownloader().Download(context.Background(), server.URL, dest, func(downloaded, total int64) {
+		lastDownloaded, lastTotal = downloaded, total
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(dest)
+	if string(got) != content {
+		t.Errorf("downloaded %d bytes, want %d matching bytes", len(got), len(content))
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=1000-" {
+		t.Errorf("requests ranges = %q, want a resume from byte 1000", ranges)
+	}
+	if lastDownloaded != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Errorf("last progress = %d/%d, want %d/%d", lastDownloaded, lastTotal, len(content), len(content))
+	}
+	if _, statErr := os.Stat(dest + ".part"); !os.IsNotExist(statErr) {
+		t.Errorf("expected partial file to be renamed")
+	}
+}
+
+func TestHTTPDownloaderRetriesServerErrors(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("#!/bin/sh\n"))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	downloader := newTestDownloader()
+	downloader.policy.Sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	dest := filepath.Join(t.TempDir(), "install.sh")
+	if err := downloader.Download(context.Background(), server.URL, dest, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if len(delays) != 2 || delays[1] != 2*delays[0] {
+		t.Errorf("backoff delays = %v, want two exponentially increasing delays", delays)
+	}
+}
+
+func TestHTTPDownloaderFailures(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		wantRequests int
+		wantErr      string
+	}{
+		{
+			name: "not found is not retried",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.NotFound(w, nil)
+			},
+			wantRequests: 1,
+			wantErr:      "404",
+		},
+		{
+			name: "retries are capped",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantRequests: 4,
+			wantErr:      "after 4 attempts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "install.sh")
+			err := newTestDownloader().Download(context.Background(), server.URL, dest, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Download() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", requests, tt.wantRequests)
+			}
+			if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+				t.Errorf("expected no file at %s after a failed download", dest)
+			}
+		})
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := map[string]int64{
+		"bytes 100-199/200": 200,
+		"bytes 0-99/*":      -1,
+		"":                  -1,
+	}
+	for header, want := range tests {
+		if got := contentRangeTotal(header); got != want {
+			t.Errorf("contentRangeTotal(%q) = %d, want %d", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package nix
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+)
+
+/*
+Flavor identifies which tool installed Nix on the machine.
+*/
+type Flavor int
+
+const (
+	// FlavorUnknown means no Nix installation could be identified.
+	FlavorUnknown Flavor = iota
+	// FlavorUpstream is an installation made with the official nixos.org install script.
+	FlavorUpstream
+	// FlavorDeterminateSystems is an installation made with the Determinate Systems installer.
+	FlavorDeterminateSystems
+	// FlavorNixDarwin is a macOS system managed by nix-darwin.
+	FlavorNixDarwin
+	// FlavorNixOS is a NixOS system, where Nix is part of the operating system.
+	FlavorNixOS
+)
+
+const (
+	determinateReceipt   = "/nix/receipt.json"
+	determinateInstaller = "/nix/nix-installer"
+	nixOSMarker          = "/etc/NIXOS"
+	darwinVersionFile    = "/run/current-system/darwin-version"
+	systemProfile        = "/nix/var/nix/profiles/system"
+)
+
+/*
+String returns a human readable name for the flavor.
+*/
+func (f Flavor) String() string {
+	switch f {
+	case FlavorUpstream:
+		return "the upstream Nix installer"
+	case FlavorDeterminateSystems:
+		return "the Determinate Systems installer"
+	case FlavorNixDarwin:
+		return "nix-darwin"
+	case FlavorNixOS:
+		return "NixOS"
+	default:
+		return "an unknown installer"
+	}
+}
+
+/*
+IsForeign reports whether the installation is owned by a tool other than the
+upstream installer, which nix-foundry must not modify or remove.
+*/
+func (f Flavor) IsForeign() bool {
+	return f == FlavorDeterminateSystems || f == FlavorNixDarwin || f == FlavorNixOS
+}
+
+/*
+DetectFlavor probes the filesystem for markers left by the different ways of
+installing Nix. nix-darwin and NixOS are checked first since they are usually
+layered on top of an installation made by one of the installers.
+*/
+func (i *Installer) DetectFlavor() Flavor {
+	switch {
+	case i.fs.Exists(nixOSMarker):
+		return FlavorNixOS
+	case i.fs.Exists(darwinVersionFile):
+		return FlavorNixDarwin
+	case i.fs.Exists(systemProfile) && runtime.GOOS == "darwin":
+		return FlavorNixDarwin
+	case i.fs.Exists(systemProfile):
+		return FlavorNixOS
+	case i.fs.Exists(determinateReceipt) || i.fs.Exists(determinateInstaller):
+		return FlavorDeterminateSystems
+	case i.fs.Exists("/nix/store") || i.fs.Exists("/nix/var/nix"):
+		return FlavorUpstream
+	default:
+		return FlavorUnknown
+	}
+}
+
+/*
+CheckForeignInstallation returns an error if Nix was installed by a tool other than
+the upstream installer, unless force is true.
+*/
+func (i *Installer) CheckForeignInstallation(force bool) error {
+	flavor := i.DetectFlavor()
+	if !flavor.IsForeign() {
+		return nil
+	}
+
+	if force {
+		logging.Warn("Nix was installed by another tool; continuing due to --force", "installer", flavor.String())
+		return nil
+	}
+
+	return fmt.Errorf("nix was installed by %s, which nix-foundry does not manage; use --force to proceed anyway", flavor)
+}
+
+/*
+uninstallForeign handles uninstalling a Nix installation owned by another tool.
+The Determinate Systems installer is delegated to when its binary is present;
+otherwise an error with manual instructions is returned.
+*/
+func (i *Installer) uninstallForeign(flavor Flavor, force bool) error {
+	switch flavor {
+	case FlavorDeterminateSystems:
+		if !i.fs.Exists(determinateInstaller) {
+			return fmt.Errorf("nix was installed by %s, but %s is missing; uninstall it with:\n  curl --proto '=https' --tlsv1.2 -sSf -L https://install.determinate.systems/nix | sh -s -- uninstall", flavor, determinateInstaller)
+		}
+
+		fmt.Printf("Nix was installed by %s; delegating to %s uninstall\n", flavor, determinateInstaller)
+		args := []string{"uninstall"}
+		if force {
+			args = append(args, "--no-confirm")
+		}
+		if err := i.runner.Run(determinateInstaller, args...); err != nil {
+			return fmt.Errorf("%s uninstall failed: %w", determinateInstaller, err)
+		}
+		return nil
+	case FlavorNixDarwin:
+		return fmt.Errorf("nix is managed by nix-darwin; uninstall nix-darwin first with:\n  sudo nix --extra-experimental-features 'nix-command flakes' run nix-darwin#darwin-uninstaller\nthen rerun this command to remove Nix itself")
+	case FlavorNixOS:
+		return fmt.Errorf("nix is part of NixOS and cannot be uninstalled by nix-foundry")
+	default:
+		return fmt.Errorf("nix was installed by %s and cannot be uninstalled by nix-foundry", flavor)
+	}
+}
@@ -0,0 +1,122 @@
+package nix
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectFlavor(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  Flavor
+	}{
+		{name: "no installation", want: FlavorUnknown},
+		{name: "upstream", files: []string{"/nix/store", "/nix/var/nix"}, want: FlavorUpstream},
+		{name: "determinate systems receipt", files: []string{"/nix/store", determinateReceipt}, want: FlavorDeterminateSystems},
+		{name: "determinate systems installer", files: []string{"/nix/store", determinateInstaller}, want: FlavorDeterminateSystems},
+		{name: "nix-darwin on determinate systems", files: []string{"/nix/store", determinateReceipt, darwinVersionFile}, want: FlavorNixDarwin},
+		{name: "nixos", files: []string{"/nix/store", nixOSMarker, systemProfile}, want: FlavorNixOS},
+	}
+
+	if runtime.GOOS == "darwin" {
+		tests = append(tests, struct {
+			name  string
+			files []string
+			want  Flavor
+		}{name: "darwin system profile", files: []string{"/nix/store", systemProfile}, want: FlavorNixDarwin})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installer, runner := newTestInstaller("")
+			for _, file := range tt.files {
+				writeFakeFile(runner.fs, file, nil, 0644)
+			}
+
+			if got := installer.DetectFlavor(); got != tt.want {
+				t.Errorf("DetectFlavor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallRefusesForeignInstallation(t *testing.T) {
+	installer, runner := newTestInstaller("#!/bin/sh\n")
+	writeFakeFile(runner.fs, "/nix/store", nil, 0644)
+	writeFakeFile(runner.fs, determinateReceipt, nil, 0644)
+
+	err := installer.Install(false, InstallOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("Install() error = %v, want refusal mentioning --force", err)
+	}
+	if runner.ran("curl") || runner.ran("sh") {
+		t.Errorf("expected nothing to run over a foreign installation, got commands: %v", runner.commands)
+	}
+
+	if err := installer.Install(false, InstallOptions{Force: true}); err != nil {
+		t.Fatalf("Install() with Force error = %v", err)
+	}
+	if !runner.ran("sh") {
+		t.Errorf("expected install script to run with Force, got commands: %v", runner.commands)
+	}
+}
+
+func TestUninstallForeignInstallation(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		force       bool
+		wantErr     string
+		wantCommand string
+	}{
+		{
+			name:        "delegates to determinate systems uninstaller",
+			files:       []string{determinateReceipt, determinateInstaller},
+			force:       true,
+			wantCommand: determinateInstaller + " uninstall --no-confirm",
+		},
+		{
+			name:    "determinate systems without installer binary",
+			files:   []string{determinateReceipt},
+			wantErr: "install.determinate.systems",
+		},
+		{
+			name:    "nix-darwin",
+			files:   []string{darwinVersionFile},
+			wantErr: "darwin-uninstaller",
+		},
+		{
+			name:    "nixos",
+			files:   []string{nixOSMarker},
+			wantErr: "part of NixOS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installer, runner := newTestInstaller("")
+			writeFakeFile(runner.fs, "/nix/store", nil, 0644)
+			for _, file := range tt.files {
+				writeFakeFile(runner.fs, file, nil, 0644)
+			}
+
+			err := installer.Uninstall(tt.force, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Uninstall() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Uninstall() error = %v", err)
+			}
+
+			if tt.wantCommand != "" && !runner.ran(tt.wantCommand) {
+				t.Errorf("expected %q to run, got commands: %v", tt.wantCommand, runner.commands)
+			}
+			if !runner.fs.Exists("/nix/store") {
+				t.Errorf("foreign installation files must not be removed by nix-foundry")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package nix
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+var gcSummaryPattern = regexp.MustCompile(`(\d+) store paths deleted, ([0-9.]+ [KMGT]?i?B) freed`)
+
+/*
+GCResult summarizes a garbage collection run.
+*/
+type GCResult struct {
+	Output       string
+	PathsDeleted int
+	Freed        string
+}
+
+/*
+CollectGarbage runs nix-collect-garbage through the multi-user daemon profile,
+falling back to the single-user profile if that fails. When deleteOld is true,
+old profile generations are deleted as well. The combined output is parsed for
+the number of deleted store paths and the amount of space freed.
+*/
+func CollectGarbage(runner cmdexec.Runner, fs filesystem.FileSystem, deleteOld bool) (*GCResult, error) {
+	gcCommand := "nix-collect-garbage"
+	if deleteOld {
+		gcCommand += " -d"
+	}
+	gcCommand += " 2>&1"
+
+	daemonProfile := "/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh"
+	output, gcErr := runner.Output("bash", "-c", fmt.Sprintf(". %s && %s", daemonProfile, gcCommand))
+	if gcErr != nil {
+		homeDir, homeDirErr := os.UserHomeDir()
+		if homeDirErr != nil {
+			return nil, fmt.Errorf("multi-user garbage collection failed: %w", gcErr)
+		}
+		profilePath := filepath.Join(homeDir, ".nix-profile/etc/profile.d/nix.sh")
+		if !fs.Exists(profilePath) {
+			return nil, fmt.Errorf("multi-user garbage collection failed: %w", gcErr)
+		}
+
+		var singleGcErr error
+		output, singleGcErr = runner.Output("bash", "-c", fmt.Sprintf(". %s && %s", profilePath, gcCommand))
+		if singleGcErr != nil {
+			return nil, fmt.Errorf("garbage collection failed: %w", singleGcErr)
+		}
+	}
+
+	return ParseGCOutput(string(output)), nil
+}
+
+/*
+ParseGCOutput extracts the summary line printed by nix-collect-garbage, e.g.
+"42 store paths deleted, 512.30 MiB freed".
+*/
+func ParseGCOutput(output string) *GCResult {
+	result := &GCResult{Output: output}
+
+	match := gcSummaryPattern.FindStringSubmatch(output)
+	if match == nil {
+		return result
+	}
+	result.PathsDeleted, _ = strconv.Atoi(match[1])
+	result.Freed = match[2]
+
+	return result
+}
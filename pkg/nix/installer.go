@@ -6,30 +6,100 @@ installations in both single-user and multi-user modes.
 package nix
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/retry"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
 )
 
+const (
+	// DefaultInstallScriptURL is the upstream location of the Nix install script.
+	DefaultInstallScriptURL = "https://nixos.org/nix/install"
+
+	// InstallScriptEnv names the environment variable pointing at a pre-downloaded
+	// install script or release tarball for offline installations.
+	InstallScriptEnv = "NIX_FOUNDRY_INSTALL_SCRIPT"
+
+	// nixReleaseKeyFingerprint is the fingerprint of the key used to sign Nix releases.
+	nixReleaseKeyFingerprint = "B541D55301270E0BCF15CA5D8170B4726D7198DE"
+
+	// gpgKeyServer is the keyserver used to fetch the Nix release signing key.
+	gpgKeyServer = "hkps://keyserver.ubuntu.com"
+)
+
+/*
+ScriptVerification describes how the Nix install script is verified before it is executed.
+SHA256 is the expected hex-encoded checksum of the script; when empty, checksum
+verification is skipped. VerifyGPG checks the script against the detached signature
+published next to it (ScriptURL + ".asc") using the Nix release signing key.
+*/
+type ScriptVerification struct {
+	ScriptURL string
+	SHA256    string
+	VerifyGPG bool
+}
+
 /*
 Installer handles Nix package manager installation operations.
 It provides functionality for installing, uninstalling, and verifying
 Nix installations using a provided filesystem abstraction.
 */
 type Installer struct {
-	fs filesystem.FileSystem
+	fs             filesystem.FileSystem
+	runner         cmdexec.Runner
+	verification   ScriptVerification
+	nonInteractive bool
+	downloader     Downloader
+	policy         retry.Policy
 }
 
 /*
 NewInstaller creates a new Nix installer with the provided filesystem implementation.
 */
 func NewInstaller(fs filesystem.FileSystem) *Installer {
-	return &Installer{fs: fs}
+	return &Installer{
+		fs:         fs,
+		runner:     cmdexec.NewOSRunner(),
+		downloader: NewHTTPDownloader(),
+		policy:     retry.DefaultPolicy(),
+	}
+}
+
+/*
+SetVerification configures how the install script is verified before execution.
+*/
+func (i *Installer) SetVerification(verification ScriptVerification) {
+	i.verification = verification
+}
+
+/*
+SetMaxAttempts sets how many times network operations, such as downloading the
+install script and waiting for the Nix daemon, are attempted before giving up.
+*/
+func (i *Installer) SetMaxAttempts(attempts int) {
+	i.policy.MaxAttempts = attempts
+}
+
+/*
+SetNonInteractive makes the install script accept its prompts instead of asking,
+for unattended installations.
+*/
+func (i *Installer) SetNonInteractive(nonInteractive bool) {
+	i.nonInteractive = nonInteractive
 }
 
 /*
@@ -40,21 +110,28 @@ IsInstalled checks if Nix is installed by verifying:
 Returns true if any of these checks succeed.
 */
 func (i *Installer) IsInstalled() bool {
-	fmt.Println("Checking Nix installation status...")
+	logging.Debug("checking Nix installation status")
+
+	if supportErr := platform.CheckNixSupported(); supportErr != nil {
+		fmt.Printf("Note: %v\n", supportErr)
+		return false
+	}
 
 	nixPath, lookPathErr := exec.LookPath("nix")
 	if lookPathErr == nil {
-		fmt.Printf("Found nix binary at: %s\n", nixPath)
-		cmd := exec.Command("nix", "--version")
-		if out, versionErr := cmd.CombinedOutput(); versionErr == nil {
-			fmt.Printf("Nix version: %s\n", strings.TrimSpace(string(out)))
+		logging.Debug("found nix binary", "path", nixPath)
+		if out, versionErr := i.runner.Output("nix", "--version"); versionErr == nil {
+			logging.Debug("nix version", "version", strings.TrimSpace(string(out)))
 			return true
 		}
-		fmt.Printf("Nix binary found but not working: %v\n", lookPathErr)
+		logging.Debug("nix binary found but not working", "error", lookPathErr)
 	}
 
 	if i.fs.Exists("/nix/store") {
-		fmt.Println("Found Nix store directory")
+		logging.Debug("found Nix store directory")
+		if flavor := i.DetectFlavor(); flavor.IsForeign() {
+			fmt.Printf("Nix was installed by %s\n", flavor)
+		}
 		return true
 	}
 
@@ -62,12 +139,12 @@ func (i *Installer) IsInstalled() bool {
 	if homeDirErr == nil {
 		profile := filepath.Join(homeDir, ".nix-profile")
 		if i.fs.Exists(profile) {
-			fmt.Println("Found Nix profile")
+			logging.Debug("found Nix profile")
 			return true
 		}
 	}
 
-	fmt.Println("No working Nix installation found")
+	logging.Debug("no working Nix installation found")
 	return false
 }
 
@@ -79,24 +156,24 @@ IsMultiUser checks if Nix is installed in multi-user mode by checking for:
 Returns true if any of these checks succeed.
 */
 func (i *Installer) IsMultiUser() (bool, error) {
-	fmt.Println("Checking Nix installation mode...")
+	logging.Debug("checking Nix installation mode")
 
 	if i.fs.Exists("/etc/systemd/system/nix-daemon.service") {
-		fmt.Println("Found Nix daemon systemd service")
+		logging.Debug("found Nix daemon systemd service")
 		return true, nil
 	}
 
 	if i.fs.Exists("/Library/LaunchDaemons/org.nixos.nix-daemon.plist") {
-		fmt.Println("Found Nix daemon launchd service")
+		logging.Debug("found Nix daemon launchd service")
 		return true, nil
 	}
 
 	if i.fs.Exists("/nix/var/nix/daemon") {
-		fmt.Println("Found Nix daemon service")
+		logging.Debug("found Nix daemon service")
 		return true, nil
 	}
 
-	fmt.Println("No multi-user installation detected")
+	logging.Debug("no multi-user installation detected")
 	return false, nil
 }
 
@@ -114,11 +191,8 @@ func (i *Installer) cleanupBackupFiles() error {
 	var errs []error
 	for _, file := range backupFiles {
 		if i.fs.Exists(file) {
-			fmt.Printf("Removing old backup file: %s\n", file)
-			removeCmd := exec.Command("sudo", "rm", "-fv", file)
-			removeCmd.Stdout = os.Stdout
-			removeCmd.Stderr = os.Stderr
-			if removeErr := removeCmd.Run(); removeErr != nil {
+			logging.Debug("removing old backup file", "path", file)
+			if removeErr := i.runner.Run("sudo", "rm", "-fv", file); removeErr != nil {
 				errs = append(errs, fmt.Errorf("failed to remove backup file %s: %w", file, removeErr))
 			}
 		}
@@ -130,17 +204,57 @@ func (i *Installer) cleanupBackupFiles() error {
 	return nil
 }
 
+/*
+InstallOptions controls where the Nix installer comes from.
+ScriptPath points at a pre-downloaded install script or Nix release tarball, and
+SkipDownload forbids downloading the install script, for air-gapped machines.
+UseCurl downloads the script with curl instead of the built-in HTTP client, and
+Progress, if set, is called as the download makes progress. Force allows
+installing over a Nix installation made by another tool.
+*/
+type InstallOptions struct {
+	ScriptPath   string
+	SkipDownload bool
+	UseCurl      bool
+	Progress     DownloadProgress
+	Force        bool
+}
+
 /*
 Install installs Nix in either single-user or multi-user mode.
 It performs the following steps:
 1. Cleans up any old backup files
-2. Downloads the Nix installation script
-3. Executes the installation script with appropriate flags
-4. Verifies the installation was successful
+2. Downloads the Nix installation script, or uses the local script or tarball from opts
+3. Verifies the script against the configured checksum and signature
+4. Executes the installation script with appropriate flags
+5. Verifies the installation was successful
 */
-func (i *Installer) Install(multiUser bool) error {
-	fmt.Printf("Installing Nix in %s mode...\n",
-		map[bool]string{true: "multi-user", false: "single-user"}[multiUser])
+func (i *Installer) Install(multiUser bool, opts InstallOptions) error {
+	if supportErr := platform.CheckNixSupported(); supportErr != nil {
+		return supportErr
+	}
+
+	if foreignErr := i.CheckForeignInstallation(opts.Force); foreignErr != nil {
+		return foreignErr
+	}
+
+	if opts.SkipDownload && opts.ScriptPath == "" {
+		return fmt.Errorf("offline installation requires a local install script or release tarball; pass --script <path> or set %s", InstallScriptEnv)
+	}
+
+	if opts.ScriptPath != "" {
+		fmt.Printf("Installing Nix in %s mode from %s...\n",
+			map[bool]string{true: "multi-user", false: "single-user"}[multiUser], opts.ScriptPath)
+	} else {
+		fmt.Printf("Installing Nix in %s mode...\n",
+			map[bool]string{true: "multi-user", false: "single-user"}[multiUser])
+	}
+
+	if opts.ScriptPath != "" {
+		if checkErr := i.checkLocalInstaller(opts.ScriptPath); checkErr != nil {
+			return checkErr
+		}
+	}
 
 	if cleanupErr := i.cleanupBackupFiles(); cleanupErr != nil {
 		return cleanupErr
@@ -152,39 +266,254 @@ func (i *Installer) Install(multiUser bool) error {
 	}
 	defer func() { _ = os.RemoveAll(tmpDir) }()
 
+	if opts.ScriptPath != "" {
+		if verifyErr := i.verifyScript(opts.ScriptPath); verifyErr != nil {
+			return verifyErr
+		}
+
+		if !isInstallerTarball(opts.ScriptPath) {
+			return i.runInstallScript(opts.ScriptPath, multiUser)
+		}
+
+		fmt.Println("Extracting Nix release tarball...")
+		if err := i.runner.Run("tar", "-xf", opts.ScriptPath, "-C", tmpDir, "--strip-components=1"); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", opts.ScriptPath, err)
+		}
+		scriptPath := filepath.Join(tmpDir, "install")
+		if !i.fs.Exists(scriptPath) {
+			return fmt.Errorf("%s does not contain a Nix install script", opts.ScriptPath)
+		}
+		return i.runInstallScript(scriptPath, multiUser)
+	}
+
+	scriptURL := i.scriptURL()
 	scriptPath := filepath.Join(tmpDir, "install.sh")
+	downloader := i.downloader
+	if opts.UseCurl || downloader == nil {
+		downloader = NewCurlDownloader(i.runner)
+	}
+	if limited, ok := downloader.(interface{ SetMaxAttempts(int) }); ok && i.policy.MaxAttempts > 0 {
+		limited.SetMaxAttempts(i.policy.MaxAttempts)
+	}
+
+	ctx, cancel := context.WithTimeout(cmdexec.Context(), defaultDownloadTimeout)
+	defer cancel()
+
 	fmt.Println("Downloading Nix...")
-	cmd := exec.Command("curl", "-L", "--progress-bar", "https://nixos.org/nix/install", "-o", scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to download Nix: %w", err)
+	if err := downloader.Download(ctx, scriptURL, scriptPath, opts.Progress); err != nil {
+		return fmt.Errorf("failed to download Nix from %s: %w (on offline machines, pass --offline --script <path> or set %s)", scriptURL, err, InstallScriptEnv)
+	}
+
+	if verifyErr := i.verifyScript(scriptPath); verifyErr != nil {
+		return verifyErr
 	}
 
-	if chmodErr := os.Chmod(scriptPath, 0755); chmodErr != nil {
+	if chmodErr := i.fs.Chmod(scriptPath, 0755); chmodErr != nil {
 		return fmt.Errorf("failed to make script executable: %w", chmodErr)
 	}
 
+	return i.runInstallScript(scriptPath, multiUser)
+}
+
+/*
+InstallFromScript installs Nix from a pre-downloaded install script or release
+tarball, skipping the download step entirely. This supports air-gapped machines
+where nixos.org is not reachable.
+*/
+func (i *Installer) InstallFromScript(path string, multiUser bool) error {
+	return i.Install(multiUser, InstallOptions{ScriptPath: path, SkipDownload: true})
+}
+
+/*
+checkLocalInstaller ensures a pre-downloaded install script or release tarball
+exists and, for scripts, is executable.
+*/
+func (i *Installer) checkLocalInstaller(path string) error {
+	info, statErr := i.fs.Stat(path)
+	if statErr != nil {
+		return fmt.Errorf("failed to access install script: %w", statErr)
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("install script %s is a directory", path)
+	}
+
+	if !isInstallerTarball(path) && info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("install script %s is not executable (run: chmod +x %s)", path, path)
+	}
+
+	return nil
+}
+
+/*
+isInstallerTarball reports whether path looks like a Nix release tarball rather
+than an install script.
+*/
+func isInstallerTarball(path string) bool {
+	for _, suffix := range []string{".tar", ".tar.xz", ".tar.gz", ".tgz", ".tar.zst"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+runInstallScript executes a Nix install script and verifies the result, polling
+with backoff while the new installation settles.
+*/
+func (i *Installer) runInstallScript(scriptPath string, multiUser bool) error {
 	fmt.Println("Installing Nix...")
-	var installCmd *exec.Cmd
+	args := []string{scriptPath}
 	if multiUser {
-		installCmd = exec.Command("sh", scriptPath, "--daemon")
-	} else {
-		installCmd = exec.Command("sh", scriptPath)
+		args = append(args, "--daemon")
+	}
+	if i.nonInteractive {
+		args = append(args, "--yes")
 	}
 
-	installCmd.Stdout = os.Stdout
-	installCmd.Stderr = os.Stderr
-	if installErr := installCmd.Run(); installErr != nil {
+	if installErr := i.runner.Run("sh", args...); installErr != nil {
 		return fmt.Errorf("failed to install Nix: %w", installErr)
 	}
 
-	fmt.Println("Waiting for installation to complete...")
-	time.Sleep(2 * time.Second)
-
 	fmt.Println("Verifying installation...")
-	if !i.IsInstalled() {
-		return fmt.Errorf("installation verification failed")
+	policy := i.policy
+	policy.OnRetry = func(attempt int, delay time.Duration, _ error) {
+		logging.Debug("Nix installation not ready, retrying", "attempt", attempt, "maxAttempts", policy.MaxAttempts, "delay", delay)
+	}
+	verifyErr := policy.Do(cmdexec.Context(), func() error {
+		if !i.IsInstalled() {
+			return errors.New("nix is not installed")
+		}
+		return nil
+	})
+	if verifyErr != nil {
+		return fmt.Errorf("installation verification failed: %w", verifyErr)
+	}
+
+	return nil
+}
+
+/*
+WaitForDaemon waits with backoff until Nix commands can reach the Nix daemon
+after an installation.
+*/
+func (i *Installer) WaitForDaemon() error {
+	fmt.Println("Waiting for Nix daemon to be ready...")
+	runner := cmdexec.WithOutput(i.runner, io.Discard)
+	policy := i.policy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		logging.Debug("nix daemon not ready, retrying", "attempt", attempt, "maxAttempts", policy.MaxAttempts, "delay", delay, "error", err)
+	}
+
+	if err := policy.Do(cmdexec.Context(), func() error {
+		return runner.Run("bash", "-c", "/nix/var/nix/profiles/default/bin/nix-env --version")
+	}); err != nil {
+		return fmt.Errorf("nix daemon not ready: %w", err)
+	}
+	return nil
+}
+
+/*
+InitializeChannels adds the nixpkgs-unstable channel and updates it, retrying the
+update with backoff since it downloads nixpkgs. Failures are reported as
+warnings, since packages can still be installed from flakes.
+*/
+func (i *Installer) InitializeChannels() {
+	fmt.Println("Initializing Nix channels...")
+	const daemonProfile = ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "
+	if err := i.runner.Run("bash", "-c", daemonProfile+"nix-channel --add https://nixos.org/channels/nixpkgs-unstable"); err != nil {
+		logging.Warn("failed to add the nixpkgs channel", "error", err)
+		return
+	}
+
+	policy := i.policy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		logging.Debug("nix-channel --update failed, retrying", "attempt", attempt, "maxAttempts", policy.MaxAttempts, "delay", delay, "error", err)
+	}
+	if err := policy.Do(cmdexec.Context(), func() error {
+		return i.runner.Run("bash", "-c", daemonProfile+"nix-channel --update")
+	}); err != nil {
+		logging.Warn("failed to initialize Nix channels", "error", err)
+	}
+}
+
+/*
+scriptURL returns the URL the install script is downloaded from.
+*/
+func (i *Installer) scriptURL() string {
+	if i.verification.ScriptURL != "" {
+		return i.verification.ScriptURL
+	}
+	return DefaultInstallScriptURL
+}
+
+/*
+verifyScript checks the install script against the configured SHA-256 checksum
+and, when requested, the published GPG signature. It refuses to continue if
+either check fails.
+*/
+func (i *Installer) verifyScript(scriptPath string) error {
+	if i.verification.SHA256 == "" && !i.verification.VerifyGPG {
+		logging.Warn("no checksum provided, skipping install script verification")
+		return nil
+	}
+
+	if i.verification.SHA256 != "" {
+		content, readErr := i.fs.ReadFile(scriptPath)
+		if readErr != nil {
+			return fmt.Errorf("failed to read install script: %w", readErr)
+		}
+
+		sum := sha256.Sum256(content)
+		actual := hex.EncodeToString(sum[:])
+		expected := strings.ToLower(strings.TrimSpace(i.verification.SHA256))
+		if actual != expected {
+			return fmt.Errorf("install script checksum mismatch (expected %s, got %s); refusing to execute it", expected, actual)
+		}
+		fmt.Println("✨ Install script checksum verified")
+	}
+
+	if i.verification.VerifyGPG {
+		if gpgErr := i.verifySignature(scriptPath); gpgErr != nil {
+			return gpgErr
+		}
+		fmt.Println("✨ Install script signature verified")
+	}
+
+	return nil
+}
+
+/*
+verifySignature verifies the install script with gpg using the Nix release signing key.
+A detached signature next to the script (<script>.asc) is used when present, otherwise
+it is downloaded from the script URL. The signing key is only fetched from the
+keyserver when it is not already in the local keyring.
+*/
+func (i *Installer) verifySignature(scriptPath string) error {
+	if _, lookPathErr := exec.LookPath("gpg"); lookPathErr != nil {
+		return fmt.Errorf("signature verification requested but gpg is not installed")
+	}
+
+	signaturePath := scriptPath + ".asc"
+	if !i.fs.Exists(signaturePath) {
+		downloader := NewCurlDownloader(i.runner)
+		if i.policy.MaxAttempts > 0 {
+			downloader.SetMaxAttempts(i.policy.MaxAttempts)
+		}
+		if err := downloader.Download(cmdexec.Context(), i.scriptURL()+".asc", signaturePath, nil); err != nil {
+			return fmt.Errorf("failed to download install script signature: %w", err)
+		}
+	}
+
+	if _, listErr := i.runner.Output("gpg", "--batch", "--list-keys", nixReleaseKeyFingerprint); listErr != nil {
+		if err := i.runner.Run("gpg", "--batch", "--keyserver", gpgKeyServer, "--recv-keys", nixReleaseKeyFingerprint); err != nil {
+			return fmt.Errorf("failed to fetch Nix release signing key: %w", err)
+		}
+	}
+
+	if err := i.runner.Run("gpg", "--batch", "--verify", signaturePath, scriptPath); err != nil {
+		return fmt.Errorf("install script signature verification failed; refusing to execute it: %w", err)
 	}
 
 	return nil
@@ -196,78 +525,97 @@ performGarbageCollection runs Nix garbage collection to clean up unreferenced st
 func (i *Installer) performGarbageCollection() {
 	fmt.Println("Running Nix garbage collection...")
 
-	gcCmd := exec.Command("bash", "-c", ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && nix-collect-garbage -d")
-	gcCmd.Stdout = os.Stdout
-	gcCmd.Stderr = os.Stderr
-	if gcErr := gcCmd.Run(); gcErr != nil {
-		fmt.Printf("Warning: Multi-user garbage collection failed: %v\n", gcErr)
-
-		if homeDir, homeDirErr := os.UserHomeDir(); homeDirErr == nil {
-			profilePath := filepath.Join(homeDir, ".nix-profile/etc/profile.d/nix.sh")
-			if i.fs.Exists(profilePath) {
-				singleGcCmd := exec.Command("bash", "-c", fmt.Sprintf(". %s && nix-collect-garbage -d", profilePath))
-				singleGcCmd.Stdout = os.Stdout
-				singleGcCmd.Stderr = os.Stderr
-				if singleGcErr := singleGcCmd.Run(); singleGcErr != nil {
-					fmt.Printf("Warning: Single-user garbage collection failed: %v\n", singleGcErr)
-				}
-			}
-		}
+	result, gcErr := CollectGarbage(i.runner, i.fs, true)
+	if gcErr != nil {
+		logging.Warn("garbage collection failed", "error", gcErr)
+		return
 	}
+
+	fmt.Print(result.Output)
 }
 
 /*
 uninstallPackages uninstalls all packages from both multi-user and single-user profiles.
+Packages that could not be removed are reported once all profiles have been processed.
 */
 func (i *Installer) uninstallPackages() {
 	fmt.Println("Uninstalling all Nix packages...")
 
-	fmt.Println("Checking multi-user profile...")
-	listCmd := exec.Command("bash", "-c", ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && nix-env -q")
-	listCmd.Stdout = os.Stdout
-	listCmd.Stderr = os.Stderr
-	output, listErr := listCmd.Output()
+	var failed []string
+
+	logging.Debug("checking multi-user profile")
+	daemonProfile := "/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh"
+	output, listErr := i.runner.Output("bash", "-c", fmt.Sprintf(". %s && nix-env -q", daemonProfile))
 	if listErr == nil {
-		i.uninstallPackagesFromOutput(string(output), "/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh")
+		failed = append(failed, i.uninstallPackagesFromOutput(string(output), daemonProfile)...)
 	} else {
-		fmt.Printf("Note: No packages found in multi-user profile or profile not accessible\n")
+		logging.Debug("no packages found in multi-user profile or profile not accessible")
 	}
 
 	homeDir, homeDirErr := os.UserHomeDir()
 	if homeDirErr == nil {
-		fmt.Println("Checking single-user profile...")
+		logging.Debug("checking single-user profile")
 		profilePath := filepath.Join(homeDir, ".nix-profile/etc/profile.d/nix.sh")
-		listCmd = exec.Command("bash", "-c", fmt.Sprintf(". %s && nix-env -q", profilePath))
-		listCmd.Stdout = os.Stdout
-		listCmd.Stderr = os.Stderr
-		output, listErr = listCmd.Output()
+		output, listErr = i.runner.Output("bash", "-c", fmt.Sprintf(". %s && nix-env -q", profilePath))
 		if listErr == nil {
-			i.uninstallPackagesFromOutput(string(output), profilePath)
+			failed = append(failed, i.uninstallPackagesFromOutput(string(output), profilePath)...)
 		} else {
-			fmt.Printf("Note: No packages found in single-user profile or profile not accessible\n")
+			logging.Debug("no packages found in single-user profile or profile not accessible")
 		}
 	}
 
+	if len(failed) > 0 {
+		logging.Warn("failed to uninstall packages", "packages", strings.Join(failed, ", "))
+	}
+
 	i.performGarbageCollection()
 }
 
+/*
+uninstallBatchSize caps the number of packages passed to a single nix-env -e
+invocation to stay well below argument length limits.
+*/
+const uninstallBatchSize = 50
+
 /*
 uninstallPackagesFromOutput uninstalls packages from a specific profile.
+Packages are removed in batches with a single nix-env invocation per batch; when a
+batch fails, its packages are retried one at a time so that one bad package does not
+block the rest. It returns the packages that could not be removed.
 */
-func (i *Installer) uninstallPackagesFromOutput(output, profilePath string) {
-	packages := strings.Split(strings.TrimSpace(output), "\n")
-	for _, pkg := range packages {
-		if pkg == "" {
+func (i *Installer) uninstallPackagesFromOutput(output, profilePath string) []string {
+	var packages []string
+	for _, pkg := range strings.Split(strings.TrimSpace(output), "\n") {
+		if pkg = strings.TrimSpace(pkg); pkg != "" {
+			packages = append(packages, pkg)
+		}
+	}
+
+	var failed []string
+	for start := 0; start < len(packages); start += uninstallBatchSize {
+		end := min(start+uninstallBatchSize, len(packages))
+		batch := packages[start:end]
+
+		fmt.Printf("Uninstalling packages: %s\n", strings.Join(batch, " "))
+		batchErr := i.runner.Run("bash", "-c", fmt.Sprintf(". %s && nix-env -e %s", profilePath, strings.Join(batch, " ")))
+		if batchErr == nil {
 			continue
 		}
-		fmt.Printf("Uninstalling package: %s\n", pkg)
-		uninstallCmd := exec.Command("bash", "-c", fmt.Sprintf(". %s && nix-env -e %s", profilePath, pkg))
-		uninstallCmd.Stdout = os.Stdout
-		uninstallCmd.Stderr = os.Stderr
-		if uninstallErr := uninstallCmd.Run(); uninstallErr != nil {
-			fmt.Printf("Warning: Failed to uninstall package %s: %v\n", pkg, uninstallErr)
+
+		if len(batch) == 1 {
+			failed = append(failed, batch[0])
+			continue
+		}
+
+		logging.Debug("batch uninstall failed, retrying packages individually")
+		for _, pkg := range batch {
+			if uninstallErr := i.runner.Run("bash", "-c", fmt.Sprintf(". %s && nix-env -e %s", profilePath, pkg)); uninstallErr != nil {
+				failed = append(failed, pkg)
+			}
 		}
 	}
+
+	return failed
 }
 
 /*
@@ -282,77 +630,76 @@ func (i *Installer) stopDaemonServices() {
 		if i.fs.Exists("/etc/systemd/system/nix-daemon.service") {
 			fmt.Println("Stopping and disabling systemd service...")
 
-			stopCmd := exec.Command("sudo", "systemctl", "stop", "nix-daemon.service")
-			stopCmd.Stdout = os.Stdout
-			stopCmd.Stderr = os.Stderr
-			if stopErr := stopCmd.Run(); stopErr != nil {
-				fmt.Printf("Warning: Failed to stop systemd service: %v\n", stopErr)
+			if stopErr := i.runner.Run("sudo", "systemctl", "stop", "nix-daemon.service"); stopErr != nil {
+				logging.Warn("failed to stop systemd service", "error", stopErr)
 			}
 
-			disableCmd := exec.Command("sudo", "systemctl", "disable", "nix-daemon.service")
-			disableCmd.Stdout = os.Stdout
-			disableCmd.Stderr = os.Stderr
-			if disableErr := disableCmd.Run(); disableErr != nil {
-				fmt.Printf("Warning: Failed to disable systemd service: %v\n", disableErr)
+			if disableErr := i.runner.Run("sudo", "systemctl", "disable", "nix-daemon.service"); disableErr != nil {
+				logging.Warn("failed to disable systemd service", "error", disableErr)
 			}
 
 			if i.fs.Exists("/etc/systemd/system/nix-daemon.socket") {
-				socketCmd := exec.Command("sudo", "systemctl", "stop", "nix-daemon.socket")
-				socketCmd.Stdout = os.Stdout
-				socketCmd.Stderr = os.Stderr
-				if socketErr := socketCmd.Run(); socketErr != nil {
-					fmt.Printf("Warning: Failed to stop socket: %v\n", socketErr)
+				if socketErr := i.runner.Run("sudo", "systemctl", "stop", "nix-daemon.socket"); socketErr != nil {
+					logging.Warn("failed to stop socket", "error", socketErr)
 				}
 
-				disableSocketCmd := exec.Command("sudo", "systemctl", "disable", "nix-daemon.socket")
-				disableSocketCmd.Stdout = os.Stdout
-				disableSocketCmd.Stderr = os.Stderr
-				if disableSocketErr := disableSocketCmd.Run(); disableSocketErr != nil {
-					fmt.Printf("Warning: Failed to disable socket: %v\n", disableSocketErr)
+				if disableSocketErr := i.runner.Run("sudo", "systemctl", "disable", "nix-daemon.socket"); disableSocketErr != nil {
+					logging.Warn("failed to disable socket", "error", disableSocketErr)
 				}
 			}
 
-			reloadCmd := exec.Command("sudo", "systemctl", "daemon-reload")
-			reloadCmd.Stdout = os.Stdout
-			reloadCmd.Stderr = os.Stderr
-			if reloadErr := reloadCmd.Run(); reloadErr != nil {
-				fmt.Printf("Warning: Failed to reload systemd: %v\n", reloadErr)
+			if reloadErr := i.runner.Run("sudo", "systemctl", "daemon-reload"); reloadErr != nil {
+				logging.Warn("failed to reload systemd", "error", reloadErr)
 			}
 		}
 
 		if i.fs.Exists("/Library/LaunchDaemons/org.nixos.nix-daemon.plist") {
 			fmt.Println("Unloading launchd service...")
-			stopCmd := exec.Command("sudo", "launchctl", "unload", "/Library/LaunchDaemons/org.nixos.nix-daemon.plist")
-			stopCmd.Stdout = os.Stdout
-			stopCmd.Stderr = os.Stderr
-			if stopErr := stopCmd.Run(); stopErr != nil {
-				fmt.Printf("Warning: Failed to unload launchd service: %v\n", stopErr)
+			if stopErr := i.runner.Run("sudo", "launchctl", "unload", "/Library/LaunchDaemons/org.nixos.nix-daemon.plist"); stopErr != nil {
+				logging.Warn("failed to unload launchd service", "error", stopErr)
 			}
 		}
 
 		if i.fs.Exists("/Library/LaunchDaemons/org.nixos.darwin-store.plist") {
 			fmt.Println("Unloading darwin-store service...")
-			stopCmd := exec.Command("sudo", "launchctl", "unload", "/Library/LaunchDaemons/org.nixos.darwin-store.plist")
-			stopCmd.Stdout = os.Stdout
-			stopCmd.Stderr = os.Stderr
-			if stopErr := stopCmd.Run(); stopErr != nil {
-				fmt.Printf("Warning: Failed to unload darwin-store service: %v\n", stopErr)
+			if stopErr := i.runner.Run("sudo", "launchctl", "unload", "/Library/LaunchDaemons/org.nixos.darwin-store.plist"); stopErr != nil {
+				logging.Warn("failed to unload darwin-store service", "error", stopErr)
 			}
 		}
 	}
 
 	fmt.Println("Killing any remaining Nix processes...")
-	killCmd := exec.Command("sudo", "pkill", "-f", "nix-daemon")
-	_ = killCmd.Run()
+	_, _ = i.runner.Output("sudo", "pkill", "-f", "nix-daemon")
 }
 
 /*
-cleanupShellFiles removes Nix-related lines from shell configuration files.
-This includes both system-wide and user-specific shell configuration files.
+writeFileAsRoot replaces the content of a file that is only writable by root. The
+content is staged in a temporary file and copied into place with sudo, which keeps
+the file's existing ownership and mode.
 */
-func (i *Installer) cleanupShellFiles(force bool) {
-	fmt.Println("Cleaning up shell configuration files...")
+func (i *Installer) writeFileAsRoot(path, content string) error {
+	staged, createErr := os.CreateTemp("", "nix-foundry-*")
+	if createErr != nil {
+		return fmt.Errorf("failed to create temporary file: %w", createErr)
+	}
+	defer func() { _ = os.Remove(staged.Name()) }()
+
+	if _, writeErr := staged.WriteString(content); writeErr != nil {
+		_ = staged.Close()
+		return fmt.Errorf("failed to write temporary file: %w", writeErr)
+	}
+	if closeErr := staged.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write temporary file: %w", closeErr)
+	}
 
+	return i.runner.Run("sudo", "cp", staged.Name(), path)
+}
+
+/*
+shellConfigFiles returns the system-wide and user-specific shell configuration
+files that may contain Nix initialization.
+*/
+func shellConfigFiles() []string {
 	systemShellFiles := []string{
 		"/etc/bashrc",
 		"/etc/zshrc",
@@ -373,75 +720,114 @@ func (i *Installer) cleanupShellFiles(force bool) {
 		}
 	}
 
-	allShellFiles := append(systemShellFiles, userShellFiles...)
+	return append(systemShellFiles, userShellFiles...)
+}
+
+/*
+nixPaths returns the system and user files and directories that make up a Nix
+installation, in the order they are removed during uninstallation.
+*/
+func nixPaths() []string {
+	systemPaths := []string{
+		"/nix",
+		"/etc/nix",
+		"/etc/profile.d/nix.sh",
+		"/etc/synthetic.conf",
+		"/etc/fstab",
+		"/Library/LaunchDaemons/org.nixos.nix-daemon.plist",
+		"/Library/LaunchDaemons/org.nixos.darwin-store.plist",
+		"/etc/systemd/system/nix-daemon.service",
+		"/etc/systemd/system/nix-daemon.socket",
+		"/etc/tmpfiles.d/nix-daemon.conf",
+		"/usr/local/bin/nix-env",
+		"/usr/local/bin/nix",
+		"/usr/local/bin/nix-shell",
+	}
+
+	userPaths := []string{}
+	if userHomeDir, homeDirErr := os.UserHomeDir(); homeDirErr == nil {
+		userPaths = []string{
+			filepath.Join(userHomeDir, ".nix-profile"),
+			filepath.Join(userHomeDir, ".nix-defexpr"),
+			filepath.Join(userHomeDir, ".nix-channels"),
+			filepath.Join(userHomeDir, ".nixpkgs"),
+			filepath.Join(userHomeDir, ".config/nixpkgs"),
+			filepath.Join(userHomeDir, ".config/nix"),
+			filepath.Join(userHomeDir, ".cache/nix"),
+			filepath.Join(userHomeDir, ".local/state/nix"),
+		}
+	}
+
+	return append(systemPaths, userPaths...)
+}
+
+/*
+daemonServiceFiles lists the systemd and launchd units stopped and unloaded by
+stopDaemonServices.
+*/
+var daemonServiceFiles = []string{
+	"/etc/systemd/system/nix-daemon.service",
+	"/etc/systemd/system/nix-daemon.socket",
+	"/Library/LaunchDaemons/org.nixos.nix-daemon.plist",
+	"/Library/LaunchDaemons/org.nixos.darwin-store.plist",
+}
 
-	for _, file := range allShellFiles {
+/*
+cleanupShellFiles removes Nix-related lines from shell configuration files.
+This includes both system-wide and user-specific shell configuration files.
+Only marked blocks are removed unless aggressive is true, in which case the
+legacy substring heuristics are applied as well.
+*/
+func (i *Installer) cleanupShellFiles(force, aggressive bool) {
+	fmt.Println("Cleaning up shell configuration files...")
+
+	for _, file := range shellConfigFiles() {
 		if i.fs.Exists(file) {
-			i.cleanupSingleShellFile(file, force)
+			i.cleanupSingleShellFile(file, force, aggressive)
 		}
 	}
 }
 
 /*
 cleanupSingleShellFile removes Nix-related lines from a single shell configuration file.
+Blocks delimited by nix-foundry or Nix installer markers are always removed. Unmarked
+lines that merely look Nix-related are only removed when aggressive is true, and the
+exact lines are printed before the file is rewritten.
 */
-func (i *Installer) cleanupSingleShellFile(file string, force bool) {
-	content, readErr := os.ReadFile(file)
+func (i *Installer) cleanupSingleShellFile(file string, force, aggressive bool) {
+	content, readErr := i.fs.ReadFile(file)
 	if readErr != nil {
-		fmt.Printf("Warning: Failed to read shell file %s: %v\n", file, readErr)
+		logging.Warn("failed to read shell file", "path", file, "error", readErr)
 		return
 	}
 
-	lines := strings.Split(string(content), "\n")
-	var newLines []string
-	skipBlock := false
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		if strings.Contains(trimmedLine, "# Nix") ||
-			strings.Contains(trimmedLine, "# Added by Nix") ||
-			strings.Contains(trimmedLine, "# Begin Nix") {
-			skipBlock = true
-			continue
-		}
+	newContent, _ := shell.RemoveManagedBlocks(string(content))
 
-		if skipBlock && (strings.Contains(trimmedLine, "# End Nix") || trimmedLine == "") {
-			skipBlock = false
-			if trimmedLine == "" {
-				continue
+	if aggressive {
+		var legacyLines []string
+		newContent, legacyLines = shell.RemoveLegacyNixLines(newContent)
+		if len(legacyLines) > 0 {
+			fmt.Printf("Removing unmarked Nix-related lines from %s:\n", file)
+			for _, line := range legacyLines {
+				fmt.Printf("  - %s\n", line)
 			}
 		}
-
-		if skipBlock ||
-			strings.Contains(line, "/nix/") ||
-			strings.Contains(line, "nix-daemon") ||
-			strings.Contains(line, ".nix-profile") ||
-			strings.Contains(line, "nix.sh") ||
-			strings.Contains(line, "NIX_") ||
-			strings.Contains(line, "NIXPKGS_") {
-			continue
-		}
-
-		newLines = append(newLines, line)
+	} else if _, legacyLines := shell.RemoveLegacyNixLines(newContent); len(legacyLines) > 0 {
+		fmt.Printf("Note: %s contains %d unmarked Nix-related line(s); rerun with --aggressive to remove them\n", file, len(legacyLines))
 	}
 
-	newContent := strings.Join(newLines, "\n")
-
 	if newContent != string(content) {
 		fmt.Printf("Cleaning Nix entries from: %s\n", file)
 
 		needsSudo := strings.HasPrefix(file, "/etc/")
 
 		if needsSudo || force {
-			writeCmd := exec.Command("sudo", "tee", file)
-			writeCmd.Stdin = strings.NewReader(newContent)
-			if writeErr := writeCmd.Run(); writeErr != nil {
-				fmt.Printf("Warning: Failed to update shell file %s: %v\n", file, writeErr)
+			if writeErr := i.writeFileAsRoot(file, newContent); writeErr != nil {
+				logging.Warn("failed to update shell file", "path", file, "error", writeErr)
 			}
 		} else {
-			if writeErr := os.WriteFile(file, []byte(newContent), 0644); writeErr != nil {
-				fmt.Printf("Warning: Failed to update shell file %s: %v\n", file, writeErr)
+			if writeErr := i.fs.WriteFile(file, []byte(newContent), 0644); writeErr != nil {
+				logging.Warn("failed to update shell file", "path", file, "error", writeErr)
 			}
 		}
 	}
@@ -454,44 +840,12 @@ This includes system directories, user directories, cache, and configuration fil
 func (i *Installer) removeNixPaths(force bool) error {
 	fmt.Println("Removing Nix files and directories...")
 
-	systemPaths := []string{
-		"/nix",
-		"/etc/nix",
-		"/etc/profile.d/nix.sh",
-		"/etc/synthetic.conf",
-		"/etc/fstab",
-		"/Library/LaunchDaemons/org.nixos.nix-daemon.plist",
-		"/Library/LaunchDaemons/org.nixos.darwin-store.plist",
-		"/etc/systemd/system/nix-daemon.service",
-		"/etc/systemd/system/nix-daemon.socket",
-		"/etc/tmpfiles.d/nix-daemon.conf",
-		"/usr/local/bin/nix-env",
-		"/usr/local/bin/nix",
-		"/usr/local/bin/nix-shell",
-	}
-
-	userPaths := []string{}
-	if userHomeDir, homeDirErr := os.UserHomeDir(); homeDirErr == nil {
-		userPaths = []string{
-			filepath.Join(userHomeDir, ".nix-profile"),
-			filepath.Join(userHomeDir, ".nix-defexpr"),
-			filepath.Join(userHomeDir, ".nix-channels"),
-			filepath.Join(userHomeDir, ".nixpkgs"),
-			filepath.Join(userHomeDir, ".config/nixpkgs"),
-			filepath.Join(userHomeDir, ".config/nix"),
-			filepath.Join(userHomeDir, ".cache/nix"),
-			filepath.Join(userHomeDir, ".local/state/nix"),
-		}
-	}
-
-	allPaths := append(systemPaths, userPaths...)
-
-	for _, path := range allPaths {
+	for _, path := range nixPaths() {
 		if !i.fs.Exists(path) {
 			continue
 		}
 
-		fmt.Printf("Removing: %s\n", path)
+		logging.Debug("removing", "path", path)
 
 		if path == "/nix" {
 			i.unmountNix()
@@ -502,20 +856,18 @@ func (i *Installer) removeNixPaths(force bool) error {
 			strings.HasPrefix(path, "/usr/") ||
 			path == "/nix"
 
-		var removeCmd *exec.Cmd
+		var removeErr error
 		if needsSudo {
-			removeCmd = exec.Command("sudo", "rm", "-rf", path)
+			removeErr = i.runner.Run("sudo", "rm", "-rf", path)
 		} else {
-			removeCmd = exec.Command("rm", "-rf", path)
+			removeErr = i.runner.Run("rm", "-rf", path)
 		}
 
-		removeCmd.Stdout = os.Stdout
-		removeCmd.Stderr = os.Stderr
-		if removeErr := removeCmd.Run(); removeErr != nil {
+		if removeErr != nil {
 			if !force {
 				return fmt.Errorf("failed to remove %s: %w", path, removeErr)
 			}
-			fmt.Printf("Warning: Failed to remove %s: %v\n", path, removeErr)
+			logging.Warn("failed to remove path", "path", path, "error", removeErr)
 		}
 	}
 	return nil
@@ -527,50 +879,52 @@ unmountNix attempts to unmount the Nix store on both macOS and Linux.
 func (i *Installer) unmountNix() {
 	if i.fs.Exists("/usr/sbin/diskutil") {
 		fmt.Println("Attempting macOS unmount...")
-		unmountCmd := exec.Command("sudo", "diskutil", "unmount", "force", "/nix")
-		unmountCmd.Stdout = os.Stdout
-		unmountCmd.Stderr = os.Stderr
-		if unmountErr := unmountCmd.Run(); unmountErr != nil {
-			fmt.Printf("Warning: Failed to unmount /nix: %v\n", unmountErr)
+		if unmountErr := i.runner.Run("sudo", "diskutil", "unmount", "force", "/nix"); unmountErr != nil {
+			logging.Warn("failed to unmount /nix", "error", unmountErr)
 		}
 
 		fmt.Println("Attempting to remove Nix APFS volume...")
-		listCmd := exec.Command("diskutil", "list")
-		listCmd.Stderr = os.Stderr
-		if listOutput, listErr := listCmd.Output(); listErr == nil {
-			lines := strings.Split(string(listOutput), "\n")
-			for _, line := range lines {
-				if strings.Contains(line, "Nix Store") {
-					fields := strings.Fields(line)
-					if len(fields) > 0 {
-						volumeID := fields[len(fields)-1]
-						fmt.Printf("Found Nix volume: %s\n", volumeID)
-						deleteCmd := exec.Command("sudo", "diskutil", "apfs", "deleteVolume", volumeID)
-						deleteCmd.Stdout = os.Stdout
-						deleteCmd.Stderr = os.Stderr
-						if deleteErr := deleteCmd.Run(); deleteErr != nil {
-							fmt.Printf("Warning: Failed to delete Nix volume %s: %v\n", volumeID, deleteErr)
-						} else {
-							fmt.Printf("Successfully deleted Nix volume: %s\n", volumeID)
-						}
-						break
-					}
-				}
+		if volumes := i.nixVolumes(); len(volumes) > 0 {
+			volumeID := volumes[0]
+			logging.Debug("found Nix volume", "volume", volumeID)
+			if deleteErr := i.runner.Run("sudo", "diskutil", "apfs", "deleteVolume", volumeID); deleteErr != nil {
+				logging.Warn("failed to delete Nix volume", "volume", volumeID, "error", deleteErr)
+			} else {
+				fmt.Printf("Successfully deleted Nix volume: %s\n", volumeID)
 			}
 		}
 	}
 
 	if i.fs.Exists("/bin/umount") {
 		fmt.Println("Attempting Linux unmount...")
-		unmountCmd := exec.Command("sudo", "umount", "-f", "/nix")
-		unmountCmd.Stdout = os.Stdout
-		unmountCmd.Stderr = os.Stderr
-		if unmountErr := unmountCmd.Run(); unmountErr != nil {
-			fmt.Printf("Warning: Failed to unmount /nix: %v\n", unmountErr)
+		if unmountErr := i.runner.Run("sudo", "umount", "-f", "/nix"); unmountErr != nil {
+			logging.Warn("failed to unmount /nix", "error", unmountErr)
 		}
 	}
 }
 
+/*
+nixVolumes returns the identifiers of APFS volumes named "Nix Store" as reported
+by diskutil. It returns nil when diskutil is unavailable.
+*/
+func (i *Installer) nixVolumes() []string {
+	listOutput, listErr := i.runner.Output("diskutil", "list")
+	if listErr != nil {
+		return nil
+	}
+
+	var volumes []string
+	for _, line := range strings.Split(string(listOutput), "\n") {
+		if strings.Contains(line, "Nix Store") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 {
+				volumes = append(volumes, fields[len(fields)-1])
+			}
+		}
+	}
+	return volumes
+}
+
 /*
 Uninstall removes Nix installation from the system.
 It performs the following steps:
@@ -582,9 +936,10 @@ It performs the following steps:
 6. Cleans up shell configurations
 7. Verifies uninstallation was successful
 
-The force parameter allows bypassing certain checks and errors.
+The force parameter allows bypassing certain checks and errors. The aggressive
+parameter additionally removes unmarked Nix-related lines from shell files.
 */
-func (i *Installer) Uninstall(force bool) error {
+func (i *Installer) Uninstall(force, aggressive bool) error {
 	fmt.Println("Starting Nix uninstallation...")
 
 	if !i.IsInstalled() {
@@ -592,30 +947,33 @@ func (i *Installer) Uninstall(force bool) error {
 		return nil
 	}
 
+	if flavor := i.DetectFlavor(); flavor.IsForeign() {
+		return i.uninstallForeign(flavor, force)
+	}
+
 	if !force {
-		fmt.Println("Checking for running Nix processes...")
-		processCmd := exec.Command("pgrep", "-f", "nix")
-		if processErr := processCmd.Run(); processErr == nil {
+		logging.Debug("checking for running Nix processes")
+		if _, processErr := i.runner.Output("pgrep", "-f", "nix"); processErr == nil {
 			return fmt.Errorf("nix processes are still running. Please stop them first or use --force")
 		}
 	}
 
 	i.uninstallPackages()
 	i.stopDaemonServices()
-	i.cleanupShellFiles(force)
+	i.cleanupShellFiles(force, aggressive)
 
 	if removeErr := i.removeNixPaths(force); removeErr != nil {
 		return removeErr
 	}
 
 	if cleanupErr := i.cleanupBackupFiles(); cleanupErr != nil {
-		fmt.Printf("Warning: Failed to clean up backup files: %v\n", cleanupErr)
+		logging.Warn("failed to clean up backup files", "error", cleanupErr)
 	}
 
 	fmt.Println("Verifying uninstallation...")
 	if i.IsInstalled() {
 		if force {
-			fmt.Println("Warning: Nix appears to still be installed, but continuing due to --force")
+			logging.Warn("nix appears to still be installed, but continuing due to --force")
 			return nil
 		}
 		return fmt.Errorf("uninstallation verification failed")
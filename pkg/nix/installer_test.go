@@ -0,0 +1,442 @@
+package nix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/retry"
+)
+
+/*
+writeFakeFile writes content to path in fs, creating its parent directories.
+Paths that are only checked for existence are written empty.
+*/
+func writeFakeFile(fs *filesystem.MemFS, path string, content []byte, perm os.FileMode) {
+	_ = fs.MkdirAll(filepath.Dir(path), 0755)
+	_ = fs.WriteFile(path, content, perm)
+}
+
+type fakeRunner struct {
+	fs       *filesystem.MemFS
+	script   []byte
+	outputs  map[string]string
+	failing  map[string]bool
+	flaky    map[string]int
+	commands []string
+}
+
+func (r *fakeRunner) Run(name string, args ...string) error {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	if r.failing[command] || r.failing[name] {
+		return fmt.Errorf("command failed: %s", command)
+	}
+	if r.flaky[command] > 0 {
+		r.flaky[command]--
+		return fmt.Errorf("command failed: %s", command)
+	}
+	switch name {
+	case "curl":
+		writeFakeFile(r.fs, args[len(args)-1], r.script, 0644)
+	case "sh":
+		_ = r.fs.MkdirAll("/nix/store", 0755)
+	case "tar":
+		writeFakeFile(r.fs, filepath.Join(args[3], "install"), r.script, 0755)
+	}
+	return nil
+}
+
+func (r *fakeRunner) Output(name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	if output, ok := r.outputs[command]; ok {
+		return []byte(output), nil
+	}
+	return nil, fmt.Errorf("command not available")
+}
+
+func (r *fakeRunner) ran(prefix string) bool {
+	for _, cmd := range r.commands {
+		if cmd == prefix || strings.HasPrefix(cmd, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestInstaller(script string) (*Installer, *fakeRunner) {
+	fs := filesystem.NewMemFS()
+	runner := &fakeRunner{fs: fs, script: []byte(script)}
+	return &Installer{fs: fs, runner: runner}, runner
+}
+
+func TestInstallVerifiesScriptChecksum(t *testing.T) {
+	script := "#!/bin/sh\necho installing nix\n"
+	sum := sha256.Sum256([]byte(script))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		checksum  string
+		wantErr   bool
+		wantRunSh bool
+	}{
+		{name: "matching checksum", checksum: checksum, wantRunSh: true},
+		{name: "matching checksum with uppercase hex", checksum: strings.ToUpper(checksum), wantRunSh: true},
+		{name: "mismatched checksum", checksum: strings.Repeat("0", 64), wantErr: true},
+		{name: "no checksum", checksum: "", wantRunSh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installer, runner := newTestInstaller(script)
+			installer.SetVerification(ScriptVerification{SHA256: tt.checksum})
+
+			err := installer.Install(false, InstallOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "checksum mismatch") {
+				t.Errorf("expected checksum mismatch error, got %v", err)
+			}
+			if runner.ran("sh") != tt.wantRunSh {
+				t.Errorf("install script executed = %v, want %v", runner.ran("sh"), tt.wantRunSh)
+			}
+		})
+	}
+}
+
+func TestInstallFromScriptSkipsDownload(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/install.sh")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	sum := sha256.Sum256(fixture)
+
+	installer, runner := newTestInstaller("")
+	scriptPath := "/offline/install.sh"
+	writeFakeFile(runner.fs, scriptPath, fixture, 0755)
+	installer.SetVerification(ScriptVerification{SHA256: hex.EncodeToString(sum[:])})
+
+	if installErr := installer.InstallFromScript(scriptPath, true); installErr != nil {
+		t.Fatalf("InstallFromScript() error = %v", installErr)
+	}
+
+	if runner.ran("curl") {
+		t.Errorf("expected no download during offline install, got commands: %v", runner.commands)
+	}
+	if !runner.ran("sh " + scriptPath + " --daemon") {
+		t.Errorf("expected install script to run in daemon mode, got commands: %v", runner.commands)
+	}
+}
+
+func TestInstallFromTarball(t *testing.T) {
+	tarball := []byte("release tarball contents")
+	sum := sha256.Sum256(tarball)
+
+	installer, runner := newTestInstaller("#!/bin/sh\n")
+	tarballPath := "/offline/nix-2.24.9-x86_64-linux.tar.xz"
+	writeFakeFile(runner.fs, tarballPath, tarball, 0644)
+	installer.SetVerification(ScriptVerification{SHA256: hex.EncodeToString(sum[:])})
+
+	if installErr := installer.Install(false, InstallOptions{ScriptPath: tarballPath, SkipDownload: true}); installErr != nil {
+		t.Fatalf("Install() error = %v", installErr)
+	}
+
+	if runner.ran("curl") {
+		t.Errorf("expected no download when installing from a tarball, got commands: %v", runner.commands)
+	}
+	if !runner.ran("tar -xf " + tarballPath) {
+		t.Errorf("expected tarball to be extracted, got commands: %v", runner.commands)
+	}
+	ranInstall := false
+	for _, command := range runner.commands {
+		ranInstall = ranInstall || (strings.HasPrefix(command, "sh ") && strings.Contains(command, "/install"))
+	}
+	if !ranInstall {
+		t.Errorf("expected extracted install script to run, got commands: %v", runner.commands)
+	}
+}
+
+func TestInstallOfflineErrors(t *testing.T) {
+	installer, runner := newTestInstaller("")
+	if err := installer.Install(false, InstallOptions{SkipDownload: true}); err == nil || !strings.Contains(err.Error(), InstallScriptEnv) {
+		t.Errorf("expected error pointing at %s, got %v", InstallScriptEnv, err)
+	}
+
+	installer, runner = newTestInstaller("")
+	runner.failing = map[string]bool{"curl": true}
+	err := installer.Install(false, InstallOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--offline --script") {
+		t.Errorf("expected download failure to suggest offline install, got %v", err)
+	}
+	if runner.ran("sh") {
+		t.Errorf("expected no install script to run after a failed download")
+	}
+}
+
+func TestInstallNonInteractiveAcceptsPrompts(t *testing.T) {
+	installer, runner := newTestInstaller("")
+	scriptPath := "/offline/install.sh"
+	writeFakeFile(runner.fs, scriptPath, []byte("#!/bin/sh\n"), 0755)
+	installer.SetNonInteractive(true)
+
+	if installErr := installer.Install(true, InstallOptions{ScriptPath: scriptPath, SkipDownload: true}); installErr != nil {
+		t.Fatalf("Install() error = %v", installErr)
+	}
+	if !runner.ran("sh " + scriptPath + " --daemon --yes") {
+		t.Errorf("expected install script to run with --yes, got commands: %v", runner.commands)
+	}
+}
+
+func TestInstallFromScriptRejectsNonExecutableScript(t *testing.T) {
+	installer, runner := newTestInstaller("")
+	scriptPath := "/offline/install.sh"
+	writeFakeFile(runner.fs, scriptPath, []byte("#!/bin/sh\n"), 0644)
+
+	if err := installer.InstallFromScript(scriptPath, false); err == nil || !strings.Contains(err.Error(), "not executable") {
+		t.Fatalf("expected not executable error, got %v", err)
+	}
+	if runner.ran("sh") {
+		t.Errorf("expected install script not to be executed")
+	}
+}
+
+func TestInstallerRetriesWithBackoff(t *testing.T) {
+	daemonCheck := "bash -c /nix/var/nix/profiles/default/bin/nix-env --version"
+	channelUpdate := "bash -c . /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && nix-channel --update"
+
+	tests := []struct {
+		name         string
+		command      string
+		failures     int
+		run          func(*Installer) error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "daemon ready on the third attempt",
+			command:      daemonCheck,
+			failures:     2,
+			run:          (*Installer).WaitForDaemon,
+			wantAttempts: 3,
+		},
+		{
+			name:         "daemon never ready",
+			command:      daemonCheck,
+			failures:     10,
+			run:          (*Installer).WaitForDaemon,
+			wantAttempts: 4,
+			wantErr:      true,
+		},
+		{
+			name:     "channel update succeeds on the third attempt",
+			command:  channelUpdate,
+			failures: 2,
+			run: func(installer *Installer) error {
+				installer.InitializeChannels()
+				return nil
+			},
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installer, runner := newTestInstaller("")
+			runner.flaky = map[string]int{tt.command: tt.failures}
+			var delays []time.Duration
+			installer.policy = retry.Policy{
+				MaxAttempts: 4,
+				Initial:     time.Second,
+				Max:         time.Minute,
+				Sleep:       func(d time.Duration) { delays = append(delays, d) },
+			}
+
+			if err := tt.run(installer); (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			attempts := 0
+			for _, command := range runner.commands {
+				if command == tt.command {
+					attempts++
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("ran %q %d times, want %d", tt.command, attempts, tt.wantAttempts)
+			}
+			if len(delays) != tt.wantAttempts-1 {
+				t.Fatalf("delays = %v, want %d", delays, tt.wantAttempts-1)
+			}
+			for idx := 1; idx < len(delays); idx++ {
+				if delays[idx] != 2*delays[idx-1] {
+					t.Errorf("delays = %v, want each delay double the previous one", delays)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanUninstallListsOnlyExistingPaths(t *testing.T) {
+	home := "/home/tester"
+	t.Setenv("HOME", home)
+
+	installer, runner := newTestInstaller("")
+	fs := runner.fs
+	for _, dir := range []string{"/nix", "/etc/nix", filepath.Join(home, ".nix-profile")} {
+		_ = fs.MkdirAll(dir, 0755)
+	}
+	writeFakeFile(fs, "/usr/sbin/diskutil", nil, 0755)
+	writeFakeFile(fs, "/Library/LaunchDaemons/org.nixos.nix-daemon.plist", nil, 0644)
+	writeFakeFile(fs, filepath.Join(home, ".zshrc"), []byte("export NIX_REMOTE_BUILDERS=builder\n"+
+		"# >>> nix-foundry managed block >>>\n. /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh\n# <<< nix-foundry managed block <<<\n"), 0644)
+	writeFakeFile(fs, filepath.Join(home, ".bashrc"), []byte("alias ll='ls -l'\n"), 0644)
+	runner.outputs = map[string]string{
+		"diskutil list": "   2:                APFS Volume Nix Store               1.2 GB     disk1s7\n",
+	}
+
+	plan, err := installer.PlanUninstall()
+	if err != nil {
+		t.Fatalf("PlanUninstall() error = %v", err)
+	}
+
+	wantPaths := []string{
+		"/nix",
+		"/etc/nix",
+		"/Library/LaunchDaemons/org.nixos.nix-daemon.plist",
+		filepath.Join(home, ".nix-profile"),
+	}
+	if !reflect.DeepEqual(plan.Paths, wantPaths) {
+		t.Errorf("plan paths = %v, want %v", plan.Paths, wantPaths)
+	}
+
+	wantServices := []string{"/Library/LaunchDaemons/org.nixos.nix-daemon.plist"}
+	if !reflect.DeepEqual(plan.Services, wantServices) {
+		t.Errorf("plan services = %v, want %v", plan.Services, wantServices)
+	}
+
+	if !reflect.DeepEqual(plan.Volumes, []string{"disk1s7"}) {
+		t.Errorf("plan volumes = %v, want [disk1s7]", plan.Volumes)
+	}
+
+	if len(plan.ShellEdits) != 1 || plan.ShellEdits[0].Path != filepath.Join(home, ".zshrc") {
+		t.Fatalf("plan shell edits = %+v, want a single edit of .zshrc", plan.ShellEdits)
+	}
+	if len(plan.ShellEdits[0].Lines) != 3 {
+		t.Errorf("plan removes %d lines from .zshrc, want 3", len(plan.ShellEdits[0].Lines))
+	}
+	if !reflect.DeepEqual(plan.ShellEdits[0].LegacyLines, []string{"export NIX_REMOTE_BUILDERS=builder"}) {
+		t.Errorf("plan legacy lines = %v", plan.ShellEdits[0].LegacyLines)
+	}
+
+	if runner.ran("sudo") || runner.ran("rm") {
+		t.Errorf("PlanUninstall() must not modify the system, got commands: %v", runner.commands)
+	}
+}
+
+func TestPlanUninstallEmptyWhenNothingInstalled(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	installer, _ := newTestInstaller("")
+	plan, err := installer.PlanUninstall()
+	if err != nil {
+		t.Fatalf("PlanUninstall() error = %v", err)
+	}
+	if !plan.IsEmpty() {
+		t.Errorf("expected empty plan, got %+v", plan)
+	}
+}
+
+func TestUninstallPackagesFromOutputBatches(t *testing.T) {
+	profile := "/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh"
+	removeCmd := func(pkgs ...string) string {
+		return fmt.Sprintf("bash -c . %s && nix-env -e %s", profile, strings.Join(pkgs, " "))
+	}
+
+	t.Run("single invocation when batch succeeds", func(t *testing.T) {
+		installer, runner := newTestInstaller("")
+
+		failed := installer.uninstallPackagesFromOutput("git\nhello\njq\n", profile)
+		if len(failed) != 0 {
+			t.Errorf("unexpected failures: %v", failed)
+		}
+		if !reflect.DeepEqual(runner.commands, []string{removeCmd("git", "hello", "jq")}) {
+			t.Errorf("commands = %v", runner.commands)
+		}
+	})
+
+	t.Run("falls back to per-package removal when batch fails", func(t *testing.T) {
+		installer, runner := newTestInstaller("")
+		runner.failing = map[string]bool{
+			removeCmd("git", "broken", "jq"): true,
+			removeCmd("broken"):              true,
+		}
+
+		failed := installer.uninstallPackagesFromOutput("git\nbroken\njq", profile)
+		if !reflect.DeepEqual(failed, []string{"broken"}) {
+			t.Errorf("failed = %v, want [broken]", failed)
+		}
+		want := []string{
+			removeCmd("git", "broken", "jq"),
+			removeCmd("git"),
+			removeCmd("broken"),
+			removeCmd("jq"),
+		}
+		if !reflect.DeepEqual(runner.commands, want) {
+			t.Errorf("commands = %v, want %v", runner.commands, want)
+		}
+	})
+
+	t.Run("chunks large package lists", func(t *testing.T) {
+		installer, runner := newTestInstaller("")
+
+		var pkgs []string
+		for n := 0; n < uninstallBatchSize+1; n++ {
+			pkgs = append(pkgs, fmt.Sprintf("pkg%d", n))
+		}
+
+		installer.uninstallPackagesFromOutput(strings.Join(pkgs, "\n"), profile)
+		want := []string{removeCmd(pkgs[:uninstallBatchSize]...), removeCmd(pkgs[uninstallBatchSize:]...)}
+		if !reflect.DeepEqual(runner.commands, want) {
+			t.Errorf("expected %d batched invocations, got %d", len(want), len(runner.commands))
+		}
+	})
+}
+
+func TestParseGCOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		wantPaths int
+		wantFreed string
+	}{
+		{
+			name:      "summary line",
+			output:    "finding garbage collector roots...\ndeleting unused links...\n42 store paths deleted, 512.30 MiB freed\n",
+			wantPaths: 42,
+			wantFreed: "512.30 MiB",
+		},
+		{
+			name:   "nothing collected",
+			output: "finding garbage collector roots...\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParseGCOutput(tt.output)
+			if result.PathsDeleted != tt.wantPaths || result.Freed != tt.wantFreed {
+				t.Errorf("ParseGCOutput() = %d paths, %q freed; want %d, %q", result.PathsDeleted, result.Freed, tt.wantPaths, tt.wantFreed)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package nix
+
+import (
+	"fmt"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+/*
+UninstallPlan describes everything Uninstall would touch on the current system.
+Only paths, shell files, services, and volumes that actually exist are listed.
+*/
+type UninstallPlan struct {
+	Paths      []string
+	ShellEdits []ShellFileEdit
+	Services   []string
+	Volumes    []string
+}
+
+/*
+ShellFileEdit describes the lines Uninstall would remove from a shell file.
+Lines are inside nix-foundry or Nix installer markers and are always removed;
+LegacyLines are unmarked Nix-related lines removed only in aggressive mode.
+*/
+type ShellFileEdit struct {
+	Path        string
+	Lines       []string
+	LegacyLines []string
+}
+
+/*
+IsEmpty reports whether the plan contains nothing to remove.
+*/
+func (p *UninstallPlan) IsEmpty() bool {
+	return len(p.Paths) == 0 && len(p.ShellEdits) == 0 && len(p.Services) == 0 && len(p.Volumes) == 0
+}
+
+/*
+PlanUninstall enumerates the paths, shell file edits, services, and volumes that
+Uninstall would touch, without modifying anything.
+*/
+func (i *Installer) PlanUninstall() (*UninstallPlan, error) {
+	plan := &UninstallPlan{}
+
+	for _, path := range nixPaths() {
+		if i.fs.Exists(path) {
+			plan.Paths = append(plan.Paths, path)
+		}
+	}
+
+	for _, file := range shellConfigFiles() {
+		if !i.fs.Exists(file) {
+			continue
+		}
+
+		content, readErr := i.fs.ReadFile(file)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read shell file %s: %w", file, readErr)
+		}
+
+		remaining, lines := shell.RemoveManagedBlocks(string(content))
+		_, legacyLines := shell.RemoveLegacyNixLines(remaining)
+		if len(lines) > 0 || len(legacyLines) > 0 {
+			plan.ShellEdits = append(plan.ShellEdits, ShellFileEdit{
+				Path:        file,
+				Lines:       lines,
+				LegacyLines: legacyLines,
+			})
+		}
+	}
+
+	for _, service := range daemonServiceFiles {
+		if i.fs.Exists(service) {
+			plan.Services = append(plan.Services, service)
+		}
+	}
+
+	if i.fs.Exists("/nix") && i.fs.Exists("/usr/sbin/diskutil") {
+		plan.Volumes = i.nixVolumes()
+	}
+
+	return plan, nil
+}
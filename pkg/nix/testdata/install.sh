@@ -0,0 +1,3 @@
+#!/bin/sh
+# Fixture standing in for the upstream Nix install script.
+echo "installing nix"
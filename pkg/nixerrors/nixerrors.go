@@ -0,0 +1,107 @@
+/*
+Package nixerrors classifies failed Nix commands. Known Nix error messages and
+exit codes are mapped to sentinel errors so that callers can react to the kind
+of failure with errors.Is instead of matching command output themselves.
+*/
+package nixerrors
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+)
+
+var (
+	// ErrUnfreeLicense means the package has a license that is not allowed.
+	ErrUnfreeLicense = errors.New("unfree license")
+	// ErrPermissionDenied means Nix could not write to the store or profile.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNoSuchAttribute means the package does not exist in nixpkgs.
+	ErrNoSuchAttribute = errors.New("not found")
+	// ErrHashMismatch means a downloaded source did not match its expected hash.
+	ErrHashMismatch = errors.New("hash mismatch")
+	// ErrNetworkFailure means a download or substitution failed.
+	ErrNetworkFailure = errors.New("network failure")
+)
+
+/*
+exitHashMismatch is the exit status Nix uses when a fixed-output derivation
+produced a different hash than declared.
+*/
+const exitHashMismatch = 102
+
+/*
+patterns maps Nix error messages to the failure they indicate. Patterns are
+checked in order, so more specific messages come first.
+*/
+var patterns = []struct {
+	pattern *regexp.Regexp
+	kind    error
+}{
+	{regexp.MustCompile(`has an unfree license`), ErrUnfreeLicense},
+	{regexp.MustCompile(`hash mismatch in fixed-output derivation|specified: sha256-\S+\s+got:`), ErrHashMismatch},
+	{regexp.MustCompile(`attribute '[^']*' (missing|in selection path '[^']*' not found)|does not provide attribute|selector '[^']*' matches no derivations`), ErrNoSuchAttribute},
+	{regexp.MustCompile(`(?i)unable to download|could(n't| not) resolve host|failed to connect|connection (timed out|refused|reset)|SSL connect error|network is unreachable`), ErrNetworkFailure},
+	{regexp.MustCompile(`(?i)operation not permitted|permission denied|cannot create directory|mkdir: /nix/store`), ErrPermissionDenied},
+}
+
+/*
+Error is a classified Nix failure. It matches both its Kind and the underlying
+error with errors.Is and errors.As.
+*/
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+/*
+Classify returns err wrapped in an *Error if the failure can be attributed to one
+of the known kinds. The standard error of a *cmdexec.Error is examined, falling
+back to the error message for other errors. Unrecognized errors are returned
+unchanged.
+*/
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	text := err.Error()
+	var cmdErr *cmdexec.Error
+	if errors.As(err, &cmdErr) {
+		if cmdErr.ExitCode == exitHashMismatch {
+			return &Error{Kind: ErrHashMismatch, Err: err}
+		}
+		if cmdErr.Stderr != "" {
+			text = cmdErr.Stderr
+		}
+	}
+
+	for _, p := range patterns {
+		if p.pattern.MatchString(text) {
+			return &Error{Kind: p.kind, Err: err}
+		}
+	}
+	return err
+}
+
+/*
+Kind returns the sentinel error that err was classified as, or nil if err is not
+a classified Nix failure.
+*/
+func Kind(err error) error {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package nixerrors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+)
+
+func commandError(stderr string, exitCode int) error {
+	return &cmdexec.Error{
+		Command:  "bash -c nix-env -iA nixpkgs.example",
+		Output:   stderr,
+		Stderr:   stderr,
+		ExitCode: exitCode,
+		Err:      fmt.Errorf("exit status %d", exitCode),
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "unfree license",
+			err:  commandError("error: Package ‘vscode-1.90.0’ in /nix/store/...-source/pkgs/applications/editors/vscode/vscode.nix:97 has an unfree license (‘unfree’), refusing to evaluate.", 1),
+			want: ErrUnfreeLicense,
+		},
+		{
+			name: "missing attribute",
+			err:  commandError("error: attribute 'ripgerp' in selection path 'nixpkgs.ripgerp' not found", 1),
+			want: ErrNoSuchAttribute,
+		},
+		{
+			name: "flake without attribute",
+			err:  commandError("error: flake 'flake:nixpkgs' does not provide attribute 'packages.x86_64-linux.ripgerp'", 1),
+			want: ErrNoSuchAttribute,
+		},
+		{
+			name: "hash mismatch message",
+			err:  commandError("error: hash mismatch in fixed-output derivation '/nix/store/abc-source.drv':\n  specified: sha256-AAAA\n     got:    sha256-BBBB", 1),
+			want: ErrHashMismatch,
+		},
+		{
+			name: "hash mismatch exit status",
+			err:  commandError("", 102),
+			want: ErrHashMismatch,
+		},
+		{
+			name: "network failure",
+			err:  commandError("error: unable to download 'https://cache.nixos.org/nar/abc.nar.xz': Couldn't resolve host name (6)", 1),
+			want: ErrNetworkFailure,
+		},
+		{
+			name: "permission denied",
+			err:  commandError("error: creating directory '/nix/store/.links': Operation not permitted", 1),
+			want: ErrPermissionDenied,
+		},
+		{
+			name: "plain error",
+			err:  errors.New("error: opening lock file '/nix/var/nix/profiles/per-user/root/profile.lock': Permission denied"),
+			want: ErrPermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("Classify() = %v, want kind %v", got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("Classify() should keep the original error in the chain")
+			}
+			if Kind(got) != tt.want {
+				t.Errorf("Kind() = %v, want %v", Kind(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	err := commandError("error: builder for '/nix/store/abc.drv' failed with exit code 2", 1)
+	if got := Classify(err); got != err || Kind(got) != nil {
+		t.Errorf("Classify() = %v, want the error unchanged", got)
+	}
+	if Classify(nil) != nil {
+		t.Errorf("Classify(nil) should return nil")
+	}
+}
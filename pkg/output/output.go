@@ -0,0 +1,88 @@
+/*
+Package output writes the results of list commands in the format selected with
+the --output flag, so that scripts can consume them without parsing the text
+meant for people.
+*/
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Format is an output format. Table is the human-readable text each command prints
+by default; JSON and YAML encode the command's results.
+*/
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+)
+
+/*
+FlagName is the name of the persistent flag that selects the output format.
+*/
+const FlagName = "output"
+
+/*
+FromCommand returns the format selected with the --output flag of cmd. The root
+command rejects unsupported formats before any command runs.
+*/
+func FromCommand(cmd *cobra.Command) Format {
+	name, _ := cmd.Flags().GetString(FlagName)
+	format, _ := ParseFormat(name)
+	return format
+}
+
+/*
+ParseFormat returns the output format with the given name. "yml" is accepted as
+an alias for YAML.
+*/
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "table":
+		return Table, nil
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q (expected table, json or yaml)", name)
+	}
+}
+
+/*
+Write encodes value to w as JSON or YAML. A nil list is written as an empty list
+so that consumers always receive one. Table output is left to the caller, and
+Write returns an error for it.
+*/
+func Write(w io.Writer, format Format, value interface{}) error {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && v.IsNil() {
+		value = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if encodeErr := encoder.Encode(value); encodeErr != nil {
+			return encodeErr
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("cannot encode results as %q", format)
+	}
+}
@@ -0,0 +1,130 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/config"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{"": Table, "table": Table, "JSON": JSON, "yml": YAML, "yaml": YAML}
+	for name, want := range tests {
+		got, err := ParseFormat(name)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseFormat("csv"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestFromCommand(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		want Format
+	}{
+		"default":    {args: []string{"list"}, want: Table},
+		"persistent": {args: []string{"list", "--output", "yml"}, want: YAML},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got Format
+			root := &cobra.Command{Use: "root"}
+			root.PersistentFlags().String(FlagName, string(Table), "")
+			root.AddCommand(&cobra.Command{Use: "list", Run: func(cmd *cobra.Command, _ []string) {
+				got = FromCommand(cmd)
+			}})
+			root.SetArgs(tt.args)
+
+			if err := root.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FromCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteListResults(t *testing.T) {
+	userConfig := schema.NewDefaultConfig()
+	userConfig.Metadata.Name = "default"
+	teamConfig := schema.NewDefaultConfig()
+	teamConfig.Type = schema.TeamConfig
+	teamConfig.Metadata.Name = "platform"
+	teamConfig.Base = "default"
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{
+			name:  "config list",
+			value: []*schema.Config{userConfig, teamConfig},
+			want:  "platform",
+		},
+		{
+			name: "config script list",
+			value: []config.ScriptPlan{
+				{Script: schema.Script{Name: "setup", Commands: "echo hi"}, Run: true},
+				{Script: schema.Script{Name: "mac-only"}, Reason: "only runs on darwin"},
+			},
+			want: "only runs on darwin",
+		},
+		{
+			name:  "packages search",
+			value: []packages.PackageResult{{Name: "ripgrep", Version: "14.1.0", Description: "Fast grep"}},
+			want:  "ripgrep",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, JSON, tt.value); err != nil {
+				t.Fatalf("Write JSON: %v", err)
+			}
+			var decoded []map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+			}
+			if !bytes.Contains(buf.Bytes(), []byte(tt.want)) {
+				t.Errorf("JSON output does not contain %q:\n%s", tt.want, buf.String())
+			}
+
+			buf.Reset()
+			if err := Write(&buf, YAML, tt.value); err != nil {
+				t.Fatalf("Write YAML: %v", err)
+			}
+			if err := yaml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("output is not valid YAML: %v\n%s", err, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteNilListAsEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, JSON, []*schema.Config(nil)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := buf.String(); got != "[]\n" {
+		t.Errorf("got %q, want an empty JSON list", got)
+	}
+}
+
+func TestWriteRejectsTable(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, Table, []string{"a"}); err == nil {
+		t.Error("expected an error when writing table output")
+	}
+}
@@ -0,0 +1,262 @@
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+packageIndexTTL is how long the cached list of nixpkgs attributes is used before
+nixpkgs is evaluated again.
+*/
+const packageIndexTTL = 24 * time.Hour
+
+/*
+PackageStatus is the outcome of checking whether a package exists in nixpkgs.
+*/
+type PackageStatus int
+
+const (
+	// PackageFound means the package exists in nixpkgs.
+	PackageFound PackageStatus = iota
+	// PackageNotFound means nixpkgs was queried and has no such package.
+	PackageNotFound
+	// PackageUnverified means the package could not be checked, e.g. when offline.
+	PackageUnverified
+)
+
+/*
+String returns a human readable name for the status.
+*/
+func (s PackageStatus) String() string {
+	switch s {
+	case PackageFound:
+		return "found"
+	case PackageNotFound:
+		return "not found"
+	default:
+		return "unverified"
+	}
+}
+
+/*
+PackageCheck is the result of checking a single configured package.
+Suggestions holds similarly named packages when the package was not found, and
+Reason explains why a package could not be verified.
+*/
+type PackageCheck struct {
+	Name        string
+	Status      PackageStatus
+	Suggestions []string
+	Reason      string
+}
+
+/*
+packageIndexEntry is the on-disk representation of the cached package index.
+*/
+type packageIndexEntry struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Names     []string  `json:"names"`
+}
+
+/*
+CheckPackages checks that each package exists in nixpkgs. Packages are looked up
+in a cached index of all nixpkgs attributes, which is built with a single nix
+search; packages missing from the index (such as attributes in nested sets that
+nix search does not descend into) are confirmed with nix eval. With offline set,
+or when nixpkgs cannot be queried, packages are reported as unverified instead.
+*/
+func (m *Manager) CheckPackages(pkgs []string, offline bool) []PackageCheck {
+	checks := make([]PackageCheck, 0, len(pkgs))
+
+	if offline {
+		for _, pkg := range pkgs {
+			checks = append(checks, PackageCheck{Name: pkg, Status: PackageUnverified, Reason: "offline"})
+		}
+		return checks
+	}
+
+	index, indexErr := m.packageIndex()
+	if indexErr != nil {
+		for _, pkg := range pkgs {
+			checks = append(checks, PackageCheck{Name: pkg, Status: PackageUnverified, Reason: indexErr.Error()})
+		}
+		return checks
+	}
+
+	known := make(map[string]bool, len(index))
+	for _, name := range index {
+		known[name] = true
+	}
+
+	for _, pkg := range pkgs {
+		attr := schema.PackageAttribute(pkg)
+		if known[attr] || m.evalPackage(attr) {
+			checks = append(checks, PackageCheck{Name: pkg, Status: PackageFound})
+			continue
+		}
+
+		checks = append(checks, PackageCheck{
+			Name:        pkg,
+			Status:      PackageNotFound,
+			Suggestions: SuggestPackages(attr, index),
+		})
+	}
+
+	return checks
+}
+
+/*
+evalPackage reports whether attr evaluates to a derivation in nixpkgs.
+*/
+func (m *Manager) evalPackage(attr string) bool {
+	_, err := m.runner.Output("bash", nixShellCommand(fmt.Sprintf(
+		"%s/nix --extra-experimental-features 'nix-command flakes' eval --raw 'nixpkgs#%s.name' 2>/dev/null",
+		nixBinDir, attr))...)
+	return err == nil
+}
+
+/*
+packageIndex returns the attribute names of all packages in nixpkgs, using the
+cached index when it has not expired.
+*/
+func (m *Manager) packageIndex() ([]string, error) {
+	cacheFile, cacheErr := packageIndexFile()
+	if cacheErr == nil {
+		if content, readErr := m.fs.ReadFile(cacheFile); readErr == nil {
+			var entry packageIndexEntry
+			if jsonErr := json.Unmarshal(content, &entry); jsonErr == nil && m.now().Sub(entry.CreatedAt) <= packageIndexTTL {
+				return entry.Names, nil
+			}
+		}
+	}
+
+	output, err := m.runner.Output("bash", nixShellCommand(fmt.Sprintf(
+		"%s/nix --extra-experimental-features 'nix-command flakes' search nixpkgs '^' --json",
+		nixBinDir))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nixpkgs: %w", err)
+	}
+
+	results, parseErr := parseSearchJSON(output)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+
+	if cacheErr == nil {
+		if content, marshalErr := json.Marshal(packageIndexEntry{CreatedAt: m.now(), Names: names}); marshalErr == nil {
+			if mkdirErr := m.fs.MkdirAll(filepath.Dir(cacheFile), 0755); mkdirErr == nil {
+				_ = m.fs.WriteFile(cacheFile, content, 0644)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+/*
+CachedPackageIndex returns the package names from the cached index, however old,
+without querying nixpkgs. It reports false when no index has been cached yet.
+*/
+func (m *Manager) CachedPackageIndex() ([]string, bool) {
+	cacheFile, cacheErr := packageIndexFile()
+	if cacheErr != nil {
+		return nil, false
+	}
+
+	content, readErr := m.fs.ReadFile(cacheFile)
+	if readErr != nil {
+		return nil, false
+	}
+
+	var entry packageIndexEntry
+	if jsonErr := json.Unmarshal(content, &entry); jsonErr != nil {
+		return nil, false
+	}
+	return entry.Names, true
+}
+
+/*
+packageIndexFile returns the cache file holding the package index.
+*/
+func packageIndexFile() (string, error) {
+	cacheDir, err := paths.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "package-index.json"), nil
+}
+
+/*
+SuggestPackages returns up to three package names from index that are close to
+name, preferring the smallest edit distance.
+*/
+func SuggestPackages(name string, index []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	maxDistance := 2
+	if len(name) > 8 {
+		maxDistance = 3
+	}
+
+	var candidates []candidate
+	for _, known := range index {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(known))
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{name: known, distance: distance})
+		}
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].distance != candidates[b].distance {
+			return candidates[a].distance < candidates[b].distance
+		}
+		return candidates[a].name < candidates[b].name
+	})
+
+	var suggestions []string
+	for idx := 0; idx < len(candidates) && idx < 3; idx++ {
+		suggestions = append(suggestions, candidates[idx].name)
+	}
+	return suggestions
+}
+
+/*
+editDistance returns the Levenshtein distance between a and b.
+*/
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
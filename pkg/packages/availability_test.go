@@ -0,0 +1,162 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+/*
+indexRunner answers nix search with the package index fixture and nix eval only
+for the attributes listed in evaluable.
+*/
+type indexRunner struct {
+	index     []byte
+	evaluable map[string]bool
+	searches  int
+}
+
+func (r *indexRunner) Run(string, ...string) error { return nil }
+
+func (r *indexRunner) Output(_ string, args ...string) ([]byte, error) {
+	command := strings.Join(args, " ")
+	if strings.Contains(command, " search ") {
+		r.searches++
+		if r.index == nil {
+			return nil, fmt.Errorf("network unreachable")
+		}
+		return r.index, nil
+	}
+	for attr := range r.evaluable {
+		if strings.Contains(command, "nixpkgs#"+attr+".name") {
+			return []byte(attr), nil
+		}
+	}
+	return nil, fmt.Errorf("attribute not found")
+}
+
+func TestCheckPackages(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	fixture, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	runner := &indexRunner{index: fixture, evaluable: map[string]bool{"python3Packages.requests": true, "nodejs_20": true}}
+	manager := &Manager{
+		fs:     filesystem.NewMemFS(),
+		runner: runner,
+		now:    func() time.Time { return now },
+	}
+
+	checks := manager.CheckPackages([]string{"ripgrep", "ripgerp", "python3Packages.requests", "nodejs@20"}, false)
+	want := []PackageCheck{
+		{Name: "ripgrep", Status: PackageFound},
+		{Name: "ripgerp", Status: PackageNotFound, Suggestions: []string{"ripgrep"}},
+		{Name: "python3Packages.requests", Status: PackageFound},
+		{Name: "nodejs@20", Status: PackageFound},
+	}
+	if !reflect.DeepEqual(checks, want) {
+		t.Errorf("CheckPackages() = %+v, want %+v", checks, want)
+	}
+
+	manager.CheckPackages([]string{"ripgrep"}, false)
+	if runner.searches != 1 {
+		t.Errorf("expected the package index to be cached, nix search ran %d times", runner.searches)
+	}
+
+	now = now.Add(packageIndexTTL + time.Minute)
+	manager.CheckPackages([]string{"ripgrep"}, false)
+	if runner.searches != 2 {
+		t.Errorf("expected the package index to be rebuilt after TTL expiry, nix search ran %d times", runner.searches)
+	}
+}
+
+func TestCachedPackageIndex(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	fixture, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	runner := &indexRunner{index: fixture}
+	manager := &Manager{
+		fs:     filesystem.NewMemFS(),
+		runner: runner,
+		now:    func() time.Time { return now },
+	}
+
+	if _, ok := manager.CachedPackageIndex(); ok {
+		t.Fatal("expected no cached index before nixpkgs was searched")
+	}
+
+	manager.CheckPackages([]string{"ripgrep"}, false)
+	now = now.Add(packageIndexTTL + time.Minute)
+
+	index, ok := manager.CachedPackageIndex()
+	if !ok || !slices.Contains(index, "ripgrep") {
+		t.Errorf("CachedPackageIndex() = %v, %v, want the expired index to still be returned", index, ok)
+	}
+	if runner.searches != 1 {
+		t.Errorf("expected CachedPackageIndex not to query nixpkgs, nix search ran %d times", runner.searches)
+	}
+}
+
+func TestCheckPackagesUnverified(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	tests := []struct {
+		name       string
+		offline    bool
+		wantReason string
+	}{
+		{name: "offline", offline: true, wantReason: "offline"},
+		{name: "nixpkgs unreachable", wantReason: "failed to query nixpkgs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &indexRunner{}
+			manager := &Manager{
+				fs:     filesystem.NewMemFS(),
+				runner: runner,
+				now:    time.Now,
+			}
+
+			checks := manager.CheckPackages([]string{"ripgrep"}, tt.offline)
+			if len(checks) != 1 || checks[0].Status != PackageUnverified || !strings.Contains(checks[0].Reason, tt.wantReason) {
+				t.Errorf("CheckPackages() = %+v, want unverified with reason containing %q", checks, tt.wantReason)
+			}
+			if tt.offline && runner.searches != 0 {
+				t.Errorf("expected no nix search when offline, ran %d times", runner.searches)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"ripgrep", "ripgrep", 0},
+		{"ripgerp", "ripgrep", 2},
+		{"git", "gti", 2},
+		{"", "jq", 2},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
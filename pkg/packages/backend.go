@@ -0,0 +1,338 @@
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+const (
+	// NixEnvManager selects the nix-env backend.
+	NixEnvManager = "nix-env"
+	// NixProfileManager selects the nix profile backend.
+	NixProfileManager = "nix-profile"
+
+	nixDaemonProfile = "/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh"
+	nixBinDir        = "/nix/var/nix/profiles/default/bin"
+	allowUnfreeEnv   = "NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1"
+)
+
+/*
+PackageManager installs, removes, and lists packages in the user's Nix profile.
+Installed packages are reported by package name (pname) so they can be compared
+with configured packages using schema.DiffPackages.
+*/
+type PackageManager interface {
+	Name() string
+	Install(pkg string) error
+	InstallFrom(flakeRef, pkg string) error
+	Remove(pkg string) error
+	ListInstalled() ([]string, error)
+	OutPaths(pkg string) ([]string, error)
+}
+
+/*
+NewPackageManager returns the backend selected by the nix.manager setting.
+An empty name selects nix-env, the historical default.
+*/
+func NewPackageManager(name string, runner cmdexec.Runner) (PackageManager, error) {
+	switch name {
+	case "", NixEnvManager:
+		return &NixEnv{runner: runner}, nil
+	case NixProfileManager:
+		return &NixProfile{runner: runner}, nil
+	default:
+		return nil, fmt.Errorf("unsupported package manager: %s (expected %s or %s)", name, NixEnvManager, NixProfileManager)
+	}
+}
+
+/*
+nixShellCommand wraps a Nix command so it runs with the daemon profile sourced.
+*/
+func nixShellCommand(command string) []string {
+	return []string{"-c", fmt.Sprintf(". %s && %s", nixDaemonProfile, command)}
+}
+
+/*
+NixEnv manages packages with the legacy nix-env command.
+*/
+type NixEnv struct {
+	runner cmdexec.Runner
+}
+
+/*
+Name returns the nix.manager value that selects this backend.
+*/
+func (n *NixEnv) Name() string {
+	return NixEnvManager
+}
+
+/*
+Install installs a package from the nixpkgs channel with nix-env -iA.
+*/
+func (n *NixEnv) Install(pkg string) error {
+	return n.runner.Run("bash", nixShellCommand(fmt.Sprintf(
+		"%s %s/nix-env -iA nixpkgs.%s -Q", allowUnfreeEnv, nixBinDir, pkg))...)
+}
+
+/*
+InstallFrom installs a package from a pinned source with nix-env -f. nix-env cannot
+evaluate flakes, so only references that map to a source tarball are supported:
+github: references with a revision and plain tarball URLs.
+*/
+func (n *NixEnv) InstallFrom(flakeRef, pkg string) error {
+	source, err := nixEnvSource(flakeRef)
+	if err != nil {
+		return err
+	}
+	return n.runner.Run("bash", nixShellCommand(fmt.Sprintf(
+		"%s %s/nix-env -f '%s' -iA %s -Q", allowUnfreeEnv, nixBinDir, source, pkg))...)
+}
+
+/*
+nixEnvSource converts a flake reference into a tarball URL nix-env can import.
+*/
+func nixEnvSource(flakeRef string) (string, error) {
+	if validateErr := schema.ValidateFlakeRef(flakeRef); validateErr != nil {
+		return "", validateErr
+	}
+
+	if rest, ok := strings.CutPrefix(flakeRef, "github:"); ok {
+		parts := strings.SplitN(strings.SplitN(rest, "?", 2)[0], "/", 3)
+		if len(parts) == 3 && parts[2] != "" {
+			return fmt.Sprintf("https://github.com/%s/%s/archive/%s.tar.gz", parts[0], parts[1], parts[2]), nil
+		}
+	}
+
+	for _, prefix := range []string{"https://", "http://", "tarball+https://"} {
+		if strings.HasPrefix(flakeRef, prefix) {
+			return strings.TrimPrefix(flakeRef, "tarball+"), nil
+		}
+	}
+
+	return "", fmt.Errorf("nix-env cannot install from %q; use a github:owner/repo/<rev> reference or set nix.manager to %s", flakeRef, NixProfileManager)
+}
+
+/*
+Remove uninstalls a package by name with nix-env -e.
+*/
+func (n *NixEnv) Remove(pkg string) error {
+	return n.runner.Run("bash", nixShellCommand(fmt.Sprintf("%s/nix-env -e %s", nixBinDir, pkg))...)
+}
+
+/*
+ListInstalled queries nix-env -q --json and returns the pname of each installed package.
+*/
+func (n *NixEnv) ListInstalled() ([]string, error) {
+	output, err := n.runner.Output("bash", nixShellCommand(nixBinDir+"/nix-env -q --json")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed packages: %w", err)
+	}
+	return parseNixEnvJSON(output)
+}
+
+/*
+OutPaths returns the Nix store output paths of an installed package using
+nix-env -q --out-path.
+*/
+func (n *NixEnv) OutPaths(pkg string) ([]string, error) {
+	output, err := n.runner.Output("bash", nixShellCommand(fmt.Sprintf("%s/nix-env -q --out-path %s", nixBinDir, pkg))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query store paths for %s: %w", pkg, err)
+	}
+	return parseNixEnvOutPaths(output), nil
+}
+
+/*
+parseNixEnvOutPaths extracts store paths from nix-env -q --out-path output. Each line
+is a package name followed by either a single path or, for packages with several
+outputs, a semicolon-separated list of output=path pairs.
+*/
+func parseNixEnvOutPaths(output []byte) []string {
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, entry := range strings.Split(fields[len(fields)-1], ";") {
+			if idx := strings.Index(entry, "="); idx >= 0 {
+				entry = entry[idx+1:]
+			}
+			if strings.HasPrefix(entry, "/") {
+				paths = append(paths, entry)
+			}
+		}
+	}
+	return paths
+}
+
+/*
+parseNixEnvJSON extracts package names from nix-env -q --json output.
+*/
+func parseNixEnvJSON(output []byte) ([]string, error) {
+	var packages map[string]map[string]interface{}
+	if jsonErr := json.Unmarshal(output, &packages); jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse package JSON: %w", jsonErr)
+	}
+
+	var packageNames []string
+	for _, pkg := range packages {
+		if pname, ok := pkg["pname"].(string); ok {
+			packageNames = append(packageNames, pname)
+		}
+	}
+	sort.Strings(packageNames)
+
+	return packageNames, nil
+}
+
+/*
+NixProfile manages packages with the nix profile command from the new Nix CLI.
+*/
+type NixProfile struct {
+	runner cmdexec.Runner
+}
+
+/*
+Name returns the nix.manager value that selects this backend.
+*/
+func (n *NixProfile) Name() string {
+	return NixProfileManager
+}
+
+/*
+nixProfileCommand builds a nix profile invocation with the experimental features it needs.
+*/
+func nixProfileCommand(args string) string {
+	return fmt.Sprintf("%s/nix --extra-experimental-features 'nix-command flakes' profile %s", nixBinDir, args)
+}
+
+/*
+Install installs a package from the nixpkgs flake with nix profile install.
+The install is impure so that the unfree and unsupported-system overrides apply.
+*/
+func (n *NixProfile) Install(pkg string) error {
+	return n.runner.Run("bash", nixShellCommand(fmt.Sprintf(
+		"%s %s", allowUnfreeEnv, nixProfileCommand("install --impure nixpkgs#"+pkg)))...)
+}
+
+/*
+InstallFrom installs a package from a pinned flake reference with nix profile install.
+*/
+func (n *NixProfile) InstallFrom(flakeRef, pkg string) error {
+	if validateErr := schema.ValidateFlakeRef(flakeRef); validateErr != nil {
+		return validateErr
+	}
+	return n.runner.Run("bash", nixShellCommand(fmt.Sprintf(
+		"%s %s", allowUnfreeEnv, nixProfileCommand(fmt.Sprintf("install --impure '%s#%s'", flakeRef, pkg))))...)
+}
+
+/*
+Remove uninstalls a profile element by name with nix profile remove.
+*/
+func (n *NixProfile) Remove(pkg string) error {
+	return n.runner.Run("bash", nixShellCommand(nixProfileCommand("remove "+pkg))...)
+}
+
+/*
+ListInstalled queries nix profile list --json and returns the name of each element.
+*/
+func (n *NixProfile) ListInstalled() ([]string, error) {
+	output, err := n.runner.Output("bash", nixShellCommand(nixProfileCommand("list --json"))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed packages: %w", err)
+	}
+	return parseNixProfileJSON(output)
+}
+
+/*
+OutPaths returns the Nix store paths of the profile element named pkg.
+*/
+func (n *NixProfile) OutPaths(pkg string) ([]string, error) {
+	output, err := n.runner.Output("bash", nixShellCommand(nixProfileCommand("list --json"))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query store paths for %s: %w", pkg, err)
+	}
+
+	elements, parseErr := parseNixProfileElements(output)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	element, ok := elements[pkg]
+	if !ok {
+		return nil, fmt.Errorf("package %s is not installed in the profile", pkg)
+	}
+	return element.StorePaths, nil
+}
+
+/*
+nixProfileList is the JSON document printed by nix profile list --json. Nix 2.20 and
+later key elements by name; older releases emit an array of elements instead.
+*/
+type nixProfileList struct {
+	Elements json.RawMessage `json:"elements"`
+}
+
+/*
+nixProfileElement is a single installed element in nix profile list --json output.
+*/
+type nixProfileElement struct {
+	AttrPath   string   `json:"attrPath"`
+	StorePaths []string `json:"storePaths"`
+}
+
+/*
+parseNixProfileJSON extracts package names from nix profile list --json output.
+*/
+func parseNixProfileJSON(output []byte) ([]string, error) {
+	elements, err := parseNixProfileElements(output)
+	if err != nil {
+		return nil, err
+	}
+
+	packageNames := make([]string, 0, len(elements))
+	for name := range elements {
+		packageNames = append(packageNames, name)
+	}
+	sort.Strings(packageNames)
+
+	return packageNames, nil
+}
+
+/*
+parseNixProfileElements returns the elements of nix profile list --json output keyed
+by name. For the older array format, the name is the last component of the
+attribute path.
+*/
+func parseNixProfileElements(output []byte) (map[string]nixProfileElement, error) {
+	var list nixProfileList
+	if jsonErr := json.Unmarshal(output, &list); jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse package JSON: %w", jsonErr)
+	}
+
+	var named map[string]nixProfileElement
+	if json.Unmarshal(list.Elements, &named) == nil {
+		return named, nil
+	}
+
+	var indexed []nixProfileElement
+	if jsonErr := json.Unmarshal(list.Elements, &indexed); jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse package JSON: %w", jsonErr)
+	}
+
+	named = make(map[string]nixProfileElement, len(indexed))
+	for _, element := range indexed {
+		if element.AttrPath == "" {
+			continue
+		}
+		parts := strings.Split(element.AttrPath, ".")
+		named[parts[len(parts)-1]] = element
+	}
+	return named, nil
+}
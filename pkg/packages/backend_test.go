@@ -0,0 +1,191 @@
+package packages
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeRunner struct {
+	output   string
+	commands []string
+}
+
+func (r *fakeRunner) Run(name string, args ...string) error {
+	r.commands = append(r.commands, strings.Join(append([]string{name}, args...), " "))
+	return nil
+}
+
+func (r *fakeRunner) Output(name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, strings.Join(append([]string{name}, args...), " "))
+	if r.output == "" {
+		return nil, fmt.Errorf("no output configured")
+	}
+	return []byte(r.output), nil
+}
+
+func TestPackageManagerCommands(t *testing.T) {
+	source := ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "
+	nixProfile := "/nix/var/nix/profiles/default/bin/nix --extra-experimental-features 'nix-command flakes' profile "
+
+	tests := []struct {
+		manager     string
+		wantInstall string
+		wantRemove  string
+		wantList    string
+	}{
+		{
+			manager:     NixEnvManager,
+			wantInstall: "bash -c " + source + allowUnfreeEnv + " /nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.jq -Q",
+			wantRemove:  "bash -c " + source + "/nix/var/nix/profiles/default/bin/nix-env -e jq",
+			wantList:    "bash -c " + source + "/nix/var/nix/profiles/default/bin/nix-env -q --json",
+		},
+		{
+			manager:     NixProfileManager,
+			wantInstall: "bash -c " + source + allowUnfreeEnv + " " + nixProfile + "install --impure nixpkgs#jq",
+			wantRemove:  "bash -c " + source + nixProfile + "remove jq",
+			wantList:    "bash -c " + source + nixProfile + "list --json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.manager, func(t *testing.T) {
+			runner := &fakeRunner{}
+			pm, err := NewPackageManager(tt.manager, runner)
+			if err != nil {
+				t.Fatalf("NewPackageManager() error = %v", err)
+			}
+			if pm.Name() != tt.manager {
+				t.Errorf("Name() = %q, want %q", pm.Name(), tt.manager)
+			}
+
+			_ = pm.Install("jq")
+			_ = pm.Remove("jq")
+			_, _ = pm.ListInstalled()
+
+			want := []string{tt.wantInstall, tt.wantRemove, tt.wantList}
+			if !reflect.DeepEqual(runner.commands, want) {
+				t.Errorf("commands =\n%q\nwant\n%q", runner.commands, want)
+			}
+		})
+	}
+}
+
+func TestNewPackageManagerDefaultsAndErrors(t *testing.T) {
+	pm, err := NewPackageManager("", &fakeRunner{})
+	if err != nil || pm.Name() != NixEnvManager {
+		t.Errorf("NewPackageManager(\"\") = %v, %v; want nix-env backend", pm, err)
+	}
+
+	if _, err := NewPackageManager("apt", &fakeRunner{}); err == nil {
+		t.Error("expected error for unsupported package manager")
+	}
+}
+
+func TestListInstalledParsesJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		manager string
+		output  string
+		want    []string
+	}{
+		{
+			name:    "nix-env",
+			manager: NixEnvManager,
+			output: `{
+				"0": {"name": "git-2.40.1", "pname": "git", "version": "2.40.1"},
+				"1": {"name": "nodejs-18.16.1", "pname": "nodejs", "version": "18.16.1"}
+			}`,
+			want: []string{"git", "nodejs"},
+		},
+		{
+			name:    "nix profile keyed by name",
+			manager: NixProfileManager,
+			output: `{"version": 3, "elements": {
+				"webstorm": {"attrPath": "legacyPackages.aarch64-darwin.jetbrains.webstorm", "active": true},
+				"git": {"attrPath": "legacyPackages.aarch64-darwin.git", "active": true}
+			}}`,
+			want: []string{"git", "webstorm"},
+		},
+		{
+			name:    "nix profile element array",
+			manager: NixProfileManager,
+			output: `{"version": 2, "elements": [
+				{"attrPath": "legacyPackages.x86_64-linux.ripgrep"},
+				{"attrPath": "legacyPackages.x86_64-linux.git"}
+			]}`,
+			want: []string{"git", "ripgrep"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, _ := NewPackageManager(tt.manager, &fakeRunner{output: tt.output})
+
+			got, err := pm.ListInstalled()
+			if err != nil {
+				t.Fatalf("ListInstalled() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListInstalled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallFromPinsFlakeRef(t *testing.T) {
+	source := ". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && " + allowUnfreeEnv + " "
+	ref := "github:NixOS/nixpkgs/4a8b7c1d"
+
+	tests := []struct {
+		manager string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{
+			manager: NixProfileManager,
+			ref:     ref,
+			want:    "bash -c " + source + "/nix/var/nix/profiles/default/bin/nix --extra-experimental-features 'nix-command flakes' profile install --impure 'github:NixOS/nixpkgs/4a8b7c1d#ripgrep'",
+		},
+		{
+			manager: NixEnvManager,
+			ref:     ref,
+			want:    "bash -c " + source + "/nix/var/nix/profiles/default/bin/nix-env -f 'https://github.com/NixOS/nixpkgs/archive/4a8b7c1d.tar.gz' -iA ripgrep -Q",
+		},
+		{manager: NixEnvManager, ref: "nixpkgs/nixos-24.05", wantErr: true},
+		{manager: NixProfileManager, ref: "github:NixOS/nixpkgs#ripgrep", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.manager+" "+tt.ref, func(t *testing.T) {
+			runner := &fakeRunner{}
+			pm, _ := NewPackageManager(tt.manager, runner)
+
+			err := pm.InstallFrom(tt.ref, "ripgrep")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(runner.commands) != 0 {
+					t.Errorf("expected no commands for rejected ref, got %v", runner.commands)
+				}
+				return
+			}
+			if !reflect.DeepEqual(runner.commands, []string{tt.want}) {
+				t.Errorf("commands = %q, want %q", runner.commands, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNixEnvOutPaths(t *testing.T) {
+	output := "vscode-1.85.0  /nix/store/abc123-vscode-1.85.0\n" +
+		"jetbrains-toolbox-2.1  bin=/nix/store/def456-toolbox-bin;out=/nix/store/def456-toolbox\n"
+
+	want := []string{"/nix/store/abc123-vscode-1.85.0", "/nix/store/def456-toolbox-bin", "/nix/store/def456-toolbox"}
+	if got := parseNixEnvOutPaths([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNixEnvOutPaths() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package packages
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+/*
+Conflict is a set of packages that cannot be installed together, usually because
+they provide the same commands, and why.
+*/
+type Conflict struct {
+	Packages []string `yaml:"packages" json:"packages"`
+	Reason   string   `yaml:"reason" json:"reason"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s", strings.Join(c.Packages, ", "), c.Reason)
+}
+
+/*
+knownConflicts lists nixpkgs attributes that provide the same commands under
+different names, keyed by what they provide. Attributes are matched after
+versioned entries (nodejs@20) are turned into their attribute (nodejs_20).
+*/
+var knownConflicts = []struct {
+	provides   string
+	attributes []string
+}{
+	{provides: "java and javac", attributes: []string{"jdk", "jdk8", "jdk11", "jdk17", "jdk21", "openjdk", "openjdk8", "openjdk11", "openjdk17", "openjdk21", "temurin-bin", "zulu"}},
+	{provides: "cc", attributes: []string{"gcc", "clang"}},
+	{provides: "python3", attributes: []string{"python3", "python310", "python311", "python312", "python313"}},
+	{provides: "vim and vi", attributes: []string{"vim", "vim-full"}},
+	{provides: "docker", attributes: []string{"docker", "podman-docker"}},
+}
+
+/*
+versionSuffixPattern matches the version suffix of versioned attributes, such as
+_20 in nodejs_20 or _1_22 in go_1_22.
+*/
+var versionSuffixPattern = regexp.MustCompile(`(_[0-9]+)+$`)
+
+/*
+DetectConflicts returns the conflicts among pkgs, the packages of a
+configuration. Conflicts come from a table of known conflicts and from
+installing versions of the same package side by side (nodejs with nodejs_20,
+or go_1_21 with go_1_22), which provide the same commands. Each conflict lists
+its packages as they are written in pkgs.
+*/
+func DetectConflicts(pkgs []string) ([]Conflict, error) {
+	byAttribute := make(map[string]string)
+	for _, pkg := range pkgs {
+		if specErr := schema.ValidatePackageSpec(pkg); specErr != nil {
+			return nil, specErr
+		}
+		byAttribute[schema.PackageAttribute(pkg)] = pkg
+	}
+
+	var conflicts []Conflict
+	conflicting := make(map[string]bool)
+	for _, known := range knownConflicts {
+		var found []string
+		for _, attribute := range known.attributes {
+			if pkg, ok := byAttribute[attribute]; ok {
+				found = append(found, pkg)
+			}
+		}
+		if len(found) > 1 {
+			conflicts = append(conflicts, Conflict{Packages: found, Reason: "all provide " + known.provides})
+			for _, pkg := range found {
+				conflicting[pkg] = true
+			}
+		}
+	}
+
+	families := make(map[string][]string)
+	for attribute, pkg := range byAttribute {
+		if conflicting[pkg] {
+			continue
+		}
+		base := versionSuffixPattern.ReplaceAllString(attribute, "")
+		families[base] = append(families[base], pkg)
+	}
+	var bases []string
+	for base, members := range families {
+		if len(members) > 1 {
+			bases = append(bases, base)
+		}
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		members := families[base]
+		sort.Strings(members)
+		conflicts = append(conflicts, Conflict{Packages: members, Reason: "different versions of " + base + " provide the same commands"})
+	}
+
+	return conflicts, nil
+}
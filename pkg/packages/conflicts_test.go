@@ -0,0 +1,34 @@
+package packages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		pkgs []string
+		want [][]string
+	}{
+		{name: "known conflict", pkgs: []string{"git", "openjdk17", "jdk21"}, want: [][]string{{"jdk21", "openjdk17"}}},
+		{name: "versions of one package", pkgs: []string{"nodejs", "nodejs@20", "go_1_22"}, want: [][]string{{"nodejs", "nodejs@20"}}},
+		{name: "no conflicts", pkgs: []string{"gcc", "gnumake", "nodejs@20", "python3", "jetbrains.goland"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts, err := DetectConflicts(tt.pkgs)
+			if err != nil {
+				t.Fatalf("DetectConflicts() error = %v", err)
+			}
+			var got [][]string
+			for _, conflict := range conflicts {
+				got = append(got, conflict.Packages)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectConflicts(%v) = %v, want %v", tt.pkgs, got, tt.want)
+			}
+		})
+	}
+}
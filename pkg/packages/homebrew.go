@@ -0,0 +1,115 @@
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+)
+
+/*
+Homebrew installs, removes, and lists Homebrew formulae and casks on macOS.
+*/
+type Homebrew struct {
+	runner cmdexec.Runner
+}
+
+/*
+NewHomebrew returns a Homebrew manager that runs brew with runner.
+*/
+func NewHomebrew(runner cmdexec.Runner) *Homebrew {
+	return &Homebrew{runner: runner}
+}
+
+/*
+Available reports whether brew can be run.
+*/
+func (h *Homebrew) Available() bool {
+	_, err := h.runner.Output("brew", "--version")
+	return err == nil
+}
+
+/*
+ListInstalled returns the formulae installed on request and the installed casks,
+as reported by brew info --json=v2 --installed. Formulae only installed as
+dependencies of other formulae are left out so they are never removed directly.
+*/
+func (h *Homebrew) ListInstalled() (formulae, casks []string, err error) {
+	output, outputErr := h.runner.Output("brew", "info", "--json=v2", "--installed")
+	if outputErr != nil {
+		return nil, nil, fmt.Errorf("failed to query installed Homebrew packages: %w", outputErr)
+	}
+	return parseHomebrewJSON(output)
+}
+
+/*
+InstallFormula installs a formula with brew install.
+*/
+func (h *Homebrew) InstallFormula(name string) error {
+	return h.runner.Run("brew", "install", name)
+}
+
+/*
+InstallCask installs a cask with brew install --cask.
+*/
+func (h *Homebrew) InstallCask(name string) error {
+	return h.runner.Run("brew", "install", "--cask", name)
+}
+
+/*
+RemoveFormula uninstalls a formula with brew uninstall.
+*/
+func (h *Homebrew) RemoveFormula(name string) error {
+	return h.runner.Run("brew", "uninstall", name)
+}
+
+/*
+RemoveCask uninstalls a cask with brew uninstall --cask.
+*/
+func (h *Homebrew) RemoveCask(name string) error {
+	return h.runner.Run("brew", "uninstall", "--cask", name)
+}
+
+/*
+homebrewInfo is the document printed by brew info --json=v2.
+*/
+type homebrewInfo struct {
+	Formulae []struct {
+		FullName  string `json:"full_name"`
+		Installed []struct {
+			InstalledOnRequest bool `json:"installed_on_request"`
+		} `json:"installed"`
+	} `json:"formulae"`
+	Casks []struct {
+		FullToken string `json:"full_token"`
+	} `json:"casks"`
+}
+
+/*
+parseHomebrewJSON extracts the formulae installed on request and the casks from
+brew info --json=v2 output. Formulae from third-party taps are reported with the
+tap prefix, matching how they are written in the config.
+*/
+func parseHomebrewJSON(output []byte) (formulae, casks []string, err error) {
+	var info homebrewInfo
+	if jsonErr := json.Unmarshal(output, &info); jsonErr != nil {
+		return nil, nil, fmt.Errorf("failed to parse Homebrew JSON: %w", jsonErr)
+	}
+
+	for _, formula := range info.Formulae {
+		for _, installed := range formula.Installed {
+			if installed.InstalledOnRequest {
+				formulae = append(formulae, formula.FullName)
+				break
+			}
+		}
+	}
+	for _, cask := range info.Casks {
+		casks = append(casks, cask.FullToken)
+	}
+	sort.Strings(formulae)
+	sort.Strings(casks)
+
+	return formulae, casks, nil
+}
@@ -0,0 +1,56 @@
+package packages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHomebrewJSON(t *testing.T) {
+	output := `{
+		"formulae": [
+			{"full_name": "wget", "installed": [{"installed_on_request": true}]},
+			{"full_name": "hashicorp/tap/terraform", "installed": [{"installed_on_request": true}]},
+			{"full_name": "openssl@3", "installed": [{"installed_on_request": false}]}
+		],
+		"casks": [{"full_token": "slack"}, {"full_token": "firefox"}]
+	}`
+
+	formulae, casks, err := parseHomebrewJSON([]byte(output))
+	if err != nil {
+		t.Fatalf("parseHomebrewJSON() error = %v", err)
+	}
+	if want := []string{"hashicorp/tap/terraform", "wget"}; !reflect.DeepEqual(formulae, want) {
+		t.Errorf("formulae = %v, want %v", formulae, want)
+	}
+	if want := []string{"firefox", "slack"}; !reflect.DeepEqual(casks, want) {
+		t.Errorf("casks = %v, want %v", casks, want)
+	}
+
+	if _, _, err := parseHomebrewJSON([]byte("not json")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestHomebrewCommands(t *testing.T) {
+	runner := &fakeRunner{}
+	brew := NewHomebrew(runner)
+
+	_ = brew.InstallFormula("jq")
+	_ = brew.InstallCask("firefox")
+	_ = brew.RemoveFormula("wget")
+	_ = brew.RemoveCask("slack")
+
+	want := []string{
+		"brew install jq",
+		"brew install --cask firefox",
+		"brew uninstall wget",
+		"brew uninstall --cask slack",
+	}
+	if !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("commands = %v, want %v", runner.commands, want)
+	}
+
+	if brew.Available() {
+		t.Error("Available() = true when brew cannot be run")
+	}
+}
@@ -6,8 +6,10 @@ package packages
 
 import (
 	"fmt"
-	"os/exec"
+	"io"
+	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
 	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 )
@@ -19,8 +21,10 @@ using the Nix package manager.
 */
 type Manager struct {
 	fs     filesystem.FileSystem
+	runner cmdexec.Runner
 	isWSL  bool
 	groups map[string][]string
+	now    func() time.Time
 }
 
 /*
@@ -29,22 +33,34 @@ NewManager creates a new package manager instance with the provided filesystem.
 func NewManager(fs filesystem.FileSystem) *Manager {
 	return &Manager{
 		fs:     fs,
+		runner: cmdexec.NewOSRunner(),
 		isWSL:  platform.IsWSL(),
 		groups: make(map[string][]string),
+		now:    time.Now,
 	}
 }
 
+/*
+NewManagerWithRunner creates a package manager instance that runs commands
+through the provided runner.
+*/
+func NewManagerWithRunner(fs filesystem.FileSystem, runner cmdexec.Runner) *Manager {
+	manager := NewManager(fs)
+	manager.runner = runner
+	return manager
+}
+
 /*
 InstallPackage installs a package using nix-env.
 */
 func (m *Manager) InstallPackage(pkg string) error {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
+	err := cmdexec.WithOutput(m.runner, io.Discard).Run("bash", "-c", fmt.Sprintf(
 		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
 			"NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 "+
 			"/nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
 		pkg))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to install package %s: %s: %w", pkg, output, err)
+	if err != nil {
+		return fmt.Errorf("failed to install package %s: %w", pkg, err)
 	}
 	return nil
 }
@@ -53,12 +69,12 @@ func (m *Manager) InstallPackage(pkg string) error {
 RemovePackage removes a package using nix-env.
 */
 func (m *Manager) RemovePackage(pkg string) error {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
+	err := cmdexec.WithOutput(m.runner, io.Discard).Run("bash", "-c", fmt.Sprintf(
 		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
 			"/nix/var/nix/profiles/default/bin/nix-env -e %s",
 		pkg))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to remove package %s: %s: %w", pkg, output, err)
+	if err != nil {
+		return fmt.Errorf("failed to remove package %s: %w", pkg, err)
 	}
 	return nil
 }
@@ -67,32 +83,15 @@ func (m *Manager) RemovePackage(pkg string) error {
 ListInstalledPackages returns a list of installed packages.
 */
 func (m *Manager) ListInstalledPackages() ([]string, error) {
-	cmd := exec.Command("bash", "-c",
+	output, err := m.runner.Output("bash", "-c",
 		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
 			"/nix/var/nix/profiles/default/bin/nix-env -q")
-	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list packages: %w", err)
 	}
 	return []string{string(output)}, nil
 }
 
-/*
-SearchPackages searches for available packages matching the query.
-Returns a map of package names to their descriptions.
-*/
-func (m *Manager) SearchPackages(query string) (map[string]string, error) {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
-		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
-			"/nix/var/nix/profiles/default/bin/nix-env -qaP '*%s*'",
-		query))
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to search packages: %w", err)
-	}
-	return map[string]string{string(output): ""}, nil
-}
-
 /*
 GetPackageName returns the platform-specific package name for a given package.
 For language packages, it returns both the language and its essential tools.
@@ -136,25 +135,30 @@ func (m *Manager) GetDefaultPackages() []string {
 ValidatePackage checks if a package is valid for the current platform.
 */
 func (m *Manager) ValidatePackage(pkg string) error {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf(
+	err := cmdexec.WithOutput(m.runner, io.Discard).Run("bash", "-c", fmt.Sprintf(
 		". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
 			"/nix/var/nix/profiles/default/bin/nix-env -qaP '^%s$'",
 		pkg))
-	if err := cmd.Run(); err != nil {
+	if err != nil {
 		return fmt.Errorf("package %s not found", pkg)
 	}
 	return nil
 }
 
 /*
-GetPackageGroups returns predefined groups of packages for common use cases.
+GetPackageGroups returns the packages of the bundled presets by preset name.
 */
 func (m *Manager) GetPackageGroups() map[string][]string {
-	return map[string][]string{
-		"development": {"git", "make", "gcc"},
-		"web":         {"nodejs", "yarn", "nginx"},
-		"data":        {"postgresql", "redis", "mongodb"},
+	presets, presetsErr := Presets()
+	if presetsErr != nil {
+		return map[string][]string{}
+	}
+
+	groups := make(map[string][]string, len(presets))
+	for _, preset := range presets {
+		groups[preset.Name] = preset.Packages
 	}
+	return groups
 }
 
 /*
@@ -0,0 +1,61 @@
+package packages
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed presets.yaml
+var presetsYAML []byte
+
+/*
+Preset is a bundled package group for a common use case, such as web
+development, that can be added to a configuration in one step.
+*/
+type Preset struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Packages    []string `yaml:"packages" json:"packages"`
+}
+
+/*
+Presets returns the bundled package group presets, sorted by name.
+*/
+func Presets() ([]Preset, error) {
+	registry := map[string]Preset{}
+	if unmarshalErr := yaml.Unmarshal(presetsYAML, &registry); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse package presets: %w", unmarshalErr)
+	}
+
+	presets := make([]Preset, 0, len(registry))
+	for name, preset := range registry {
+		preset.Name = name
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+/*
+LookupPreset returns the preset with the given name, or an error listing the
+available presets.
+*/
+func LookupPreset(name string) (*Preset, error) {
+	presets, presetsErr := Presets()
+	if presetsErr != nil {
+		return nil, presetsErr
+	}
+
+	names := make([]string, 0, len(presets))
+	for idx := range presets {
+		if presets[idx].Name == name {
+			return &presets[idx], nil
+		}
+		names = append(names, presets[idx].Name)
+	}
+	return nil, fmt.Errorf("unknown package group %q (available: %s)", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,42 @@
+package packages
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func TestPresets(t *testing.T) {
+	presets, err := Presets()
+	if err != nil {
+		t.Fatalf("Presets() error = %v", err)
+	}
+	for idx, preset := range presets {
+		if idx > 0 && presets[idx-1].Name >= preset.Name {
+			t.Errorf("presets are not sorted by name: %s before %s", presets[idx-1].Name, preset.Name)
+		}
+		if preset.Description == "" || len(preset.Packages) == 0 {
+			t.Errorf("preset %s has no description or packages", preset.Name)
+		}
+		for _, pkg := range preset.Packages {
+			if specErr := schema.ValidatePackageSpec(pkg); specErr != nil {
+				t.Errorf("preset %s: %v", preset.Name, specErr)
+			}
+		}
+	}
+}
+
+func TestLookupPreset(t *testing.T) {
+	preset, err := LookupPreset("web")
+	if err != nil {
+		t.Fatalf("LookupPreset(web) error = %v", err)
+	}
+	if !reflect.DeepEqual(preset.Packages, []string{"nodejs", "yarn", "pnpm"}) {
+		t.Errorf("web packages = %v", preset.Packages)
+	}
+
+	if _, err := LookupPreset("gamedev"); err == nil {
+		t.Error("LookupPreset(gamedev) error = nil, want an unknown group error")
+	}
+}
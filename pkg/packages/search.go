@@ -0,0 +1,164 @@
+package packages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+)
+
+/*
+searchCacheTTL is how long nix search results are reused before the evaluator is
+queried again.
+*/
+const searchCacheTTL = 15 * time.Minute
+
+/*
+PackageResult is a single package returned by a nixpkgs search.
+Name is the nixpkgs attribute path usable in the configuration (e.g. "jetbrains.webstorm").
+*/
+type PackageResult struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+/*
+searchCacheEntry is the on-disk representation of cached search results.
+*/
+type searchCacheEntry struct {
+	Query     string          `json:"query"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Results   []PackageResult `json:"results"`
+}
+
+/*
+Search looks up packages in nixpkgs matching query using nix search.
+Results are cached under the nix-foundry cache directory for a short time so
+repeated searches do not re-evaluate nixpkgs.
+*/
+func (m *Manager) Search(query string) ([]PackageResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+
+	cacheFile, cacheErr := searchCacheFile(query)
+	if cacheErr == nil {
+		if results, ok := m.loadSearchCache(cacheFile, query); ok {
+			return results, nil
+		}
+	}
+
+	output, err := m.runner.Output("bash", nixShellCommand(fmt.Sprintf(
+		"%s/nix --extra-experimental-features 'nix-command flakes' search nixpkgs '%s' --json",
+		nixBinDir, strings.ReplaceAll(query, "'", `'\''`)))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search packages: %w", err)
+	}
+
+	results, parseErr := parseSearchJSON(output)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	if cacheErr == nil {
+		m.saveSearchCache(cacheFile, query, results)
+	}
+
+	return results, nil
+}
+
+/*
+parseSearchJSON converts nix search --json output into package results sorted by name.
+The flake output prefix (legacyPackages.<system>.) is stripped from attribute paths.
+*/
+func parseSearchJSON(output []byte) ([]PackageResult, error) {
+	var raw map[string]struct {
+		Pname       string `json:"pname"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	}
+	if jsonErr := json.Unmarshal(output, &raw); jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse search results: %w", jsonErr)
+	}
+
+	results := make([]PackageResult, 0, len(raw))
+	for attrPath, pkg := range raw {
+		name := attrPath
+		if parts := strings.SplitN(attrPath, ".", 3); len(parts) == 3 && parts[0] == "legacyPackages" {
+			name = parts[2]
+		}
+		results = append(results, PackageResult{
+			Name:        name,
+			Version:     pkg.Version,
+			Description: pkg.Description,
+		})
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Name < results[b].Name
+	})
+
+	return results, nil
+}
+
+/*
+searchCacheFile returns the cache file used for query.
+*/
+func searchCacheFile(query string) (string, error) {
+	cacheDir, err := paths.CacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(query))
+	return filepath.Join(cacheDir, "search", hex.EncodeToString(hash[:8])+".json"), nil
+}
+
+/*
+loadSearchCache returns cached results for query if they exist and have not expired.
+*/
+func (m *Manager) loadSearchCache(cacheFile, query string) ([]PackageResult, bool) {
+	content, readErr := m.fs.ReadFile(cacheFile)
+	if readErr != nil {
+		return nil, false
+	}
+
+	var entry searchCacheEntry
+	if jsonErr := json.Unmarshal(content, &entry); jsonErr != nil {
+		return nil, false
+	}
+
+	if entry.Query != query || m.now().Sub(entry.CreatedAt) > searchCacheTTL {
+		return nil, false
+	}
+
+	return entry.Results, true
+}
+
+/*
+saveSearchCache stores results for query. Failures are ignored since the cache is
+only an optimization.
+*/
+func (m *Manager) saveSearchCache(cacheFile, query string, results []PackageResult) {
+	content, marshalErr := json.Marshal(searchCacheEntry{
+		Query:     query,
+		CreatedAt: m.now(),
+		Results:   results,
+	})
+	if marshalErr != nil {
+		return
+	}
+
+	if mkdirErr := m.fs.MkdirAll(filepath.Dir(cacheFile), 0755); mkdirErr != nil {
+		return
+	}
+	_ = m.fs.WriteFile(cacheFile, content, 0644)
+}
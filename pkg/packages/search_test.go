@@ -0,0 +1,76 @@
+package packages
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+func TestSearchParsesResults(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	results, err := parseSearchJSON(fixture)
+	if err != nil {
+		t.Fatalf("parseSearchJSON() error = %v", err)
+	}
+
+	want := []PackageResult{
+		{Name: "ripgrep", Version: "14.1.0", Description: "Utility that combines the usability of The Silver Searcher with the raw speed of grep"},
+		{Name: "ripgrep-all", Version: "0.10.6", Description: "Ripgrep, but also search in PDFs, E-Books, Office documents, zip, tar.gz, and more"},
+		{Name: "vimPlugins.vim-ripgrep", Version: "2021-11-30", Description: ""},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("parseSearchJSON() = %+v, want %+v", results, want)
+	}
+}
+
+func TestSearchCachesResults(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+
+	fixture, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	runner := &fakeRunner{output: string(fixture)}
+	manager := &Manager{
+		fs:     filesystem.NewMemFS(),
+		runner: runner,
+		now:    func() time.Time { return now },
+	}
+
+	search := func() {
+		t.Helper()
+		results, searchErr := manager.Search("ripgrep")
+		if searchErr != nil {
+			t.Fatalf("Search() error = %v", searchErr)
+		}
+		if len(results) != 3 {
+			t.Fatalf("Search() returned %d results, want 3", len(results))
+		}
+	}
+
+	search()
+	if len(runner.commands) != 1 {
+		t.Fatalf("expected nix search to run on cache miss, ran %d times", len(runner.commands))
+	}
+
+	now = now.Add(searchCacheTTL / 2)
+	search()
+	if len(runner.commands) != 1 {
+		t.Errorf("expected cached results within TTL, nix search ran %d times", len(runner.commands))
+	}
+
+	now = now.Add(searchCacheTTL)
+	search()
+	if len(runner.commands) != 2 {
+		t.Errorf("expected nix search to run after TTL expiry, ran %d times", len(runner.commands))
+	}
+}
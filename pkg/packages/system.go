@@ -0,0 +1,116 @@
+package packages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+)
+
+/*
+SystemManager checks and installs packages with a Linux system package manager
+(apt, dnf) or flatpak. Installing needs root, so the manager only builds the
+install command; the caller decides whether to run it.
+*/
+type SystemManager struct {
+	backend string
+	runner  cmdexec.Runner
+}
+
+/*
+NewSystemManager returns the manager for the systemPackages.backend setting.
+*/
+func NewSystemManager(backend string, runner cmdexec.Runner) (*SystemManager, error) {
+	switch backend {
+	case "apt", "dnf", "flatpak":
+		return &SystemManager{backend: backend, runner: runner}, nil
+	default:
+		return nil, fmt.Errorf("unsupported system package backend: %s (expected apt, dnf, or flatpak)", backend)
+	}
+}
+
+/*
+Backend returns the name of the package manager.
+*/
+func (m *SystemManager) Backend() string {
+	return m.backend
+}
+
+/*
+Available reports whether the backend's package manager (apt-get, dnf, or
+flatpak) is installed, i.e. whether this is a distribution the backend applies to.
+*/
+func (m *SystemManager) Available() bool {
+	_, err := m.runner.Output(m.InstallCommand(nil)[1], "--version")
+	return err == nil
+}
+
+/*
+queryCommand returns the command listing the installed packages, one per line.
+*/
+func (m *SystemManager) queryCommand() []string {
+	switch m.backend {
+	case "apt":
+		return []string{"dpkg-query", "-W", "-f=${Package} ${db:Status-Status}\n"}
+	case "dnf":
+		return []string{"rpm", "-qa", "--qf", "%{NAME}\n"}
+	default:
+		return []string{"flatpak", "list", "--app", "--columns=application"}
+	}
+}
+
+/*
+Missing returns the packages in pkgs that are not installed, in order.
+*/
+func (m *SystemManager) Missing(pkgs []string) ([]string, error) {
+	command := m.queryCommand()
+	output, err := m.runner.Output(command[0], command[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed %s packages: %w", m.backend, err)
+	}
+
+	installed := parseSystemPackages(m.backend, output)
+	var missing []string
+	for _, pkg := range pkgs {
+		if !installed[pkg] {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing, nil
+}
+
+/*
+InstallCommand returns the privileged command that installs pkgs.
+*/
+func (m *SystemManager) InstallCommand(pkgs []string) []string {
+	var command []string
+	switch m.backend {
+	case "apt":
+		command = []string{"sudo", "apt-get", "install", "-y"}
+	case "dnf":
+		command = []string{"sudo", "dnf", "install", "-y"}
+	default:
+		command = []string{"sudo", "flatpak", "install", "-y", "--system", "flathub"}
+	}
+	return append(command, pkgs...)
+}
+
+/*
+parseSystemPackages returns the set of installed package names in the output of
+the backend's query command. dpkg-query also lists removed packages whose
+configuration files remain, so only those with the installed status are kept.
+*/
+func parseSystemPackages(backend string, output []byte) map[string]bool {
+	installed := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if backend == "apt" && (len(fields) < 2 || fields[1] != "installed") {
+			continue
+		}
+		installed[fields[0]] = true
+	}
+	return installed
+}
@@ -0,0 +1,73 @@
+package packages
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSystemManagerMissing(t *testing.T) {
+	tests := []struct {
+		backend   string
+		output    string
+		wantQuery string
+	}{
+		{
+			backend:   "apt",
+			output:    "openvpn installed\nlibnss3-tools config-files\ncurl installed\n",
+			wantQuery: "dpkg-query -W",
+		},
+		{
+			backend:   "dnf",
+			output:    "openvpn\ncurl\n",
+			wantQuery: "rpm -qa",
+		},
+		{
+			backend:   "flatpak",
+			output:    "openvpn\ncurl\n",
+			wantQuery: "flatpak list --app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			runner := &fakeRunner{output: tt.output}
+			manager, err := NewSystemManager(tt.backend, runner)
+			if err != nil {
+				t.Fatalf("NewSystemManager() error = %v", err)
+			}
+
+			missing, err := manager.Missing([]string{"openvpn", "libnss3-tools"})
+			if err != nil {
+				t.Fatalf("Missing() error = %v", err)
+			}
+			if want := []string{"libnss3-tools"}; !reflect.DeepEqual(missing, want) {
+				t.Errorf("Missing() = %v, want %v", missing, want)
+			}
+			if !strings.HasPrefix(runner.commands[0], tt.wantQuery) {
+				t.Errorf("query = %q, want prefix %q", runner.commands[0], tt.wantQuery)
+			}
+		})
+	}
+
+	if _, err := NewSystemManager("pacman", &fakeRunner{}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestSystemManagerInstallCommand(t *testing.T) {
+	tests := map[string]string{
+		"apt":     "sudo apt-get install -y openvpn",
+		"dnf":     "sudo dnf install -y openvpn",
+		"flatpak": "sudo flatpak install -y --system flathub openvpn",
+	}
+	for backend, want := range tests {
+		manager, err := NewSystemManager(backend, &fakeRunner{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(manager.InstallCommand([]string{"openvpn"}), " "); got != want {
+			t.Errorf("%s InstallCommand() = %q, want %q", backend, got, want)
+		}
+	}
+}
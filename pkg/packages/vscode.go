@@ -0,0 +1,64 @@
+package packages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+)
+
+/*
+VSCode installs, removes, and lists Visual Studio Code extensions with the code
+command line interface.
+*/
+type VSCode struct {
+	runner cmdexec.Runner
+}
+
+/*
+NewVSCode returns a VS Code extension manager that runs code with runner.
+*/
+func NewVSCode(runner cmdexec.Runner) *VSCode {
+	return &VSCode{runner: runner}
+}
+
+/*
+Available reports whether code can be run.
+*/
+func (v *VSCode) Available() bool {
+	_, err := v.runner.Output("code", "--version")
+	return err == nil
+}
+
+/*
+ListExtensions returns the identifiers of the installed extensions, as reported
+by code --list-extensions.
+*/
+func (v *VSCode) ListExtensions() ([]string, error) {
+	output, outputErr := v.runner.Output("code", "--list-extensions")
+	if outputErr != nil {
+		return nil, fmt.Errorf("failed to list VS Code extensions: %w", outputErr)
+	}
+
+	var extensions []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if extension := strings.TrimSpace(line); extension != "" {
+			extensions = append(extensions, extension)
+		}
+	}
+	return extensions, nil
+}
+
+/*
+InstallExtension installs an extension with code --install-extension.
+*/
+func (v *VSCode) InstallExtension(id string) error {
+	return v.runner.Run("code", "--install-extension", id)
+}
+
+/*
+UninstallExtension removes an extension with code --uninstall-extension.
+*/
+func (v *VSCode) UninstallExtension(id string) error {
+	return v.runner.Run("code", "--uninstall-extension", id)
+}
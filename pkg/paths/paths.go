@@ -0,0 +1,179 @@
+/*
+Package paths decides where Nix Foundry keeps its files. Configuration, caches
+and state live in separate directories following the XDG Base Directory
+specification, with the usual Library locations as defaults on macOS.
+*/
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+)
+
+/*
+ConfigDirEnv names the environment variable that relocates the configuration
+directory. When it is set, caches and state are kept in that directory too.
+*/
+const ConfigDirEnv = "NIX_FOUNDRY_CONFIG_DIR"
+
+const appName = "nix-foundry"
+
+/*
+Resolver resolves the directories of a user. Getenv looks up environment
+variables and GOOS selects the platform defaults; NewResolver fills them from the
+running process.
+*/
+type Resolver struct {
+	Home   string
+	GOOS   string
+	Getenv func(string) string
+}
+
+/*
+NewResolver returns a resolver for the user running nix-foundry, even under sudo.
+*/
+func NewResolver() (*Resolver, error) {
+	homeDir, err := platform.GetRealUserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return &Resolver{Home: homeDir, GOOS: runtime.GOOS, Getenv: os.Getenv}, nil
+}
+
+/*
+ConfigDir returns the directory holding the user and team configurations:
+NIX_FOUNDRY_CONFIG_DIR, $XDG_CONFIG_HOME/nix-foundry, or ~/.config/nix-foundry.
+*/
+func (r *Resolver) ConfigDir() string {
+	if configDir := r.Getenv(ConfigDirEnv); configDir != "" {
+		return filepath.Clean(configDir)
+	}
+	return r.xdgDir("XDG_CONFIG_HOME", filepath.Join(r.Home, ".config"))
+}
+
+/*
+CacheDir returns the directory for caches that can be deleted at any time:
+$XDG_CACHE_HOME/nix-foundry, ~/Library/Caches/nix-foundry on macOS, or
+~/.cache/nix-foundry.
+*/
+func (r *Resolver) CacheDir() string {
+	if configDir := r.Getenv(ConfigDirEnv); configDir != "" {
+		return filepath.Join(filepath.Clean(configDir), "cache")
+	}
+	if r.GOOS == "darwin" {
+		return r.xdgDir("XDG_CACHE_HOME", filepath.Join(r.Home, "Library", "Caches"))
+	}
+	return r.xdgDir("XDG_CACHE_HOME", filepath.Join(r.Home, ".cache"))
+}
+
+/*
+StateDir returns the directory for state that should survive between runs but is
+not configuration, such as logs and script hashes: $XDG_STATE_HOME/nix-foundry,
+~/Library/Application Support/nix-foundry on macOS, or ~/.local/state/nix-foundry.
+*/
+func (r *Resolver) StateDir() string {
+	if configDir := r.Getenv(ConfigDirEnv); configDir != "" {
+		return filepath.Clean(configDir)
+	}
+	if r.GOOS == "darwin" {
+		return r.xdgDir("XDG_STATE_HOME", filepath.Join(r.Home, "Library", "Application Support"))
+	}
+	return r.xdgDir("XDG_STATE_HOME", filepath.Join(r.Home, ".local", "state"))
+}
+
+/*
+xdgDir returns the nix-foundry directory under the base directory named by env,
+or under fallback when env is unset. Relative values are ignored, as the XDG
+specification requires.
+*/
+func (r *Resolver) xdgDir(env, fallback string) string {
+	if base := r.Getenv(env); filepath.IsAbs(base) {
+		return filepath.Join(base, appName)
+	}
+	return filepath.Join(fallback, appName)
+}
+
+/*
+legacyStateFiles are the files that earlier versions kept in the configuration
+directory and that now belong in the state directory.
+*/
+var legacyStateFiles = []string{"logs", "script-hashes.json", "active-profile", "last-update-check"}
+
+/*
+MigrateLegacyLayout moves state that earlier versions kept in the configuration
+directory to the state directory, and removes the old cache directory, which is
+rebuilt on demand. Files already present in the new location are left alone.
+Nothing is done when NIX_FOUNDRY_CONFIG_DIR keeps everything in one directory.
+*/
+func (r *Resolver) MigrateLegacyLayout() error {
+	configDir := r.ConfigDir()
+	stateDir := r.StateDir()
+	if stateDir == configDir {
+		return nil
+	}
+
+	var errs []error
+	for _, name := range legacyStateFiles {
+		oldPath := filepath.Join(configDir, name)
+		newPath := filepath.Join(stateDir, name)
+		if _, statErr := os.Lstat(oldPath); statErr != nil {
+			continue
+		}
+		if _, statErr := os.Lstat(newPath); statErr == nil {
+			continue
+		}
+		if mkdirErr := os.MkdirAll(stateDir, 0755); mkdirErr != nil {
+			errs = append(errs, fmt.Errorf("failed to create %s: %w", stateDir, mkdirErr))
+			break
+		}
+		if renameErr := os.Rename(oldPath, newPath); renameErr != nil {
+			errs = append(errs, fmt.Errorf("failed to move %s to %s: %w", oldPath, newPath, renameErr))
+		}
+	}
+
+	if oldCache := filepath.Join(configDir, "cache"); oldCache != r.CacheDir() {
+		if removeErr := os.RemoveAll(oldCache); removeErr != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", oldCache, removeErr))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+ConfigDir returns the configuration directory of the user running nix-foundry.
+*/
+func ConfigDir() (string, error) {
+	resolver, err := NewResolver()
+	if err != nil {
+		return "", err
+	}
+	return resolver.ConfigDir(), nil
+}
+
+/*
+CacheDir returns the cache directory of the user running nix-foundry.
+*/
+func CacheDir() (string, error) {
+	resolver, err := NewResolver()
+	if err != nil {
+		return "", err
+	}
+	return resolver.CacheDir(), nil
+}
+
+/*
+StateDir returns the state directory of the user running nix-foundry.
+*/
+func StateDir() (string, error) {
+	resolver, err := NewResolver()
+	if err != nil {
+		return "", err
+	}
+	return resolver.StateDir(), nil
+}
@@ -0,0 +1,126 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestResolver(home, goos string, env map[string]string) *Resolver {
+	return &Resolver{Home: home, GOOS: goos, Getenv: func(name string) string { return env[name] }}
+}
+
+func TestResolver(t *testing.T) {
+	home := "/home/dev"
+
+	tests := []struct {
+		name                 string
+		goos                 string
+		env                  map[string]string
+		config, cache, state string
+	}{
+		{
+			name:   "linux defaults",
+			goos:   "linux",
+			config: "/home/dev/.config/nix-foundry",
+			cache:  "/home/dev/.cache/nix-foundry",
+			state:  "/home/dev/.local/state/nix-foundry",
+		},
+		{
+			name:   "macOS defaults",
+			goos:   "darwin",
+			config: "/home/dev/.config/nix-foundry",
+			cache:  "/home/dev/Library/Caches/nix-foundry",
+			state:  "/home/dev/Library/Application Support/nix-foundry",
+		},
+		{
+			name:   "XDG variables",
+			goos:   "darwin",
+			env:    map[string]string{"XDG_CONFIG_HOME": "/xdg/config", "XDG_CACHE_HOME": "/xdg/cache", "XDG_STATE_HOME": "/xdg/state"},
+			config: "/xdg/config/nix-foundry",
+			cache:  "/xdg/cache/nix-foundry",
+			state:  "/xdg/state/nix-foundry",
+		},
+		{
+			name:   "relative XDG variables are ignored",
+			goos:   "linux",
+			env:    map[string]string{"XDG_CONFIG_HOME": "config", "XDG_CACHE_HOME": "cache", "XDG_STATE_HOME": "state"},
+			config: "/home/dev/.config/nix-foundry",
+			cache:  "/home/dev/.cache/nix-foundry",
+			state:  "/home/dev/.local/state/nix-foundry",
+		},
+		{
+			name:   "NIX_FOUNDRY_CONFIG_DIR keeps everything together",
+			goos:   "linux",
+			env:    map[string]string{ConfigDirEnv: "/srv/foundry/", "XDG_CACHE_HOME": "/xdg/cache"},
+			config: "/srv/foundry",
+			cache:  "/srv/foundry/cache",
+			state:  "/srv/foundry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := newTestResolver(home, tt.goos, tt.env)
+			if got := resolver.ConfigDir(); got != tt.config {
+				t.Errorf("ConfigDir() = %q, want %q", got, tt.config)
+			}
+			if got := resolver.CacheDir(); got != tt.cache {
+				t.Errorf("CacheDir() = %q, want %q", got, tt.cache)
+			}
+			if got := resolver.StateDir(); got != tt.state {
+				t.Errorf("StateDir() = %q, want %q", got, tt.state)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyLayout(t *testing.T) {
+	home := t.TempDir()
+	resolver := newTestResolver(home, "linux", nil)
+	configDir := resolver.ConfigDir()
+	stateDir := resolver.StateDir()
+
+	writeFile(t, filepath.Join(configDir, "config.yaml"), "type: user\n")
+	writeFile(t, filepath.Join(configDir, "script-hashes.json"), `{"setup":"abc"}`)
+	writeFile(t, filepath.Join(configDir, "logs", "nix-foundry.log"), "{}\n")
+	writeFile(t, filepath.Join(configDir, "cache", "package-index.json"), "[]")
+	writeFile(t, filepath.Join(configDir, "active-profile"), "old\n")
+	writeFile(t, filepath.Join(stateDir, "active-profile"), "work\n")
+
+	if err := resolver.MigrateLegacyLayout(); err != nil {
+		t.Fatalf("MigrateLegacyLayout() error = %v", err)
+	}
+
+	for _, name := range []string{"script-hashes.json", filepath.Join("logs", "nix-foundry.log")} {
+		if _, err := os.Stat(filepath.Join(stateDir, name)); err != nil {
+			t.Errorf("%s was not moved to the state directory: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(configDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s is still in the config directory", name)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(stateDir, "active-profile")); string(content) != "work\n" {
+		t.Errorf("active-profile = %q, want the file already in the state directory kept", content)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "cache")); !os.IsNotExist(err) {
+		t.Error("the old cache directory was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "config.yaml")); err != nil {
+		t.Errorf("config.yaml was moved: %v", err)
+	}
+
+	if err := resolver.MigrateLegacyLayout(); err != nil {
+		t.Errorf("second MigrateLegacyLayout() error = %v, want nothing left to do", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
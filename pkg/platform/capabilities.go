@@ -0,0 +1,125 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+/*
+Capabilities describes what the current machine supports, as far as installing
+and running Nix is concerned.
+*/
+type Capabilities struct {
+	OS        Platform `json:"os"`
+	Arch      string   `json:"arch"`
+	NixSystem string   `json:"nixSystem"`
+	WSL       bool     `json:"wsl"`
+	// MultiUser reports whether a multi-user (daemon) Nix installation is possible.
+	MultiUser bool `json:"multiUser"`
+	// RequiresMultiUser reports whether Nix can only be installed in multi-user mode.
+	RequiresMultiUser bool `json:"requiresMultiUser"`
+	Homebrew          bool `json:"homebrew"`
+	// Reflink reports whether the Nix store, or the home directory before Nix is
+	// installed, is on a filesystem with copy-on-write clones (APFS or Btrfs).
+	Reflink bool `json:"reflink"`
+	Chsh    bool `json:"chsh"`
+}
+
+/*
+Service probes the capabilities of the machine it runs on.
+*/
+type Service struct {
+	goos     string
+	goarch   string
+	getenv   func(string) string
+	readFile func(string) ([]byte, error)
+	lookPath func(string) (string, error)
+	fsType   func(string) (string, error)
+	homeDir  func() (string, error)
+}
+
+/*
+NewService creates a platform service for the running process.
+*/
+func NewService() *Service {
+	return &Service{
+		goos:     runtime.GOOS,
+		goarch:   runtime.GOARCH,
+		getenv:   os.Getenv,
+		readFile: os.ReadFile,
+		lookPath: exec.LookPath,
+		fsType:   filesystemType,
+		homeDir:  GetRealUserHomeDir,
+	}
+}
+
+/*
+DetectCapabilities probes the capabilities of the running process.
+*/
+func DetectCapabilities() (*Capabilities, error) {
+	return NewService().Capabilities()
+}
+
+/*
+Capabilities probes the operating system, architecture, and the tools and
+filesystem features nix-foundry relies on. A tool that cannot be found or a
+filesystem that cannot be inspected is reported as unsupported rather than as an
+error.
+*/
+func (s *Service) Capabilities() (*Capabilities, error) {
+	caps := &Capabilities{
+		OS:        platformFor(s.goos),
+		Arch:      s.goarch,
+		NixSystem: NixSystem(s.goos, s.goarch),
+		WSL:       isWSL(s.goos, s.getenv, s.readFile),
+	}
+	caps.MultiUser = !caps.WSL && caps.OS != Windows
+	caps.RequiresMultiUser = caps.OS == MacOS
+
+	_, brewErr := s.lookPath("brew")
+	caps.Homebrew = brewErr == nil
+	_, chshErr := s.lookPath("chsh")
+	caps.Chsh = chshErr == nil
+
+	reflink, reflinkErr := s.supportsReflink()
+	if reflinkErr != nil {
+		return nil, reflinkErr
+	}
+	caps.Reflink = reflink
+
+	return caps, nil
+}
+
+/*
+supportsReflink reports whether the Nix store supports copy-on-write clones. When
+Nix is not installed yet, the home directory is checked instead.
+*/
+func (s *Service) supportsReflink() (bool, error) {
+	fsType, typeErr := s.fsType("/nix")
+	if typeErr != nil {
+		homeDir, homeErr := s.homeDir()
+		if homeErr != nil {
+			return false, fmt.Errorf("failed to get home directory: %w", homeErr)
+		}
+		if fsType, typeErr = s.fsType(homeDir); typeErr != nil {
+			return false, nil
+		}
+	}
+	return fsType == "apfs" || fsType == "btrfs", nil
+}
+
+/*
+platformFor returns the Platform for a runtime.GOOS value.
+*/
+func platformFor(goos string) Platform {
+	switch goos {
+	case "darwin":
+		return MacOS
+	case "windows":
+		return Windows
+	default:
+		return Linux
+	}
+}
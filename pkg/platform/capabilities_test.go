@@ -0,0 +1,119 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNixSystem(t *testing.T) {
+	tests := []struct {
+		goos   string
+		goarch string
+		want   string
+	}{
+		{goos: "darwin", goarch: "arm64", want: "aarch64-darwin"},
+		{goos: "darwin", goarch: "amd64", want: "x86_64-darwin"},
+		{goos: "linux", goarch: "arm64", want: "aarch64-linux"},
+		{goos: "linux", goarch: "amd64", want: "x86_64-linux"},
+		{goos: "windows", goarch: "arm64", want: "aarch64-linux"},
+	}
+
+	for _, tt := range tests {
+		if got := NixSystem(tt.goos, tt.goarch); got != tt.want {
+			t.Errorf("NixSystem(%q, %q) = %q, want %q", tt.goos, tt.goarch, got, tt.want)
+		}
+	}
+}
+
+func TestSupportedNixSystems(t *testing.T) {
+	want := []string{"x86_64-linux", "aarch64-linux", "x86_64-darwin", "aarch64-darwin"}
+	if !reflect.DeepEqual(SupportedNixSystems, want) {
+		t.Errorf("SupportedNixSystems = %v, want %v", SupportedNixSystems, want)
+	}
+	if err := ValidateNixSystem("i686-linux"); err == nil {
+		t.Error("ValidateNixSystem(\"i686-linux\") error = nil, want an unsupported system error")
+	}
+}
+
+/*
+fakeService returns a platform service for goos and goarch on which only the
+given tools exist and paths are on the given filesystems.
+*/
+func fakeService(goos, goarch string, env map[string]string, tools []string, filesystems map[string]string) *Service {
+	return &Service{
+		goos:     goos,
+		goarch:   goarch,
+		getenv:   func(key string) string { return env[key] },
+		readFile: func(string) ([]byte, error) { return nil, os.ErrNotExist },
+		lookPath: func(name string) (string, error) {
+			for _, tool := range tools {
+				if tool == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("executable file not found in $PATH")
+		},
+		fsType: func(path string) (string, error) {
+			if fsType, ok := filesystems[path]; ok {
+				return fsType, nil
+			}
+			return "", os.ErrNotExist
+		},
+		homeDir: func() (string, error) { return "/home/user", nil },
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		service *Service
+		want    Capabilities
+	}{
+		{
+			name:    "macOS with Homebrew and Nix on APFS",
+			service: fakeService("darwin", "arm64", nil, []string{"brew", "chsh"}, map[string]string{"/nix": "apfs"}),
+			want: Capabilities{
+				OS: MacOS, Arch: "arm64", NixSystem: "aarch64-darwin",
+				MultiUser: true, RequiresMultiUser: true, Homebrew: true, Reflink: true, Chsh: true,
+			},
+		},
+		{
+			name:    "Linux before Nix is installed checks the home directory",
+			service: fakeService("linux", "amd64", nil, []string{"chsh"}, map[string]string{"/home/user": "btrfs"}),
+			want: Capabilities{
+				OS: Linux, Arch: "amd64", NixSystem: "x86_64-linux",
+				MultiUser: true, Reflink: true, Chsh: true,
+			},
+		},
+		{
+			name:    "WSL without chsh",
+			service: fakeService("linux", "arm64", map[string]string{"WSL_DISTRO_NAME": "Ubuntu"}, nil, map[string]string{"/nix": "0xef53"}),
+			want: Capabilities{
+				OS: Linux, Arch: "arm64", NixSystem: "aarch64-linux", WSL: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.service.Capabilities()
+			if err != nil {
+				t.Fatalf("Capabilities() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Capabilities() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesWithoutHomeDir(t *testing.T) {
+	service := fakeService("linux", "amd64", nil, nil, nil)
+	service.homeDir = func() (string, error) { return "", errors.New("$HOME is not defined") }
+
+	if _, err := service.Capabilities(); err == nil {
+		t.Error("Capabilities() error = nil, want the home directory error")
+	}
+}
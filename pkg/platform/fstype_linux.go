@@ -0,0 +1,23 @@
+package platform
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const btrfsSuperMagic = 0x9123683e
+
+/*
+filesystemType returns "btrfs" for paths on Btrfs and the hexadecimal filesystem
+magic number otherwise.
+*/
+func filesystemType(path string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", err
+	}
+	if uint32(stat.Type) == btrfsSuperMagic {
+		return "btrfs", nil
+	}
+	return fmt.Sprintf("%#x", uint32(stat.Type)), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package platform
+
+import "errors"
+
+/*
+filesystemType is not supported on this platform.
+*/
+func filesystemType(string) (string, error) {
+	return "", errors.New("filesystem type detection is not supported on this platform")
+}
@@ -0,0 +1,53 @@
+package platform
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+/*
+ciEnvVars are set by CI services. CI is set by most of them, including GitHub
+Actions, GitLab CI, CircleCI, Travis CI and Buildkite; the others cover the
+services that do not set it.
+*/
+var ciEnvVars = []string{"CI", "GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "CIRCLECI", "JENKINS_URL", "TF_BUILD", "TEAMCITY_VERSION"}
+
+/*
+IsTerminal reports whether f is attached to a terminal.
+*/
+func IsTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+/*
+IsCI reports whether nix-foundry runs in a CI environment.
+*/
+func IsCI() bool {
+	return isCI(os.Getenv)
+}
+
+func isCI(getenv func(string) string) bool {
+	for _, name := range ciEnvVars {
+		switch getenv(name) {
+		case "", "0", "false", "False", "FALSE":
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+/*
+IsInteractive reports whether someone can answer prompts: stdin and stdout are
+terminals and nix-foundry is not running in CI, where a terminal may be
+allocated without anyone watching it. Commands that would prompt require flags
+that answer for the user when it returns false.
+*/
+func IsInteractive() bool {
+	return isInteractive(IsTerminal(os.Stdin), IsTerminal(os.Stdout), isCI(os.Getenv))
+}
+
+func isInteractive(stdinTerminal, stdoutTerminal, ci bool) bool {
+	return stdinTerminal && stdoutTerminal && !ci
+}
@@ -0,0 +1,39 @@
+package platform
+
+import "testing"
+
+func TestIsCI(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{name: "no CI variables", env: map[string]string{"HOME": "/home/user"}},
+		{name: "GitHub Actions", env: map[string]string{"CI": "true", "GITHUB_ACTIONS": "true"}, want: true},
+		{name: "Jenkins", env: map[string]string{"JENKINS_URL": "https://ci.example.com/"}, want: true},
+		{name: "CI disabled", env: map[string]string{"CI": "false"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCI(func(name string) string { return tt.env[name] }); got != tt.want {
+				t.Errorf("isCI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInteractive(t *testing.T) {
+	if !isInteractive(true, true, false) {
+		t.Error("isInteractive() = false for a terminal outside CI")
+	}
+	for _, tt := range []struct{ stdin, stdout, ci bool }{
+		{stdin: false, stdout: true},
+		{stdin: true, stdout: false},
+		{stdin: true, stdout: true, ci: true},
+	} {
+		if isInteractive(tt.stdin, tt.stdout, tt.ci) {
+			t.Errorf("isInteractive(%v, %v, %v) = true, want false", tt.stdin, tt.stdout, tt.ci)
+		}
+	}
+}
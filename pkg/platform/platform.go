@@ -5,10 +5,12 @@ It handles platform detection, path resolution, and system-specific configuratio
 package platform
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -27,16 +29,31 @@ const (
 	Windows Platform = "windows"
 )
 
+/*
+ErrNixRequiresWSL is returned when a Nix operation is attempted on native Windows.
+Nix only runs on Windows inside Windows Subsystem for Linux.
+*/
+var ErrNixRequiresWSL = errors.New("nix requires WSL on Windows; install a WSL distribution and run nix-foundry from inside it")
+
 /*
 IsWSL determines if the current environment is running under Windows Subsystem for Linux.
 It checks the system version information for Microsoft-specific identifiers.
+WSL is otherwise treated as a regular Linux platform.
 */
 func IsWSL() bool {
-	if runtime.GOOS != "linux" {
+	return isWSL(runtime.GOOS, os.Getenv, os.ReadFile)
+}
+
+func isWSL(goos string, getenv func(string) string, readFile func(string) ([]byte, error)) bool {
+	if goos != "linux" {
 		return false
 	}
 
-	data, err := os.ReadFile("/proc/version")
+	if getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+
+	data, err := readFile("/proc/version")
 	if err != nil {
 		return false
 	}
@@ -48,14 +65,26 @@ func IsWSL() bool {
 GetPlatform returns the current operating system platform.
 */
 func GetPlatform() Platform {
-	switch runtime.GOOS {
-	case "darwin":
-		return MacOS
-	case "windows":
-		return Windows
-	default:
-		return Linux
+	return platformFor(runtime.GOOS)
+}
+
+/*
+IsNativeWindows reports whether the process is running directly on Windows rather
+than inside WSL.
+*/
+func IsNativeWindows() bool {
+	return runtime.GOOS == "windows"
+}
+
+/*
+CheckNixSupported returns ErrNixRequiresWSL on native Windows, where Nix cannot be
+installed or run. It returns nil on every other platform, including WSL.
+*/
+func CheckNixSupported() error {
+	if IsNativeWindows() {
+		return ErrNixRequiresWSL
 	}
+	return nil
 }
 
 /*
@@ -73,9 +102,6 @@ func GetDefaultShell() string {
 		return "/bin/zsh"
 	}
 	if runtime.GOOS == "windows" {
-		if IsWSL() {
-			return "/bin/bash"
-		}
 		return "powershell.exe"
 	}
 	return "/bin/bash"
@@ -99,37 +125,55 @@ func GetHomeDir() (string, error) {
 }
 
 /*
-GetConfigDir returns the configuration directory for Nix Foundry.
+GetNixSystem returns the Nix system identifier for the current platform.
+It determines the appropriate system identifier based on the operating system
+and CPU architecture. WSL reports as Linux, and native Windows returns the Linux
+system of a WSL distribution on the same architecture, since that is where Nix runs.
 */
-func GetConfigDir() (string, error) {
-	homeDir, err := GetHomeDir()
-	if err != nil {
-		return "", err
-	}
+func GetNixSystem() string {
+	return NixSystem(runtime.GOOS, runtime.GOARCH)
+}
 
-	return filepath.Join(homeDir, ".config", "nix-foundry"), nil
+/*
+NixSystem returns the Nix system identifier for an operating system and CPU
+architecture as reported by runtime.GOOS and runtime.GOARCH.
+*/
+func NixSystem(goos, goarch string) string {
+	arch := "x86_64"
+	if goarch == "arm64" {
+		arch = "aarch64"
+	}
+	if goos == "darwin" {
+		return arch + "-darwin"
+	}
+	return arch + "-linux"
 }
 
 /*
-GetNixSystem returns the Nix system identifier for the current platform.
-It determines the appropriate system identifier based on the operating system
-and CPU architecture.
+SupportedNixSystems are the Nix systems nix-foundry runs on: Linux and macOS on
+x86_64 and aarch64. Windows is supported through WSL, which is Linux to Nix.
 */
-func GetNixSystem() string {
-	switch runtime.GOOS {
-	case "darwin":
-		if runtime.GOARCH == "arm64" {
-			return "aarch64-darwin"
-		}
-		return "x86_64-darwin"
-	case "linux":
-		if runtime.GOARCH == "arm64" {
-			return "aarch64-linux"
+var SupportedNixSystems = supportedNixSystems()
+
+func supportedNixSystems() []string {
+	var systems []string
+	for _, goos := range []string{"linux", "darwin"} {
+		for _, goarch := range []string{"amd64", "arm64"} {
+			systems = append(systems, NixSystem(goos, goarch))
 		}
-		return "x86_64-linux"
-	default:
-		return "x86_64-linux"
 	}
+	return systems
+}
+
+/*
+ValidateNixSystem returns an error listing the supported Nix systems if system is
+not one of them.
+*/
+func ValidateNixSystem(system string) error {
+	if !slices.Contains(SupportedNixSystems, system) {
+		return fmt.Errorf("unsupported system %q (valid options: %s)", system, strings.Join(SupportedNixSystems, ", "))
+	}
+	return nil
 }
 
 /*
@@ -159,7 +203,8 @@ func GetNixProfileDir() (string, error) {
 
 /*
 GetShellConfigFile returns the path to the configuration file for the specified shell.
-It uses the real user's home directory when running under sudo.
+It uses the real user's home directory when running under sudo. PowerShell profiles
+are supported for "powershell" (Windows PowerShell) and "pwsh" (PowerShell 7+).
 */
 func GetShellConfigFile(shell string) (string, error) {
 	homeDir, err := GetRealUserHomeDir()
@@ -167,19 +212,16 @@ func GetShellConfigFile(shell string) (string, error) {
 		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	var rcFile string
 	switch shell {
-	case "bash":
-		rcFile = filepath.Join(homeDir, ".bashrc")
-	case "zsh":
-		rcFile = filepath.Join(homeDir, ".zshrc")
-	case "fish":
-		rcFile = filepath.Join(homeDir, ".config", "fish", "config.fish")
-	default:
-		return "", fmt.Errorf("unsupported shell: %s", shell)
+	case "powershell":
+		return filepath.Join(homeDir, "Documents", "WindowsPowerShell", "Microsoft.PowerShell_profile.ps1"), nil
+	case "pwsh":
+		if runtime.GOOS == "windows" {
+			return filepath.Join(homeDir, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1"), nil
+		}
+		return filepath.Join(homeDir, ".config", "powershell", "Microsoft.PowerShell_profile.ps1"), nil
 	}
-
-	return rcFile, nil
+	return ShellConfigPath(homeDir, shell)
 }
 
 /*
@@ -0,0 +1,66 @@
+package platform
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/*
+SupportedShells are the shells nix-foundry can install and configure, by the name
+used for settings.shell and the shell's nixpkgs attribute.
+*/
+var SupportedShells = []string{"bash", "zsh", "fish", "nushell"}
+
+/*
+ValidateShell returns an error listing the supported shells if shell is not one
+of them.
+*/
+func ValidateShell(shell string) error {
+	if !slices.Contains(SupportedShells, shell) {
+		return fmt.Errorf("unsupported shell %q (valid options: %s)", shell, strings.Join(SupportedShells, ", "))
+	}
+	return nil
+}
+
+/*
+ShellName returns the shell name for the base name of a shell executable, such
+as the one in $SHELL. Nushell's executable is nu; every other executable is
+named after its shell.
+*/
+func ShellName(executable string) string {
+	if executable == "nu" {
+		return "nushell"
+	}
+	return executable
+}
+
+/*
+ShellExecutable returns the base name of the executable of shell.
+*/
+func ShellExecutable(shell string) string {
+	if shell == "nushell" {
+		return "nu"
+	}
+	return shell
+}
+
+/*
+ShellConfigPath returns the configuration file nix-foundry manages for shell in
+homeDir. Fish and nushell keep theirs in a directory under ~/.config that may
+not exist yet.
+*/
+func ShellConfigPath(homeDir, shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return filepath.Join(homeDir, ".bashrc"), nil
+	case "zsh":
+		return filepath.Join(homeDir, ".zshrc"), nil
+	case "fish":
+		return filepath.Join(homeDir, ".config", "fish", "config.fish"), nil
+	case "nushell":
+		return filepath.Join(homeDir, ".config", "nushell", "config.nu"), nil
+	}
+	return "", ValidateShell(shell)
+}
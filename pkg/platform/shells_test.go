@@ -0,0 +1,41 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellConfigPath(t *testing.T) {
+	tests := map[string]string{
+		"bash":    "/home/user/.bashrc",
+		"zsh":     "/home/user/.zshrc",
+		"fish":    "/home/user/.config/fish/config.fish",
+		"nushell": "/home/user/.config/nushell/config.nu",
+	}
+	for _, shell := range SupportedShells {
+		got, err := ShellConfigPath("/home/user", shell)
+		if err != nil || got != tests[shell] {
+			t.Errorf("ShellConfigPath(%s) = %q, %v; want %q", shell, got, err, tests[shell])
+		}
+	}
+
+	_, err := ShellConfigPath("/home/user", "tcsh")
+	if err == nil || err.Error() != ValidateShell("tcsh").Error() {
+		t.Fatalf("ShellConfigPath(tcsh) error = %v, want the ValidateShell error", err)
+	}
+	if !strings.Contains(err.Error(), "bash, zsh, fish, nushell") {
+		t.Errorf("error %q does not list the supported shells", err)
+	}
+}
+
+func TestShellNames(t *testing.T) {
+	if got := ShellName("nu"); got != "nushell" {
+		t.Errorf("ShellName(nu) = %q, want nushell", got)
+	}
+	if got := ShellName("zsh"); got != "zsh" {
+		t.Errorf("ShellName(zsh) = %q, want zsh", got)
+	}
+	if got := ShellExecutable("nushell"); got != "nu" {
+		t.Errorf("ShellExecutable(nushell) = %q, want nu", got)
+	}
+}
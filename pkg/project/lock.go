@@ -0,0 +1,258 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LockFile is the project lockfile, relative to the project root.
+	LockFile = ".nix-foundry/lock.yaml"
+
+	// DefaultNixpkgsRef is the nixpkgs branch packages are taken from unless
+	// another one is configured or locked.
+	DefaultNixpkgsRef = schema.DefaultNixpkgsRef
+)
+
+/*
+ErrLockOutOfSync is returned when the project configuration changed after the
+lockfile was written.
+*/
+var ErrLockOutOfSync = errors.New("lockfile is out of sync with the project configuration; run 'nix-foundry project lock'")
+
+/*
+Lock records the nixpkgs revision and package versions a project configuration
+resolved to. ConfigHash is the SHA-256 of the configuration it was generated
+from and is used to detect a stale lock.
+*/
+type Lock struct {
+	ConfigHash string          `yaml:"configHash"`
+	Nixpkgs    string          `yaml:"nixpkgs"`
+	Packages   []LockedPackage `yaml:"packages"`
+}
+
+/*
+LockedPackage is a package resolved to a concrete version. Source is the flake
+reference the package is taken from.
+*/
+type LockedPackage struct {
+	Name      string `yaml:"name"`
+	Attribute string `yaml:"attribute"`
+	Version   string `yaml:"version"`
+	Source    string `yaml:"source"`
+}
+
+/*
+flakeMetadata is the part of nix flake metadata --json that is used to lock a
+flake reference.
+*/
+type flakeMetadata struct {
+	Locked struct {
+		Owner string `json:"owner"`
+		Repo  string `json:"repo"`
+		Rev   string `json:"rev"`
+		Type  string `json:"type"`
+	} `json:"locked"`
+	URL string `json:"url"`
+}
+
+/*
+Lock resolves the project's packages to concrete versions and writes them to
+.nix-foundry/lock.yaml. The configured nixpkgs and the flake references of
+pinned packages are locked to the revisions they currently point at.
+*/
+func (s *Service) Lock() error {
+	content, config, readErr := s.readConfig()
+	if readErr != nil {
+		return readErr
+	}
+
+	nixpkgs, resolveErr := ResolveFlakeRef(s.runner, config.Nix.NixpkgsRef())
+	if resolveErr != nil {
+		return resolveErr
+	}
+
+	lock := &Lock{
+		ConfigHash: configHash(content),
+		Nixpkgs:    nixpkgs,
+	}
+
+	pinned := make(map[string]bool)
+	for _, pin := range config.Nix.Packages.Pinned {
+		source, pinErr := ResolveFlakeRef(s.runner, pin.FlakeRef)
+		if pinErr != nil {
+			return pinErr
+		}
+		locked, lockErr := LockPackage(s.runner, pin.Name, source)
+		if lockErr != nil {
+			return lockErr
+		}
+		lock.Packages = append(lock.Packages, locked)
+		pinned[pin.Name] = true
+	}
+
+	for _, pkg := range config.Nix.Packages.AllPackages() {
+		if pinned[pkg] {
+			continue
+		}
+		locked, lockErr := LockPackage(s.runner, pkg, nixpkgs)
+		if lockErr != nil {
+			return lockErr
+		}
+		lock.Packages = append(lock.Packages, locked)
+	}
+
+	output, marshalErr := yaml.Marshal(lock)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", marshalErr)
+	}
+
+	if writeErr := s.fs.WriteFile(filepath.Join(s.root, LockFile), output, 0644); writeErr != nil {
+		return fmt.Errorf("failed to write lockfile: %w", writeErr)
+	}
+	return nil
+}
+
+/*
+ReadLock returns the project lockfile, or nil if the project has none. It
+returns ErrLockOutOfSync when the lock was generated from a different
+configuration.
+*/
+func (s *Service) ReadLock() (*Lock, error) {
+	lockContent, readErr := s.fs.ReadFile(filepath.Join(s.root, LockFile))
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lockfile: %w", readErr)
+	}
+
+	lock := &Lock{}
+	if unmarshalErr := yaml.Unmarshal(lockContent, lock); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %w", unmarshalErr)
+	}
+	if validateErr := validateLock(lock); validateErr != nil {
+		return nil, validateErr
+	}
+
+	content, _, configErr := s.readConfig()
+	if configErr != nil {
+		return nil, configErr
+	}
+	if lock.ConfigHash != configHash(content) {
+		return lock, ErrLockOutOfSync
+	}
+
+	return lock, nil
+}
+
+/*
+ValidateLockedPackages checks that locked packages are well-formed and come from
+valid flake references.
+*/
+func ValidateLockedPackages(pkgs []LockedPackage) error {
+	for _, pkg := range pkgs {
+		if specErr := schema.ValidatePackageSpec(pkg.Name); specErr != nil {
+			return fmt.Errorf("invalid package in lockfile: %w", specErr)
+		}
+		if refErr := schema.ValidateFlakeRef(pkg.Source); refErr != nil {
+			return fmt.Errorf("invalid source for %s in lockfile: %w", pkg.Name, refErr)
+		}
+	}
+	return nil
+}
+
+/*
+validateLock checks that a lockfile only references well-formed packages and
+flake references, since its contents end up in the generated flake.
+*/
+func validateLock(lock *Lock) error {
+	if refErr := schema.ValidateFlakeRef(lock.Nixpkgs); refErr != nil {
+		return fmt.Errorf("invalid nixpkgs reference in lockfile: %w", refErr)
+	}
+	return ValidateLockedPackages(lock.Packages)
+}
+
+/*
+LockPackage resolves the version of pkg in the flake referenced by source.
+*/
+func LockPackage(runner cmdexec.Runner, pkg, source string) (LockedPackage, error) {
+	attr := schema.PackageAttribute(pkg)
+	version, evalErr := runner.Output("nix", "--extra-experimental-features", "nix-command flakes",
+		"eval", "--raw", fmt.Sprintf("%s#%s.version", source, attr))
+	if evalErr != nil {
+		return LockedPackage{}, fmt.Errorf("failed to resolve version of %s: %w", pkg, evalErr)
+	}
+
+	return LockedPackage{
+		Name:      pkg,
+		Attribute: attr,
+		Version:   strings.TrimSpace(string(version)),
+		Source:    source,
+	}, nil
+}
+
+/*
+ResolveFlakeRef returns ref locked to the revision it currently points at.
+*/
+func ResolveFlakeRef(runner cmdexec.Runner, ref string) (string, error) {
+	output, metaErr := runner.Output("nix", "--extra-experimental-features", "nix-command flakes",
+		"flake", "metadata", ref, "--json")
+	if metaErr != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, metaErr)
+	}
+
+	var metadata flakeMetadata
+	if jsonErr := json.Unmarshal(output, &metadata); jsonErr != nil {
+		return "", fmt.Errorf("failed to parse flake metadata for %s: %w", ref, jsonErr)
+	}
+
+	locked := metadata.Locked
+	if locked.Type == "github" && locked.Owner != "" && locked.Repo != "" && locked.Rev != "" {
+		return fmt.Sprintf("github:%s/%s/%s", locked.Owner, locked.Repo, locked.Rev), nil
+	}
+	if metadata.URL != "" {
+		return metadata.URL, nil
+	}
+	return "", fmt.Errorf("flake metadata for %s has no locked revision", ref)
+}
+
+/*
+readConfig returns the raw and parsed project configuration. The configuration
+is migrated to the current schema version before it is parsed; the raw content
+is returned as it is on disk.
+*/
+func (s *Service) readConfig() ([]byte, *schema.Config, error) {
+	content, readErr := s.fs.ReadFile(filepath.Join(s.root, ConfigDir, "config.yaml"))
+	if readErr != nil {
+		return nil, nil, fmt.Errorf("failed to read project config: %w", readErr)
+	}
+	migrated, _, migrateErr := schema.MigrateConfig(content)
+	if migrateErr != nil {
+		return nil, nil, fmt.Errorf("failed to load project config: %w", migrateErr)
+	}
+
+	config := &schema.Config{}
+	if unmarshalErr := yaml.Unmarshal(migrated, config); unmarshalErr != nil {
+		return nil, nil, fmt.Errorf("failed to parse project config: %w", unmarshalErr)
+	}
+	return content, config, nil
+}
+
+/*
+configHash returns the hex encoded SHA-256 of a project configuration.
+*/
+func configHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,189 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+nixRunner answers nix flake metadata and nix eval with canned output and accepts
+every flake passed to nix-instantiate --parse.
+*/
+type nixRunner struct {
+	revs     map[string]string
+	versions map[string]string
+}
+
+func (r *nixRunner) Run(name string, args ...string) error {
+	return fmt.Errorf("unexpected command: %s %s", name, strings.Join(args, " "))
+}
+
+func (r *nixRunner) Output(name string, args ...string) ([]byte, error) {
+	command := strings.Join(args, " ")
+	switch {
+	case name == "nix-instantiate":
+		return nil, nil
+	case strings.Contains(command, "flake metadata"):
+		ref := args[len(args)-2]
+		rev, ok := r.revs[ref]
+		if !ok {
+			return nil, fmt.Errorf("unknown flake %s", ref)
+		}
+		return []byte(fmt.Sprintf(`{"locked":{"type":"github","owner":"NixOS","repo":"nixpkgs","rev":%q},"url":"github:NixOS/nixpkgs/%s"}`, rev, rev)), nil
+	case strings.Contains(command, "eval --raw"):
+		installable := args[len(args)-1]
+		version, ok := r.versions[installable]
+		if !ok {
+			return nil, fmt.Errorf("unknown package %s", installable)
+		}
+		return []byte(version), nil
+	}
+	return nil, fmt.Errorf("unexpected command: %s %s", name, command)
+}
+
+func newLockRunner() *nixRunner {
+	return &nixRunner{
+		revs: map[string]string{
+			DefaultNixpkgsRef:               "aaaa1111",
+			"github:NixOS/nixpkgs/4a8b7c1d": "4a8b7c1d",
+		},
+		versions: map[string]string{
+			"github:NixOS/nixpkgs/aaaa1111#go.version":        "1.22.3",
+			"github:NixOS/nixpkgs/aaaa1111#nodejs_20.version": "20.11.1",
+			"github:NixOS/nixpkgs/4a8b7c1d#ripgrep.version":   "13.0.0",
+		},
+	}
+}
+
+const lockedProjectConfig = `type: project
+metadata:
+  name: demo
+nix:
+  packages:
+    core: [go, nodejs@20]
+    pinned:
+      - name: ripgrep
+        flakeRef: github:NixOS/nixpkgs/4a8b7c1d
+`
+
+func TestLock(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, lockedProjectConfig)
+
+	service := NewServiceWithRunner(filesystem.NewOSFileSystem(), newLockRunner(), root)
+	if err := service.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, LockFile))
+	if err != nil {
+		t.Fatalf("lockfile not written: %v", err)
+	}
+	lock := &Lock{}
+	if err := yaml.Unmarshal(content, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if lock.Nixpkgs != "github:NixOS/nixpkgs/aaaa1111" {
+		t.Errorf("Nixpkgs = %q, want the locked revision", lock.Nixpkgs)
+	}
+	want := []LockedPackage{
+		{Name: "ripgrep", Attribute: "ripgrep", Version: "13.0.0", Source: "github:NixOS/nixpkgs/4a8b7c1d"},
+		{Name: "go", Attribute: "go", Version: "1.22.3", Source: "github:NixOS/nixpkgs/aaaa1111"},
+		{Name: "nodejs@20", Attribute: "nodejs_20", Version: "20.11.1", Source: "github:NixOS/nixpkgs/aaaa1111"},
+	}
+	if len(lock.Packages) != len(want) {
+		t.Fatalf("Packages = %+v, want %+v", lock.Packages, want)
+	}
+	for idx := range want {
+		if lock.Packages[idx] != want[idx] {
+			t.Errorf("Packages[%d] = %+v, want %+v", idx, lock.Packages[idx], want[idx])
+		}
+	}
+
+	if _, err := service.ReadLock(); err != nil {
+		t.Errorf("ReadLock() error = %v, want a lock in sync", err)
+	}
+}
+
+func TestSyncProjectEnvironmentUsesLock(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, lockedProjectConfig)
+
+	service := NewServiceWithRunner(filesystem.NewOSFileSystem(), newLockRunner(), root)
+	if err := service.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+	flake, _ := os.ReadFile(filepath.Join(root, ShellDir, "flake.nix"))
+	if !strings.Contains(string(flake), `nixpkgs.url = "github:NixOS/nixpkgs/aaaa1111";`) {
+		t.Errorf("flake.nix does not use the locked nixpkgs:\n%s", flake)
+	}
+
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [go]\n")
+	if _, err := service.ReadLock(); !errors.Is(err, ErrLockOutOfSync) {
+		t.Errorf("ReadLock() error = %v, want ErrLockOutOfSync", err)
+	}
+
+	changed, err := service.SyncProjectEnvironment()
+	if err != nil || !changed {
+		t.Fatalf("sync with a stale lock changed = %v, err = %v; want regenerated", changed, err)
+	}
+	flake, _ = os.ReadFile(filepath.Join(root, ShellDir, "flake.nix"))
+	if !strings.Contains(string(flake), `nixpkgs.url = "`+DefaultNixpkgsRef+`";`) {
+		t.Errorf("flake.nix uses a stale lock:\n%s", flake)
+	}
+}
+
+func TestReadLockRejectsInvalidLock(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, lockedProjectConfig)
+	lock := "nixpkgs: github:NixOS/nixpkgs/aaaa1111\npackages:\n  - name: go\n    source: \"github:x/y; rm -rf /\"\n"
+	if err := os.WriteFile(filepath.Join(root, LockFile), []byte(lock), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewService(filesystem.NewOSFileSystem(), root).ReadLock(); err == nil || errors.Is(err, ErrLockOutOfSync) {
+		t.Errorf("ReadLock() error = %v, want a validation error", err)
+	}
+}
+
+func TestGroupPackagesReachFlakeAndLock(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nmetadata:\n  name: demo\nnix:\n  packages:\n    core: [go]\n    groups:\n      frontend:\n        packages: [nodejs@20]\n        default: true\n      docs:\n        packages: [ripgrep]\n")
+
+	service := NewServiceWithRunner(filesystem.NewOSFileSystem(), newLockRunner(), root)
+	if err := service.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	lock, err := service.ReadLock()
+	if err != nil {
+		t.Fatalf("ReadLock() error = %v", err)
+	}
+	var locked []string
+	for _, pkg := range lock.Packages {
+		locked = append(locked, pkg.Name)
+	}
+	if !reflect.DeepEqual(locked, []string{"go", "nodejs@20"}) {
+		t.Errorf("locked %v, want the core package and the enabled group's package", locked)
+	}
+
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+	flake, _ := os.ReadFile(filepath.Join(root, ShellDir, "flake.nix"))
+	if !strings.Contains(string(flake), "pkgs.nodejs_20") || strings.Contains(string(flake), "ripgrep") {
+		t.Errorf("flake.nix should include the enabled group only:\n%s", flake)
+	}
+}
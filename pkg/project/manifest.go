@@ -0,0 +1,141 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/selfupdate"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ManifestFile describes the generated project shell, relative to the project root.
+	ManifestFile = ".nix-foundry/shell/MANIFEST.yaml"
+
+	// flakeTemplate names the generator the project shell flake is rendered with.
+	flakeTemplate = "project-shell"
+)
+
+/*
+Manifest records what generated the project shell and from which sources, so the
+shell can be explained to whoever finds it and hand edits to its files can be
+detected. Paths are relative to the project root.
+*/
+type Manifest struct {
+	Version  string        `yaml:"version"`
+	Created  time.Time     `yaml:"created"`
+	Updated  time.Time     `yaml:"updated"`
+	Template string        `yaml:"template"`
+	Sources  []ManagedFile `yaml:"sources"`
+	Files    []ManagedFile `yaml:"files"`
+}
+
+/*
+ManagedFile is a file recorded in a manifest with the SHA-256 of its content.
+*/
+type ManagedFile struct {
+	Path string `yaml:"path"`
+	Hash string `yaml:"hash"`
+}
+
+/*
+ModifiedFilesError is returned when generated files were edited by hand since
+the project shell was last generated.
+*/
+type ModifiedFilesError struct {
+	Files []string
+}
+
+func (e *ModifiedFilesError) Error() string {
+	return fmt.Sprintf("%s changed since the project shell was generated; move your changes to .nix-foundry/config.yaml, or use --force to overwrite them", strings.Join(e.Files, ", "))
+}
+
+/*
+ReadManifest reads the manifest of the project shell. It returns nil without an
+error if the project shell has not been generated with a manifest yet.
+*/
+func (s *Service) ReadManifest() (*Manifest, error) {
+	content, readErr := s.fs.ReadFile(filepath.Join(s.root, ManifestFile))
+	if errors.Is(readErr, os.ErrNotExist) {
+		return nil, nil
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, readErr)
+	}
+
+	manifest := &Manifest{}
+	if unmarshalErr := yaml.Unmarshal(content, manifest); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFile, unmarshalErr)
+	}
+	return manifest, nil
+}
+
+/*
+ModifiedFiles returns the generated files that no longer match the manifest. A
+file that was deleted is not reported; it is simply generated again.
+*/
+func (s *Service) ModifiedFiles(manifest *Manifest) ([]string, error) {
+	var modified []string
+	for _, file := range manifest.Files {
+		content, readErr := s.fs.ReadFile(filepath.Join(s.root, filepath.FromSlash(file.Path)))
+		if errors.Is(readErr, os.ErrNotExist) {
+			continue
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, readErr)
+		}
+		if configHash(content) != file.Hash {
+			modified = append(modified, file.Path)
+		}
+	}
+	return modified, nil
+}
+
+/*
+sourcesChanged reports whether sources differ from the sources recorded in the
+manifest.
+*/
+func (m *Manifest) sourcesChanged(sources []ManagedFile) bool {
+	if len(m.Sources) != len(sources) {
+		return true
+	}
+	for idx := range sources {
+		if m.Sources[idx] != sources[idx] {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+writeManifest records the sources and files of a freshly generated project shell.
+The creation time of a previous manifest is kept.
+*/
+func (s *Service) writeManifest(previous *Manifest, sources, files []ManagedFile) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	manifest := &Manifest{
+		Version:  selfupdate.Version,
+		Created:  now,
+		Updated:  now,
+		Template: flakeTemplate,
+		Sources:  sources,
+		Files:    files,
+	}
+	if previous != nil && !previous.Created.IsZero() {
+		manifest.Created = previous.Created
+	}
+
+	content, marshalErr := yaml.Marshal(manifest)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode %s: %w", ManifestFile, marshalErr)
+	}
+	content = append([]byte("# Generated by nix-foundry from .nix-foundry/config.yaml. Run 'nix-foundry project info' for details.\n"), content...)
+	if writeErr := s.fs.AtomicWriteFile(filepath.Join(s.root, ManifestFile), content, 0644); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", ManifestFile, writeErr)
+	}
+	return nil
+}
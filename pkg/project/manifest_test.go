@@ -0,0 +1,69 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+)
+
+func TestSyncProjectEnvironmentWritesManifest(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [go]\n")
+
+	service := NewService(filesystem.NewOSFileSystem(), root)
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+
+	manifest, err := service.ReadManifest()
+	if err != nil || manifest == nil {
+		t.Fatalf("ReadManifest() = %v, %v; want the manifest", manifest, err)
+	}
+	if manifest.Template != flakeTemplate || manifest.Created.IsZero() {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if len(manifest.Sources) != 1 || manifest.Sources[0].Path != ".nix-foundry/config.yaml" {
+		t.Errorf("Sources = %+v, want the project config", manifest.Sources)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Path != ShellDir+"/flake.nix" {
+		t.Errorf("Files = %+v, want the flake", manifest.Files)
+	}
+	if modified, err := service.ModifiedFiles(manifest); err != nil || len(modified) != 0 {
+		t.Errorf("ModifiedFiles() = %v, %v; want none", modified, err)
+	}
+}
+
+func TestSyncProjectEnvironmentKeepsHandEdits(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [go]\n")
+
+	service := NewService(filesystem.NewOSFileSystem(), root)
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+
+	flakeFile := filepath.Join(root, ShellDir, "flake.nix")
+	if err := os.WriteFile(flakeFile, []byte("# edited by hand\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [python3]\n")
+
+	var modifiedErr *ModifiedFilesError
+	if _, err := service.SyncProjectEnvironment(); !errors.As(err, &modifiedErr) {
+		t.Fatalf("SyncProjectEnvironment() error = %v, want a ModifiedFilesError", err)
+	}
+	if flake, _ := os.ReadFile(flakeFile); string(flake) != "# edited by hand\n" {
+		t.Errorf("flake.nix was overwritten:\n%s", flake)
+	}
+
+	changed, err := service.SyncProjectEnvironmentWithOptions(SyncOptions{Force: true})
+	if err != nil || !changed {
+		t.Fatalf("forced sync changed = %v, err = %v; want regenerated", changed, err)
+	}
+	if flake, _ := os.ReadFile(flakeFile); string(flake) == "# edited by hand\n" {
+		t.Error("flake.nix was not regenerated with Force")
+	}
+}
@@ -0,0 +1,480 @@
+/*
+Package project provides project-level environment management for Nix Foundry.
+It generates a project-scoped Nix flake from the project configuration and wires
+it up with direnv so the environment is activated when entering the project.
+*/
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+	"github.com/shawnkhoffman/nix-foundry/pkg/shell"
+)
+
+const (
+	// ConfigDir is the project directory holding nix-foundry files.
+	ConfigDir = ".nix-foundry"
+	// ShellDir is the generated project shell directory, relative to the project root.
+	ShellDir = ".nix-foundry/shell"
+
+	// legacyHashFile is where the configuration hash was kept before the manifest.
+	legacyHashFile = ".config-hash"
+	envrcContent   = "use flake ./" + ShellDir + "\n"
+)
+
+var nixIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+/*
+Service manages the project shell for a project rooted at a given directory.
+*/
+type Service struct {
+	fs     filesystem.FileSystem
+	runner cmdexec.Runner
+	root   string
+}
+
+/*
+NewService creates a project service for the project rooted at root.
+*/
+func NewService(fs filesystem.FileSystem, root string) *Service {
+	return &Service{
+		fs:     fs,
+		runner: cmdexec.NewOSRunner(),
+		root:   root,
+	}
+}
+
+/*
+NewServiceWithRunner creates a project service that runs Nix commands through
+the provided runner.
+*/
+func NewServiceWithRunner(fs filesystem.FileSystem, runner cmdexec.Runner, root string) *Service {
+	service := NewService(fs, root)
+	service.runner = runner
+	return service
+}
+
+/*
+SyncOptions controls how SyncProjectEnvironmentWithOptions regenerates the
+project shell. Force overwrites generated files that were edited by hand.
+*/
+type SyncOptions struct {
+	Force bool
+}
+
+/*
+SyncProjectEnvironment regenerates the project shell without overwriting hand
+edits; see SyncProjectEnvironmentWithOptions.
+*/
+func (s *Service) SyncProjectEnvironment() (bool, error) {
+	return s.SyncProjectEnvironmentWithOptions(SyncOptions{})
+}
+
+/*
+SyncProjectEnvironmentWithOptions regenerates the project shell flake and .envrc
+when the project configuration or lockfile has changed since the last sync.
+Changes are detected by comparing the hashes of .nix-foundry/config.yaml and
+.nix-foundry/lock.yaml with those recorded in the manifest. When the lockfile is
+in sync with the configuration, the flake uses its locked revisions; a stale
+lockfile is ignored with a warning. A generated flake that was edited by hand is
+only overwritten with opts.Force; otherwise a *ModifiedFilesError is returned.
+It returns true if files were regenerated.
+*/
+func (s *Service) SyncProjectEnvironmentWithOptions(opts SyncOptions) (bool, error) {
+	content, config, readErr := s.readConfig()
+	if readErr != nil {
+		return false, readErr
+	}
+
+	sources := []ManagedFile{{Path: ConfigDir + "/config.yaml", Hash: configHash(content)}}
+	if lockContent, lockReadErr := s.fs.ReadFile(filepath.Join(s.root, LockFile)); lockReadErr == nil {
+		sources = append(sources, ManagedFile{Path: LockFile, Hash: configHash(lockContent)})
+	}
+
+	shellDir := filepath.Join(s.root, ShellDir)
+	flakeFile := filepath.Join(shellDir, "flake.nix")
+	manifest, manifestErr := s.ReadManifest()
+	if manifestErr != nil {
+		return false, manifestErr
+	}
+	if manifest != nil && !manifest.sourcesChanged(sources) && s.fs.Exists(flakeFile) {
+		return false, nil
+	}
+	if manifest != nil && !opts.Force {
+		modified, modifiedErr := s.ModifiedFiles(manifest)
+		if modifiedErr != nil {
+			return false, modifiedErr
+		}
+		if len(modified) > 0 {
+			return false, &ModifiedFilesError{Files: modified}
+		}
+	}
+
+	lock, lockErr := s.ReadLock()
+	if lockErr != nil {
+		if !errors.Is(lockErr, ErrLockOutOfSync) {
+			return false, lockErr
+		}
+		logging.Warn("ignoring project lockfile", "error", lockErr)
+		lock = nil
+	}
+
+	flake, flakeErr := generateFlake(config, lock)
+	if flakeErr != nil {
+		return false, flakeErr
+	}
+
+	if mkdirErr := s.fs.MkdirAll(shellDir, 0755); mkdirErr != nil {
+		return false, fmt.Errorf("failed to create project shell directory: %w", mkdirErr)
+	}
+
+	if parseErr := s.checkSyntax(shellDir, flake); parseErr != nil {
+		return false, parseErr
+	}
+
+	if writeErr := s.fs.AtomicWriteFile(flakeFile, []byte(flake), 0644); writeErr != nil {
+		return false, fmt.Errorf("failed to write project flake: %w", writeErr)
+	}
+
+	if envrcErr := s.writeEnvrc(config.Env); envrcErr != nil {
+		return false, envrcErr
+	}
+
+	if ignoreErr := s.ensureGitignore(); ignoreErr != nil {
+		fmt.Printf("Warning: Failed to update .gitignore: %v\n", ignoreErr)
+	}
+
+	files := []ManagedFile{{Path: ShellDir + "/flake.nix", Hash: configHash([]byte(flake))}}
+	if manifestErr := s.writeManifest(manifest, sources, files); manifestErr != nil {
+		return false, manifestErr
+	}
+	if legacyFile := filepath.Join(shellDir, legacyHashFile); s.fs.Exists(legacyFile) {
+		_ = s.fs.Remove(legacyFile)
+	}
+
+	return true, nil
+}
+
+/*
+writeEnvrc points the project's .envrc at the generated flake and exports the
+project's environment variables in a nix-foundry managed block. The flake line
+is appended if missing and the rest of the file is left untouched, so user
+additions are preserved.
+*/
+func (s *Service) writeEnvrc(env map[string]string) error {
+	envrcPath := filepath.Join(s.root, ".envrc")
+
+	existing, readErr := s.fs.ReadFile(envrcPath)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return fmt.Errorf("failed to read .envrc: %w", readErr)
+	}
+
+	content := string(existing)
+	if !strings.Contains(content, strings.TrimSpace(envrcContent)) {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += envrcContent
+	}
+
+	if len(env) > 0 {
+		content = shell.UpsertManagedBlock(content, shell.WrapManagedBlock(shell.EnvExports("bash", env)))
+	} else if shell.HasManagedBlock(content) {
+		content, _ = shell.RemoveManagedBlocks(content)
+		content = strings.TrimRight(content, "\n") + "\n"
+	}
+
+	if content == string(existing) {
+		return nil
+	}
+	if writeErr := s.fs.WriteFile(envrcPath, []byte(content), 0644); writeErr != nil {
+		return fmt.Errorf("failed to write .envrc: %w", writeErr)
+	}
+	return nil
+}
+
+/*
+ensureGitignore adds the generated shell directory to .gitignore when the project
+root is a git repository.
+*/
+func (s *Service) ensureGitignore() error {
+	if !s.fs.Exists(filepath.Join(s.root, ".git")) {
+		return nil
+	}
+
+	ignorePath := filepath.Join(s.root, ".gitignore")
+	entry := "/" + ShellDir + "/"
+
+	existing, readErr := s.fs.ReadFile(ignorePath)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return readErr
+	}
+
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += entry + "\n"
+
+	return s.fs.WriteFile(ignorePath, []byte(content), 0644)
+}
+
+/*
+GenerateFlake renders a flake providing a default devShell with the project's
+core and optional packages, those of its enabled groups, and its environment
+variables. Pinned packages get their
+own flake input.
+*/
+func GenerateFlake(config *schema.Config) (string, error) {
+	return generateFlake(config, nil)
+}
+
+/*
+generateFlake renders the project flake, taking nixpkgs and pinned packages from
+the revisions recorded in lock when it is not nil, and from the configured
+nixpkgs and pins otherwise.
+*/
+func generateFlake(config *schema.Config, lock *Lock) (string, error) {
+	var inputs []string
+	var packages []string
+
+	if refErr := schema.ValidateNixpkgsRef(config.Nix.Nixpkgs.Ref); refErr != nil {
+		return "", refErr
+	}
+	systems, systemsErr := flakeSystems(config)
+	if systemsErr != nil {
+		return "", systemsErr
+	}
+
+	nixpkgsRef := config.Nix.NixpkgsRef()
+	lockedSources := make(map[string]string)
+	if lock != nil {
+		nixpkgsRef = lock.Nixpkgs
+		for _, locked := range lock.Packages {
+			lockedSources[locked.Name] = locked.Source
+		}
+	}
+
+	pinned := make(map[string]bool)
+	for idx, pin := range config.Nix.Packages.Pinned {
+		if refErr := schema.ValidateFlakeRef(pin.FlakeRef); refErr != nil {
+			return "", fmt.Errorf("invalid pin for %s: %w", pin.Name, refErr)
+		}
+		flakeRef := pin.FlakeRef
+		if source, ok := lockedSources[pin.Name]; ok {
+			flakeRef = source
+		}
+		input := fmt.Sprintf("pin%d", idx)
+		inputs = append(inputs, fmt.Sprintf("    %s.url = %s;", input, nixString(flakeRef)))
+		attr, attrErr := nixAttrPath(schema.PackageAttribute(pin.Name))
+		if attrErr != nil {
+			return "", attrErr
+		}
+		packages = append(packages, fmt.Sprintf("inputs.%s.legacyPackages.${pkgs.system}.%s", input, attr))
+		pinned[pin.Name] = true
+	}
+
+	for _, pkg := range config.Nix.Packages.AllPackages() {
+		if pinned[pkg] {
+			continue
+		}
+		if specErr := schema.ValidatePackageSpec(pkg); specErr != nil {
+			return "", specErr
+		}
+		attr, attrErr := nixAttrPath(schema.PackageAttribute(pkg))
+		if attrErr != nil {
+			return "", attrErr
+		}
+		packages = append(packages, "pkgs."+attr)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by nix-foundry from .nix-foundry/config.yaml. Do not edit.\n")
+	b.WriteString("{\n")
+	fmt.Fprintf(&b, "  description = %s;\n\n", nixString("Project shell for "+config.Metadata.Name))
+	b.WriteString("  inputs = {\n")
+	fmt.Fprintf(&b, "    nixpkgs.url = %s;\n", nixString(nixpkgsRef))
+	for _, input := range inputs {
+		b.WriteString(input + "\n")
+	}
+	b.WriteString("  };\n\n")
+	b.WriteString("  outputs = { self, nixpkgs, ... }@inputs:\n")
+	b.WriteString("    let\n")
+	fmt.Fprintf(&b, "      systems = [ %s ];\n", strings.Join(systems, " "))
+	b.WriteString("      forAllSystems = f: nixpkgs.lib.genAttrs systems (system: f nixpkgs.legacyPackages.${system});\n")
+	b.WriteString("    in {\n")
+	b.WriteString("      devShells = forAllSystems (pkgs: {\n")
+	b.WriteString("        default = pkgs.mkShell {\n")
+	b.WriteString("          packages = [\n")
+	for _, pkg := range packages {
+		fmt.Fprintf(&b, "            %s\n", pkg)
+	}
+	b.WriteString("          ];\n")
+	if len(config.Env) > 0 {
+		if envErr := schema.ValidateEnv(config.Env); envErr != nil {
+			return "", envErr
+		}
+		names := make([]string, 0, len(config.Env))
+		for name := range config.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b.WriteString("          env = {\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "            %s = %s;\n", name, nixString(config.Env[name]))
+		}
+		b.WriteString("          };\n")
+	}
+	b.WriteString("        };\n")
+	b.WriteString("      });\n")
+	b.WriteString("    };\n")
+	b.WriteString("}\n")
+
+	return b.String(), nil
+}
+
+/*
+flakeSystems returns the quoted Nix systems the flake provides its shell for: the
+systems configured in nix.systems, or every supported system.
+*/
+func flakeSystems(config *schema.Config) ([]string, error) {
+	systems := config.Nix.Systems
+	if len(systems) == 0 {
+		systems = platform.SupportedNixSystems
+	}
+
+	quoted := make([]string, 0, len(systems))
+	for _, system := range systems {
+		if systemErr := platform.ValidateNixSystem(system); systemErr != nil {
+			return nil, systemErr
+		}
+		quoted = append(quoted, nixString(system))
+	}
+	return quoted, nil
+}
+
+/*
+checkSyntax parses the generated flake with nix-instantiate --parse from a
+temporary file in shellDir, so that a flake Nix cannot read is reported with its
+content instead of replacing the current one. The check is skipped when
+nix-instantiate is not available.
+*/
+func (s *Service) checkSyntax(shellDir, flake string) error {
+	flakePath := filepath.Join(shellDir, ".flake.nix.check")
+	if writeErr := s.fs.WriteFile(flakePath, []byte(flake), 0644); writeErr != nil {
+		return fmt.Errorf("failed to write temporary flake: %w", writeErr)
+	}
+	defer func() { _ = s.fs.Remove(flakePath) }()
+
+	_, parseErr := s.runner.Output("nix-instantiate", "--parse", flakePath)
+	if parseErr == nil {
+		return nil
+	}
+	if errors.Is(parseErr, exec.ErrNotFound) {
+		logging.Debug("skipping flake syntax check", "error", parseErr)
+		return nil
+	}
+
+	var numbered strings.Builder
+	for idx, line := range strings.Split(strings.TrimRight(flake, "\n"), "\n") {
+		fmt.Fprintf(&numbered, "%4d  %s\n", idx+1, line)
+	}
+	return fmt.Errorf("generated flake.nix is not valid Nix: %w\n\n%s", parseErr, numbered.String())
+}
+
+/*
+nixAttrPath converts a dotted nixpkgs attribute into a Nix attribute path, quoting
+components that are not plain identifiers.
+*/
+func nixAttrPath(attribute string) (string, error) {
+	parts := strings.Split(attribute, ".")
+	for idx, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid package attribute: %q", attribute)
+		}
+		if !nixIdentifierPattern.MatchString(part) {
+			parts[idx] = nixString(part)
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
+
+/*
+nixString renders value as a double-quoted Nix string, escaping characters that
+would otherwise end the string or start an interpolation.
+*/
+func nixString(value string) string {
+	escaped := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"${", `\${`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	).Replace(value)
+	return `"` + escaped + `"`
+}
+
+/*
+DirenvStatus reports whether direnv is installed and hooked into the given shell.
+*/
+func DirenvStatus(shell string) (installed, hooked bool) {
+	if _, lookErr := exec.LookPath("direnv"); lookErr != nil {
+		return false, false
+	}
+
+	rcFile, rcErr := platform.GetShellConfigFile(shell)
+	if rcErr != nil {
+		return true, false
+	}
+
+	content, readErr := os.ReadFile(rcFile)
+	if readErr != nil {
+		return true, false
+	}
+
+	return true, strings.Contains(string(content), "direnv hook")
+}
+
+/*
+DirenvSetupInstructions returns the steps needed to install and hook direnv for shell.
+*/
+func DirenvSetupInstructions(shell string, installed bool) []string {
+	var steps []string
+	if !installed {
+		steps = append(steps, "Install direnv: nix-env -iA nixpkgs.direnv (or add it to your packages)")
+	}
+
+	switch shell {
+	case "fish":
+		steps = append(steps, "Add to ~/.config/fish/config.fish: direnv hook fish | source")
+	case "nushell":
+		steps = append(steps, "Add the direnv hook from https://direnv.net/docs/hook.html#nushell to ~/.config/nushell/config.nu")
+	case "zsh":
+		steps = append(steps, "Add to ~/.zshrc: eval \"$(direnv hook zsh)\"")
+	default:
+		steps = append(steps, "Add to ~/.bashrc: eval \"$(direnv hook bash)\"")
+	}
+
+	steps = append(steps, "Run 'direnv allow' in the project directory")
+	return steps
+}
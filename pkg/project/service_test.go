@@ -0,0 +1,271 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func writeProjectConfig(t *testing.T, root, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(root, ConfigDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ConfigDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncProjectEnvironment(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".envrc"), []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeProjectConfig(t, root, `type: project
+metadata:
+  name: demo
+nix:
+  packages:
+    core: [go, nodejs@20, jetbrains.goland]
+    pinned:
+      - name: ripgrep
+        flakeRef: github:NixOS/nixpkgs/4a8b7c1d
+`)
+
+	service := NewService(filesystem.NewOSFileSystem(), root)
+
+	changed, err := service.SyncProjectEnvironment()
+	if err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+	if !changed {
+		t.Fatal("expected first sync to generate the project shell")
+	}
+
+	flake, err := os.ReadFile(filepath.Join(root, ShellDir, "flake.nix"))
+	if err != nil {
+		t.Fatalf("flake.nix not written: %v", err)
+	}
+	for _, want := range []string{
+		"pkgs.go\n",
+		"pkgs.nodejs_20\n",
+		"pkgs.jetbrains.goland\n",
+		`pin0.url = "github:NixOS/nixpkgs/4a8b7c1d";`,
+		"inputs.pin0.legacyPackages.${pkgs.system}.ripgrep",
+	} {
+		if !strings.Contains(string(flake), want) {
+			t.Errorf("flake.nix missing %q:\n%s", want, flake)
+		}
+	}
+
+	envrc, _ := os.ReadFile(filepath.Join(root, ".envrc"))
+	if string(envrc) != "export FOO=bar\nuse flake ./.nix-foundry/shell\n" {
+		t.Errorf(".envrc = %q", envrc)
+	}
+
+	gitignore, _ := os.ReadFile(filepath.Join(root, ".gitignore"))
+	if string(gitignore) != "/.nix-foundry/shell/\n" {
+		t.Errorf(".gitignore = %q", gitignore)
+	}
+
+	changed, err = service.SyncProjectEnvironment()
+	if err != nil || changed {
+		t.Errorf("second sync changed = %v, err = %v; want unchanged", changed, err)
+	}
+
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [python3]\n")
+	changed, err = service.SyncProjectEnvironment()
+	if err != nil || !changed {
+		t.Fatalf("sync after config change changed = %v, err = %v; want regenerated", changed, err)
+	}
+	flake, _ = os.ReadFile(filepath.Join(root, ShellDir, "flake.nix"))
+	if !strings.Contains(string(flake), "pkgs.python3") || strings.Contains(string(flake), "pkgs.go\n") {
+		t.Errorf("flake.nix not regenerated from new config:\n%s", flake)
+	}
+
+	envrc, _ = os.ReadFile(filepath.Join(root, ".envrc"))
+	if strings.Count(string(envrc), "use flake") != 1 {
+		t.Errorf(".envrc duplicated flake line: %q", envrc)
+	}
+}
+
+func TestSyncProjectEnvironmentWithoutGit(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [git]\n")
+
+	if _, err := NewService(filesystem.NewOSFileSystem(), root).SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".gitignore")); !os.IsNotExist(err) {
+		t.Errorf("expected no .gitignore outside a git repository")
+	}
+}
+
+func TestSyncProjectEnvironmentExportsEnv(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [go]\nenv:\n  GOFLAGS: -mod=vendor\n  GREETING: it's here\n")
+
+	service := NewService(filesystem.NewOSFileSystem(), root)
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+
+	envrc, _ := os.ReadFile(filepath.Join(root, ".envrc"))
+	for _, want := range []string{"use flake ./.nix-foundry/shell\n", "export GOFLAGS='-mod=vendor'\n", `export GREETING='it'\''s here'`} {
+		if !strings.Contains(string(envrc), want) {
+			t.Errorf(".envrc missing %q:\n%s", want, envrc)
+		}
+	}
+
+	writeProjectConfig(t, root, "type: project\nnix:\n  packages:\n    core: [go]\n")
+	if _, err := service.SyncProjectEnvironment(); err != nil {
+		t.Fatalf("SyncProjectEnvironment() error = %v", err)
+	}
+	envrc, _ = os.ReadFile(filepath.Join(root, ".envrc"))
+	if string(envrc) != "use flake ./.nix-foundry/shell\n" {
+		t.Errorf(".envrc = %q, want only the flake line once env is removed", envrc)
+	}
+}
+
+func TestGenerateFlakeEnv(t *testing.T) {
+	config := &schema.Config{}
+	config.Nix.Packages.Core = []string{"go"}
+	config.Env = map[string]string{
+		"GREETING": "say \"hi\"\n${USER} \\o/",
+		"GOFLAGS":  "-mod=vendor",
+	}
+
+	flake, err := GenerateFlake(config)
+	if err != nil {
+		t.Fatalf("GenerateFlake() error = %v", err)
+	}
+	want := "          env = {\n" +
+		"            GOFLAGS = \"-mod=vendor\";\n" +
+		"            GREETING = \"say \\\"hi\\\"\\n\\${USER} \\\\o/\";\n" +
+		"          };\n"
+	if !strings.Contains(flake, want) {
+		t.Errorf("flake.nix missing env block %q:\n%s", want, flake)
+	}
+
+	config.Env = map[string]string{"BAD NAME": "x"}
+	if _, err := GenerateFlake(config); err == nil {
+		t.Error("GenerateFlake() accepted an invalid variable name")
+	}
+}
+
+/*
+parseRunner fails nix-instantiate --parse with a Nix syntax error.
+*/
+type parseRunner struct {
+	parsed []string
+}
+
+func (r *parseRunner) Run(string, ...string) error { return nil }
+
+func (r *parseRunner) Output(name string, args ...string) ([]byte, error) {
+	r.parsed = append(r.parsed, name+" "+strings.Join(args, " "))
+	return nil, errors.New("error: syntax error, unexpected '}'")
+}
+
+func TestSyncProjectEnvironmentRejectsInvalidFlake(t *testing.T) {
+	root := t.TempDir()
+	writeProjectConfig(t, root, "type: project\nmetadata:\n  name: demo\nnix:\n  packages:\n    core: [go]\n")
+
+	runner := &parseRunner{}
+	service := NewServiceWithRunner(filesystem.NewOSFileSystem(), runner, root)
+
+	_, err := service.SyncProjectEnvironment()
+	if err == nil {
+		t.Fatal("expected an error when the generated flake does not parse")
+	}
+	if !strings.Contains(err.Error(), "unexpected '}'") || !strings.Contains(err.Error(), "   3    description = \"Project shell for demo\";") {
+		t.Errorf("error = %v, want the Nix error and the numbered flake", err)
+	}
+	if len(runner.parsed) != 1 || !strings.HasPrefix(runner.parsed[0], "nix-instantiate --parse ") {
+		t.Errorf("ran %v, want nix-instantiate --parse on a temporary file", runner.parsed)
+	}
+	if _, statErr := os.Stat(filepath.Join(root, ShellDir, "flake.nix")); !os.IsNotExist(statErr) {
+		t.Errorf("expected no flake.nix to be written, stat error = %v", statErr)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, ShellDir)); len(entries) != 0 {
+		t.Errorf("expected the temporary flake to be removed, found %v", entries)
+	}
+}
+
+func TestGenerateFlakeEscapesStrings(t *testing.T) {
+	config := &schema.Config{
+		Metadata: schema.Metadata{Name: `web "app" ${builtins.currentSystem} \ café`},
+		Nix:      schema.Nix{Packages: schema.Packages{Core: []string{"go"}}},
+	}
+
+	flake, err := GenerateFlake(config)
+	if err != nil {
+		t.Fatalf("GenerateFlake() error = %v", err)
+	}
+	want := `description = "Project shell for web \"app\" \${builtins.currentSystem} \\ café";`
+	if !strings.Contains(flake, want) {
+		t.Errorf("expected the description to be escaped for Nix, got:\n%s", flake)
+	}
+}
+
+func TestGenerateFlakeUsesConfiguredNixpkgs(t *testing.T) {
+	config := &schema.Config{
+		Nix: schema.Nix{
+			Packages: schema.Packages{Core: []string{"go"}},
+			Nixpkgs:  schema.NixpkgsSettings{Ref: "nixos-24.05"},
+		},
+	}
+
+	flake, err := GenerateFlake(config)
+	if err != nil {
+		t.Fatalf("GenerateFlake() error = %v", err)
+	}
+	if !strings.Contains(flake, `nixpkgs.url = "github:NixOS/nixpkgs/nixos-24.05";`) {
+		t.Errorf("flake.nix does not use the configured nixpkgs:\n%s", flake)
+	}
+
+	config.Nix.Nixpkgs.Ref = "nixos 24.05"
+	if _, err := GenerateFlake(config); err == nil {
+		t.Error("GenerateFlake() error = nil, want an invalid nixpkgs ref error")
+	}
+}
+
+func TestGenerateFlakeSystems(t *testing.T) {
+	config := &schema.Config{Nix: schema.Nix{Packages: schema.Packages{Core: []string{"go"}}}}
+
+	flake, err := GenerateFlake(config)
+	if err != nil {
+		t.Fatalf("GenerateFlake() error = %v", err)
+	}
+	if !strings.Contains(flake, "devShells = forAllSystems (pkgs: {\n        default = pkgs.mkShell {") {
+		t.Errorf("flake.nix has no default devShell per system:\n%s", flake)
+	}
+	for _, system := range platform.SupportedNixSystems {
+		if !strings.Contains(flake, `"`+system+`"`) {
+			t.Errorf("flake.nix does not provide %s:\n%s", system, flake)
+		}
+	}
+
+	config.Nix.Systems = []string{"aarch64-darwin"}
+	flake, err = GenerateFlake(config)
+	if err != nil {
+		t.Fatalf("GenerateFlake() error = %v", err)
+	}
+	if !strings.Contains(flake, `systems = [ "aarch64-darwin" ];`) {
+		t.Errorf("flake.nix does not limit the systems to nix.systems:\n%s", flake)
+	}
+
+	config.Nix.Systems = []string{"i686-linux"}
+	if _, err := GenerateFlake(config); err == nil {
+		t.Error("GenerateFlake() error = nil, want an unsupported system error")
+	}
+}
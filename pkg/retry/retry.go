@@ -0,0 +1,162 @@
+/*
+Package retry runs operations that can fail transiently, such as downloads and
+waiting for a service to start, with exponential backoff and jitter.
+*/
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+/*
+DefaultMaxAttempts is the number of attempts DefaultPolicy makes.
+*/
+const DefaultMaxAttempts = 6
+
+/*
+Policy decides how often and how long to wait between attempts. The delay before
+the second attempt is Initial and doubles for each further attempt up to Max.
+Jitter spreads each delay randomly by up to that fraction in either direction, so
+that clients failing together do not retry together. Sleep and Rand default to
+time.Sleep and math/rand and can be replaced in tests. OnRetry, if set, is called
+before waiting for each retry.
+*/
+type Policy struct {
+	MaxAttempts int
+	Initial     time.Duration
+	Max         time.Duration
+	Jitter      float64
+	Sleep       func(time.Duration)
+	Rand        func() float64
+	OnRetry     func(attempt int, delay time.Duration, err error)
+}
+
+/*
+DefaultPolicy returns the policy used for network operations: six attempts, one
+second doubling up to 30 seconds, with 20% jitter.
+*/
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: DefaultMaxAttempts,
+		Initial:     time.Second,
+		Max:         30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+/*
+permanentError marks failures that retrying cannot fix.
+*/
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+/*
+Permanent marks err as not worth retrying, such as a 404 response. Do returns
+the wrapped error right away.
+*/
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+/*
+IsPermanent reports whether err was marked with Permanent.
+*/
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+/*
+ExhaustedError is returned by Do when every attempt failed. Err is the error of
+the last attempt.
+*/
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error { return e.Err }
+
+/*
+Delay returns how long to wait before the given attempt, counting from 1 for the
+first attempt, which is not delayed.
+*/
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+
+	delay := p.Initial << (attempt - 2)
+	if p.Max > 0 && (delay > p.Max || delay <= 0) {
+		delay = p.Max
+	}
+
+	if p.Jitter > 0 {
+		random := rand.Float64
+		if p.Rand != nil {
+			random = p.Rand
+		}
+		delay += time.Duration(float64(delay) * p.Jitter * (2*random() - 1))
+	}
+	return delay
+}
+
+/*
+Do calls op until it succeeds, returns a permanent error, or MaxAttempts attempts
+have been made, waiting between attempts as the policy describes. It stops early
+when ctx is done. A MaxAttempts of zero or less makes a single attempt.
+*/
+func (p Policy) Do(ctx context.Context, op func() error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	sleep := time.Sleep
+	if p.Sleep != nil {
+		sleep = p.Sleep
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := p.Delay(attempt)
+			if p.OnRetry != nil {
+				p.OnRetry(attempt, delay, lastErr)
+			}
+			sleep(delay)
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if lastErr != nil {
+				return fmt.Errorf("%w (last error: %v)", ctxErr, lastErr)
+			}
+			return ctxErr
+		}
+
+		lastErr = op()
+		if lastErr == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			return permanent.err
+		}
+	}
+
+	return &ExhaustedError{Attempts: attempts, Err: lastErr}
+}
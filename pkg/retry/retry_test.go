@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	var delays []time.Duration
+	policy := Policy{
+		MaxAttempts: 5,
+		Initial:     time.Second,
+		Max:         30 * time.Second,
+		Sleep:       func(d time.Duration) { delays = append(delays, d) },
+	}
+
+	attempts := 0
+	err := policy.Do(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("connection reset")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Errorf("delays = %v, want [1s 2s]", delays)
+	}
+}
+
+func TestDoStops(t *testing.T) {
+	notFound := errors.New("server returned 404 Not Found")
+
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+		wantErr      func(error) bool
+	}{
+		{
+			name:         "permanent errors fail fast",
+			err:          Permanent(notFound),
+			wantAttempts: 1,
+			wantErr:      func(err error) bool { return err == notFound },
+		},
+		{
+			name:         "attempts are capped",
+			err:          fmt.Errorf("server returned 503"),
+			wantAttempts: 4,
+			wantErr: func(err error) bool {
+				var exhausted *ExhaustedError
+				return errors.As(err, &exhausted) && exhausted.Attempts == 4
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			policy := Policy{MaxAttempts: 4, Initial: time.Second, Sleep: func(time.Duration) {}}
+			err := policy.Do(context.Background(), func() error {
+				attempts++
+				return tt.err
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if !tt.wantErr(err) {
+				t.Errorf("Do() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDoStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, Sleep: func(time.Duration) { cancel() }}
+
+	attempts := 0
+	err := policy.Do(ctx, func() error {
+		attempts++
+		return fmt.Errorf("timeout")
+	})
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() = %v after %d attempts, want the cancellation after 1", err, attempts)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	policy := Policy{Initial: time.Second, Max: 10 * time.Second, Jitter: 0.2}
+
+	tests := []struct {
+		attempt int
+		random  float64
+		want    time.Duration
+	}{
+		{attempt: 1, random: 0.5, want: 0},
+		{attempt: 2, random: 0.5, want: time.Second},
+		{attempt: 3, random: 0.5, want: 2 * time.Second},
+		{attempt: 4, random: 1, want: 4800 * time.Millisecond},
+		{attempt: 5, random: 0, want: 6400 * time.Millisecond},
+		{attempt: 9, random: 0.5, want: 10 * time.Second},
+		{attempt: 80, random: 0.5, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		random := tt.random
+		policy.Rand = func() float64 { return random }
+		if got := policy.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) with random %v = %s, want %s", tt.attempt, tt.random, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+/*
+BundleSettings controls what 'config export' adds to a bundle besides the
+configurations. With IncludeDotfiles set, the configuration file of the
+configured shell and the files listed in Dotfiles are included so they can be
+restored on another machine. Dotfiles are given relative to the home directory,
+such as ~/.gitconfig.
+*/
+type BundleSettings struct {
+	IncludeDotfiles bool     `yaml:"includeDotfiles,omitempty" json:"includeDotfiles,omitempty" toml:"includeDotfiles,omitempty"`
+	Dotfiles        []string `yaml:"dotfiles,omitempty" json:"dotfiles,omitempty" toml:"dotfiles,omitempty"`
+}
+
+/*
+ValidateBundleSettings checks that every dotfile is a path inside the home
+directory written as ~/<path>.
+*/
+func ValidateBundleSettings(bundle BundleSettings) error {
+	for _, dotfile := range bundle.Dotfiles {
+		if _, relErr := DotfilePath(dotfile); relErr != nil {
+			return relErr
+		}
+	}
+	return nil
+}
+
+/*
+DotfilePath returns the path of a ~/<path> dotfile relative to the home
+directory, with forward slashes.
+*/
+func DotfilePath(dotfile string) (string, error) {
+	rel, ok := strings.CutPrefix(dotfile, "~/")
+	if !ok || rel == "" || path.IsAbs(rel) || path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("invalid dotfile %q: expected a path inside the home directory such as ~/.gitconfig", dotfile)
+	}
+	return rel, nil
+}
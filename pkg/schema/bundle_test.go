@@ -0,0 +1,21 @@
+package schema
+
+import "testing"
+
+func TestDotfilePath(t *testing.T) {
+	tests := map[string]string{
+		"~/.gitconfig":            ".gitconfig",
+		"~/.config/nvim/init.lua": ".config/nvim/init.lua",
+		"~/../etc/passwd":         "",
+		"/etc/passwd":             "",
+		".gitconfig":              "",
+		"~/":                      "",
+		"~//etc/passwd":           "",
+	}
+	for dotfile, want := range tests {
+		got, err := DotfilePath(dotfile)
+		if (err == nil) != (want != "") || got != want {
+			t.Errorf("DotfilePath(%q) = %q, %v; want %q", dotfile, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+Editors configures the extensions and plugins of the editors nix-foundry manages.
+*/
+type Editors struct {
+	VSCode VSCode `yaml:"vscode,omitempty" json:"vscode,omitempty" toml:"vscode,omitempty"`
+	Neovim Neovim `yaml:"neovim,omitempty" json:"neovim,omitempty" toml:"neovim,omitempty"`
+}
+
+/*
+VSCode lists the Visual Studio Code extensions to install, by their identifier
+(publisher.name), e.g. golang.go.
+*/
+type VSCode struct {
+	Extensions []string `yaml:"extensions,omitempty" json:"extensions,omitempty" toml:"extensions,omitempty"`
+}
+
+/*
+Neovim lists the Neovim plugins to load with lazy.nvim, by their GitHub
+repository (owner/name), e.g. nvim-treesitter/nvim-treesitter.
+*/
+type Neovim struct {
+	Plugins []string `yaml:"plugins,omitempty" json:"plugins,omitempty" toml:"plugins,omitempty"`
+}
+
+var (
+	vscodeExtensionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*\.[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	neovimPluginPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*/[A-Za-z0-9_.-]+$`)
+)
+
+/*
+IsEmpty reports whether no extensions or plugins are configured.
+*/
+func (e Editors) IsEmpty() bool {
+	return len(e.VSCode.Extensions) == 0 && len(e.Neovim.Plugins) == 0
+}
+
+/*
+ValidateEditors checks that every VS Code extension is a publisher.name
+identifier and every Neovim plugin an owner/name repository.
+*/
+func ValidateEditors(editors Editors) error {
+	for _, extension := range editors.VSCode.Extensions {
+		if !vscodeExtensionPattern.MatchString(extension) {
+			return fmt.Errorf("invalid VS Code extension %q (expected publisher.name)", extension)
+		}
+	}
+	for _, plugin := range editors.Neovim.Plugins {
+		if !neovimPluginPattern.MatchString(plugin) {
+			return fmt.Errorf("invalid Neovim plugin %q (expected owner/name)", plugin)
+		}
+	}
+	return nil
+}
+
+/*
+DiffExtensions compares installed VS Code extensions with the desired ones and
+returns those to install and to remove, each in sorted order. Identifiers are
+compared in lower case, since VS Code ignores their case.
+*/
+func DiffExtensions(installed, desired []string) PackageDiff {
+	return DiffHomebrew(lowerAll(installed), lowerAll(desired))
+}
+
+func lowerAll(names []string) []string {
+	lowered := make([]string, len(names))
+	for idx, name := range names {
+		lowered[idx] = strings.ToLower(name)
+	}
+	return lowered
+}
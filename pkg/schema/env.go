@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/*
+reservedEnvVars are environment variables nix-foundry or Nix itself manages.
+Setting them in a config would break package installation or the Nix profile.
+*/
+var reservedEnvVars = map[string]bool{
+	"NIXPKGS_ALLOW_UNFREE":             true,
+	"NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM": true,
+	"NIX_PATH":                         true,
+	"NIX_PROFILES":                     true,
+	"NIX_SSL_CERT_FILE":                true,
+	"PATH":                             true,
+}
+
+/*
+ValidateEnv checks that every environment variable has a valid name and does not
+collide with a variable nix-foundry manages.
+*/
+func ValidateEnv(env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name: %q", name)
+		}
+		if reservedEnvVars[name] {
+			return fmt.Errorf("environment variable %s is managed by nix-foundry and cannot be set in env", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package schema
+
+import "testing"
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		env     map[string]string
+		wantErr bool
+	}{
+		{env: map[string]string{"EDITOR": "vim", "_PRIVATE": "1", "GOFLAGS": "-mod=vendor"}},
+		{env: map[string]string{"NIXPKGS_ALLOW_UNFREE": "0"}, wantErr: true},
+		{env: map[string]string{"PATH": "/usr/bin"}, wantErr: true},
+		{env: map[string]string{"MY-VAR": "x"}, wantErr: true},
+		{env: map[string]string{"1ST": "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateEnv(tt.env); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateEnv(%v) error = %v, wantErr %v", tt.env, err, tt.wantErr)
+		}
+	}
+}
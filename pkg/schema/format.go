@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Format is a serialization format for configuration files.
+*/
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+/*
+ParseFormat returns the format with the given name. "yml" is accepted as an
+alias for YAML.
+*/
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "json":
+		return FormatJSON, nil
+	case "toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unsupported config format %q (expected yaml, json or toml)", name)
+	}
+}
+
+/*
+FormatFromPath returns the format of a configuration file based on its extension.
+*/
+func FormatFromPath(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return "", fmt.Errorf("cannot determine config format of %s: no file extension", path)
+	}
+	return ParseFormat(ext)
+}
+
+/*
+MarshalConfig encodes config in the given format.
+*/
+func MarshalConfig(config *Config, format Format) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(config)
+	case FormatJSON:
+		content, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(content, '\n'), nil
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(config); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+}
+
+/*
+UnmarshalConfig decodes content in the given format into config.
+*/
+func UnmarshalConfig(content []byte, format Format, config *Config) error {
+	switch format {
+	case FormatYAML:
+		return yaml.Unmarshal(content, config)
+	case FormatJSON:
+		return json.Unmarshal(content, config)
+	case FormatTOML:
+		return toml.Unmarshal(content, config)
+	default:
+		return fmt.Errorf("unsupported config format %q", format)
+	}
+}
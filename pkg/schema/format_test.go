@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func formatTestConfig() *Config {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	return &Config{
+		Version: "1.0.0",
+		Kind:    "Config",
+		Type:    UserConfig,
+		Base:    "platform",
+		Metadata: Metadata{
+			Name:        "default",
+			Description: "Default user configuration",
+			Created:     created,
+			Updated:     created.Add(time.Hour),
+		},
+		Settings: Settings{
+			Shell:          "zsh",
+			LogLevel:       "info",
+			AutoUpdate:     true,
+			UpdateInterval: 24 * time.Hour,
+			CommandTimeout: 90 * time.Second,
+		},
+		Nix: Nix{
+			Manager:            "nix-profile",
+			AutoGC:             true,
+			InstallConcurrency: 4,
+			Packages: Packages{
+				Core:     []string{"git", "nodejs@20"},
+				Optional: []string{"ripgrep"},
+				Pinned:   []PinnedPackage{{Name: "go", FlakeRef: "github:NixOS/nixpkgs/4a8b7c1d"}},
+			},
+			Scripts: []Script{{
+				Name:        "setup",
+				Description: "Set up the environment",
+				Commands:    "echo one\necho two\n",
+				RunOnce:     true,
+			}},
+		},
+	}
+}
+
+func TestConfigFormatsRoundTrip(t *testing.T) {
+	original := formatTestConfig()
+	yamlContent, err := MarshalConfig(original, FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			content, err := MarshalConfig(original, format)
+			if err != nil {
+				t.Fatalf("MarshalConfig() error = %v", err)
+			}
+
+			decoded := &Config{}
+			if err := UnmarshalConfig(content, format, decoded); err != nil {
+				t.Fatalf("UnmarshalConfig() error = %v\n%s", err, content)
+			}
+			if !reflect.DeepEqual(decoded, original) {
+				t.Errorf("round trip through %s lost data:\ngot  %+v\nwant %+v", format, decoded, original)
+			}
+
+			saved, err := MarshalConfig(decoded, FormatYAML)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(saved) != string(yamlContent) {
+				t.Errorf("YAML saved after importing %s differs:\n%s\nwant:\n%s", format, saved, yamlContent)
+			}
+		})
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]Format{
+		"config.yaml":      FormatYAML,
+		"config.yml":       FormatYAML,
+		"/tmp/config.JSON": FormatJSON,
+		"team.toml":        FormatTOML,
+	}
+	for path, want := range tests {
+		if got, err := FormatFromPath(path); err != nil || got != want {
+			t.Errorf("FormatFromPath(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"config", "env.tar.gz"} {
+		if _, err := FormatFromPath(path); err == nil {
+			t.Errorf("FormatFromPath(%q) succeeded, want an error", path)
+		}
+	}
+}
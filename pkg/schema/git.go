@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Git scopes: a global identity applies to every repository, a project identity
+only to repositories inside the project.
+*/
+const (
+	GitScopeGlobal  = "global"
+	GitScopeProject = "project"
+)
+
+/*
+Git configures the git identity nix-foundry includes into the user's gitconfig.
+Scope defaults to project for project configs and to global otherwise.
+*/
+type Git struct {
+	Scope      string `yaml:"scope,omitempty" json:"scope,omitempty" toml:"scope,omitempty"`
+	Name       string `yaml:"name,omitempty" json:"name,omitempty" toml:"name,omitempty"`
+	Email      string `yaml:"email,omitempty" json:"email,omitempty" toml:"email,omitempty"`
+	SigningKey string `yaml:"signingKey,omitempty" json:"signingKey,omitempty" toml:"signingKey,omitempty"`
+}
+
+/*
+IsEmpty reports whether no git identity is configured.
+*/
+func (g Git) IsEmpty() bool {
+	return g.Name == "" && g.Email == "" && g.SigningKey == ""
+}
+
+/*
+ScopeFor returns the scope of g in a config of the given type.
+*/
+func (g Git) ScopeFor(configType ConfigType) string {
+	if g.Scope != "" {
+		return g.Scope
+	}
+	if configType == ProjectConfig {
+		return GitScopeProject
+	}
+	return GitScopeGlobal
+}
+
+/*
+ValidateGit checks the scope of git and that its values fit on one gitconfig
+line. A project scope is only valid in project configs.
+*/
+func ValidateGit(git Git, configType ConfigType) error {
+	switch git.Scope {
+	case "", GitScopeGlobal:
+	case GitScopeProject:
+		if configType != ProjectConfig {
+			return fmt.Errorf("git.scope %q is only valid in project configs", git.Scope)
+		}
+	default:
+		return fmt.Errorf("invalid git.scope %q (valid options: global, project)", git.Scope)
+	}
+
+	for field, value := range map[string]string{"name": git.Name, "email": git.Email, "signingKey": git.SigningKey} {
+		if strings.ContainsAny(value, "\n\r\x00") {
+			return fmt.Errorf("git.%s must be a single line", field)
+		}
+	}
+	if git.Email != "" && !strings.Contains(git.Email, "@") {
+		return fmt.Errorf("invalid git.email %q", git.Email)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package schema
+
+import "testing"
+
+func TestValidateGit(t *testing.T) {
+	tests := []struct {
+		name       string
+		git        Git
+		configType ConfigType
+		wantErr    bool
+	}{
+		{name: "global identity", git: Git{Name: "Jane Doe", Email: "jane@example.com"}, configType: UserConfig},
+		{name: "project scope in a project", git: Git{Scope: GitScopeProject, Email: "jane@example.com"}, configType: ProjectConfig},
+		{name: "project scope in a user config", git: Git{Scope: GitScopeProject}, configType: UserConfig, wantErr: true},
+		{name: "unknown scope", git: Git{Scope: "system"}, configType: UserConfig, wantErr: true},
+		{name: "multi-line name", git: Git{Name: "Jane\n[core]"}, configType: UserConfig, wantErr: true},
+		{name: "invalid email", git: Git{Email: "jane"}, configType: UserConfig, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateGit(tt.git, tt.configType); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
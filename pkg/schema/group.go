@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+PackageGroup is a named set of packages that can be switched on and off as a
+whole, such as the Kubernetes tooling of a team. Default decides whether the
+group is installed when the user has not enabled or disabled it.
+*/
+type PackageGroup struct {
+	Packages []string `yaml:"packages" json:"packages" toml:"packages"`
+	Default  bool     `yaml:"default,omitempty" json:"default,omitempty" toml:"default,omitempty"`
+}
+
+/*
+Reasons a package group is enabled or disabled, as reported by GroupStatus.
+*/
+const (
+	GroupReasonDefault  = "default"
+	GroupReasonOverride = "user override"
+)
+
+/*
+GroupStatus describes a package group of a configuration: its packages, whether
+it is enabled, and whether that comes from the group's default or the user's
+override.
+*/
+type GroupStatus struct {
+	Name     string   `yaml:"name" json:"name"`
+	Packages []string `yaml:"packages" json:"packages"`
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	Reason   string   `yaml:"reason" json:"reason"`
+}
+
+/*
+GroupEnabled reports whether the named group is enabled: the user's override
+when there is one, and the group's default otherwise.
+*/
+func (p Packages) GroupEnabled(name string) bool {
+	if enabled, ok := p.GroupOverrides[name]; ok {
+		return enabled
+	}
+	return p.Groups[name].Default
+}
+
+/*
+GroupStatuses returns the status of every group in p, sorted by name.
+*/
+func (p Packages) GroupStatuses() []GroupStatus {
+	names := make([]string, 0, len(p.Groups))
+	for name := range p.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]GroupStatus, 0, len(names))
+	for _, name := range names {
+		reason := GroupReasonDefault
+		if _, ok := p.GroupOverrides[name]; ok {
+			reason = GroupReasonOverride
+		}
+		statuses = append(statuses, GroupStatus{
+			Name:     name,
+			Packages: p.Groups[name].Packages,
+			Enabled:  p.GroupEnabled(name),
+			Reason:   reason,
+		})
+	}
+	return statuses
+}
+
+/*
+EnabledPackages returns the packages of the enabled groups in p, without
+duplicates.
+*/
+func (p Packages) EnabledPackages() []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, status := range p.GroupStatuses() {
+		if !status.Enabled {
+			continue
+		}
+		for _, pkg := range status.Packages {
+			if !seen[pkg] {
+				seen[pkg] = true
+				result = append(result, pkg)
+			}
+		}
+	}
+	return result
+}
+
+/*
+AllPackages returns the core and optional packages of p followed by the packages
+of its enabled groups, without duplicates. Pinned packages are not included.
+*/
+func (p Packages) AllPackages() []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, pkg := range append(append(append([]string{}, p.Core...), p.Optional...), p.EnabledPackages()...) {
+		if !seen[pkg] {
+			seen[pkg] = true
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+/*
+ValidateGroups checks that every package group has a valid name and valid
+package names.
+*/
+func ValidateGroups(groups map[string]PackageGroup) error {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !profileNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid package group name: %q", name)
+		}
+		for _, pkg := range groups[name].Packages {
+			if specErr := ValidatePackageSpec(pkg); specErr != nil {
+				return fmt.Errorf("package group %s: %w", name, specErr)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupStatuses(t *testing.T) {
+	pkgs := Packages{
+		Core: []string{"git"},
+		Groups: map[string]PackageGroup{
+			"kubernetes":    {Packages: []string{"kubectl", "helm"}, Default: true},
+			"frontend":      {Packages: []string{"nodejs@20", "kubectl"}},
+			"observability": {Packages: []string{"k6"}, Default: true},
+		},
+		GroupOverrides: map[string]bool{"frontend": true, "observability": false},
+	}
+
+	want := []GroupStatus{
+		{Name: "frontend", Packages: []string{"nodejs@20", "kubectl"}, Enabled: true, Reason: GroupReasonOverride},
+		{Name: "kubernetes", Packages: []string{"kubectl", "helm"}, Enabled: true, Reason: GroupReasonDefault},
+		{Name: "observability", Packages: []string{"k6"}, Enabled: false, Reason: GroupReasonOverride},
+	}
+	if got := pkgs.GroupStatuses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupStatuses() = %+v, want %+v", got, want)
+	}
+	if got := pkgs.EnabledPackages(); !reflect.DeepEqual(got, []string{"nodejs@20", "kubectl", "helm"}) {
+		t.Errorf("EnabledPackages() = %v, want the packages of enabled groups once each", got)
+	}
+	if got := pkgs.AllPackages(); !reflect.DeepEqual(got, []string{"git", "nodejs@20", "kubectl", "helm"}) {
+		t.Errorf("AllPackages() = %v, want the core packages followed by the enabled groups", got)
+	}
+
+	diff := DiffPackages([]string{"git", "k6"}, pkgs)
+	if len(diff.ToInstall) != 3 || !reflect.DeepEqual(diff.ToRemove, []string{"k6"}) {
+		t.Errorf("DiffPackages() = %+v, want enabled groups installed and disabled ones removed", diff)
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	tests := []struct {
+		groups  map[string]PackageGroup
+		wantErr bool
+	}{
+		{groups: map[string]PackageGroup{"kubernetes": {Packages: []string{"kubectl"}, Default: true}}},
+		{groups: map[string]PackageGroup{"k8s tools": {}}, wantErr: true},
+		{groups: map[string]PackageGroup{"frontend": {Packages: []string{"node js"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateGroups(tt.groups); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateGroups(%v) error = %v, wantErr %v", tt.groups, err, tt.wantErr)
+		}
+	}
+}
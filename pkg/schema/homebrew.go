@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+/*
+Homebrew lists the Homebrew formulae and casks installed on macOS alongside the
+Nix packages. Names may be qualified with their tap, e.g. hashicorp/tap/terraform.
+*/
+type Homebrew struct {
+	Formulae []string `yaml:"formulae,omitempty" json:"formulae,omitempty" toml:"formulae,omitempty"`
+	Casks    []string `yaml:"casks,omitempty" json:"casks,omitempty" toml:"casks,omitempty"`
+}
+
+var homebrewNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@+._-]*(/[A-Za-z0-9][A-Za-z0-9@+._-]*){0,2}$`)
+
+/*
+IsEmpty reports whether no formulae or casks are configured.
+*/
+func (h Homebrew) IsEmpty() bool {
+	return len(h.Formulae) == 0 && len(h.Casks) == 0
+}
+
+/*
+ValidateHomebrew checks that every formula and cask is a valid Homebrew name.
+*/
+func ValidateHomebrew(homebrew Homebrew) error {
+	for _, name := range homebrew.Formulae {
+		if !homebrewNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid Homebrew formula: %q", name)
+		}
+	}
+	for _, name := range homebrew.Casks {
+		if !homebrewNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid Homebrew cask: %q", name)
+		}
+	}
+	return nil
+}
+
+/*
+DiffHomebrew compares installed formulae or casks with the desired ones and
+returns those to install and to remove, each in sorted order.
+*/
+func DiffHomebrew(installed, desired []string) PackageDiff {
+	var diff PackageDiff
+	for _, name := range desired {
+		if !slices.Contains(installed, name) && !slices.Contains(diff.ToInstall, name) {
+			diff.ToInstall = append(diff.ToInstall, name)
+		}
+	}
+	for _, name := range installed {
+		if !slices.Contains(desired, name) {
+			diff.ToRemove = append(diff.ToRemove, name)
+		}
+	}
+	slices.Sort(diff.ToInstall)
+	slices.Sort(diff.ToRemove)
+	return diff
+}
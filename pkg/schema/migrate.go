@@ -0,0 +1,192 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+CurrentVersion is the configuration schema version this build reads and writes.
+Configurations with an older version are migrated to it when they are loaded.
+*/
+const CurrentVersion = "1.1.0"
+
+/*
+oldestVersion is assumed for configurations that do not declare a version, or
+that declare a legacy version (see isLegacyVersion).
+*/
+const oldestVersion = "1.0.0"
+
+/*
+Migration upgrades a configuration document from one schema version to the next.
+Migrate edits the document as decoded from YAML in place.
+*/
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Migrate     func(doc map[string]interface{}) error
+}
+
+/*
+AppliedMigration records a migration in the migrations log of a configuration.
+*/
+type AppliedMigration struct {
+	From        string    `yaml:"from" json:"from" toml:"from"`
+	To          string    `yaml:"to" json:"to" toml:"to"`
+	Description string    `yaml:"description" json:"description" toml:"description"`
+	Applied     time.Time `yaml:"applied" json:"applied" toml:"applied"`
+}
+
+/*
+migrations are applied in order, each to configurations at its From version.
+*/
+var migrations = []Migration{
+	{
+		From:        "1.0.0",
+		To:          "1.1.0",
+		Description: "rename nix.packages.additional to nix.packages.optional",
+		Migrate:     renameAdditionalPackages,
+	},
+}
+
+/*
+UnsupportedVersionError is returned for a configuration written by a newer
+nix-foundry than the running one.
+*/
+type UnsupportedVersionError struct {
+	Version string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("config version %s is newer than this nix-foundry supports (%s); please upgrade nix-foundry", e.Version, CurrentVersion)
+}
+
+/*
+MigrateConfig upgrades a YAML configuration to CurrentVersion. It returns the
+migrated content and the migrations applied, which are also appended to the
+migrations log of the configuration. Content that is already current is returned
+as it is, with no migrations. A configuration newer than CurrentVersion is
+rejected with an *UnsupportedVersionError rather than loaded without the fields
+this build does not know.
+*/
+func MigrateConfig(content []byte) ([]byte, []AppliedMigration, error) {
+	doc := map[string]interface{}{}
+	if unmarshalErr := yaml.Unmarshal(content, &doc); unmarshalErr != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", unmarshalErr)
+	}
+
+	version, _ := doc["version"].(string)
+	if version == "" || isLegacyVersion(version) {
+		version = oldestVersion
+	}
+	cmp, cmpErr := compareVersions(version, CurrentVersion)
+	if cmpErr != nil {
+		return nil, nil, cmpErr
+	}
+	if cmp > 0 {
+		return nil, nil, &UnsupportedVersionError{Version: version}
+	}
+	if cmp == 0 {
+		return content, nil, nil
+	}
+
+	var applied []AppliedMigration
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, migration := range migrations {
+		if cmp, _ := compareVersions(version, migration.From); cmp > 0 {
+			continue
+		}
+		if migrateErr := migration.Migrate(doc); migrateErr != nil {
+			return nil, nil, fmt.Errorf("failed to migrate config from %s to %s: %w", migration.From, migration.To, migrateErr)
+		}
+		applied = append(applied, AppliedMigration{From: version, To: migration.To, Description: migration.Description, Applied: now})
+		version = migration.To
+	}
+
+	log, _ := doc["migrations"].([]interface{})
+	for _, migration := range applied {
+		log = append(log, map[string]interface{}{
+			"from":        migration.From,
+			"to":          migration.To,
+			"description": migration.Description,
+			"applied":     migration.Applied,
+		})
+	}
+	doc["migrations"] = log
+	doc["version"] = version
+
+	migrated, marshalErr := yaml.Marshal(doc)
+	if marshalErr != nil {
+		return nil, nil, fmt.Errorf("failed to encode migrated config: %w", marshalErr)
+	}
+	return migrated, applied, nil
+}
+
+/*
+renameAdditionalPackages moves nix.packages.additional, the name optional
+packages were configured under before 1.1.0, to nix.packages.optional.
+*/
+func renameAdditionalPackages(doc map[string]interface{}) error {
+	nix, _ := doc["nix"].(map[string]interface{})
+	packages, _ := nix["packages"].(map[string]interface{})
+	additional, ok := packages["additional"]
+	if !ok {
+		return nil
+	}
+	if _, exists := packages["optional"]; exists {
+		return fmt.Errorf("nix.packages has both additional and optional packages; merge them into optional")
+	}
+	packages["optional"] = additional
+	delete(packages, "additional")
+	return nil
+}
+
+/*
+isLegacyVersion reports whether version is a label such as v1 or 1 from before
+configurations had dotted schema versions. Those configurations are 1.0.0.
+*/
+func isLegacyVersion(version string) bool {
+	number := strings.TrimPrefix(version, "v")
+	if number == "" {
+		return false
+	}
+	_, atoiErr := strconv.Atoi(number)
+	return atoiErr == nil
+}
+
+/*
+compareVersions compares two schema versions of dot-separated numbers, such as
+1.0 and 1.0.0, and returns -1, 0, or 1.
+*/
+func compareVersions(a, b string) (int, error) {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for idx := 0; idx < max(len(aParts), len(bParts)); idx++ {
+		aNum, aErr := versionPart(aParts, idx)
+		if aErr != nil {
+			return 0, fmt.Errorf("invalid config version %q", a)
+		}
+		bNum, bErr := versionPart(bParts, idx)
+		if bErr != nil {
+			return 0, fmt.Errorf("invalid config version %q", b)
+		}
+		switch {
+		case aNum < bNum:
+			return -1, nil
+		case aNum > bNum:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func versionPart(parts []string, idx int) (int, error) {
+	if idx >= len(parts) {
+		return 0, nil
+	}
+	return strconv.Atoi(parts[idx])
+}
@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	content := []byte("version: \"1.0\"\ntype: user\nnix:\n  packages:\n    core: [git]\n    additional: [jq]\n")
+
+	migrated, applied, err := MigrateConfig(content)
+	if err != nil {
+		t.Fatalf("MigrateConfig() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0].From != "1.0" || applied[0].To != "1.1.0" {
+		t.Errorf("applied = %+v, want the 1.0 to 1.1.0 migration", applied)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(migrated, config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != CurrentVersion {
+		t.Errorf("Version = %q, want %q", config.Version, CurrentVersion)
+	}
+	if len(config.Nix.Packages.Optional) != 1 || config.Nix.Packages.Optional[0] != "jq" {
+		t.Errorf("Optional = %v, want the additional packages", config.Nix.Packages.Optional)
+	}
+	if len(config.Migrations) != 1 || config.Migrations[0].Description != applied[0].Description {
+		t.Errorf("Migrations = %+v, want the applied migration logged", config.Migrations)
+	}
+
+	again, applied, err := MigrateConfig(migrated)
+	if err != nil || len(applied) != 0 || string(again) != string(migrated) {
+		t.Errorf("MigrateConfig() of a current config = %d migrations, %v; want it unchanged", len(applied), err)
+	}
+}
+
+func TestMigrateConfigLegacyVersions(t *testing.T) {
+	for _, version := range []string{"v1", "'v1'", "1"} {
+		content := []byte("version: " + version + "\ntype: user\nnix:\n  packages:\n    additional: [jq]\n")
+
+		migrated, applied, err := MigrateConfig(content)
+		if err != nil {
+			t.Fatalf("MigrateConfig(version %s) error = %v", version, err)
+		}
+		if len(applied) != 1 || applied[0].From != "1.0.0" {
+			t.Errorf("MigrateConfig(version %s) applied = %+v, want the migrations from 1.0.0", version, applied)
+		}
+		config := &Config{}
+		if err := yaml.Unmarshal(migrated, config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Version != CurrentVersion || len(config.Nix.Packages.Optional) != 1 {
+			t.Errorf("MigrateConfig(version %s) = version %q, optional %v; want a migrated config", version, config.Version, config.Nix.Packages.Optional)
+		}
+	}
+}
+
+func TestMigrateConfigRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr func(error) bool
+	}{
+		{
+			name:    "newer versions",
+			content: "version: 2.0.0\ntype: user\n",
+			wantErr: func(err error) bool {
+				var unsupported *UnsupportedVersionError
+				return errors.As(err, &unsupported) && unsupported.Version == "2.0.0"
+			},
+		},
+		{
+			name:    "invalid versions",
+			content: "version: latest\n",
+			wantErr: func(err error) bool { return err != nil },
+		},
+		{
+			name:    "additional and optional packages",
+			content: "version: 1.0.0\nnix:\n  packages:\n    optional: [jq]\n    additional: [yq]\n",
+			wantErr: func(err error) bool { return err != nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := MigrateConfig([]byte(tt.content)); !tt.wantErr(err) {
+				t.Errorf("MigrateConfig() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+DefaultNixpkgsRef is the nixpkgs branch packages are taken from unless another
+one is configured or locked.
+*/
+const DefaultNixpkgsRef = "github:NixOS/nixpkgs/nixpkgs-unstable"
+
+/*
+NixpkgsSettings selects the nixpkgs packages are installed from. Ref is a
+nixpkgs branch, channel or revision, such as nixos-24.05, or a flake reference
+such as github:NixOS/nixpkgs/nixos-24.05.
+*/
+type NixpkgsSettings struct {
+	Ref string `yaml:"ref,omitempty" json:"ref,omitempty" toml:"ref,omitempty"`
+}
+
+var nixpkgsBranchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+/*
+ValidateNixpkgsRef checks that ref is a nixpkgs branch, channel or revision name,
+or a valid flake reference. An empty ref selects DefaultNixpkgsRef.
+*/
+func ValidateNixpkgsRef(ref string) error {
+	if ref == "" || nixpkgsBranchPattern.MatchString(ref) {
+		return nil
+	}
+	if refErr := ValidateFlakeRef(ref); refErr != nil {
+		return fmt.Errorf("invalid nixpkgs ref: %w", refErr)
+	}
+	return nil
+}
+
+/*
+NixpkgsRef returns the flake reference of the configured nixpkgs: the ref as
+given when it is a flake reference, the NixOS/nixpkgs repository at that ref when
+it names a branch, channel or revision, and DefaultNixpkgsRef when none is set.
+*/
+func (n Nix) NixpkgsRef() string {
+	ref := n.Nixpkgs.Ref
+	switch {
+	case ref == "":
+		return DefaultNixpkgsRef
+	case strings.ContainsAny(ref, ":/"):
+		return ref
+	default:
+		return "github:NixOS/nixpkgs/" + ref
+	}
+}
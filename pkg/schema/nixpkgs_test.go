@@ -0,0 +1,43 @@
+package schema
+
+import "testing"
+
+func TestNixpkgsRef(t *testing.T) {
+	tests := map[string]string{
+		"":                                    DefaultNixpkgsRef,
+		"nixos-24.05":                         "github:NixOS/nixpkgs/nixos-24.05",
+		"4a8b7c1d2e3f":                        "github:NixOS/nixpkgs/4a8b7c1d2e3f",
+		"github:NixOS/nixpkgs/nixos-unstable": "github:NixOS/nixpkgs/nixos-unstable",
+		"nixpkgs/nixos-24.05":                 "nixpkgs/nixos-24.05",
+	}
+
+	for ref, want := range tests {
+		nix := Nix{Nixpkgs: NixpkgsSettings{Ref: ref}}
+		if got := nix.NixpkgsRef(); got != want {
+			t.Errorf("NixpkgsRef() with ref %q = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestValidateNixpkgsRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: ""},
+		{ref: "nixos-24.05"},
+		{ref: "nixpkgs-unstable"},
+		{ref: "github:NixOS/nixpkgs/nixos-24.05"},
+		{ref: "-nixos", wantErr: true},
+		{ref: "nixos 24.05", wantErr: true},
+		{ref: "github:NixOS/nixpkgs#hello", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if err := ValidateNixpkgsRef(tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNixpkgsRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+		})
+	}
+}
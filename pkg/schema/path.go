@@ -0,0 +1,269 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+/*
+GetValue returns the value at path in config. path is the dotted list of YAML keys
+leading to the value, such as settings.shell or nix.packages.core. Map entries are
+addressed by their key (env.EDITOR) and list items by their index
+(nix.scripts.0.name).
+*/
+func GetValue(config *Config, path string) (interface{}, error) {
+	value, lookupErr := lookupPath(reflect.ValueOf(config).Elem(), path)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return value.Interface(), nil
+}
+
+/*
+SetValue parses value according to the type at path and stores it there.
+Durations use Go duration syntax (30m), booleans true or false, and lists are
+given as comma-separated values, replacing the current list. Lists of objects
+such as scripts cannot be set this way.
+*/
+func SetValue(config *Config, path, value string) error {
+	parent, key, lookupErr := lookupParent(config, path)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	if parent.Kind() == reflect.Map {
+		parsed, parseErr := parseValue(path, value, parent.Type().Elem())
+		if parseErr != nil {
+			return parseErr
+		}
+		if parent.IsNil() {
+			parent.Set(reflect.MakeMap(parent.Type()))
+		}
+		parent.SetMapIndex(reflect.ValueOf(key).Convert(parent.Type().Key()), parsed)
+		return nil
+	}
+
+	target, childErr := child(parent, key, path)
+	if childErr != nil {
+		return childErr
+	}
+	if !target.CanSet() {
+		return fmt.Errorf("%s cannot be set from the command line; edit the config file instead", path)
+	}
+	parsed, parseErr := parseValue(path, value, target.Type())
+	if parseErr != nil {
+		return parseErr
+	}
+	target.Set(parsed)
+	return nil
+}
+
+/*
+AppendValue adds value to the list at path, such as nix.packages.core. It returns
+an error if the list already contains the value.
+*/
+func AppendValue(config *Config, path, value string) error {
+	list, listErr := lookupList(config, path)
+	if listErr != nil {
+		return listErr
+	}
+
+	item := reflect.ValueOf(value).Convert(list.Type().Elem())
+	if listIndex(list, value) >= 0 {
+		return fmt.Errorf("%s already contains %s", path, value)
+	}
+	list.Set(reflect.Append(list, item))
+	return nil
+}
+
+/*
+RemoveValue removes value from the list at path. It returns an error if the list
+does not contain the value.
+*/
+func RemoveValue(config *Config, path, value string) error {
+	list, listErr := lookupList(config, path)
+	if listErr != nil {
+		return listErr
+	}
+
+	idx := listIndex(list, value)
+	if idx < 0 {
+		return fmt.Errorf("%s does not contain %s", path, value)
+	}
+	list.Set(reflect.AppendSlice(list.Slice(0, idx), list.Slice(idx+1, list.Len())))
+	return nil
+}
+
+/*
+lookupList returns the list of strings at path.
+*/
+func lookupList(config *Config, path string) (reflect.Value, error) {
+	list, lookupErr := lookupPath(reflect.ValueOf(config).Elem(), path)
+	if lookupErr != nil {
+		return reflect.Value{}, lookupErr
+	}
+	if list.Kind() != reflect.Slice || list.Type().Elem().Kind() != reflect.String {
+		return reflect.Value{}, fmt.Errorf("%s is not a list of values", path)
+	}
+	if !list.CanSet() {
+		return reflect.Value{}, fmt.Errorf("%s cannot be changed from the command line; edit the config file instead", path)
+	}
+	return list, nil
+}
+
+/*
+listIndex returns the position of value in list, or -1.
+*/
+func listIndex(list reflect.Value, value string) int {
+	for idx := 0; idx < list.Len(); idx++ {
+		if list.Index(idx).String() == value {
+			return idx
+		}
+	}
+	return -1
+}
+
+/*
+lookupPath follows path from v and returns the value it leads to.
+*/
+func lookupPath(v reflect.Value, path string) (reflect.Value, error) {
+	if path == "" {
+		return reflect.Value{}, fmt.Errorf("config path cannot be empty")
+	}
+	return walk(v, strings.Split(path, "."), path)
+}
+
+/*
+lookupParent returns the value holding the last key of path, together with that
+key.
+*/
+func lookupParent(config *Config, path string) (reflect.Value, string, error) {
+	if path == "" {
+		return reflect.Value{}, "", fmt.Errorf("config path cannot be empty")
+	}
+
+	keys := strings.Split(path, ".")
+	parent, walkErr := walk(reflect.ValueOf(config).Elem(), keys[:len(keys)-1], path)
+	if walkErr != nil {
+		return reflect.Value{}, "", walkErr
+	}
+	return parent, keys[len(keys)-1], nil
+}
+
+/*
+walk follows keys from v. path is the full path, used in error messages.
+*/
+func walk(v reflect.Value, keys []string, path string) (reflect.Value, error) {
+	for _, key := range keys {
+		next, childErr := child(v, key, path)
+		if childErr != nil {
+			return reflect.Value{}, childErr
+		}
+		v = next
+	}
+	return v, nil
+}
+
+/*
+child returns the value under key in v: a struct field by its YAML name, a map
+entry, or a list item by its index.
+*/
+func child(v reflect.Value, key, path string) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		var keys []string
+		for idx := 0; idx < v.NumField(); idx++ {
+			name := yamlName(v.Type().Field(idx))
+			if name == key {
+				return v.Field(idx), nil
+			}
+			if name != "" {
+				keys = append(keys, name)
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("unknown config path %s: no key %q (valid keys: %s)", path, key, strings.Join(keys, ", "))
+
+	case reflect.Map:
+		entry := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !entry.IsValid() {
+			return reflect.Value{}, fmt.Errorf("unknown config path %s: %q is not set", path, key)
+		}
+		return entry, nil
+
+	case reflect.Slice:
+		idx, atoiErr := strconv.Atoi(key)
+		if atoiErr != nil || idx < 0 || idx >= v.Len() {
+			return reflect.Value{}, fmt.Errorf("unknown config path %s: %q is not an index of a list with %d items", path, key, v.Len())
+		}
+		return v.Index(idx), nil
+
+	default:
+		return reflect.Value{}, fmt.Errorf("unknown config path %s: %q is not a section", path, key)
+	}
+}
+
+/*
+yamlName returns the YAML key of a struct field, or an empty string for fields
+that are not stored in config files.
+*/
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" || !field.IsExported() {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+/*
+parseValue converts value to a value of type t.
+*/
+func parseValue(path, value string, t reflect.Type) (reflect.Value, error) {
+	if t == durationType {
+		duration, parseErr := time.ParseDuration(value)
+		if parseErr != nil {
+			return reflect.Value{}, fmt.Errorf("%s must be a duration such as 30m or 24h: %w", path, parseErr)
+		}
+		return reflect.ValueOf(duration), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(value).Convert(t), nil
+
+	case reflect.Bool:
+		parsed, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			return reflect.Value{}, fmt.Errorf("%s must be true or false", path)
+		}
+		return reflect.ValueOf(parsed).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, parseErr := strconv.ParseInt(value, 10, t.Bits())
+		if parseErr != nil {
+			return reflect.Value{}, fmt.Errorf("%s must be a whole number", path)
+		}
+		return reflect.ValueOf(parsed).Convert(t), nil
+
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			break
+		}
+		list := reflect.MakeSlice(t, 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(t.Elem()))
+			}
+		}
+		return list, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("%s cannot be set from the command line; edit the config file instead", path)
+}
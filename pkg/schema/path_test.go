@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetValue(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Nix.Packages.Core = []string{"git"}
+	config.Nix.Packages.Pinned = []PinnedPackage{{Name: "ripgrep", FlakeRef: "github:NixOS/nixpkgs/abc"}}
+	config.Env = map[string]string{"EDITOR": "nvim"}
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"settings.updateInterval", config.Settings.UpdateInterval},
+		{"nix.packages.core", []string{"git"}},
+		{"nix.packages.pinned.0.flakeRef", "github:NixOS/nixpkgs/abc"},
+		{"env.EDITOR", "nvim"},
+	}
+	for _, tt := range tests {
+		got, err := GetValue(config, tt.path)
+		if err != nil {
+			t.Errorf("GetValue(%q) error = %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetValue(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"settings.editor", "nix.packages.pinned.3.name", "env.MISSING", "settings.shell.name", ""} {
+		if _, err := GetValue(config, path); err == nil {
+			t.Errorf("GetValue(%q) succeeded, want an error", path)
+		}
+	}
+
+	_, err := GetValue(config, "settings.editor")
+	if err == nil || !strings.Contains(err.Error(), `no key "editor"`) || !strings.Contains(err.Error(), "shell") {
+		t.Errorf("GetValue() error = %v, want the unknown key and the valid keys", err)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	config := NewDefaultConfig()
+
+	for path, value := range map[string]string{
+		"settings.shell":          "zsh",
+		"settings.autoUpdate":     "false",
+		"settings.commandTimeout": "30m",
+		"nix.installConcurrency":  "4",
+		"nix.packages.optional":   "jq, ripgrep",
+		"env.EDITOR":              "nvim",
+	} {
+		if err := SetValue(config, path, value); err != nil {
+			t.Fatalf("SetValue(%q, %q) error = %v", path, value, err)
+		}
+	}
+
+	if config.Settings.Shell != "zsh" || config.Settings.AutoUpdate || config.Settings.CommandTimeout != 30*time.Minute {
+		t.Errorf("Settings = %+v, want the parsed values", config.Settings)
+	}
+	if config.Nix.InstallConcurrency != 4 || !reflect.DeepEqual(config.Nix.Packages.Optional, []string{"jq", "ripgrep"}) {
+		t.Errorf("Nix = %+v, want the parsed values", config.Nix)
+	}
+	if config.Env["EDITOR"] != "nvim" {
+		t.Errorf("Env = %v, want EDITOR set", config.Env)
+	}
+
+	for path, value := range map[string]string{
+		"settings.autoUpdate":     "sometimes",
+		"settings.updateInterval": "daily",
+		"nix.installConcurrency":  "four",
+		"nix.scripts":             "setup",
+		"settings.unknown":        "x",
+	} {
+		if err := SetValue(config, path, value); err == nil {
+			t.Errorf("SetValue(%q, %q) succeeded, want an error", path, value)
+		}
+	}
+}
+
+func TestAppendAndRemoveValue(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Nix.Packages.Core = []string{"git"}
+
+	if err := AppendValue(config, "nix.packages.core", "nodejs@20"); err != nil {
+		t.Fatalf("AppendValue() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Nix.Packages.Core, []string{"git", "nodejs@20"}) {
+		t.Errorf("Core = %v, want nodejs appended", config.Nix.Packages.Core)
+	}
+	if err := AppendValue(config, "nix.packages.core", "git"); err == nil {
+		t.Error("AppendValue() succeeded for a package already in the list")
+	}
+
+	if err := RemoveValue(config, "nix.packages.core", "git"); err != nil {
+		t.Fatalf("RemoveValue() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Nix.Packages.Core, []string{"nodejs@20"}) {
+		t.Errorf("Core = %v, want git removed", config.Nix.Packages.Core)
+	}
+	if err := RemoveValue(config, "nix.packages.core", "git"); err == nil {
+		t.Error("RemoveValue() succeeded for a package not in the list")
+	}
+
+	if err := AppendValue(config, "settings.shell", "zsh"); err == nil || !strings.Contains(err.Error(), "not a list") {
+		t.Errorf("AppendValue() error = %v, want an error for a value that is not a list", err)
+	}
+
+	config.Profiles = map[string]Profile{"work": {Packages: []string{"openconnect"}}}
+	if err := AppendValue(config, "profiles.work.packages", "slack"); err == nil || !strings.Contains(err.Error(), "edit the config file") {
+		t.Errorf("AppendValue() error = %v, want lists inside map entries refused", err)
+	}
+	if err := SetValue(config, "profiles.work.packages", "slack"); err == nil || !strings.Contains(err.Error(), "edit the config file") {
+		t.Errorf("SetValue() error = %v, want values inside map entries refused", err)
+	}
+}
@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+PinnedPackage pins a package to a specific flake reference, such as a nixpkgs
+revision (e.g. "github:NixOS/nixpkgs/4a8b7c1d" or "nixpkgs/nixos-24.05").
+*/
+type PinnedPackage struct {
+	Name     string `yaml:"name" json:"name" toml:"name"`
+	FlakeRef string `yaml:"flakeRef" json:"flakeRef" toml:"flakeRef"`
+}
+
+var (
+	packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]*$`)
+	versionPattern     = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+	ownerRepoPattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+(/[A-Za-z0-9_./-]+)?$`)
+	indirectPattern    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(/[A-Za-z0-9_./-]+)?$`)
+)
+
+/*
+PackageAttribute returns the nixpkgs attribute to install for a package entry.
+Entries of the form name@version select the versioned attribute nixpkgs provides
+for that release line, following its naming convention: "nodejs@20" becomes
+"nodejs_20" and "go@1.22" becomes "go_1_22". Other entries are returned unchanged.
+*/
+func PackageAttribute(spec string) string {
+	name, version, found := strings.Cut(spec, "@")
+	if !found {
+		return spec
+	}
+	return name + "_" + strings.ReplaceAll(version, ".", "_")
+}
+
+/*
+ValidatePackageSpec checks that a package entry is either a nixpkgs attribute name
+or a name@version pair with a numeric version.
+*/
+func ValidatePackageSpec(spec string) error {
+	name, version, found := strings.Cut(spec, "@")
+	if !packageNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid package name: %q", spec)
+	}
+	if found && !versionPattern.MatchString(version) {
+		return fmt.Errorf("invalid version in %q: expected a numeric version such as 20 or 1.22", spec)
+	}
+	return nil
+}
+
+/*
+ValidateFlakeRef checks that ref is a flake reference nix-foundry can install from.
+Supported forms are github:, gitlab:, and sourcehut: references, git+ and tarball
+URLs, path: references, and indirect registry references such as nixpkgs/nixos-24.05.
+The reference must not include an output attribute (#...); the package name is
+appended when installing.
+*/
+func ValidateFlakeRef(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("flake reference cannot be empty")
+	}
+	if strings.ContainsAny(ref, " \t\n'\"`$;&|") {
+		return fmt.Errorf("invalid flake reference %q: contains whitespace or shell metacharacters", ref)
+	}
+	if strings.Contains(ref, "#") {
+		return fmt.Errorf("invalid flake reference %q: must not include an output attribute", ref)
+	}
+
+	scheme, rest, hasScheme := strings.Cut(ref, ":")
+	if !hasScheme {
+		if !indirectPattern.MatchString(ref) {
+			return fmt.Errorf("invalid flake reference %q", ref)
+		}
+		return nil
+	}
+
+	switch scheme {
+	case "github", "gitlab", "sourcehut":
+		if !ownerRepoPattern.MatchString(strings.SplitN(rest, "?", 2)[0]) {
+			return fmt.Errorf("invalid flake reference %q: expected %s:owner/repo[/ref]", ref, scheme)
+		}
+	case "git+https", "git+ssh", "git+file", "https", "http", "tarball+https", "file":
+		if !strings.HasPrefix(rest, "//") || len(rest) <= 2 {
+			return fmt.Errorf("invalid flake reference %q: expected a URL", ref)
+		}
+	case "path":
+		if rest == "" {
+			return fmt.Errorf("invalid flake reference %q: missing path", ref)
+		}
+	case "flake":
+		if !indirectPattern.MatchString(rest) {
+			return fmt.Errorf("invalid flake reference %q", ref)
+		}
+	default:
+		return fmt.Errorf("invalid flake reference %q: unsupported type %q", ref, scheme)
+	}
+
+	return nil
+}
+
+/*
+PinnedRef returns the flake reference a package is pinned to, if any.
+*/
+func (p Packages) PinnedRef(name string) (string, bool) {
+	for _, pinned := range p.Pinned {
+		if pinned.Name == name {
+			return pinned.FlakeRef, true
+		}
+	}
+	return "", false
+}
+
+/*
+Pin pins name to ref, replacing any existing pin for the same package.
+*/
+func (p *Packages) Pin(name, ref string) {
+	for idx := range p.Pinned {
+		if p.Pinned[idx].Name == name {
+			p.Pinned[idx].FlakeRef = ref
+			return
+		}
+	}
+	p.Pinned = append(p.Pinned, PinnedPackage{Name: name, FlakeRef: ref})
+}
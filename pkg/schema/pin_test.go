@@ -0,0 +1,61 @@
+package schema
+
+import "testing"
+
+func TestValidateFlakeRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "github:NixOS/nixpkgs/4a8b7c1d2e3f"},
+		{ref: "github:NixOS/nixpkgs"},
+		{ref: "github:NixOS/nixpkgs?rev=4a8b7c1d2e3f"},
+		{ref: "nixpkgs/nixos-24.05"},
+		{ref: "git+https://github.com/NixOS/nixpkgs?ref=nixos-24.05"},
+		{ref: "https://github.com/NixOS/nixpkgs/archive/4a8b7c1d.tar.gz"},
+		{ref: "path:/home/me/nixpkgs"},
+		{ref: "", wantErr: true},
+		{ref: "github:NixOS", wantErr: true},
+		{ref: "github:NixOS/nixpkgs#hello", wantErr: true},
+		{ref: "nixpkgs; rm -rf ~", wantErr: true},
+		{ref: "ftp://example.com/nixpkgs.tar.gz", wantErr: true},
+		{ref: "https:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if err := ValidateFlakeRef(tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFlakeRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPackageAttribute(t *testing.T) {
+	tests := map[string]string{
+		"ripgrep":            "ripgrep",
+		"nodejs@20":          "nodejs_20",
+		"go@1.22":            "go_1_22",
+		"jetbrains.webstorm": "jetbrains.webstorm",
+	}
+
+	for spec, want := range tests {
+		if got := PackageAttribute(spec); got != want {
+			t.Errorf("PackageAttribute(%q) = %q, want %q", spec, got, want)
+		}
+	}
+}
+
+func TestDiffPackagesWithPins(t *testing.T) {
+	diff := DiffPackages([]string{"nodejs"}, Packages{
+		Core:   []string{"nodejs@20"},
+		Pinned: []PinnedPackage{{Name: "ripgrep", FlakeRef: "github:NixOS/nixpkgs/4a8b7c1d"}},
+	})
+
+	if len(diff.ToRemove) != 0 {
+		t.Errorf("ToRemove = %v, want none", diff.ToRemove)
+	}
+	if len(diff.ToInstall) != 1 || diff.ToInstall[0] != "ripgrep" {
+		t.Errorf("ToInstall = %v, want [ripgrep]", diff.ToInstall)
+	}
+}
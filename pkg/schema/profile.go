@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+/*
+Profile is a named set of packages and environment variables applied over the
+base configuration, such as the tools only needed on a work machine. Packages are
+added to the core packages and Env takes precedence over the base env.
+*/
+type Profile struct {
+	Packages []string          `yaml:"packages,omitempty" json:"packages,omitempty" toml:"packages,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+/*
+ProfileNames returns the names of the profiles in config in sorted order.
+*/
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+ValidateProfiles checks that every profile has a valid name, valid package names
+and valid environment variables.
+*/
+func ValidateProfiles(profiles map[string]Profile) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !profileNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid profile name: %q", name)
+		}
+		for _, pkg := range profiles[name].Packages {
+			if specErr := ValidatePackageSpec(pkg); specErr != nil {
+				return fmt.Errorf("profile %s: %w", name, specErr)
+			}
+		}
+		if envErr := ValidateEnv(profiles[name].Env); envErr != nil {
+			return fmt.Errorf("profile %s: %w", name, envErr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		profiles map[string]Profile
+		wantErr  bool
+	}{
+		{profiles: map[string]Profile{"work": {Packages: []string{"openconnect", "nodejs@20"}, Env: map[string]string{"HTTPS_PROXY": "http://proxy:3128"}}}},
+		{profiles: map[string]Profile{"work laptop": {}}, wantErr: true},
+		{profiles: map[string]Profile{"work": {Packages: []string{"bad name"}}}, wantErr: true},
+		{profiles: map[string]Profile{"work": {Env: map[string]string{"PATH": "/opt/bin"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateProfiles(tt.profiles); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateProfiles(%v) error = %v, wantErr %v", tt.profiles, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProfileNames(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Profiles = map[string]Profile{"work": {}, "personal": {}}
+
+	if got := config.ProfileNames(); !reflect.DeepEqual(got, []string{"personal", "work"}) {
+		t.Errorf("ProfileNames() = %v, want sorted names", got)
+	}
+}
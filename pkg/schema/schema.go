@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
 	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 	"gopkg.in/yaml.v3"
 )
@@ -47,16 +48,29 @@ const (
 
 /*
 Config represents the configuration file structure.
-It contains metadata, settings, and Nix-specific configuration.
+It contains metadata, settings, Nix-specific configuration, the Homebrew packages
+installed on macOS, the system packages installed on Linux, editor extensions and
+plugins, the git identity, the environment variables exported in the user's shell, named profiles
+that add packages and environment variables on top of them, the dotfiles
+exported with bundles, and the log of schema migrations applied to the file (see
+MigrateConfig).
 */
 type Config struct {
-	Version  string     `yaml:"version"`
-	Kind     string     `yaml:"kind"`
-	Type     ConfigType `yaml:"type"`
-	Base     string     `yaml:"base,omitempty"`
-	Metadata Metadata   `yaml:"metadata"`
-	Settings Settings   `yaml:"settings"`
-	Nix      Nix        `yaml:"nix"`
+	Version        string             `yaml:"version" json:"version" toml:"version"`
+	Kind           string             `yaml:"kind" json:"kind" toml:"kind"`
+	Type           ConfigType         `yaml:"type" json:"type" toml:"type"`
+	Base           string             `yaml:"base,omitempty" json:"base,omitempty" toml:"base,omitempty"`
+	Metadata       Metadata           `yaml:"metadata" json:"metadata" toml:"metadata"`
+	Settings       Settings           `yaml:"settings" json:"settings" toml:"settings"`
+	Nix            Nix                `yaml:"nix" json:"nix" toml:"nix"`
+	Homebrew       Homebrew           `yaml:"homebrew,omitempty" json:"homebrew,omitempty" toml:"homebrew,omitempty"`
+	SystemPackages SystemPackages     `yaml:"systemPackages,omitempty" json:"systemPackages,omitempty" toml:"systemPackages,omitempty"`
+	Editors        Editors            `yaml:"editors,omitempty" json:"editors,omitempty" toml:"editors,omitempty"`
+	Git            Git                `yaml:"git,omitempty" json:"git,omitempty" toml:"git,omitempty"`
+	Env            map[string]string  `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty" json:"profiles,omitempty" toml:"profiles,omitempty"`
+	Bundle         BundleSettings     `yaml:"bundle,omitempty" json:"bundle,omitempty" toml:"bundle,omitempty"`
+	Migrations     []AppliedMigration `yaml:"migrations,omitempty" json:"migrations,omitempty" toml:"migrations,omitempty"`
 }
 
 /*
@@ -64,10 +78,10 @@ Metadata contains configuration metadata including name, description,
 and timestamps for creation and updates.
 */
 type Metadata struct {
-	Name        string    `yaml:"name"`
-	Description string    `yaml:"description"`
-	Created     time.Time `yaml:"created"`
-	Updated     time.Time `yaml:"updated"`
+	Name        string    `yaml:"name" json:"name" toml:"name"`
+	Description string    `yaml:"description" json:"description" toml:"description"`
+	Created     time.Time `yaml:"created" json:"created" toml:"created"`
+	Updated     time.Time `yaml:"updated" json:"updated" toml:"updated"`
 }
 
 /*
@@ -75,40 +89,62 @@ Settings contains global settings for the configuration.
 This includes shell preferences, logging settings, and update configurations.
 */
 type Settings struct {
-	Shell          string        `yaml:"shell,omitempty"`
-	LogLevel       string        `yaml:"logLevel"`
-	AutoUpdate     bool          `yaml:"autoUpdate"`
-	UpdateInterval time.Duration `yaml:"updateInterval"`
+	Shell          string        `yaml:"shell,omitempty" json:"shell,omitempty" toml:"shell,omitempty"`
+	LogLevel       string        `yaml:"logLevel" json:"logLevel" toml:"logLevel"`
+	AutoUpdate     bool          `yaml:"autoUpdate" json:"autoUpdate" toml:"autoUpdate"`
+	UpdateInterval time.Duration `yaml:"updateInterval" json:"updateInterval" toml:"updateInterval"`
+	CommandTimeout time.Duration `yaml:"commandTimeout,omitempty" json:"commandTimeout,omitempty" toml:"commandTimeout,omitempty"`
 }
 
 /*
 Nix contains Nix-specific configuration.
-This includes package manager settings, package lists, and shell scripts.
+This includes package manager settings, the nixpkgs to install from, the systems
+generated flakes support, package lists, and shell scripts.
 */
 type Nix struct {
-	Manager  string   `yaml:"manager"`
-	Packages Packages `yaml:"packages"`
-	Scripts  []Script `yaml:"scripts,omitempty"`
+	Manager            string          `yaml:"manager" json:"manager" toml:"manager"`
+	MultiUser          bool            `yaml:"multiUser,omitempty" json:"multiUser,omitempty" toml:"multiUser,omitempty"`
+	Nixpkgs            NixpkgsSettings `yaml:"nixpkgs,omitempty" json:"nixpkgs,omitempty" toml:"nixpkgs,omitempty"`
+	AutoGC             bool            `yaml:"autoGC,omitempty" json:"autoGC,omitempty" toml:"autoGC,omitempty"`
+	InstallConcurrency int             `yaml:"installConcurrency,omitempty" json:"installConcurrency,omitempty" toml:"installConcurrency,omitempty"`
+	Systems            []string        `yaml:"systems,omitempty" json:"systems,omitempty" toml:"systems,omitempty"`
+	Packages           Packages        `yaml:"packages" json:"packages" toml:"packages"`
+	Scripts            []Script        `yaml:"scripts,omitempty" json:"scripts,omitempty" toml:"scripts,omitempty"`
 }
 
 /*
 Packages contains package lists.
-It separates packages into core (required) and optional packages.
+It separates packages into core (required) and optional packages. Groups are
+named sets of packages installed while they are enabled, and GroupOverrides
+records the groups the user has enabled or disabled.
 */
 type Packages struct {
-	Core     []string `yaml:"core,omitempty"`
-	Optional []string `yaml:"optional,omitempty"`
+	Core           []string                `yaml:"core,omitempty" json:"core,omitempty" toml:"core,omitempty"`
+	Optional       []string                `yaml:"optional,omitempty" json:"optional,omitempty" toml:"optional,omitempty"`
+	Pinned         []PinnedPackage         `yaml:"pinned,omitempty" json:"pinned,omitempty" toml:"pinned,omitempty"`
+	Groups         map[string]PackageGroup `yaml:"groups,omitempty" json:"groups,omitempty" toml:"groups,omitempty"`
+	GroupOverrides map[string]bool         `yaml:"groupOverrides,omitempty" json:"groupOverrides,omitempty" toml:"groupOverrides,omitempty"`
 }
 
 /*
 Script represents a shell script.
-It includes the script's name, description, and commands to execute.
+It includes the script's name, description, and commands to execute. Platforms
+limits the script to the listed operating systems (linux, darwin), Requires names
+scripts that must run first, and ContinueOnError lets the remaining scripts run
+when this one fails. Timeout interrupts the script when it runs longer (see
+DefaultScriptTimeout). Scope records the type of config the script was loaded
+from and is never read from or written to config files.
 */
 type Script struct {
-	Name        string          `yaml:"name"`
-	Description string          `yaml:"description"`
-	Commands    MultiLineString `yaml:"commands"`
-	RunOnce     bool            `yaml:"runOnce,omitempty"`
+	Name            string          `yaml:"name" json:"name" toml:"name"`
+	Description     string          `yaml:"description" json:"description" toml:"description"`
+	Commands        MultiLineString `yaml:"commands" json:"commands" toml:"commands"`
+	RunOnce         bool            `yaml:"runOnce,omitempty" json:"runOnce,omitempty" toml:"runOnce,omitempty"`
+	Platforms       []string        `yaml:"platforms,omitempty" json:"platforms,omitempty" toml:"platforms,omitempty"`
+	Requires        []string        `yaml:"requires,omitempty" json:"requires,omitempty" toml:"requires,omitempty"`
+	ContinueOnError bool            `yaml:"continueOnError,omitempty" json:"continueOnError,omitempty" toml:"continueOnError,omitempty"`
+	Timeout         time.Duration   `yaml:"timeout,omitempty" json:"timeout,omitempty" toml:"timeout,omitempty"`
+	Scope           ConfigType      `yaml:"-" json:"-" toml:"-"`
 }
 
 /*
@@ -118,7 +154,7 @@ It sets up a basic user configuration with standard settings.
 func NewDefaultConfig() *Config {
 	now := time.Now()
 	return &Config{
-		Version: "1.0.0",
+		Version: CurrentVersion,
 		Kind:    "Config",
 		Type:    UserConfig,
 		Metadata: Metadata{
@@ -146,7 +182,7 @@ It initializes a configuration for team-wide settings and packages.
 func NewTeamConfig(name string) *Config {
 	now := time.Now()
 	return &Config{
-		Version: "1.0.0",
+		Version: CurrentVersion,
 		Kind:    "Config",
 		Type:    TeamConfig,
 		Metadata: Metadata{
@@ -174,7 +210,7 @@ It initializes a configuration for project-specific settings and packages.
 func NewProjectConfig(name string) *Config {
 	now := time.Now()
 	return &Config{
-		Version: "1.0.0",
+		Version: CurrentVersion,
 		Kind:    "Config",
 		Type:    ProjectConfig,
 		Metadata: Metadata{
@@ -204,24 +240,137 @@ func ValidateConfig(config *Config) error {
 		return fmt.Errorf("shell setting is required for user configs")
 	}
 
+	if config.Settings.Shell != "" {
+		if shellErr := platform.ValidateShell(config.Settings.Shell); shellErr != nil {
+			return shellErr
+		}
+	}
+
 	if (config.Type == TeamConfig || config.Type == ProjectConfig) && len(config.Nix.Packages.Core) == 0 {
 		return fmt.Errorf("core packages are required for team and project configs")
 	}
 
+	if config.Nix.InstallConcurrency < 0 {
+		return fmt.Errorf("installConcurrency must not be negative")
+	}
+
+	if config.Type == TeamConfig && config.Metadata.Name != "" {
+		if nameErr := ValidateTeamName(config.Metadata.Name); nameErr != nil {
+			return nameErr
+		}
+	}
+
+	if config.Base != "" {
+		if baseErr := ValidateTeamName(config.Base); baseErr != nil {
+			return fmt.Errorf("invalid base: %w", baseErr)
+		}
+	}
+
+	if config.Settings.CommandTimeout < 0 {
+		return fmt.Errorf("commandTimeout must not be negative")
+	}
+
+	if envErr := ValidateEnv(config.Env); envErr != nil {
+		return envErr
+	}
+
+	if profileErr := ValidateProfiles(config.Profiles); profileErr != nil {
+		return profileErr
+	}
+
+	if groupErr := ValidateGroups(config.Nix.Packages.Groups); groupErr != nil {
+		return groupErr
+	}
+
+	if homebrewErr := ValidateHomebrew(config.Homebrew); homebrewErr != nil {
+		return homebrewErr
+	}
+
+	if editorsErr := ValidateEditors(config.Editors); editorsErr != nil {
+		return editorsErr
+	}
+
+	if gitErr := ValidateGit(config.Git, config.Type); gitErr != nil {
+		return gitErr
+	}
+
+	if systemErr := ValidateSystemPackages(config.SystemPackages); systemErr != nil {
+		return systemErr
+	}
+
+	if refErr := ValidateNixpkgsRef(config.Nix.Nixpkgs.Ref); refErr != nil {
+		return refErr
+	}
+
+	for _, system := range config.Nix.Systems {
+		if systemErr := platform.ValidateNixSystem(system); systemErr != nil {
+			return systemErr
+		}
+	}
+
+	if bundleErr := ValidateBundleSettings(config.Bundle); bundleErr != nil {
+		return bundleErr
+	}
+
+	if _, orderErr := OrderScripts(config.Nix.Scripts); orderErr != nil {
+		return orderErr
+	}
+
+	for _, pkg := range append(append([]string{}, config.Nix.Packages.Core...), config.Nix.Packages.Optional...) {
+		if specErr := ValidatePackageSpec(pkg); specErr != nil {
+			return specErr
+		}
+	}
+
+	for _, pinned := range config.Nix.Packages.Pinned {
+		if specErr := ValidatePackageSpec(pinned.Name); specErr != nil {
+			return specErr
+		}
+		if refErr := ValidateFlakeRef(pinned.FlakeRef); refErr != nil {
+			return fmt.Errorf("invalid pin for %s: %w", pinned.Name, refErr)
+		}
+	}
+
 	return nil
 }
 
+/*
+GetConfigDir returns the directory holding the user and team configurations (see
+paths.Resolver.ConfigDir).
+*/
+func GetConfigDir() (string, error) {
+	return paths.ConfigDir()
+}
+
 /*
 GetConfigPath returns the path to the configuration file.
-It constructs the path based on the user's home directory.
+It constructs the path based on the configuration directory (see GetConfigDir).
 */
 func GetConfigPath() (string, error) {
-	homeDir, err := platform.GetRealUserHomeDir()
+	configDir, err := GetConfigDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", err
 	}
 
-	return filepath.Join(homeDir, ".config", "nix-foundry", "config.yaml"), nil
+	return filepath.Join(configDir, "config.yaml"), nil
+}
+
+/*
+GetTeamConfigPath returns the path to the team configuration with the given name.
+Names that are not valid team names (see ValidateTeamName) are rejected, so the
+path is always inside the teams directory.
+*/
+func GetTeamConfigPath(name string) (string, error) {
+	if nameErr := ValidateTeamName(name); nameErr != nil {
+		return "", nameErr
+	}
+
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "teams", name+".yaml"), nil
 }
 
 /*
@@ -236,6 +385,7 @@ type PackageDiff struct {
 DiffPackages compares currently installed packages with desired packages and returns the differences.
 installedPackages should be the result of querying nix-env -q (using pname values).
 desiredPackages is the Packages struct from the configuration (using nixpkgs attribute names).
+The packages of its enabled groups are desired too.
 */
 func DiffPackages(installedPackages []string, desiredPackages Packages) PackageDiff {
 	var diff PackageDiff
@@ -258,6 +408,16 @@ func DiffPackages(installedPackages []string, desiredPackages Packages) PackageD
 		desiredMap[pname] = true
 		desiredToPnameMap[pname] = pkg
 	}
+	for _, pkg := range desiredPackages.EnabledPackages() {
+		pname := mapAttributeToPname(pkg)
+		desiredMap[pname] = true
+		desiredToPnameMap[pname] = pkg
+	}
+	for _, pinned := range desiredPackages.Pinned {
+		pname := mapAttributeToPname(pinned.Name)
+		desiredMap[pname] = true
+		desiredToPnameMap[pname] = pinned.Name
+	}
 
 	for pname := range desiredMap {
 		if !installedMap[pname] {
@@ -277,8 +437,11 @@ func DiffPackages(installedPackages []string, desiredPackages Packages) PackageD
 /*
 mapAttributeToPname converts nixpkgs attribute names to expected package names (pname).
 This handles the mapping between config format (jetbrains.webstorm) and installed format (webstorm).
+Versioned entries (nodejs@20) map to the unversioned pname (nodejs).
 */
 func mapAttributeToPname(attribute string) string {
+	attribute, _, _ = strings.Cut(attribute, "@")
+
 	if strings.HasPrefix(attribute, "jetbrains.") {
 		return strings.TrimPrefix(attribute, "jetbrains.")
 	}
@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+DefaultScriptTimeout bounds scripts that do not set a timeout.
+*/
+const DefaultScriptTimeout = 30 * time.Minute
+
+/*
+scriptPlatforms are the values accepted in a script's platforms list.
+*/
+var scriptPlatforms = []string{"linux", "darwin"}
+
+/*
+RunsOn reports whether the script runs on the given operating system (a GOOS
+value). Scripts without platforms run everywhere.
+*/
+func (s Script) RunsOn(goos string) bool {
+	return len(s.Platforms) == 0 || slices.Contains(s.Platforms, goos)
+}
+
+/*
+EffectiveTimeout returns the script's timeout, or DefaultScriptTimeout when it
+does not set one.
+*/
+func (s Script) EffectiveTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultScriptTimeout
+}
+
+/*
+RunsHere reports whether the script runs on the current operating system.
+*/
+func (s Script) RunsHere() bool {
+	return s.RunsOn(runtime.GOOS)
+}
+
+/*
+OrderScripts returns scripts in the order they should run: every script comes
+after the scripts it requires, and otherwise keeps its declaration order. It
+returns an error if a script requires an unknown script, the requirements form a
+cycle, or a script lists an unknown platform or a negative timeout.
+*/
+func OrderScripts(scripts []Script) ([]Script, error) {
+	byName := make(map[string][]int)
+	for idx, script := range scripts {
+		byName[script.Name] = append(byName[script.Name], idx)
+	}
+
+	for _, script := range scripts {
+		if script.Timeout < 0 {
+			return nil, fmt.Errorf("script %s: timeout must not be negative", script.Name)
+		}
+		for _, platform := range script.Platforms {
+			if !slices.Contains(scriptPlatforms, platform) {
+				return nil, fmt.Errorf("script %s: unknown platform %q (expected %s)", script.Name, platform, strings.Join(scriptPlatforms, " or "))
+			}
+		}
+		for _, required := range script.Requires {
+			if _, ok := byName[required]; !ok {
+				return nil, fmt.Errorf("script %s requires unknown script %q", script.Name, required)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(scripts))
+	ordered := make([]Script, 0, len(scripts))
+
+	var visit func(idx int, path []string) error
+	visit = func(idx int, path []string) error {
+		switch state[idx] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("scripts have a dependency cycle: %s", strings.Join(append(path, scripts[idx].Name), " -> "))
+		}
+
+		state[idx] = visiting
+		path = append(path, scripts[idx].Name)
+		for _, required := range scripts[idx].Requires {
+			for _, requiredIdx := range byName[required] {
+				if err := visit(requiredIdx, path); err != nil {
+					return err
+				}
+			}
+		}
+		state[idx] = visited
+		ordered = append(ordered, scripts[idx])
+		return nil
+	}
+
+	for idx := range scripts {
+		if err := visit(idx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
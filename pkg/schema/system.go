@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+/*
+SystemBackends are the package managers accepted in systemPackages.backend.
+*/
+var SystemBackends = []string{"apt", "dnf", "flatpak"}
+
+/*
+SystemPackages lists Linux packages that are not available in nixpkgs and are
+installed with the distribution's package manager (apt or dnf) or flatpak
+instead. Flatpak packages are application IDs, e.g. com.slack.Slack.
+*/
+type SystemPackages struct {
+	Backend  string   `yaml:"backend,omitempty" json:"backend,omitempty" toml:"backend,omitempty"`
+	Packages []string `yaml:"packages,omitempty" json:"packages,omitempty" toml:"packages,omitempty"`
+}
+
+var systemPackagePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._-]*$`)
+
+/*
+IsEmpty reports whether no system packages are configured.
+*/
+func (s SystemPackages) IsEmpty() bool {
+	return len(s.Packages) == 0
+}
+
+/*
+ValidateSystemPackages checks that packages have a known backend and valid names.
+*/
+func ValidateSystemPackages(system SystemPackages) error {
+	if system.Backend == "" && system.IsEmpty() {
+		return nil
+	}
+	if !slices.Contains(SystemBackends, system.Backend) {
+		return fmt.Errorf("unknown systemPackages backend %q (expected %s)", system.Backend, strings.Join(SystemBackends, ", "))
+	}
+	for _, pkg := range system.Packages {
+		if !systemPackagePattern.MatchString(pkg) {
+			return fmt.Errorf("invalid %s package: %q", system.Backend, pkg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package schema
+
+import "testing"
+
+func TestValidateSystemPackages(t *testing.T) {
+	tests := []struct {
+		system  SystemPackages
+		wantErr bool
+	}{
+		{system: SystemPackages{}},
+		{system: SystemPackages{Backend: "apt", Packages: []string{"openvpn", "libnss3-tools"}}},
+		{system: SystemPackages{Backend: "flatpak", Packages: []string{"com.slack.Slack"}}},
+		{system: SystemPackages{Backend: "pacman", Packages: []string{"openvpn"}}, wantErr: true},
+		{system: SystemPackages{Packages: []string{"openvpn"}}, wantErr: true},
+		{system: SystemPackages{Backend: "dnf", Packages: []string{"-y"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateSystemPackages(tt.system); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateSystemPackages(%+v) error = %v, wantErr %v", tt.system, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+)
+
+/*
+maxTeamNameLength bounds team names, which are used as file names.
+*/
+const maxTeamNameLength = 64
+
+/*
+teamNamePattern allows the characters that are safe in a file name on every
+platform. Team names start with a letter or digit, so they are never "." or ".."
+and never hidden files.
+*/
+var teamNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+/*
+ValidateTeamName checks that name can be used as the file name of a team
+configuration in the teams directory. Names that could point outside of it,
+such as ../shared or a/b, are rejected.
+*/
+func ValidateTeamName(name string) error {
+	if name == "" {
+		return fmt.Errorf("team name is required")
+	}
+	if len(name) > maxTeamNameLength || !teamNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid team name %q: use up to %d letters, digits, '.', '_' and '-', starting with a letter or digit", name, maxTeamNameLength)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package schema
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateTeamName(t *testing.T) {
+	valid := []string{"platform", "web-frontend", "team_2", "acme.sre"}
+	for _, name := range valid {
+		if err := ValidateTeamName(name); err != nil {
+			t.Errorf("ValidateTeamName(%q) error = %v", name, err)
+		}
+	}
+
+	invalid := []string{"", ".", "..", "../../evil", "a/b", `a\b`, "/etc/passwd", ".hidden", "team name", "team\x00", strings.Repeat("a", maxTeamNameLength+1)}
+	for _, name := range invalid {
+		if err := ValidateTeamName(name); err == nil {
+			t.Errorf("ValidateTeamName(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestGetTeamConfigPathStaysInTeamsDirectory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SUDO_USER", "")
+	t.Setenv("NIX_FOUNDRY_CONFIG_DIR", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	configDir, err := GetConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := GetTeamConfigPath("platform")
+	if err != nil || path != filepath.Join(configDir, "teams", "platform.yaml") {
+		t.Errorf("GetTeamConfigPath(platform) = %q, %v", path, err)
+	}
+
+	for _, name := range []string{"../../evil", "../config", "nested/team"} {
+		if path, err := GetTeamConfigPath(name); err == nil {
+			t.Errorf("GetTeamConfigPath(%q) = %q, want an error", name, path)
+		}
+	}
+}
@@ -8,10 +8,11 @@ package script
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 )
 
@@ -21,14 +22,23 @@ It provides functionality for managing and executing shell scripts
 using the provided filesystem abstraction.
 */
 type Manager struct {
-	fs filesystem.FileSystem
+	fs     filesystem.FileSystem
+	runner cmdexec.Runner
 }
 
 /*
 NewManager creates a new script manager instance with the provided filesystem.
 */
 func NewManager(fs filesystem.FileSystem) *Manager {
-	return &Manager{fs: fs}
+	return &Manager{fs: fs, runner: cmdexec.NewOSRunner()}
+}
+
+/*
+NewManagerWithRunner creates a script manager instance that runs scripts
+through the provided runner.
+*/
+func NewManagerWithRunner(fs filesystem.FileSystem, runner cmdexec.Runner) *Manager {
+	return &Manager{fs: fs, runner: runner}
 }
 
 /*
@@ -72,7 +82,7 @@ func (m *Manager) ListScripts(config *schema.Config) []schema.Script {
 /*
 RunScript executes a script from the configuration.
 It creates a temporary script file with the script content and executes it
-using the configured shell.
+using the configured shell, interrupting it after the script's timeout.
 */
 func (m *Manager) RunScript(name string, config *schema.Config) error {
 	var script schema.Script
@@ -102,10 +112,8 @@ func (m *Manager) RunScript(name string, config *schema.Config) error {
 		shell = "bash"
 	}
 
-	cmd := exec.Command(shell, scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	runner := cmdexec.WithTimeout(m.runner, script.EffectiveTimeout())
+	if err := runner.Run(platform.ShellExecutable(shell), scriptPath); err != nil {
 		return fmt.Errorf("failed to run script: %w", err)
 	}
 
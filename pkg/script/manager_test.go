@@ -0,0 +1,83 @@
+package script
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+type recordingRunner struct {
+	argv     [][]string
+	timeouts []time.Duration
+}
+
+func (r *recordingRunner) WithTimeout(d time.Duration) cmdexec.Runner {
+	r.timeouts = append(r.timeouts, d)
+	return r
+}
+
+func (r *recordingRunner) Run(name string, args ...string) error {
+	r.argv = append(r.argv, append([]string{name}, args...))
+	return nil
+}
+
+func (r *recordingRunner) Output(name string, args ...string) ([]byte, error) {
+	r.argv = append(r.argv, append([]string{name}, args...))
+	return nil, nil
+}
+
+func TestRunScript(t *testing.T) {
+	config := schema.NewDefaultConfig()
+	config.Settings.Shell = "zsh"
+	config.Nix.Scripts = []schema.Script{{Name: "setup", Commands: "echo setup\n"}}
+
+	runner := &recordingRunner{}
+	manager := NewManagerWithRunner(filesystem.NewOSFileSystem(), runner)
+	if err := manager.RunScript("setup", config); err != nil {
+		t.Fatalf("RunScript() error = %v", err)
+	}
+
+	if len(runner.argv) != 1 || len(runner.argv[0]) != 2 {
+		t.Fatalf("argv = %v, want a single shell invocation", runner.argv)
+	}
+	if runner.argv[0][0] != "zsh" || filepath.Base(runner.argv[0][1]) != "setup" {
+		t.Errorf("argv = %v, want [zsh <tmp>/setup]", runner.argv[0])
+	}
+
+	config.Settings.Shell = ""
+	if err := manager.RunScript("setup", config); err != nil {
+		t.Fatalf("RunScript() error = %v", err)
+	}
+	if runner.argv[1][0] != "bash" {
+		t.Errorf("argv = %v, want bash when no shell is configured", runner.argv[1])
+	}
+
+	if err := manager.RunScript("missing", config); err == nil {
+		t.Error("expected an error for an unknown script")
+	}
+}
+
+func TestRunScriptAppliesTimeout(t *testing.T) {
+	config := schema.NewDefaultConfig()
+	config.Nix.Scripts = []schema.Script{
+		{Name: "slow", Commands: "sleep 60\n", Timeout: 2 * time.Minute},
+		{Name: "default", Commands: "echo default\n"},
+	}
+
+	runner := &recordingRunner{}
+	manager := NewManagerWithRunner(filesystem.NewOSFileSystem(), runner)
+	for _, name := range []string{"slow", "default"} {
+		if err := manager.RunScript(name, config); err != nil {
+			t.Fatalf("RunScript(%q) error = %v", name, err)
+		}
+	}
+
+	want := []time.Duration{2 * time.Minute, schema.DefaultScriptTimeout}
+	if len(runner.timeouts) != len(want) || runner.timeouts[0] != want[0] || runner.timeouts[1] != want[1] {
+		t.Errorf("timeouts = %v, want %v", runner.timeouts, want)
+	}
+}
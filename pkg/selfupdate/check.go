@@ -0,0 +1,58 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/paths"
+)
+
+/*
+lastCheckFile is the file under the state directory that records when
+the startup update check last ran.
+*/
+const lastCheckFile = "last-update-check"
+
+/*
+CheckDue reports whether the startup update check should run: when it has not
+run within interval. A missing or unreadable record counts as due.
+*/
+func CheckDue(interval time.Duration, now time.Time) bool {
+	path, pathErr := lastCheckPath()
+	if pathErr != nil {
+		return false
+	}
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return true
+	}
+	last, parseErr := time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+	if parseErr != nil {
+		return true
+	}
+	return now.Sub(last) >= interval
+}
+
+/*
+RecordCheck records that the startup update check ran at now.
+*/
+func RecordCheck(now time.Time) error {
+	path, pathErr := lastCheckPath()
+	if pathErr != nil {
+		return pathErr
+	}
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0755); mkdirErr != nil {
+		return mkdirErr
+	}
+	return os.WriteFile(path, []byte(now.UTC().Format(time.RFC3339)+"\n"), 0644)
+}
+
+func lastCheckPath() (string, error) {
+	stateDir, dirErr := paths.StateDir()
+	if dirErr != nil {
+		return "", dirErr
+	}
+	return filepath.Join(stateDir, lastCheckFile), nil
+}
@@ -0,0 +1,349 @@
+/*
+Package selfupdate updates the nix-foundry binary from its GitHub releases.
+Releases publish one nix-foundry_<version>_<os>_<arch>.tar.gz archive per
+platform and a nix-foundry_<version>_checksums.txt file with their SHA-256 sums.
+*/
+package selfupdate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
+)
+
+/*
+Version is the version of the running binary. Release builds set it with
+-ldflags "-X github.com/shawnkhoffman/nix-foundry/pkg/selfupdate.Version=<version>".
+*/
+var Version = "dev"
+
+const (
+	// Repository is the GitHub repository releases are published to.
+	Repository = "HSixLabs/nix-foundry"
+
+	defaultAPIURL = "https://api.github.com"
+	binaryName    = "nix-foundry"
+)
+
+/*
+Release is a published nix-foundry release.
+*/
+type Release struct {
+	Version string
+	Assets  map[string]string
+}
+
+/*
+Updater checks for and installs new releases.
+*/
+type Updater struct {
+	client     *http.Client
+	downloader nix.Downloader
+	apiURL     string
+	goos       string
+	goarch     string
+}
+
+/*
+NewUpdater creates an updater for the current platform using the GitHub API.
+*/
+func NewUpdater() *Updater {
+	return &Updater{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		downloader: nix.NewHTTPDownloader(),
+		apiURL:     defaultAPIURL,
+		goos:       runtime.GOOS,
+		goarch:     runtime.GOARCH,
+	}
+}
+
+/*
+Latest returns the latest published release.
+*/
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", u.apiURL, Repository)
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, respErr := u.client.Do(req)
+	if respErr != nil {
+		return nil, fmt.Errorf("failed to query the latest release: %w", respErr)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query the latest release: GitHub returned %s", resp.Status)
+	}
+
+	var body struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if decodeErr := json.NewDecoder(resp.Body).Decode(&body); decodeErr != nil {
+		return nil, fmt.Errorf("failed to parse the latest release: %w", decodeErr)
+	}
+
+	release := &Release{Version: strings.TrimPrefix(body.TagName, "v"), Assets: make(map[string]string)}
+	for _, asset := range body.Assets {
+		release.Assets[asset.Name] = asset.URL
+	}
+	return release, nil
+}
+
+/*
+IsNewer reports whether the release is newer than the running binary. Development
+builds, which have no version, are never considered outdated.
+*/
+func (r *Release) IsNewer() bool {
+	return Version != "dev" && CompareVersions(r.Version, Version) > 0
+}
+
+/*
+CompareVersions compares two semantic versions, with or without a leading v, and
+returns -1, 0, or 1. A pre-release (1.2.0-beta.1) sorts before its release.
+*/
+func CompareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for idx := 0; idx < max(len(aParts), len(bParts)); idx++ {
+		if cmp := compareNumbers(part(aParts, idx), part(bParts, idx)); cmp != 0 {
+			return cmp
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for idx := 0; idx < max(len(aIDs), len(bIDs)); idx++ {
+		switch {
+		case idx >= len(aIDs):
+			return -1
+		case idx >= len(bIDs):
+			return 1
+		}
+		if cmp := compareIdentifiers(aIDs[idx], bIDs[idx]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func part(parts []string, idx int) string {
+	if idx < len(parts) {
+		return parts[idx]
+	}
+	return "0"
+}
+
+func compareNumbers(a, b string) int {
+	aNum, _ := strconv.Atoi(a)
+	bNum, _ := strconv.Atoi(b)
+	switch {
+	case aNum < bNum:
+		return -1
+	case aNum > bNum:
+		return 1
+	}
+	return 0
+}
+
+func compareIdentifiers(a, b string) int {
+	_, aErr := strconv.Atoi(a)
+	_, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareNumbers(a, b)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+/*
+assetName returns the name of the release archive for this platform.
+*/
+func (u *Updater) assetName(version string) string {
+	return fmt.Sprintf("%s_%s_%s_%s.tar.gz", binaryName, version, u.goos, u.goarch)
+}
+
+/*
+Update downloads the release archive for this platform, verifies it against the
+release's checksums file, and replaces the binary at executable with the one it
+contains. The new binary is written next to executable and renamed over it, so an
+interrupted update leaves the old binary in place. The old binary is moved aside
+first, because replacing a running binary in place fails with "text file busy".
+*/
+func (u *Updater) Update(ctx context.Context, release *Release, executable string) error {
+	archiveName := u.assetName(release.Version)
+	archiveURL, ok := release.Assets[archiveName]
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", release.Version, u.goos, u.goarch)
+	}
+	checksumsName := fmt.Sprintf("%s_%s_checksums.txt", binaryName, release.Version)
+	checksumsURL, ok := release.Assets[checksumsName]
+	if !ok {
+		return fmt.Errorf("release %s has no checksums file, refusing to install an unverified binary", release.Version)
+	}
+
+	tmpDir, tmpErr := os.MkdirTemp("", "nix-foundry-update-*")
+	if tmpErr != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", tmpErr)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	archivePath := filepath.Join(tmpDir, archiveName)
+	checksumsPath := filepath.Join(tmpDir, checksumsName)
+	if downloadErr := u.downloader.Download(ctx, archiveURL, archivePath, nil); downloadErr != nil {
+		return fmt.Errorf("failed to download %s: %w", archiveName, downloadErr)
+	}
+	if downloadErr := u.downloader.Download(ctx, checksumsURL, checksumsPath, nil); downloadErr != nil {
+		return fmt.Errorf("failed to download %s: %w", checksumsName, downloadErr)
+	}
+	if verifyErr := verifyChecksum(archivePath, checksumsPath, archiveName); verifyErr != nil {
+		return verifyErr
+	}
+
+	newBinary, extractErr := extractBinary(archivePath, filepath.Dir(executable))
+	if extractErr != nil {
+		return extractErr
+	}
+	defer func() { _ = os.Remove(newBinary) }()
+
+	return replaceBinary(newBinary, executable)
+}
+
+/*
+verifyChecksum checks that the SHA-256 sum of path matches the entry for name in
+a sha256sum-style checksums file.
+*/
+func verifyChecksum(path, checksumsPath, name string) error {
+	checksums, readErr := os.ReadFile(checksumsPath)
+	if readErr != nil {
+		return fmt.Errorf("failed to read checksums: %w", readErr)
+	}
+
+	var want string
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			want = strings.ToLower(fields[0])
+			break
+		}
+	}
+	if want == "" {
+		return fmt.Errorf("checksums file has no entry for %s", name)
+	}
+
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return openErr
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	if _, copyErr := io.Copy(hash, file); copyErr != nil {
+		return fmt.Errorf("failed to checksum %s: %w", name, copyErr)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	return nil
+}
+
+/*
+extractBinary extracts the nix-foundry binary from a release archive into a new
+executable file in dir and returns its path.
+*/
+func extractBinary(archivePath, dir string) (string, error) {
+	archive, openErr := os.Open(archivePath)
+	if openErr != nil {
+		return "", openErr
+	}
+	defer func() { _ = archive.Close() }()
+
+	gz, gzErr := gzip.NewReader(archive)
+	if gzErr != nil {
+		return "", fmt.Errorf("failed to read release archive: %w", gzErr)
+	}
+	tarReader := tar.NewReader(gz)
+
+	for {
+		header, nextErr := tarReader.Next()
+		if errors.Is(nextErr, io.EOF) {
+			return "", fmt.Errorf("release archive does not contain %s", binaryName)
+		}
+		if nextErr != nil {
+			return "", fmt.Errorf("failed to read release archive: %w", nextErr)
+		}
+		if header.Typeflag != tar.TypeReg || filepath.Base(header.Name) != binaryName {
+			continue
+		}
+
+		binary, createErr := os.CreateTemp(dir, "."+binaryName+".new-*")
+		if createErr != nil {
+			return "", fmt.Errorf("failed to create the new binary: %w", createErr)
+		}
+		_, copyErr := io.Copy(binary, tarReader)
+		closeErr := binary.Close()
+		if copyErr == nil {
+			copyErr = closeErr
+		}
+		if copyErr == nil {
+			copyErr = os.Chmod(binary.Name(), 0755)
+		}
+		if copyErr != nil {
+			_ = os.Remove(binary.Name())
+			return "", fmt.Errorf("failed to write the new binary: %w", copyErr)
+		}
+		return binary.Name(), nil
+	}
+}
+
+/*
+replaceBinary moves newBinary to executable. The current binary is renamed to
+executable.old first and restored if the new one cannot be moved into place.
+*/
+func replaceBinary(newBinary, executable string) error {
+	oldBinary := executable + ".old"
+	_ = os.Remove(oldBinary)
+	if renameErr := os.Rename(executable, oldBinary); renameErr != nil {
+		return fmt.Errorf("failed to move the current binary aside: %w", renameErr)
+	}
+	if renameErr := os.Rename(newBinary, executable); renameErr != nil {
+		_ = os.Rename(oldBinary, executable)
+		return fmt.Errorf("failed to install the new binary: %w", renameErr)
+	}
+	_ = os.Remove(oldBinary)
+	return nil
+}
@@ -0,0 +1,181 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/nix"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"v1.10.0", "1.9.3", 1},
+		{"1.2", "1.2.1", -1},
+		{"2.0.0", "2.0.0-beta.3", 1},
+		{"2.0.0-beta.10", "2.0.0-beta.9", 1},
+		{"2.0.0-alpha", "2.0.0-beta", -1},
+		{"2.0.0-beta", "2.0.0-beta.1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func releaseArchive(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "nix-foundry", Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+/*
+releaseServer serves a GitHub release of version 1.3.0 for linux/amd64 whose
+checksums file lists checksum for the archive.
+*/
+func releaseServer(t *testing.T, archive []byte, checksum string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + Repository + "/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": "v1.3.0", "assets": [
+				{"name": "nix-foundry_1.3.0_linux_amd64.tar.gz", "browser_download_url": "%[1]s/archive"},
+				{"name": "nix-foundry_1.3.0_checksums.txt", "browser_download_url": "%[1]s/checksums"}
+			]}`, server.URL)
+		case "/archive":
+			_, _ = w.Write(archive)
+		case "/checksums":
+			fmt.Fprintf(w, "%s  nix-foundry_1.3.0_darwin_arm64.tar.gz\n%s  nix-foundry_1.3.0_linux_amd64.tar.gz\n", strings.Repeat("0", 64), checksum)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testUpdater(apiURL string) *Updater {
+	return &Updater{
+		client:     http.DefaultClient,
+		downloader: nix.NewHTTPDownloader(),
+		apiURL:     apiURL,
+		goos:       "linux",
+		goarch:     "amd64",
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	archive := releaseArchive(t, "new binary")
+	sum := sha256.Sum256(archive)
+	server := releaseServer(t, archive, hex.EncodeToString(sum[:]))
+
+	originalVersion := Version
+	Version = "1.2.0"
+	t.Cleanup(func() { Version = originalVersion })
+
+	updater := testUpdater(server.URL)
+	release, err := updater.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if release.Version != "1.3.0" || !release.IsNewer() {
+		t.Fatalf("release = %+v, want a newer 1.3.0", release)
+	}
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "nix-foundry")
+	if err := os.WriteFile(executable, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updater.Update(context.Background(), release, executable); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	content, err := os.ReadFile(executable)
+	if err != nil || string(content) != "new binary" {
+		t.Errorf("binary = %q (%v), want the new binary", content, err)
+	}
+	if info, err := os.Stat(executable); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("binary mode = %v (%v), want 0755", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("update left files behind: %v", entries)
+	}
+}
+
+func TestUpdateRejectsChecksumMismatch(t *testing.T) {
+	archive := releaseArchive(t, "tampered binary")
+	server := releaseServer(t, archive, strings.Repeat("a", 64))
+
+	updater := testUpdater(server.URL)
+	release, err := updater.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+
+	executable := filepath.Join(t.TempDir(), "nix-foundry")
+	if err := os.WriteFile(executable, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updater.Update(context.Background(), release, executable); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Update() error = %v, want a checksum mismatch", err)
+	}
+	if content, _ := os.ReadFile(executable); string(content) != "old binary" {
+		t.Errorf("binary = %q, want the old binary kept", content)
+	}
+
+	release.Assets = map[string]string{"nix-foundry_1.3.0_linux_amd64.tar.gz": server.URL + "/archive"}
+	if err := updater.Update(context.Background(), release, executable); err == nil || !strings.Contains(err.Error(), "no checksums file") {
+		t.Errorf("Update() error = %v, want a missing checksums error", err)
+	}
+}
+
+func TestCheckDue(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if !CheckDue(24*time.Hour, now) {
+		t.Error("CheckDue() = false before any check")
+	}
+	if err := RecordCheck(now); err != nil {
+		t.Fatalf("RecordCheck() error = %v", err)
+	}
+	if CheckDue(24*time.Hour, now.Add(time.Hour)) {
+		t.Error("CheckDue() = true within the interval")
+	}
+	if !CheckDue(24*time.Hour, now.Add(25*time.Hour)) {
+		t.Error("CheckDue() = false after the interval")
+	}
+}
@@ -0,0 +1,324 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// ManagedBlockStart marks the beginning of content written by nix-foundry.
+	ManagedBlockStart = "# >>> nix-foundry managed block >>>"
+	// ManagedBlockEnd marks the end of content written by nix-foundry.
+	ManagedBlockEnd = "# <<< nix-foundry managed block <<<"
+
+	// nixInstallerBlockStart and nixInstallerBlockEnd delimit the block the upstream
+	// Nix installer writes into system shell files such as /etc/bashrc.
+	nixInstallerBlockStart = "# Nix"
+	nixInstallerBlockEnd   = "# End Nix"
+
+	// nixInstallerLineSuffix is appended by the single-user Nix installer to the
+	// line it adds to ~/.profile.
+	nixInstallerLineSuffix = "# added by Nix installer"
+)
+
+/*
+ManagedBlockContent returns the shell initialization nix-foundry maintains in the
+user's rc file: sourcing the Nix profile and adding ~/.local/bin to PATH.
+The content is not wrapped in markers; see WrapManagedBlock.
+*/
+func ManagedBlockContent(shell string) string {
+	switch shell {
+	case "nushell":
+		// Nushell cannot source the POSIX profile scripts, so the profile
+		// directories are added to PATH directly.
+		return `$env.PATH = ($env.PATH | split row (char esep)
+    | prepend [($env.HOME | path join '.nix-profile' 'bin') '/nix/var/nix/profiles/default/bin']
+    | append ($env.HOME | path join '.local' 'bin')
+    | uniq)`
+	case "fish":
+		return `if test -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
+    source '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.fish'
+else if test -e "$HOME/.nix-profile/etc/profile.d/nix.fish"
+    source "$HOME/.nix-profile/etc/profile.d/nix.fish"
+end
+
+if not contains $HOME/.local/bin $PATH
+    set -x PATH $PATH $HOME/.local/bin
+end`
+	default:
+		return `if [ -e '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh' ]; then
+    . '/nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh'
+elif [ -e "$HOME/.nix-profile/etc/profile.d/nix.sh" ]; then
+    . "$HOME/.nix-profile/etc/profile.d/nix.sh"
+fi
+
+case ":$PATH:" in
+    *":$HOME/.local/bin:"*) ;;
+    *) export PATH="$PATH:$HOME/.local/bin" ;;
+esac`
+	}
+}
+
+/*
+EnvExports returns the commands that export env in the given shell, one variable
+per line in name order. Values are quoted so they are taken literally.
+*/
+func EnvExports(shell string, env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		switch shell {
+		case "fish":
+			value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(env[name])
+			lines = append(lines, fmt.Sprintf("set -gx %s '%s'", name, value))
+		case "nushell":
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(env[name])
+			lines = append(lines, fmt.Sprintf("$env.%s = \"%s\"", name, value))
+		default:
+			lines = append(lines, fmt.Sprintf("export %s='%s'", name, strings.ReplaceAll(env[name], "'", `'\''`)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ManagedBlockWithEnv returns the complete nix-foundry managed block for shell: the
+Nix initialization of ManagedBlockContent followed by the exports of env.
+*/
+func ManagedBlockWithEnv(shell string, env map[string]string) string {
+	content := ManagedBlockContent(shell)
+	if len(env) > 0 {
+		content += "\n\n" + EnvExports(shell, env)
+	}
+	return WrapManagedBlock(content)
+}
+
+/*
+WrapManagedBlock surrounds content with the nix-foundry begin and end markers.
+*/
+func WrapManagedBlock(content string) string {
+	return fmt.Sprintf("%s\n%s\n%s\n", ManagedBlockStart, strings.TrimRight(content, "\n"), ManagedBlockEnd)
+}
+
+/*
+HasManagedBlock reports whether the content contains a nix-foundry managed block.
+*/
+func HasManagedBlock(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == ManagedBlockStart {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ManagedBlock returns the first nix-foundry managed block in content, including
+its markers, in the form WrapManagedBlock produces. ok is false when content has
+no complete managed block.
+*/
+func ManagedBlock(content string) (block string, ok bool) {
+	for _, section := range splitManagedBlocks(content) {
+		if section.managed && strings.TrimSpace(section.lines[0]) == ManagedBlockStart {
+			return strings.Join(section.lines, "\n") + "\n", true
+		}
+	}
+	return "", false
+}
+
+/*
+UpsertManagedBlock replaces the existing nix-foundry managed block in content with
+block, or adds block when no managed block exists yet. A new block is inserted
+directly after a shebang line if the content starts with one, and appended to the
+end otherwise. block must already be wrapped with WrapManagedBlock.
+*/
+func UpsertManagedBlock(content, block string) string {
+	if !HasManagedBlock(content) {
+		if strings.HasPrefix(content, "#!") {
+			shebang, rest, _ := strings.Cut(content, "\n")
+			return shebang + "\n" + block + "\n" + rest
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		return content + block
+	}
+
+	var result []string
+	inserted := false
+	for _, section := range splitManagedBlocks(content) {
+		if section.managed {
+			if !inserted {
+				result = append(result, strings.TrimRight(block, "\n"))
+				inserted = true
+			}
+			continue
+		}
+		result = append(result, section.lines...)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+/*
+RemoveManagedBlocks removes every nix-foundry managed block from content, along with
+the blocks the upstream Nix installer delimits with its own markers. Lines outside
+those markers are never touched. It returns the new content and the removed lines.
+*/
+func RemoveManagedBlocks(content string) (string, []string) {
+	var kept, removed []string
+	for _, section := range splitManagedBlocks(content) {
+		if section.managed {
+			removed = append(removed, section.lines...)
+			continue
+		}
+		kept = append(kept, section.lines...)
+	}
+
+	return strings.Join(kept, "\n"), removed
+}
+
+/*
+RemoveNixFoundryBlocks removes the nix-foundry managed blocks from content, and
+only those: unlike RemoveManagedBlocks, blocks written by the Nix installer are
+kept, so Nix keeps working after nix-foundry is removed. It returns the new
+content and the removed lines.
+*/
+func RemoveNixFoundryBlocks(content string) (string, []string) {
+	var kept, removed []string
+	for _, section := range splitManagedBlocks(content) {
+		if section.managed && strings.TrimSpace(section.lines[0]) == ManagedBlockStart {
+			removed = append(removed, section.lines...)
+			continue
+		}
+		kept = append(kept, section.lines...)
+	}
+
+	return strings.Join(kept, "\n"), removed
+}
+
+/*
+managedSection is a run of consecutive lines that are either entirely inside a
+marked block (including the markers) or entirely outside of one.
+*/
+type managedSection struct {
+	lines   []string
+	managed bool
+}
+
+/*
+splitManagedBlocks splits content into marked and unmarked sections. A start marker
+without a matching end marker is treated as ordinary content so that a truncated
+block never causes the rest of the file to be discarded.
+*/
+func splitManagedBlocks(content string) []managedSection {
+	lines := strings.Split(content, "\n")
+	var sections []managedSection
+	var current []string
+
+	flush := func(managed bool) {
+		if len(current) > 0 {
+			sections = append(sections, managedSection{lines: current, managed: managed})
+			current = nil
+		}
+	}
+
+	for idx := 0; idx < len(lines); idx++ {
+		trimmed := strings.TrimSpace(lines[idx])
+
+		if strings.HasSuffix(trimmed, nixInstallerLineSuffix) {
+			flush(false)
+			current = []string{lines[idx]}
+			flush(true)
+			continue
+		}
+
+		endMarker := ""
+		switch trimmed {
+		case ManagedBlockStart:
+			endMarker = ManagedBlockEnd
+		case nixInstallerBlockStart:
+			endMarker = nixInstallerBlockEnd
+		}
+
+		end := -1
+		if endMarker != "" {
+			for j := idx + 1; j < len(lines); j++ {
+				if strings.TrimSpace(lines[j]) == endMarker {
+					end = j
+					break
+				}
+			}
+		}
+
+		if end == -1 {
+			current = append(current, lines[idx])
+			continue
+		}
+
+		flush(false)
+		current = append(current, lines[idx:end+1]...)
+		flush(true)
+		idx = end
+	}
+	flush(false)
+
+	return sections
+}
+
+/*
+RemoveLegacyNixLines removes Nix-related lines from content using the substring
+heuristics that predate managed blocks: any "# Nix" style comment starts a block
+that runs until "# End Nix" or the next blank line, and any line mentioning Nix
+paths or variables is dropped. These heuristics can match unrelated user
+configuration, so callers should only apply them when the user explicitly asks
+for aggressive cleanup. It returns the new content and the removed lines.
+*/
+func RemoveLegacyNixLines(content string) (string, []string) {
+	var kept, removed []string
+	skipBlock := false
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+
+		if strings.Contains(trimmedLine, "# Nix") ||
+			strings.Contains(trimmedLine, "# Added by Nix") ||
+			strings.Contains(trimmedLine, "# Begin Nix") {
+			skipBlock = true
+			removed = append(removed, line)
+			continue
+		}
+
+		if skipBlock && (strings.Contains(trimmedLine, "# End Nix") || trimmedLine == "") {
+			skipBlock = false
+			if trimmedLine == "" {
+				removed = append(removed, line)
+				continue
+			}
+		}
+
+		if skipBlock ||
+			strings.Contains(line, "/nix/") ||
+			strings.Contains(line, "nix-daemon") ||
+			strings.Contains(line, ".nix-profile") ||
+			strings.Contains(line, "nix.sh") ||
+			strings.Contains(line, "NIX_") ||
+			strings.Contains(line, "NIXPKGS_") {
+			removed = append(removed, line)
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	return strings.Join(kept, "\n"), removed
+}
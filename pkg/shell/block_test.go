@@ -0,0 +1,121 @@
+package shell
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRemoveManagedBlocks(t *testing.T) {
+	block := WrapManagedBlock(ManagedBlockContent("zsh"))
+
+	tests := []struct {
+		name        string
+		content     string
+		wantContent string
+		wantRemoved int
+	}{
+		{
+			name:        "keeps unrelated nix lines outside markers",
+			content:     "export NIX_REMOTE_BUILDERS=builder\n# see /nix/store for details\n" + block,
+			wantContent: "export NIX_REMOTE_BUILDERS=builder\n# see /nix/store for details\n",
+			wantRemoved: strings.Count(block, "\n"),
+		},
+		{
+			name:        "removes upstream installer block",
+			content:     "alias ll='ls -l'\n# Nix\n. /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh\n# End Nix\n",
+			wantContent: "alias ll='ls -l'\n",
+			wantRemoved: 3,
+		},
+		{
+			name:        "keeps unterminated block",
+			content:     ManagedBlockStart + "\nexport EDITOR=vim\n",
+			wantContent: ManagedBlockStart + "\nexport EDITOR=vim\n",
+			wantRemoved: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := RemoveManagedBlocks(tt.content)
+			if got != tt.wantContent {
+				t.Errorf("RemoveManagedBlocks() content = %q, want %q", got, tt.wantContent)
+			}
+			if len(removed) != tt.wantRemoved {
+				t.Errorf("RemoveManagedBlocks() removed %d lines, want %d", len(removed), tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestRemoveNixFoundryBlocks(t *testing.T) {
+	installer := "# Nix\n. /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh\n# End Nix\n"
+	block := WrapManagedBlock(ManagedBlockContent("zsh"))
+
+	got, removed := RemoveNixFoundryBlocks("alias ll='ls -l'\n" + installer + block)
+	if want := "alias ll='ls -l'\n" + installer; got != want {
+		t.Errorf("RemoveNixFoundryBlocks() content = %q, want %q", got, want)
+	}
+	if len(removed) != strings.Count(block, "\n") {
+		t.Errorf("RemoveNixFoundryBlocks() removed %d lines, want %d", len(removed), strings.Count(block, "\n"))
+	}
+}
+
+func TestUpsertManagedBlockIsIdempotent(t *testing.T) {
+	block := WrapManagedBlock(ManagedBlockContent("bash"))
+	original := "export PS1='$ '"
+
+	once := UpsertManagedBlock(original, block)
+	twice := UpsertManagedBlock(once, block)
+
+	if once != twice {
+		t.Errorf("UpsertManagedBlock() is not idempotent:\n%q\n%q", once, twice)
+	}
+	if !strings.HasPrefix(once, original+"\n") {
+		t.Errorf("UpsertManagedBlock() did not preserve existing content: %q", once)
+	}
+	if strings.Count(once, ManagedBlockStart) != 1 {
+		t.Errorf("UpsertManagedBlock() wrote %d managed blocks, want 1", strings.Count(once, ManagedBlockStart))
+	}
+}
+
+func TestEnvExports(t *testing.T) {
+	env := map[string]string{
+		"GREETING": `it's "$HOME" \o/`,
+		"EDITOR":   "vim",
+	}
+
+	tests := map[string]string{
+		"zsh":     `export EDITOR='vim'` + "\n" + `export GREETING='it'\''s "$HOME" \o/'`,
+		"fish":    `set -gx EDITOR 'vim'` + "\n" + `set -gx GREETING 'it\'s "$HOME" \\o/'`,
+		"nushell": `$env.EDITOR = "vim"` + "\n" + `$env.GREETING = "it's \"$HOME\" \\o/"`,
+	}
+	for shell, want := range tests {
+		if got := EnvExports(shell, env); got != want {
+			t.Errorf("EnvExports(%s) = %q, want %q", shell, got, want)
+		}
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	output, err := exec.Command(bash, "-c", EnvExports("bash", env)+"\nprintf %s \"$GREETING\"").Output()
+	if err != nil {
+		t.Fatalf("bash failed: %v", err)
+	}
+	if string(output) != env["GREETING"] {
+		t.Errorf("bash expanded GREETING to %q, want %q", output, env["GREETING"])
+	}
+}
+
+func TestManagedBlockWithEnv(t *testing.T) {
+	if got, want := ManagedBlockWithEnv("zsh", nil), WrapManagedBlock(ManagedBlockContent("zsh")); got != want {
+		t.Errorf("ManagedBlockWithEnv(zsh, nil) = %q, want %q", got, want)
+	}
+
+	block := ManagedBlockWithEnv("zsh", map[string]string{"EDITOR": "vim"})
+	if !strings.Contains(block, ManagedBlockContent("zsh")) || !strings.Contains(block, "export EDITOR='vim'\n"+ManagedBlockEnd) {
+		t.Errorf("ManagedBlockWithEnv(zsh, env) = %q, want the Nix setup followed by the exports", block)
+	}
+}
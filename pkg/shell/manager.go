@@ -187,17 +187,11 @@ func (m *Manager) GetDefaultShell() string {
 }
 
 /*
-IsValidShell checks if the given shell is supported by Nix Foundry.
-Currently supports bash, zsh, and fish shells.
+IsValidShell checks if the given shell executable, such as /bin/zsh, is one of
+platform.SupportedShells.
 */
 func (m *Manager) IsValidShell(shell string) bool {
-	validShells := []string{"/bin/bash", "/bin/zsh", "/bin/fish"}
-	for _, s := range validShells {
-		if s == shell {
-			return true
-		}
-	}
-	return false
+	return platform.ValidateShell(platform.ShellName(filepath.Base(shell))) == nil
 }
 
 // GetShellConfigFile returns the configuration file path for the given shell.
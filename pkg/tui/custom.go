@@ -0,0 +1,180 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+)
+
+/*
+maxSuggestions is the number of package names suggested while typing.
+*/
+const maxSuggestions = 3
+
+/*
+handleCustomKey processes keyboard input on the step where packages are entered
+by name. Typed characters go to the input field, enter adds the package or, with
+an empty field, continues to the summary, and backspace on an empty field removes
+the last added package. Esc leaves the field for the summary.
+*/
+func (m Model) handleCustomKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.quitting = true
+		return m, tea.Quit
+
+	case tea.KeyRunes:
+		m.input += string(msg.Runes)
+		m.notice = ""
+
+	case tea.KeyBackspace:
+		m.notice = ""
+		if m.input != "" {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		} else if len(m.custom) > 0 {
+			m.custom = m.custom[:len(m.custom)-1]
+		}
+
+	case tea.KeyTab:
+		if suggestions, _ := m.suggestions(); len(suggestions) > 0 {
+			m.input = suggestions[0]
+		}
+
+	case tea.KeyEnter:
+		if strings.TrimSpace(m.input) == "" {
+			m = m.leaveCustomStep(summaryStep)
+		} else {
+			m.addCustomPackage(strings.TrimSpace(m.input))
+		}
+
+	case tea.KeyEsc, tea.KeyRight:
+		m = m.leaveCustomStep(summaryStep)
+
+	case tea.KeyLeft:
+		m = m.leaveCustomStep(customStep - 1)
+	}
+
+	return m, nil
+}
+
+/*
+leaveCustomStep moves to step, discarding any text that was not added.
+*/
+func (m Model) leaveCustomStep(step int) Model {
+	m.step = step
+	m.cursor = 0
+	m.input = ""
+	m.notice = ""
+	return m
+}
+
+/*
+addCustomPackage adds pkg to the packages entered by name unless it is already
+part of the selection.
+*/
+func (m *Model) addCustomPackage(pkg string) {
+	if slices.Contains(m.selections().Packages(), pkg) {
+		m.notice = fmt.Sprintf("%s is already selected", pkg)
+		return
+	}
+	m.custom = append(m.custom, pkg)
+	m.input = ""
+	m.notice = ""
+}
+
+/*
+known reports whether pkg is in the package index. Without an index every
+package is considered known, as there is nothing to check against.
+*/
+func (m Model) known(pkg string) bool {
+	return m.index == nil || slices.Contains(m.index, pkg)
+}
+
+/*
+suggestions returns package names matching the input: those starting with it,
+or, when there are none, those with a similar name. found reports whether the
+input itself is a known package.
+*/
+func (m Model) suggestions() (suggestions []string, found bool) {
+	if m.input == "" || m.index == nil {
+		return nil, false
+	}
+
+	for _, name := range m.index {
+		if name == m.input {
+			found = true
+		} else if strings.HasPrefix(name, m.input) && len(suggestions) < maxSuggestions {
+			suggestions = append(suggestions, name)
+		}
+	}
+	if len(suggestions) == 0 && !found {
+		suggestions = packages.SuggestPackages(m.input, m.index)
+	}
+	return suggestions, found
+}
+
+/*
+renderCustomPackages renders the step where packages are entered by name: the
+packages added so far, the input field, and whether the input is a known package.
+*/
+func (m Model) renderCustomPackages() string {
+	s := ColorCyan + "Add other packages" + ColorReset + " (enter a nixpkgs package name):\n\n"
+
+	if len(m.custom) > 0 {
+		chips := make([]string, 0, len(m.custom))
+		for _, pkg := range m.custom {
+			chips = append(chips, m.renderChip(pkg))
+		}
+		s += strings.Join(chips, " ") + "\n\n"
+	}
+
+	s += fmt.Sprintf("> %s█\n", m.input)
+
+	suggestions, found := m.suggestions()
+	switch {
+	case m.notice != "":
+		s += ColorYellow + "  " + m.notice + ColorReset + "\n"
+	case m.input == "":
+	case m.index == nil:
+		s += ColorGrey + "  Packages can't be checked until Nix has searched nixpkgs once" + ColorReset + "\n"
+	case found:
+		s += ColorGreen + "  ✓ found in nixpkgs" + ColorReset + "\n"
+	case len(suggestions) == 0:
+		s += ColorYellow + "  Not found in nixpkgs" + ColorReset + "\n"
+	}
+	if len(suggestions) > 0 {
+		s += ColorGrey + "  Suggestions: " + strings.Join(suggestions, ", ") + ColorReset + "\n"
+	}
+	return s
+}
+
+/*
+renderChip renders an added package, highlighting packages missing from the
+package index.
+*/
+func (m Model) renderChip(pkg string) string {
+	if !m.known(pkg) {
+		return ColorYellow + "[" + pkg + " ?]" + ColorReset
+	}
+	return "[" + pkg + " ×]"
+}
+
+/*
+renderCustomPackageSection renders the packages entered by name in the summary.
+*/
+func (m Model) renderCustomPackageSection() string {
+	s := "   Other Packages:"
+	if len(m.custom) == 0 {
+		return s + " None added\n\n"
+	}
+
+	s += "\n"
+	for _, pkg := range m.custom {
+		s += fmt.Sprintf("   • %s\n", pkg)
+	}
+	return s + "\n"
+}
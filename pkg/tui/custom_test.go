@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestModelCustomPackages(t *testing.T) {
+	m := InitialModel()
+	m.index = []string{"jq", "ripgrep", "ripgrep-all", "yq"}
+	m.step = 4
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyRight})
+	if m.step != customStep {
+		t.Fatalf("step = %d, want the custom package step after developer tools", m.step)
+	}
+
+	m = press(t, m, typed("rip"))
+	if view := m.View(); !strings.Contains(view, "Suggestions: ripgrep, ripgrep-all") {
+		t.Errorf("expected prefix suggestions, got:\n%s", view)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyTab}, tea.KeyMsg{Type: tea.KeyEnter})
+	if !reflect.DeepEqual(m.custom, []string{"ripgrep"}) || m.input != "" {
+		t.Fatalf("custom = %v input = %q, want ripgrep added from the suggestion", m.custom, m.input)
+	}
+
+	m = press(t, m, typed("ripgrep"), tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.custom) != 1 || !strings.Contains(m.View(), "ripgrep is already selected") {
+		t.Errorf("custom = %v, want duplicates refused with a notice, got:\n%s", m.custom, m.View())
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEsc}, tea.KeyMsg{Type: tea.KeyLeft})
+	m = press(t, m, typed("jqq"))
+	if view := m.View(); !strings.Contains(view, "Suggestions: jq") {
+		t.Errorf("expected similar names to be suggested for a typo, got:\n%s", view)
+	}
+
+	// Keys that navigate on other steps are typed into the field.
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyBackspace}, tea.KeyMsg{Type: tea.KeyBackspace}, typed("q"))
+	if m.input != "jq" || m.step != customStep {
+		t.Fatalf("input = %q step = %d, want q typed into the field", m.input, m.step)
+	}
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEnter}, typed("mytool"), tea.KeyMsg{Type: tea.KeyEnter})
+	if !strings.Contains(m.View(), ColorYellow+"[mytool ?]") {
+		t.Errorf("expected packages missing from the index to be highlighted, got:\n%s", m.View())
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyBackspace})
+	if !reflect.DeepEqual(m.custom, []string{"ripgrep", "jq"}) {
+		t.Errorf("custom = %v, want backspace on an empty field to remove the last package", m.custom)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.step != summaryStep {
+		t.Fatalf("step = %d, want enter on an empty field to continue to the summary", m.step)
+	}
+	if view := m.View(); !strings.Contains(view, "Other Packages:\n   • ripgrep\n   • jq\n") {
+		t.Errorf("expected the custom packages listed in the summary, got:\n%s", view)
+	}
+	if got := m.selections().Packages(); !reflect.DeepEqual(got, []string{"ripgrep", "jq"}) {
+		t.Errorf("Packages() = %v, want the custom packages included", got)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyLeft})
+	if m.step != customStep {
+		t.Errorf("step = %d, want left arrow on the summary to return to the custom package step", m.step)
+	}
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
+	"github.com/shawnkhoffman/nix-foundry/pkg/logging"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+)
+
+/*
+Detected holds what was found about the existing environment before the wizard
+starts: the login shell, the package of the preferred editor, and the packages
+already installed with nix-env. Empty fields were not detected.
+*/
+type Detected struct {
+	Shell    string
+	Editor   string
+	Packages []string
+}
+
+/*
+editorPackages maps the command in $EDITOR, without arguments, to the package of the matching editor
+choice.
+*/
+var editorPackages = map[string]string{
+	"code":  "vscode",
+	"subl":  "sublime",
+	"idea":  "jetbrains.idea-community",
+	"nvim":  "neovim",
+	"emacs": "emacs",
+}
+
+/*
+DetectEnvironment inspects the current environment using $SHELL, $EDITOR, and
+nix-env -q. It only reads; nothing is changed. Packages are left empty when Nix
+is not installed yet.
+*/
+func DetectEnvironment(runner cmdexec.Runner) Detected {
+	detected := Detected{}
+
+	if shell := getCurrentShell(); slices.Contains(shellOptions[:len(shellOptions)-1], shell) {
+		detected.Shell = shell
+	}
+
+	if editor := strings.Fields(os.Getenv("EDITOR")); len(editor) > 0 {
+		detected.Editor = editorPackages[filepath.Base(editor[0])]
+	}
+
+	manager, _ := packages.NewPackageManager(packages.NixEnvManager, runner)
+	installed, listErr := manager.ListInstalled()
+	if listErr != nil {
+		logging.Debug("no installed packages detected", "error", listErr)
+	} else {
+		detected.Packages = installed
+	}
+
+	return detected
+}
+
+/*
+WithDetected returns a copy of the model that starts from what was detected: the
+detected shell is highlighted unless one is already configured, and the choices
+for the editor and installed packages are preselected. Installed packages that
+are not among the choices are kept so the generated configuration includes them.
+Detected values are marked as such in the wizard and the summary.
+*/
+func (m Model) WithDetected(detected Detected) Model {
+	m.detected = detected
+	if m.shell == "" {
+		m.shell = detected.Shell
+	}
+
+	offered := make(map[string]bool)
+	for category, choices := range map[string][]string{
+		"languages": m.languageChoices,
+		"editors":   m.editorChoices,
+		"devtools":  m.devToolChoices,
+	} {
+		for _, choice := range choices {
+			if choice == chooseOwnChoice {
+				continue
+			}
+			pkg := getPackageName(choice)
+			offered[pkg] = true
+			if m.isDetected(pkg) {
+				m.selected[category][pkg] = struct{}{}
+			}
+		}
+	}
+
+	m.installed = nil
+	for _, pkg := range detected.Packages {
+		if !offered[pkg] {
+			m.installed = append(m.installed, pkg)
+		}
+	}
+	return m
+}
+
+/*
+isDetected reports whether pkg is the detected editor or an installed package.
+*/
+func (m Model) isDetected(pkg string) bool {
+	return pkg == m.detected.Editor || slices.Contains(m.detected.Packages, pkg)
+}
+
+/*
+detectedLabel returns the marker shown after detected values, or an empty string
+when detected is false.
+*/
+func detectedLabel(detected bool) string {
+	if !detected {
+		return ""
+	}
+	return " " + ColorYellow + "(detected)" + ColorReset
+}
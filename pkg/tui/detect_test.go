@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type fakeRunner struct {
+	output []byte
+	err    error
+}
+
+func (r *fakeRunner) Run(string, ...string) error { return r.err }
+
+func (r *fakeRunner) Output(string, ...string) ([]byte, error) { return r.output, r.err }
+
+func TestDetectEnvironment(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/zsh")
+	t.Setenv("EDITOR", "code --wait")
+
+	runner := &fakeRunner{output: []byte(`{"a": {"pname": "git"}, "b": {"pname": "ripgrep"}}`)}
+	got := DetectEnvironment(runner)
+	want := Detected{Shell: "zsh", Editor: "vscode", Packages: []string{"git", "ripgrep"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectEnvironment() = %+v, want %+v", got, want)
+	}
+
+	t.Setenv("SHELL", "/bin/tcsh")
+	t.Setenv("EDITOR", "")
+	got = DetectEnvironment(&fakeRunner{err: errors.New("nix-env: not found")})
+	if !reflect.DeepEqual(got, Detected{}) {
+		t.Errorf("DetectEnvironment() = %+v, want nothing detected", got)
+	}
+}
+
+func TestModelWithDetected(t *testing.T) {
+	m := InitialModel().WithDetected(Detected{
+		Shell:    "fish",
+		Editor:   "neovim",
+		Packages: []string{"git", "ripgrep"},
+	})
+
+	selections := m.selections()
+	if got := selections.Packages(); !reflect.DeepEqual(got, []string{"neovim", "git", "ripgrep"}) {
+		t.Errorf("Packages() = %v, want [neovim git ripgrep]", got)
+	}
+	if selections.Shell != "fish" {
+		t.Errorf("Shell = %q, want fish", selections.Shell)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.cursor != 2 || !strings.Contains(m.View(), "fish"+detectedLabel(true)) {
+		t.Errorf("expected fish to be highlighted and marked as detected, got:\n%s", m.View())
+	}
+
+	m.step, m.cursor = 4, 0
+	if !strings.Contains(m.View(), "] Git"+detectedLabel(true)) {
+		t.Errorf("expected Git to be marked as detected, got:\n%s", m.View())
+	}
+
+	m.step = summaryStep
+	view := m.View()
+	if !strings.Contains(view, "Will configure fish as your shell"+detectedLabel(true)) {
+		t.Errorf("expected the shell to be marked as detected in the summary, got:\n%s", view)
+	}
+	if !strings.Contains(view, "• ripgrep"+detectedLabel(true)) {
+		t.Errorf("expected installed packages in the summary, got:\n%s", view)
+	}
+
+	configured := InitialModelFromConfig(nil)
+	configured.shell = "bash"
+	if got := configured.WithDetected(Detected{Shell: "fish"}).shell; got != "bash" {
+		t.Errorf("shell = %q, want the configured shell to win", got)
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
+	"github.com/shawnkhoffman/nix-foundry/pkg/packages"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 )
 
 /*
@@ -24,7 +28,10 @@ type Model struct {
 	editorChoices      []string
 	devToolChoices     []string
 	cursor             int
-	selected           map[string]map[int]struct{}
+	selected           map[string]map[string]struct{}
+	query              string
+	offset             int
+	listHeight         int
 	step               int
 	manager            string
 	shell              string
@@ -34,14 +41,51 @@ type Model struct {
 	chooseOwnLanguages bool
 	chooseOwnEditors   bool
 	chooseOwnDevTools  bool
+	detected           Detected
+	installed          []string
+	custom             []string
+	input              string
+	notice             string
+	index              []string
 }
 
+/*
+chooseOwnChoice is the last entry of every package list. It is always shown,
+regardless of the filter, so a custom selection remains reachable.
+*/
+const chooseOwnChoice = "I'll choose my own"
+
+/*
+shellOptions are the shells offered on the shell step, in display order. The
+last entry stands for "I'll choose my own".
+*/
+var shellOptions = append(append([]string{}, platform.SupportedShells...), "custom")
+
+const (
+	// customStep is the step on which packages that are not among the choices
+	// are entered.
+	customStep = 5
+	// summaryStep is the final step, showing the installation summary.
+	summaryStep = 6
+)
+
+const (
+	// defaultListHeight is the number of choices shown at once before the
+	// terminal size is known.
+	defaultListHeight = 10
+	// minListHeight is the smallest viewport used on short terminals.
+	minListHeight = 3
+	// listChrome is the number of lines around a choice list: the title,
+	// filter, scroll indicators, and navigation help.
+	listChrome = 12
+)
+
 /*
 getCurrentShell retrieves the current user's shell from the environment.
 */
 func getCurrentShell() string {
 	shell := os.Getenv("SHELL")
-	return filepath.Base(shell)
+	return platform.ShellName(filepath.Base(shell))
 }
 
 /*
@@ -55,7 +99,7 @@ func InitialModel() Model {
 			"Golang (go)",
 			"Java (openjdk + maven)",
 			"C/C++ (gcc + make)",
-			"I'll choose my own",
+			chooseOwnChoice,
 		},
 		editorChoices: []string{
 			"VS Code",
@@ -63,7 +107,7 @@ func InitialModel() Model {
 			"IntelliJ IDEA",
 			"Neovim",
 			"GNU Emacs",
-			"I'll choose my own",
+			chooseOwnChoice,
 		},
 		devToolChoices: []string{
 			"Git",
@@ -71,17 +115,73 @@ func InitialModel() Model {
 			"Kubernetes CLI (kubectl)",
 			"Terraform",
 			"GitHub CLI",
-			"I'll choose my own",
+			chooseOwnChoice,
 		},
-		selected: map[string]map[int]struct{}{
-			"languages": make(map[int]struct{}),
-			"editors":   make(map[int]struct{}),
-			"devtools":  make(map[int]struct{}),
+		selected: map[string]map[string]struct{}{
+			"languages": make(map[string]struct{}),
+			"editors":   make(map[string]struct{}),
+			"devtools":  make(map[string]struct{}),
 		},
-		manager: "nix-env",
+		manager:    "nix-env",
+		listHeight: defaultListHeight,
 	}
 }
 
+/*
+InitialModelFromConfig creates an installation model that starts from an existing
+configuration, so the wizard edits the current setup instead of starting over.
+Choices whose package is in the configuration's core or optional packages are
+preselected, and the configured shell is highlighted on the shell step. The
+package manager is kept as well.
+*/
+func InitialModelFromConfig(cfg *schema.Config) Model {
+	m := InitialModel()
+	if cfg == nil {
+		return m
+	}
+
+	if cfg.Nix.Manager != "" {
+		m.manager = cfg.Nix.Manager
+	}
+	m.shell = cfg.Settings.Shell
+
+	configured := make(map[string]bool)
+	for _, pkg := range append(append([]string{}, cfg.Nix.Packages.Core...), cfg.Nix.Packages.Optional...) {
+		name, _, _ := strings.Cut(pkg, "@")
+		configured[name] = true
+	}
+
+	for category, choices := range map[string][]string{
+		"languages": m.languageChoices,
+		"editors":   m.editorChoices,
+		"devtools":  m.devToolChoices,
+	} {
+		for _, choice := range choices {
+			if choice == chooseOwnChoice {
+				continue
+			}
+			if pkg := getPackageName(choice); configured[pkg] {
+				m.selected[category][pkg] = struct{}{}
+			}
+		}
+	}
+
+	return m
+}
+
+/*
+shellCursor returns the position of the selected shell on the shell step, or 0
+when no shell is selected yet.
+*/
+func (m Model) shellCursor() int {
+	for i, shell := range shellOptions {
+		if shell == m.shell {
+			return i
+		}
+	}
+	return 0
+}
+
 // Init initializes the TUI model and returns the initial command.
 func (m Model) Init() tea.Cmd {
 	return nil
@@ -96,24 +196,113 @@ func (m Model) getMaxCursor() int {
 		return 1
 	case 1:
 		if !m.skipWizard {
-			return 3
+			return len(shellOptions) - 1
 		}
+	case 2, 3, 4:
+		return len(m.visibleChoices()) - 1
+	case summaryStep:
+		return 1
+	}
+	return 0
+}
+
+/*
+stepChoices returns the category, the full list of choices, and the "choose my
+own" flag for the current selection step. category is empty outside of the
+selection steps.
+*/
+func (m *Model) stepChoices() (string, []string, *bool) {
+	switch m.step {
 	case 2:
-		return len(m.languageChoices) - 1
+		return "languages", m.languageChoices, &m.chooseOwnLanguages
 	case 3:
-		return len(m.editorChoices) - 1
+		return "editors", m.editorChoices, &m.chooseOwnEditors
 	case 4:
-		return len(m.devToolChoices) - 1
-	case 5:
-		return 1
+		return "devtools", m.devToolChoices, &m.chooseOwnDevTools
 	}
-	return 0
+	return "", nil, nil
 }
 
 /*
-handleKeyPress processes keyboard input and updates the model state.
+visibleChoices returns the choices of the current step that contain the filter
+query, ignoring case. The "choose my own" entry is always included.
+*/
+func (m Model) visibleChoices() []string {
+	_, choices, _ := m.stepChoices()
+	query := strings.ToLower(m.query)
+
+	var visible []string
+	for _, choice := range choices {
+		if choice == chooseOwnChoice || strings.Contains(strings.ToLower(choice), query) {
+			visible = append(visible, choice)
+		}
+	}
+	return visible
+}
+
+/*
+setQuery updates the filter query and moves the cursor to the top of the
+filtered list.
+*/
+func (m *Model) setQuery(query string) {
+	m.query = query
+	m.cursor = 0
+	m.offset = 0
+}
+
+/*
+scrollToCursor moves the viewport of the choice list so that the cursor is
+visible, scrolling by as little as possible.
+*/
+func (m *Model) scrollToCursor() {
+	switch {
+	case m.cursor < m.offset:
+		m.offset = m.cursor
+	case m.cursor >= m.offset+m.listHeight:
+		m.offset = m.cursor - m.listHeight + 1
+	}
+}
+
+/*
+handleFilterKey updates the filter query while on a selection step. Typed
+characters extend the query, backspace removes the last character, and escape
+clears it. It reports whether the key was consumed.
+*/
+func (m *Model) handleFilterKey(msg tea.KeyMsg) bool {
+	if m.step < 2 || m.step > 4 {
+		return false
+	}
+
+	switch msg.Type {
+	case tea.KeyRunes:
+		m.setQuery(m.query + string(msg.Runes))
+		return true
+	case tea.KeyBackspace:
+		if m.query != "" {
+			runes := []rune(m.query)
+			m.setQuery(string(runes[:len(runes)-1]))
+		}
+		return true
+	case tea.KeyEsc:
+		m.setQuery("")
+		return true
+	}
+	return false
+}
+
+/*
+handleKeyPress processes keyboard input and updates the model state. On the
+package selection steps, typed characters filter the list instead of acting as
+shortcuts; the arrow keys, space, and enter keep working.
 */
 func (m Model) handleKeyPress(msg tea.KeyMsg) (Model, tea.Cmd) {
+	if m.handleFilterKey(msg) {
+		return m, nil
+	}
+	if m.step == customStep {
+		return m.handleCustomKey(msg)
+	}
+
 	switch msg.String() {
 	case "ctrl+c", "q":
 		m.quitting = true
@@ -123,16 +312,18 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (Model, tea.Cmd) {
 		if m.cursor > 0 {
 			m.cursor--
 		}
+		m.scrollToCursor()
 
 	case "down", "j":
 		maxCursor := m.getMaxCursor()
 		if m.cursor < maxCursor {
 			m.cursor++
 		}
+		m.scrollToCursor()
 
 	case "enter":
 		m = m.handleEnter()
-		if m.step == 5 && m.confirmed {
+		if m.step == summaryStep && m.confirmed {
 			return m, tea.Quit
 		}
 
@@ -144,13 +335,13 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (Model, tea.Cmd) {
 	case "right", "l":
 		if m.step >= 2 && m.step <= 4 {
 			m.step++
-			m.cursor = 0
+			m.setQuery("")
 		}
 
 	case "left", "h":
-		if m.step >= 1 && m.step <= 5 && !m.skipWizard {
+		if m.step >= 1 && m.step <= summaryStep && !m.skipWizard {
 			m.step--
-			m.cursor = 0
+			m.setQuery("")
 		}
 	}
 
@@ -165,15 +356,14 @@ func (m Model) handleEnter() Model {
 	case 0:
 		m.skipWizard = m.cursor == 1
 		m.step++
-		m.cursor = 0
+		m.cursor = m.shellCursor()
 		if m.skipWizard {
-			m.step = 5
+			m.step = summaryStep
 		}
 
 	case 1:
 		if !m.skipWizard {
-			shells := []string{"bash", "zsh", "fish", "custom"}
-			m.shell = shells[m.cursor]
+			m.shell = shellOptions[m.cursor]
 			m.step++
 			m.cursor = 0
 		}
@@ -181,7 +371,7 @@ func (m Model) handleEnter() Model {
 	case 2, 3, 4:
 		m.handleSelection()
 
-	case 5:
+	case summaryStep:
 		m.confirmed = m.cursor == 0
 	}
 
@@ -193,67 +383,51 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		return m.handleKeyPress(msg)
+	case tea.WindowSizeMsg:
+		m.listHeight = max(msg.Height-listChrome, minListHeight)
+		m.scrollToCursor()
 	}
 	return m, nil
 }
 
 /*
 handleSelection processes selection changes for languages, editors, and dev tools.
+Selections are keyed by package name so that they survive changes to the filter.
 */
 func (m *Model) handleSelection() {
-	var category string
-	var choices []string
-	var chooseOwn *bool
-	var selections map[int]struct{}
-
-	switch m.step {
-	case 2:
-		category = "languages"
-		choices = m.languageChoices
-		chooseOwn = &m.chooseOwnLanguages
-		selections = m.selected[category]
-	case 3:
-		category = "editors"
-		choices = m.editorChoices
-		chooseOwn = &m.chooseOwnEditors
-		selections = m.selected[category]
-	case 4:
-		category = "devtools"
-		choices = m.devToolChoices
-		chooseOwn = &m.chooseOwnDevTools
-		selections = m.selected[category]
+	category, _, chooseOwn := m.stepChoices()
+	visible := m.visibleChoices()
+	if category == "" || m.cursor >= len(visible) {
+		return
 	}
 
-	lastIndex := len(choices) - 1
-	if m.cursor == lastIndex {
-		m.handleChooseOwnSelection(category, chooseOwn, lastIndex)
+	choice := visible[m.cursor]
+	if choice == chooseOwnChoice {
+		m.handleChooseOwnSelection(category, chooseOwn)
 	} else {
-		m.handleRegularSelection(selections, chooseOwn)
+		m.handleRegularSelection(m.selected[category], chooseOwn, getPackageName(choice))
 	}
 }
 
 /*
 handleChooseOwnSelection handles the "I'll choose my own" option selection.
 */
-func (m *Model) handleChooseOwnSelection(category string, chooseOwn *bool, lastIndex int) {
+func (m *Model) handleChooseOwnSelection(category string, chooseOwn *bool) {
 	*chooseOwn = !*chooseOwn
 	if *chooseOwn {
-		m.selected[category] = make(map[int]struct{})
-		m.selected[category][lastIndex] = struct{}{}
-	} else {
-		delete(m.selected[category], lastIndex)
+		m.selected[category] = make(map[string]struct{})
 	}
 }
 
 /*
 handleRegularSelection handles regular option selection.
 */
-func (m *Model) handleRegularSelection(selections map[int]struct{}, chooseOwn *bool) {
+func (m *Model) handleRegularSelection(selections map[string]struct{}, chooseOwn *bool, pkg string) {
 	if !*chooseOwn {
-		if _, ok := selections[m.cursor]; ok {
-			delete(selections, m.cursor)
+		if _, ok := selections[pkg]; ok {
+			delete(selections, pkg)
 		} else {
-			selections[m.cursor] = struct{}{}
+			selections[pkg] = struct{}{}
 		}
 	}
 }
@@ -290,14 +464,18 @@ renderShellSelection renders the shell selection screen.
 func (m Model) renderShellSelection() string {
 	s := ColorCyan + "Choose shell:" + ColorReset + "\n\n"
 	currentShell := getCurrentShell()
-	shells := []string{"bash", "zsh", "fish", "I'll choose my own"}
-	for i, shell := range shells {
+	for i, shell := range shellOptions {
+		if shell == "custom" {
+			shell = chooseOwnChoice
+		}
 		cursor := " "
 		if m.cursor == i {
 			cursor = ">"
 		}
 		current := ""
-		if shell == currentShell {
+		if shell == m.detected.Shell {
+			current = detectedLabel(true)
+		} else if shell == currentShell {
 			current = " " + ColorYellow + "(current)" + ColorReset
 		}
 		s += fmt.Sprintf("%s %s%s\n", cursor, shell, current)
@@ -306,25 +484,49 @@ func (m Model) renderShellSelection() string {
 }
 
 /*
-renderChoiceList renders a list of choices with selection indicators.
+renderChoiceList renders the visible choices of the current step with selection
+indicators, preceded by the filter query when one is set. Only listHeight choices
+are shown at a time; indicators mark more choices above or below the viewport.
 */
-func (m Model) renderChoiceList(title string, choices []string, category string, chooseOwn bool) string {
+func (m Model) renderChoiceList(title string, category string, chooseOwn bool) string {
 	s := ColorCyan + title + ColorReset + " (space to select, right arrow to continue):\n\n"
-	for i, choice := range choices {
+	if m.query != "" {
+		s += fmt.Sprintf("Filter: %s\n\n", m.query)
+	}
+
+	visible := m.visibleChoices()
+	if len(visible) == 1 && m.query != "" {
+		s += ColorGrey + "  No matches" + ColorReset + "\n"
+	}
+
+	end := min(m.offset+m.listHeight, len(visible))
+	if m.offset > 0 {
+		s += ColorGrey + "  ▲ more" + ColorReset + "\n"
+	}
+
+	for i := m.offset; i < end; i++ {
+		choice := visible[i]
 		cursor := " "
 		if m.cursor == i {
 			cursor = ">"
 		}
+
+		isChooseOwn := choice == chooseOwnChoice
 		checked := " "
-		if _, ok := m.selected[category][i]; ok {
+		if _, ok := m.selected[category][getPackageName(choice)]; (ok && !isChooseOwn) || (isChooseOwn && chooseOwn) {
 			checked = ColorGreen + "x" + ColorReset
 		}
-		if chooseOwn && i != len(choices)-1 {
-			s += fmt.Sprintf("%s [%s] %s%s%s\n", cursor, checked, ColorGrey, choice, ColorReset)
+		label := detectedLabel(!isChooseOwn && m.isDetected(getPackageName(choice)))
+		if chooseOwn && !isChooseOwn {
+			s += fmt.Sprintf("%s [%s] %s%s%s%s\n", cursor, checked, ColorGrey, choice, ColorReset, label)
 		} else {
-			s += fmt.Sprintf("%s [%s] %s\n", cursor, checked, choice)
+			s += fmt.Sprintf("%s [%s] %s%s\n", cursor, checked, choice, label)
 		}
 	}
+
+	if end < len(visible) {
+		s += ColorGrey + "  ▼ more" + ColorReset + "\n"
+	}
 	return s
 }
 
@@ -391,14 +593,22 @@ func (m Model) renderDetailedConfigurationSection() string {
 	if m.shell == "custom" {
 		s += "   • You'll configure your shell later\n"
 	} else {
-		s += fmt.Sprintf("   • Will configure %s as your shell\n", m.shell)
+		s += fmt.Sprintf("   • Will configure %s as your shell%s\n", m.shell, detectedLabel(m.shell == m.detected.Shell))
 	}
 	s += "\n"
 
 	s += ColorBold + ColorCyan + "3. Package Installation:" + ColorReset + "\n"
-	s += m.renderPackageSection("Languages", "languages", m.languageChoices)
-	s += m.renderPackageSection("Editors", "editors", m.editorChoices)
-	s += m.renderPackageSection("Developer Tools", "devtools", m.devToolChoices)
+	s += m.renderPackageSection("Languages", "languages", m.languageChoices, m.chooseOwnLanguages)
+	s += m.renderPackageSection("Editors", "editors", m.editorChoices, m.chooseOwnEditors)
+	s += m.renderPackageSection("Developer Tools", "devtools", m.devToolChoices, m.chooseOwnDevTools)
+	s += m.renderCustomPackageSection()
+	if len(m.installed) > 0 {
+		s += "   Already installed:\n"
+		for _, pkg := range m.installed {
+			s += fmt.Sprintf("   • %s%s\n", pkg, detectedLabel(true))
+		}
+		s += "\n"
+	}
 
 	return s
 }
@@ -406,20 +616,20 @@ func (m Model) renderDetailedConfigurationSection() string {
 /*
 renderPackageSection renders a section of selected packages.
 */
-func (m Model) renderPackageSection(title, category string, choices []string) string {
+func (m Model) renderPackageSection(title, category string, choices []string, chooseOwn bool) string {
 	s := fmt.Sprintf("   %s:", title)
-	if _, ok := m.selected[category][len(choices)-1]; ok {
+	if chooseOwn {
 		s += " Will configure later\n"
 	} else if len(m.selected[category]) > 0 {
 		s += "\n"
 		var selected []string
-		for i := 0; i < len(choices)-1; i++ {
-			if _, ok := m.selected[category][i]; ok {
-				selected = append(selected, choices[i])
+		for _, choice := range choices {
+			if _, ok := m.selected[category][getPackageName(choice)]; ok && choice != chooseOwnChoice {
+				selected = append(selected, choice)
 			}
 		}
 		for _, item := range selected {
-			s += fmt.Sprintf("   • %s\n", item)
+			s += fmt.Sprintf("   • %s%s\n", item, detectedLabel(m.isDetected(getPackageName(item))))
 		}
 	} else {
 		s += " None selected\n"
@@ -444,11 +654,17 @@ func (m Model) renderPostInstallationSection() string {
 renderNavigationHelp renders navigation help text.
 */
 func (m Model) renderNavigationHelp() string {
+	if m.step == customStep {
+		s := "(type a package name, enter to add it, tab to complete the first suggestion)\n"
+		s += "(backspace on an empty field removes the last package, left arrow to go back, esc or right arrow to continue)\n"
+		return s
+	}
+
 	s := "(use arrow keys to navigate, enter to select)\n"
 	if m.step >= 1 && m.step <= 4 && !m.skipWizard {
 		s += "(left arrow to go back, "
 		if m.step >= 2 && m.step <= 4 {
-			s += "space to toggle selection, "
+			s += "space to toggle selection, type to filter, "
 		}
 		s += "right arrow to continue)\n"
 	}
@@ -465,12 +681,14 @@ func (m Model) View() string {
 	case 1:
 		s += m.renderShellSelection()
 	case 2:
-		s += m.renderChoiceList("Select programming languages", m.languageChoices, "languages", m.chooseOwnLanguages)
+		s += m.renderChoiceList("Select programming languages", "languages", m.chooseOwnLanguages)
 	case 3:
-		s += m.renderChoiceList("Select editors", m.editorChoices, "editors", m.chooseOwnEditors)
+		s += m.renderChoiceList("Select editors", "editors", m.chooseOwnEditors)
 	case 4:
-		s += m.renderChoiceList("Select developer tools", m.devToolChoices, "devtools", m.chooseOwnDevTools)
-	case 5:
+		s += m.renderChoiceList("Select developer tools", "devtools", m.chooseOwnDevTools)
+	case customStep:
+		s += m.renderCustomPackages()
+	case summaryStep:
 		s += m.renderInstallationSummary()
 	}
 
@@ -495,6 +713,8 @@ func getPackageName(displayName string) string {
 		return "gcc"
 	case strings.HasPrefix(displayName, "VS Code"):
 		return "vscode"
+	case displayName == "GNU Emacs":
+		return "emacs"
 	case strings.HasPrefix(displayName, "IntelliJ"):
 		return "jetbrains.idea-community"
 	case strings.HasPrefix(displayName, "Kubernetes CLI"):
@@ -512,40 +732,155 @@ func getPackageName(displayName string) string {
 	}
 }
 
+/*
+CategorySelection is the outcome of one package step of the wizard. Offered holds
+the packages the step offered as choices. Deferred is set when the user chose to
+configure the category later, which is distinct from leaving it empty.
+*/
+type CategorySelection struct {
+	Packages []string
+	Offered  []string
+	Deferred bool
+}
+
+/*
+Selections holds the choices made in the installation wizard. Custom holds the
+packages entered by name, and Installed the detected packages that the wizard
+does not offer as choices.
+*/
+type Selections struct {
+	Manager   string
+	Shell     string
+	Languages CategorySelection
+	Editors   CategorySelection
+	DevTools  CategorySelection
+	Custom    []string
+	Installed []string
+	Confirmed bool
+}
+
+/*
+Packages returns the selected package names of all categories in the order they
+appear in the wizard, followed by the packages entered by name and the installed
+packages.
+*/
+func (s Selections) Packages() []string {
+	var names []string
+	for _, category := range []CategorySelection{s.Languages, s.Editors, s.DevTools} {
+		names = append(names, category.Packages...)
+	}
+	names = append(names, s.Custom...)
+	return append(names, s.Installed...)
+}
+
+/*
+Unselected returns the packages offered in categories the user did not defer
+that were left unselected, so a configuration edited in the wizard can drop them.
+*/
+func (s Selections) Unselected() []string {
+	var names []string
+	for _, category := range []CategorySelection{s.Languages, s.Editors, s.DevTools} {
+		if category.Deferred {
+			continue
+		}
+		selected := make(map[string]bool, len(category.Packages))
+		for _, pkg := range category.Packages {
+			selected[pkg] = true
+		}
+		for _, pkg := range category.Offered {
+			if !selected[pkg] {
+				names = append(names, pkg)
+			}
+		}
+	}
+	return names
+}
+
+/*
+Deferred reports whether the user chose to configure any category later.
+*/
+func (s Selections) Deferred() bool {
+	return s.Languages.Deferred || s.Editors.Deferred || s.DevTools.Deferred
+}
+
 /*
 RunInstallTUI runs the installation TUI and returns the user's choices.
-Returns the selected package manager, shell, packages, and confirmation status.
 */
-func RunInstallTUI() (string, string, []string, bool, error) {
-	p := tea.NewProgram(InitialModel())
+func RunInstallTUI() (Selections, error) {
+	return runInstallModel(InitialModel())
+}
+
+/*
+RunInstallTUIFromConfig runs the installation TUI starting from an existing
+configuration, see InitialModelFromConfig.
+*/
+func RunInstallTUIFromConfig(cfg *schema.Config) (Selections, error) {
+	return runInstallModel(InitialModelFromConfig(cfg))
+}
+
+/*
+RunInstallTUIFromDetected runs the installation TUI starting from the detected
+environment, see Model.WithDetected.
+*/
+func RunInstallTUIFromDetected(detected Detected) (Selections, error) {
+	return runInstallModel(InitialModel().WithDetected(detected))
+}
+
+/*
+runInstallModel runs the installation TUI from model and returns the user's choices.
+Packages entered by name are checked against the cached nixpkgs package index
+when there is one. Without an interactive terminal it returns a
+*NonInteractiveError pointing to --unattended.
+*/
+func runInstallModel(model Model) (Selections, error) {
+	if !platform.IsInteractive() {
+		return Selections{}, &NonInteractiveError{Command: "the installer", Flags: "--unattended --yes"}
+	}
+	model.index, _ = packages.NewManager(filesystem.NewOSFileSystem()).CachedPackageIndex()
+	p := tea.NewProgram(model)
 	m, err := p.Run()
 	if err != nil {
-		return "", "", nil, false, fmt.Errorf("failed to run TUI: %w", err)
+		return Selections{}, fmt.Errorf("failed to run TUI: %w", err)
 	}
 
 	finalModel := m.(Model)
 	if finalModel.quitting {
-		return "", "", nil, false, fmt.Errorf("installation cancelled")
-	}
-
-	var packages []string
-	for category, selections := range finalModel.selected {
-		var choices []string
-		switch category {
-		case "languages":
-			choices = finalModel.languageChoices
-		case "editors":
-			choices = finalModel.editorChoices
-		case "devtools":
-			choices = finalModel.devToolChoices
+		return Selections{}, fmt.Errorf("installation cancelled")
+	}
+
+	return finalModel.selections(), nil
+}
+
+/*
+selections returns the choices made so far.
+*/
+func (m Model) selections() Selections {
+	return Selections{
+		Manager:   m.manager,
+		Shell:     m.shell,
+		Languages: m.categorySelection("languages", m.languageChoices, m.chooseOwnLanguages),
+		Editors:   m.categorySelection("editors", m.editorChoices, m.chooseOwnEditors),
+		DevTools:  m.categorySelection("devtools", m.devToolChoices, m.chooseOwnDevTools),
+		Custom:    m.custom,
+		Installed: m.installed,
+		Confirmed: m.confirmed,
+	}
+}
+
+/*
+categorySelection returns the offered and the selected package names of a
+category in the order they appear in the wizard.
+*/
+func (m Model) categorySelection(category string, choices []string, chooseOwn bool) CategorySelection {
+	selection := CategorySelection{Deferred: chooseOwn}
+	for _, choice := range choices {
+		if choice == chooseOwnChoice {
+			continue
 		}
-		for i := range selections {
-			if i == len(choices)-1 {
-				continue
-			}
-			packages = append(packages, getPackageName(choices[i]))
+		selection.Offered = append(selection.Offered, getPackageName(choice))
+		if _, ok := m.selected[category][getPackageName(choice)]; ok {
+			selection.Packages = append(selection.Packages, getPackageName(choice))
 		}
 	}
-
-	return finalModel.manager, finalModel.shell, packages, finalModel.confirmed, nil
+	return selection
 }
@@ -0,0 +1,211 @@
+package tui
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
+)
+
+func press(t *testing.T, m Model, keys ...tea.KeyMsg) Model {
+	t.Helper()
+	for _, key := range keys {
+		updated, _ := m.Update(key)
+		m = updated.(Model)
+	}
+	return m
+}
+
+func typed(text string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)}
+}
+
+func TestModelFiltersChoices(t *testing.T) {
+	m := InitialModel()
+	m.step = 4
+
+	m = press(t, m, typed("c"), typed("l"), typed("i"))
+	if m.query != "cli" {
+		t.Fatalf("query = %q, want %q", m.query, "cli")
+	}
+
+	want := []string{"Kubernetes CLI (kubectl)", "GitHub CLI", chooseOwnChoice}
+	if got := m.visibleChoices(); !reflect.DeepEqual(got, want) {
+		t.Errorf("visibleChoices() = %v, want %v", got, want)
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "Filter: cli") {
+		t.Errorf("expected the query in the view, got:\n%s", view)
+	}
+	if strings.Contains(view, "Terraform") {
+		t.Errorf("expected filtered out choices to be hidden, got:\n%s", view)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeySpace})
+	if _, ok := m.selected["devtools"]["gh"]; !ok || len(m.selected["devtools"]) != 1 {
+		t.Errorf("selected = %v, want only gh", m.selected["devtools"])
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyBackspace})
+	if m.query != "cl" || m.cursor != 0 {
+		t.Errorf("after backspace query = %q cursor = %d, want %q and 0", m.query, m.cursor, "cl")
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEsc}, tea.KeyMsg{Type: tea.KeySpace})
+	if got := m.selections().Packages(); !reflect.DeepEqual(got, []string{"git", "gh"}) {
+		t.Errorf("Packages() = %v, want [git gh]", got)
+	}
+	if !strings.Contains(m.View(), "> ["+ColorGreen+"x"+ColorReset+"] Git") {
+		t.Errorf("expected Git to be checked under the cursor, got:\n%s", m.View())
+	}
+}
+
+func TestModelFilterNoMatches(t *testing.T) {
+	m := InitialModel()
+	m.step = 2
+
+	m = press(t, m, typed("zzz"))
+	if got := m.visibleChoices(); !reflect.DeepEqual(got, []string{chooseOwnChoice}) {
+		t.Errorf("visibleChoices() = %v, want only %q", got, chooseOwnChoice)
+	}
+	if !strings.Contains(m.View(), "No matches") {
+		t.Errorf("expected a no matches notice, got:\n%s", m.View())
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyRight})
+	if m.step != 3 || m.query != "" {
+		t.Errorf("step = %d query = %q, want step 3 with the filter cleared", m.step, m.query)
+	}
+}
+
+func TestInitialModelFromConfig(t *testing.T) {
+	cfg := &schema.Config{
+		Settings: schema.Settings{Shell: "fish"},
+		Nix: schema.Nix{
+			Manager: "nix-profile",
+			Packages: schema.Packages{
+				Core:     []string{"go@1.22", "ripgrep"},
+				Optional: []string{"vscode"},
+			},
+		},
+	}
+
+	m := InitialModelFromConfig(cfg)
+
+	if _, ok := m.selected["languages"]["go"]; !ok {
+		t.Errorf("expected Golang to start selected, selected = %v", m.selected["languages"])
+	}
+	if _, ok := m.selected["editors"]["vscode"]; !ok {
+		t.Errorf("expected VS Code to start selected, selected = %v", m.selected["editors"])
+	}
+	if len(m.selected["devtools"]) != 0 {
+		t.Errorf("expected no developer tools selected, got %v", m.selected["devtools"])
+	}
+	if got := m.selections().Packages(); !reflect.DeepEqual(got, []string{"go", "vscode"}) {
+		t.Errorf("Packages() = %v, want [go vscode]", got)
+	}
+	if m.manager != "nix-profile" {
+		t.Errorf("manager = %q, want nix-profile", m.manager)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.step != 1 || m.cursor != 2 {
+		t.Errorf("step = %d cursor = %d, want the shell step with fish highlighted", m.step, m.cursor)
+	}
+
+	m.step, m.cursor = 3, 0
+	if !strings.Contains(m.View(), "> ["+ColorGreen+"x"+ColorReset+"] VS Code") {
+		t.Errorf("expected VS Code to be rendered as checked, got:\n%s", m.View())
+	}
+}
+
+func TestModelScrollsLongLists(t *testing.T) {
+	m := InitialModel()
+	m.step = 4
+	m.devToolChoices = nil
+	for i := 1; i < 50; i++ {
+		m.devToolChoices = append(m.devToolChoices, fmt.Sprintf("Tool %02d", i))
+	}
+	m.devToolChoices = append(m.devToolChoices, chooseOwnChoice)
+
+	view := m.View()
+	if !strings.Contains(view, "Tool 10") || strings.Contains(view, "Tool 11") {
+		t.Errorf("expected the first %d items to be visible, got:\n%s", defaultListHeight, view)
+	}
+	if strings.Contains(view, "▲ more") || !strings.Contains(view, "▼ more") {
+		t.Errorf("expected only the more-below indicator, got:\n%s", view)
+	}
+
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	for i := 0; i < defaultListHeight; i++ {
+		m = press(t, m, down)
+	}
+	if m.cursor != 10 || m.offset != 1 {
+		t.Fatalf("cursor = %d offset = %d, want the window to shift by one at the bottom edge", m.cursor, m.offset)
+	}
+	view = m.View()
+	if strings.Contains(view, "Tool 01") || !strings.Contains(view, "> [ ] Tool 11") {
+		t.Errorf("expected the window to show items 2-11 with the cursor on the last, got:\n%s", view)
+	}
+	if !strings.Contains(view, "▲ more") || !strings.Contains(view, "▼ more") {
+		t.Errorf("expected both indicators, got:\n%s", view)
+	}
+
+	for i := 0; i < 60; i++ {
+		m = press(t, m, down)
+	}
+	if m.cursor != 49 || m.offset != 40 {
+		t.Errorf("cursor = %d offset = %d, want the last item at the bottom of the window", m.cursor, m.offset)
+	}
+	if view = m.View(); strings.Contains(view, "▼ more") {
+		t.Errorf("expected no more-below indicator at the end of the list, got:\n%s", view)
+	}
+
+	m = press(t, m, tea.KeyMsg{Type: tea.KeyUp})
+	if m.offset != 40 {
+		t.Errorf("offset = %d, want the window to stay put while the cursor is inside it", m.offset)
+	}
+
+	m = press(t, m, typed("7"))
+	if m.offset != 0 || m.cursor != 0 {
+		t.Errorf("offset = %d cursor = %d, want the window reset when filtering", m.offset, m.cursor)
+	}
+}
+
+func TestModelSelectionsDistinguishDeferred(t *testing.T) {
+	m := InitialModel()
+	m.step = 2
+
+	// Languages: pick the first entry. Editors: choose my own. Dev tools: nothing.
+	m = press(t, m, tea.KeyMsg{Type: tea.KeySpace}, tea.KeyMsg{Type: tea.KeyRight})
+	m = press(t, m, typed("my own"), tea.KeyMsg{Type: tea.KeySpace}, tea.KeyMsg{Type: tea.KeyRight})
+
+	got := m.selections()
+	if len(got.Languages.Packages) != 1 || got.Languages.Deferred {
+		t.Errorf("Languages = %+v, want one package, not deferred", got.Languages)
+	}
+	if len(got.Editors.Packages) != 0 || !got.Editors.Deferred {
+		t.Errorf("Editors = %+v, want no packages, deferred", got.Editors)
+	}
+	if len(got.DevTools.Packages) != 0 || got.DevTools.Deferred {
+		t.Errorf("DevTools = %+v, want no packages, not deferred", got.DevTools)
+	}
+	if !got.Deferred() {
+		t.Error("Deferred() = false, want true")
+	}
+	if !reflect.DeepEqual(got.Packages(), got.Languages.Packages) {
+		t.Errorf("Packages() = %v, want %v", got.Packages(), got.Languages.Packages)
+	}
+	// The deferred editors are left alone; the other offered packages are unselected.
+	if want := len(got.Languages.Offered) - 1 + len(got.DevTools.Offered); len(got.Unselected()) != want {
+		t.Errorf("Unselected() = %v, want the %d offered languages and dev tools that were not picked", got.Unselected(), want)
+	}
+
+	if InitialModel().selections().Deferred() {
+		t.Error("Deferred() = true for an untouched wizard, want false")
+	}
+}
@@ -0,0 +1,17 @@
+package tui
+
+import "fmt"
+
+/*
+NonInteractiveError is returned instead of running a TUI when nobody can answer
+it, such as in CI or with input from a pipe (see platform.IsInteractive). Flags
+are what to run the command with instead.
+*/
+type NonInteractiveError struct {
+	Command string
+	Flags   string
+}
+
+func (e *NonInteractiveError) Error() string {
+	return fmt.Sprintf("%s needs an interactive terminal; run it with %s instead", e.Command, e.Flags)
+}
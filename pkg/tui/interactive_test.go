@@ -0,0 +1,19 @@
+package tui
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNonInteractiveError(t *testing.T) {
+	var err error = &NonInteractiveError{Command: "the installer", Flags: "--unattended --yes"}
+
+	want := "the installer needs an interactive terminal; run it with --unattended --yes instead"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	var nonInteractive *NonInteractiveError
+	if !errors.As(err, &nonInteractive) {
+		t.Error("errors.As did not find the *NonInteractiveError")
+	}
+}
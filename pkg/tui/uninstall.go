@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/shawnkhoffman/nix-foundry/pkg/platform"
 )
 
 // UninstallModel represents the TUI model for the uninstall process.
@@ -124,8 +125,12 @@ func (m UninstallModel) View() string {
 	return s
 }
 
-// RunUninstallTUI runs the uninstall TUI and returns user choices.
+// RunUninstallTUI runs the uninstall TUI and returns user choices. Without an
+// interactive terminal it returns a *NonInteractiveError pointing to --yes.
 func RunUninstallTUI() (bool, bool, error) {
+	if !platform.IsInteractive() {
+		return false, false, &NonInteractiveError{Command: "uninstall", Flags: "--yes (and --nix to uninstall Nix too)"}
+	}
 	p := tea.NewProgram(InitialUninstallModel())
 	m, err := p.Run()
 	if err != nil {
@@ -4,25 +4,33 @@ package config
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
+	"github.com/shawnkhoffman/nix-foundry/pkg/cmdexec"
 	"github.com/shawnkhoffman/nix-foundry/pkg/filesystem"
 	"github.com/shawnkhoffman/nix-foundry/pkg/schema"
 )
 
 // ApplyService handles configuration application operations.
 type ApplyService struct {
-	fs filesystem.FileSystem
+	fs     filesystem.FileSystem
+	runner cmdexec.Runner
 }
 
 // NewApplyService creates a new configuration apply service.
 func NewApplyService(fs filesystem.FileSystem) *ApplyService {
-	return &ApplyService{fs: fs}
+	return &ApplyService{fs: fs, runner: cmdexec.NewOSRunner()}
 }
 
 // Apply applies the configuration by installing packages and running scripts.
+// Commands are bounded by settings.commandTimeout when it is set.
 func (s *ApplyService) Apply(config *schema.Config) error {
+	if timeout := config.Settings.CommandTimeout; timeout > 0 {
+		bounded := *s
+		bounded.runner = cmdexec.WithTimeout(s.runner, timeout)
+		s = &bounded
+	}
+
 	if err := s.applyPackages(config); err != nil {
 		return fmt.Errorf("failed to apply packages: %w", err)
 	}
@@ -53,15 +61,11 @@ func (s *ApplyService) applyPackages(config *schema.Config) error {
 	for _, pkg := range allPackages {
 		fmt.Printf("Installing %s...\n", pkg)
 
-		cmd := exec.Command("bash", "-c", fmt.Sprintf(
+		if err := s.runner.Run("bash", "-c", fmt.Sprintf(
 			". /nix/var/nix/profiles/default/etc/profile.d/nix-daemon.sh && "+
 				"NIXPKGS_ALLOW_UNFREE=1 NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1 "+
 				"/nix/var/nix/profiles/default/bin/nix-env -iA nixpkgs.%s -Q",
-			pkg))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
+			pkg)); err != nil {
 			return fmt.Errorf("failed to install package %s: %w. "+
 				"This may be due to macOS System Integrity Protection. "+
 				"Try installing manually with: nix-env -iA nixpkgs.%s", pkg, err, pkg)
@@ -145,10 +149,7 @@ export NIXPKGS_ALLOW_UNSUPPORTED_SYSTEM=1
 			return fmt.Errorf("failed to write script file: %w", err)
 		}
 
-		cmd := exec.Command("bash", scriptPath)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		if err := s.runner.Run("bash", scriptPath); err != nil {
 			return fmt.Errorf("failed to run script '%s': %w", script.Name, err)
 		}
 	}